@@ -8,7 +8,7 @@
 
 //
 // Synopsis:
-//	boot [-v][-no-load][-no-exec]
+//	boot [-v][-no-load][-no-exec][-timeout duration]
 //
 // Description:
 //	If returns to u-root shell, the code didn't found a local bootable option
@@ -16,6 +16,10 @@
 //      -v prints messages
 //      -no-load prints the boot image paths it was going to load, but doesn't load + exec them
 //      -no-exec loads the boot image, but doesn't exec it
+//      -timeout counts down to booting the default entry, unless a key is pressed
+//      -boot-order reads the preferred order of boot entries from a JSON file
+//      -boot-log appends a JSON record of the booted image to a file
+//      -initrd-overlay offers to append a local initrd to each Linux entry's initrd
 //
 // Notes:
 //	The code is looking for boot/grub/grub.cfg file as to identify the
@@ -31,6 +35,7 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/u-root/u-root/pkg/boot"
@@ -47,6 +52,11 @@ var (
 	verbose = flag.Bool("v", false, "Print debug messages")
 	noLoad  = flag.Bool("no-load", false, "print chosen boot configuration, but do not load + exec it")
 	noExec  = flag.Bool("no-exec", false, "load boot configuration, but do not exec it")
+	timeout = flag.Duration("timeout", 0, "count down this long to booting the default entry, unless a key is pressed")
+
+	bootOrder = flag.String("boot-order", "", "JSON file with the preferred order of boot entries and a default timeout")
+	bootLog   = flag.String("boot-log", "", "File to append a JSON record of the booted image to, right before booting it")
+	overlay   = flag.String("initrd-overlay", "", "Local initrd, e.g. a cpio archive with debugging tools, that can be appended to the initrd of each Linux entry from the boot menu")
 
 	removeCmdlineItem = flag.String("remove", "console", "comma separated list of kernel params value to remove from parsed kernel configuration (default to console)")
 	reuseCmdlineItem  = flag.String("reuse", "console", "comma separated list of kernel params value to reuse from current kernel (default to console)")
@@ -95,17 +105,46 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	var overlayFile *os.File
+	if *overlay != "" {
+		overlayFile, err = os.Open(*overlay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer overlayFile.Close()
+	}
 	for _, img := range images {
 		// Make changes to the kernel command line based on our cmdline.
 		if li, ok := img.(*boot.LinuxImage); ok {
 			li.Cmdline = updateBootCmdline(li.Cmdline)
+			if overlayFile != nil {
+				li.Overlay = overlayFile
+			}
 		}
 	}
 
+	var hooks []bootcmd.PreBootHook
+	if *bootLog != "" {
+		hooks = append(hooks, func(img boot.OSImage) error {
+			return boot.RecordBoot(*bootLog, img)
+		})
+	}
+
 	menuEntries := menu.OSImages(*verbose, images...)
 	menuEntries = append(menuEntries, menu.Reboot{})
 	menuEntries = append(menuEntries, menu.StartShell{})
 
+	opts := menu.Options{Timeout: *timeout}
+	if *bootOrder != "" {
+		// A broken boot-order file must not keep the machine from
+		// booting.
+		if o, err := bootcmd.LoadBootOrder(*bootOrder); err != nil {
+			log.Printf("Warning: using the default boot order: %v", err)
+		} else {
+			menuEntries, opts = o.ApplyWithOptions(menuEntries, opts)
+		}
+	}
+
 	// Boot does not return.
-	bootcmd.ShowMenuAndBoot(menuEntries, mountPool, *noLoad, *noExec)
+	bootcmd.ShowMenuAndBoot(menuEntries, mountPool, *noLoad, *noExec, opts, hooks...)
 }
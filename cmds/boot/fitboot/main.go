@@ -79,7 +79,7 @@ func main() {
 		f.KeyRing = ring
 	}
 
-	if err := f.Load(*debug); err != nil {
+	if err := boot.Stage(f, *debug); err != nil {
 		log.Fatal(err)
 	}
 
@@ -12,7 +12,9 @@ import (
 	"path"
 	"path/filepath"
 
+	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/jsonboot"
+	"github.com/u-root/u-root/pkg/boot/localboot"
 	"github.com/u-root/u-root/pkg/mount"
 	"github.com/u-root/u-root/pkg/mount/block"
 )
@@ -30,6 +32,7 @@ var (
 	flagInitramfsPath  = flag.String("initramfs", "", "Specify the path of the initramfs to load. If using -grub, this argument is ignored")
 	flagKernelCmdline  = flag.String("cmdline", "", "Specify the kernel command line. If using -grub, this argument is ignored")
 	flagDeviceGUID     = flag.String("guid", "", "GUID of the device where the kernel (and optionally initramfs) are located. Ignored if -grub is set or if -kernel is not specified")
+	flagDevice         = flag.String("device", "", "Device where the kernel (and optionally initramfs) are located, as UUID=<fs uuid>, LABEL=<fs label>, PARTUUID=<partition GUID> or /dev/<name>. Used instead of -guid if set. Ignored if -grub is set or if -kernel is not specified")
 )
 
 var debug = func(string, ...interface{}) {}
@@ -191,6 +194,28 @@ func BootPathMode(devices block.BlockDevices, baseMountpoint string, guid string
 	return nil
 }
 
+// BootDeviceMode tries to boot a kernel in PATH mode from the device identified
+// by spec, as in localboot.FindDevice. Unlike BootPathMode, it does not leave
+// the device mounted.
+func BootDeviceMode(devices block.BlockDevices, spec string, dryrun bool) error {
+	img, err := localboot.LinuxImageFromDevice(devices, spec, *flagKernelPath, *flagInitramfsPath, *flagKernelCmdline)
+	if err != nil {
+		return err
+	}
+	debug("Trying boot image %s", img)
+	if dryrun {
+		log.Printf("Dry-run, will not actually boot")
+		return nil
+	}
+	if err := boot.Stage(img, *flagDebug); err != nil {
+		return err
+	}
+	if err := boot.Execute(); err != nil {
+		return fmt.Errorf("Failed to boot kernel %s: %v", *flagKernelPath, err)
+	}
+	return nil
+}
+
 func main() {
 	flag.Parse()
 	if *flagGrubMode && *flagKernelPath != "" {
@@ -229,6 +254,10 @@ func main() {
 		if err := BootGrubMode(devices, *flagBaseMountPoint, *flagDeviceGUID, *flagDryRun, *flagConfigIdx); err != nil {
 			log.Fatal(err)
 		}
+	} else if *flagKernelPath != "" && *flagDevice != "" {
+		if err := BootDeviceMode(devices, *flagDevice, *flagDryRun); err != nil {
+			log.Fatal(err)
+		}
 	} else if *flagKernelPath != "" {
 		if err := BootPathMode(devices, *flagBaseMountPoint, *flagDeviceGUID, *flagDryRun); err != nil {
 			log.Fatal(err)
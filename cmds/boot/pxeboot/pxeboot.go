@@ -25,6 +25,8 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/url"
+	"os"
 	"strings"
 	"time"
 
@@ -36,6 +38,7 @@ import (
 	"github.com/u-root/u-root/pkg/dhclient"
 	"github.com/u-root/u-root/pkg/sh"
 	"github.com/u-root/u-root/pkg/ulog"
+	"github.com/u-root/u-root/pkg/vfile"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
 )
@@ -44,6 +47,7 @@ var (
 	ifName      = "^e.*"
 	noLoad      = flag.Bool("no-load", false, "get DHCP response, print chosen boot configuration, but do not download + exec it")
 	noExec      = flag.Bool("no-exec", false, "download boot configuration, but do not exec it")
+	timeout     = flag.Duration("timeout", 0, "count down this long to booting the default entry, unless a key is pressed")
 	noNetConfig = flag.Bool("no-net-config", false, "get DHCP response, but do not apply the network config it to the kernel interface")
 	skipBonded  = flag.Bool("skip-bonded", false, "Skip NICs that have already been added to a bond")
 	verbose     = flag.Bool("v", false, "Verbose output")
@@ -52,6 +56,15 @@ var (
 	cmdAppend   = flag.String("cmd", "", "Kernel command to append for each image")
 	bootfile    = flag.String("file", "", "Boot file name (default tftp) or full URI to use instead of DHCP.")
 	server      = flag.String("server", "0.0.0.0", "Server IP (Requires -file for effect)")
+	slaac       = flag.Bool("slaac", false, "autoconfigure IPv6 from router advertisements, and only use DHCPv6 if the router asks for it")
+	v6Rapid     = flag.Bool("v6-rapid-commit", false, "Ask DHCPv6 servers for a two-message exchange with the Rapid Commit option")
+	pubKey      = flag.String("pubkey", "", "OpenPGP public key file; if set, kernels must have a valid detached signature at their URL + .sig")
+	bootServer  = flag.String("boot-server", "", "base URL, e.g. tftp://10.0.0.5/tftpboot, to fetch plain DHCP boot file names and relative files from instead of the DHCP next server")
+	caCert      = flag.String("ca-cert", "", "PEM file of the CA certificates to verify https servers with instead of the system's")
+	clientCert  = flag.String("client-cert", "", "PEM file of the client certificate to authenticate to https servers with (requires -client-key)")
+	clientKey   = flag.String("client-key", "", "PEM file of the private key of -client-cert")
+	tlsName     = flag.String("tls-server-name", "", "name to verify https server certificates against instead of the URL's host name")
+	overlay     = flag.String("initrd-overlay", "", "local initrd, e.g. a cpio archive with debugging tools, that can be appended to the initrd of each Linux entry from the boot menu")
 )
 
 const (
@@ -61,7 +74,7 @@ const (
 
 // NetbootImages requests DHCP on every ifaceNames interface, and parses
 // netboot images from the DHCP leases. Returns bootable OSes.
-func NetbootImages(ifaceNames string) ([]boot.OSImage, error) {
+func NetbootImages(ifaceNames string, schemes curl.Schemes, opts netboot.Options) ([]boot.OSImage, error) {
 	filteredIfs, err := dhclient.Interfaces(ifaceNames)
 	if err != nil {
 		return nil, err
@@ -75,8 +88,10 @@ func NetbootImages(ifaceNames string) ([]boot.OSImage, error) {
 	defer cancel()
 
 	c := dhclient.Config{
-		Timeout: dhcpTimeout,
-		Retries: dhcpTries,
+		Timeout:     dhcpTimeout,
+		Retries:     dhcpTries,
+		SLAAC:       *slaac,
+		RapidCommit: *v6Rapid,
 	}
 	if *verbose {
 		c.LogLevel = dhclient.LogSummary
@@ -109,7 +124,7 @@ func NetbootImages(ifaceNames string) ([]boot.OSImage, error) {
 			}
 
 			// Don't use the other context, as it's for the DHCP timeout.
-			imgs, err := netboot.BootImages(context.Background(), ulog.Log, curl.DefaultSchemes, result.Lease)
+			imgs, err := netboot.BootImagesWithOptions(context.Background(), ulog.Log, schemes, result.Lease, opts)
 			if err != nil {
 				log.Printf("Failed to boot lease %v: %v", result.Lease, err)
 				continue
@@ -157,10 +172,47 @@ func main() {
 		ifName = flag.Args()[0]
 	}
 
+	var opts netboot.Options
+	if *pubKey != "" {
+		keyring, err := vfile.GetKeyRing(*pubKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.KeyRing = keyring
+	}
+	if *bootServer != "" {
+		u, err := url.Parse(*bootServer)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			log.Fatalf("Invalid boot server %q: want a URL like tftp://10.0.0.5/tftpboot", *bootServer)
+		}
+		opts.BootServer = u
+	}
+
+	// Show the progress of downloading the chosen entry's files.
+	progress := menu.NewProgress()
+	curl.DefaultHTTPClient.Progress = progress.Update
+	curl.DefaultTFTPClient.Progress = progress.Update
+
+	schemes := curl.DefaultSchemes
+	if *caCert != "" || *clientCert != "" || *clientKey != "" || *tlsName != "" {
+		https, err := curl.NewHTTPSClient(&curl.TLSConfig{
+			CAFile:     *caCert,
+			CertFile:   *clientCert,
+			KeyFile:    *clientKey,
+			ServerName: *tlsName,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		https.Progress = progress.Update
+		schemes = schemes.Clone()
+		schemes.Register("https", https)
+	}
+
 	var images []boot.OSImage
 	var err error
 	if *bootfile == "" {
-		images, err = NetbootImages(ifName)
+		images, err = NetbootImages(ifName, schemes, opts)
 		if err != nil {
 			dumpNetDebugInfo()
 		}
@@ -169,7 +221,7 @@ func main() {
 		var l dhclient.Lease
 		l, err = newManualLease()
 		if err == nil {
-			images, err = netboot.BootImages(context.Background(), ulog.Log, curl.DefaultSchemes, l)
+			images, err = netboot.BootImagesWithOptions(context.Background(), ulog.Log, schemes, l, opts)
 		}
 	}
 
@@ -177,6 +229,18 @@ func main() {
 		log.Printf("Netboot failed: %v", err)
 	}
 
+	if *overlay != "" {
+		f, err := os.Open(*overlay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		for _, img := range images {
+			if li, ok := img.(*boot.LinuxImage); ok {
+				li.Overlay = f
+			}
+		}
+	}
 	for _, img := range images {
 		img.Edit(func(cmdline string) string {
 			return cmdline + " " + *cmdAppend
@@ -188,5 +252,5 @@ func main() {
 	menuEntries = append(menuEntries, menu.StartShell{})
 
 	// Boot does not return.
-	bootcmd.ShowMenuAndBoot(menuEntries, nil, *noLoad, *noExec)
+	bootcmd.ShowMenuAndBoot(menuEntries, nil, *noLoad, *noExec, menu.Options{Timeout: *timeout, Progress: progress})
 }
@@ -14,13 +14,24 @@
 //     -timeout:  lease timeout in seconds
 //     -renewals: number of DHCP renewals before exiting
 //     -verbose:  verbose output
+//     -vlan:     VLAN ID to request leases on
+//     -slaac:    autoconfigure IPv6 from router advertisements
+//     -v6-rapid-commit: use the DHCPv6 two-message exchange if servers support it
+//     -hook:     script to run with the lease in its environment after configuring
+//     -json:     print each lease as JSON instead of configuring the interface
+//     -configure: configure interfaces with their leases, also with -json
+//     -release:  release IPv4 leases after handling them
 package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
 	"time"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
@@ -41,8 +52,18 @@ var (
 
 	v6Port   = flag.Int("v6-port", dhcpv6.DefaultServerPort, "DHCPv6 server port to send to")
 	v6Server = flag.String("v6-server", "ff02::1:2", "DHCPv6 server address to send to (multicast or unicast)")
+	v6Rapid  = flag.Bool("v6-rapid-commit", false, "Ask DHCPv6 servers for a two-message exchange with the Rapid Commit option")
 
-	v4Port = flag.Int("v4-port", dhcpv4.ServerPort, "DHCPv4 server port to send to")
+	v4Port       = flag.Int("v4-port", dhcpv4.ServerPort, "DHCPv4 server port to send to")
+	v4ClientPort = flag.Int("v4-client-port", dhcpv4.ClientPort, "DHCPv4 client port to send from and listen on, e.g. to run next to another DHCP client")
+
+	slaac = flag.Bool("slaac", false, "Autoconfigure IPv6 addresses from router advertisements, and only use DHCPv6 if the router asks for it")
+	vlan  = flag.Int("vlan", 0, "802.1Q VLAN ID to request leases on, e.g. 100 to use eth0.100 instead of eth0")
+	hook  = flag.String("hook", "", "Script to run after configuring an interface, with lease details in dhclient-script style environment variables")
+
+	jsonOut   = flag.Bool("json", false, "Print each lease as JSON to stdout; interfaces are not configured unless -configure is also set")
+	configure = flag.Bool("configure", true, "Configure interfaces with their leases")
+	release   = flag.Bool("release", false, "Release IPv4 leases after printing or configuring them")
 )
 
 func main() {
@@ -60,10 +81,31 @@ func main() {
 		log.Fatal(err)
 	}
 
-	configureAll(filteredIfs)
+	configureAll(filteredIfs, shouldConfigure(flagsSet()))
+}
+
+// flagsSet returns the names of the flags set on the command line.
+func flagsSet() map[string]bool {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
 }
 
-func configureAll(ifs []netlink.Link) {
+// shouldConfigure returns whether interfaces are configured with their
+// leases, given the flags set on the command line.
+func shouldConfigure(set map[string]bool) bool {
+	if *dryRun {
+		return false
+	}
+	if *jsonOut && !set["configure"] {
+		return false
+	}
+	return *configure
+}
+
+func configureAll(ifs []netlink.Link, doConfigure bool) {
 	packetTimeout := time.Duration(*timeout) * time.Second
 
 	c := dhclient.Config{
@@ -77,6 +119,11 @@ func configureAll(ifs []netlink.Link) {
 			IP:   net.ParseIP(*v6Server),
 			Port: *v6Port,
 		},
+		ClientPort:  *v4ClientPort,
+		HookScript:  *hook,
+		VLAN:        *vlan,
+		SLAAC:       *slaac,
+		RapidCommit: *v6Rapid,
 	}
 	if *verbose {
 		c.LogLevel = dhclient.LogSummary
@@ -87,15 +134,49 @@ func configureAll(ifs []netlink.Link) {
 	r := dhclient.SendRequests(context.Background(), ifs, *ipv4, *ipv6, c, 30*time.Second)
 
 	for result := range r {
-		if result.Err != nil {
-			log.Printf("Could not configure %s for %s: %v", result.Interface.Attrs().Name, result.Protocol, result.Err)
-		} else if *dryRun {
-			log.Printf("Dry run: would have configured %s with %s", result.Interface.Attrs().Name, result.Lease)
-		} else if err := result.Lease.Configure(); err != nil {
+		if err := handleResult(os.Stdout, result, doConfigure); err != nil {
 			log.Printf("Could not configure %s for %s: %v", result.Interface.Attrs().Name, result.Protocol, err)
-		} else {
-			log.Printf("Configured %s with %s", result.Interface.Attrs().Name, result.Lease)
 		}
 	}
 	log.Printf("Finished trying to configure all interfaces.")
 }
+
+// handleResult prints, configures and releases the lease of result as
+// requested on the command line.
+func handleResult(w io.Writer, result *dhclient.Result, doConfigure bool) error {
+	if result.Err != nil {
+		return result.Err
+	}
+	name := result.Interface.Attrs().Name
+
+	if *jsonOut {
+		b, err := json.MarshalIndent(dhclient.NewLeaseInfo(result.Lease), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", b)
+	}
+
+	switch {
+	case doConfigure:
+		if err := result.Lease.Configure(); err != nil {
+			return err
+		}
+		log.Printf("Configured %s with %s", name, result.Lease)
+	case *dryRun:
+		log.Printf("Dry run: would have configured %s with %s", name, result.Lease)
+	}
+
+	if *release {
+		p, ok := result.Lease.(*dhclient.Packet4)
+		if !ok {
+			log.Printf("Not releasing %s lease on %s: only IPv4 leases can be released", result.Protocol, name)
+			return nil
+		}
+		if err := p.Release(); err != nil {
+			return fmt.Errorf("releasing lease: %v", err)
+		}
+		log.Printf("Released %s", result.Lease)
+	}
+	return nil
+}
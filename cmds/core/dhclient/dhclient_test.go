@@ -5,10 +5,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"net"
 	"strings"
 	"testing"
 
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/u-root/u-root/pkg/dhclient"
 	"github.com/u-root/u-root/pkg/testutil"
+	"github.com/vishvananda/netlink"
 )
 
 var tests = []struct {
@@ -35,6 +41,74 @@ func TestDhclient(t *testing.T) {
 	}
 }
 
+// setFlags sets the -json, -configure and -dry-run flags for the duration of
+// the test.
+func setFlags(t *testing.T, j, c, dry bool) {
+	oldJSON, oldConfigure, oldDry := *jsonOut, *configure, *dryRun
+	t.Cleanup(func() {
+		*jsonOut, *configure, *dryRun = oldJSON, oldConfigure, oldDry
+	})
+	*jsonOut, *configure, *dryRun = j, c, dry
+}
+
+func TestShouldConfigure(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		json      bool
+		configure bool
+		dryRun    bool
+		set       map[string]bool
+		want      bool
+	}{
+		{name: "default", configure: true, want: true},
+		{name: "json", json: true, configure: true, set: map[string]bool{"json": true}, want: false},
+		{name: "json and configure", json: true, configure: true, set: map[string]bool{"json": true, "configure": true}, want: true},
+		{name: "configure=false", configure: false, set: map[string]bool{"configure": true}, want: false},
+		{name: "dry run", configure: true, dryRun: true, set: map[string]bool{"dry-run": true}, want: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlags(t, tt.json, tt.configure, tt.dryRun)
+			if got := shouldConfigure(tt.set); got != tt.want {
+				t.Errorf("shouldConfigure(%v) = %t, want %t", tt.set, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLease(t *testing.T) {
+	setFlags(t, true, false, false)
+
+	link := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}}
+	ack, err := dhcpv4.New(
+		dhcpv4.WithYourIP(net.IP{10, 0, 0, 5}),
+		dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		dhcpv4.WithRouter(net.IP{10, 0, 0, 1}),
+		dhcpv4.WithOption(dhcpv4.OptBootFileName("http://10.0.0.1/boot.ipxe")),
+		dhcpv4.WithLeaseTime(600),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &dhclient.Result{
+		Protocol:  dhclient.NetIPv4,
+		Interface: link,
+		Lease:     dhclient.NewPacket4(link, ack),
+	}
+
+	var out bytes.Buffer
+	if err := handleResult(&out, result, false); err != nil {
+		t.Fatalf("handleResult() = %v", err)
+	}
+	var got dhclient.LeaseInfo
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("output %q is not JSON: %v", out.String(), err)
+	}
+	if got.Interface != "eth0" || !got.IP.Equal(net.IP{10, 0, 0, 5}) || got.Mask != "255.255.255.0" ||
+		got.BootFile != "http://10.0.0.1/boot.ipxe" || got.LeaseTime != 600 || len(got.Routers) != 1 {
+		t.Errorf("handleResult() printed %+v", got)
+	}
+}
+
 func TestMain(m *testing.M) {
 	testutil.Run(m, main)
 }
@@ -125,14 +125,28 @@ func main() {
 			log.Fatal(err)
 		}
 		defer kernel.Close()
+		t, err := boot.DetectImageType(kernel)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if opts.debug {
+			log.Printf("%s is a %s image", kernelpath, t)
+		}
 		var image boot.OSImage
-		if err := multiboot.Probe(kernel); err == nil {
+		switch t {
+		case boot.ImageAndroid:
+			image = &boot.AndroidBootImage{
+				Image:       uio.NewLazyFile(kernelpath),
+				Cmdline:     newCmdline,
+				LoadSyscall: opts.loadSyscall,
+			}
+		case boot.ImageMultiboot, boot.ImageMultiboot2:
 			image = &boot.MultibootImage{
 				Modules: multiboot.LazyOpenModules(opts.modules),
 				Kernel:  kernel,
 				Cmdline: newCmdline,
 			}
-		} else {
+		default:
 			var files []io.ReaderAt
 			if len(opts.extra) > 0 {
 				initrd, err := boot.CreateInitrd(strings.Fields(opts.extra)...)
@@ -158,16 +172,27 @@ func main() {
 					log.Fatalf("Failed to open dtb file %s: %v", opts.dtb, err)
 				}
 			}
-			image = &boot.LinuxImage{
-				Kernel:      uio.NewLazyFile(kernelpath),
-				Initrd:      i,
-				Cmdline:     newCmdline,
-				LoadSyscall: opts.loadSyscall,
-				KexecOpts: linux.KexecOptions{
-					DTB:        dtb,
-					MmapKernel: opts.mmapKernel,
-					MmapRamfs:  opts.mmapInitrd,
-				},
+			kexecOpts := linux.KexecOptions{
+				DTB:        dtb,
+				MmapKernel: opts.mmapKernel,
+				MmapRamfs:  opts.mmapInitrd,
+			}
+			if t == boot.ImagePE {
+				image = &boot.EFIStubImage{
+					Kernel:      uio.NewLazyFile(kernelpath),
+					Initrd:      i,
+					Cmdline:     newCmdline,
+					LoadSyscall: opts.loadSyscall,
+					KexecOpts:   kexecOpts,
+				}
+			} else {
+				image = &boot.LinuxImage{
+					Kernel:      uio.NewLazyFile(kernelpath),
+					Initrd:      i,
+					Cmdline:     newCmdline,
+					LoadSyscall: opts.loadSyscall,
+					KexecOpts:   kexecOpts,
+				}
 			}
 		}
 		if err := image.Load(opts.debug); err != nil {
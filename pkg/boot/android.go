@@ -0,0 +1,235 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot/linux"
+)
+
+// AndroidBootImage implements OSImage for an Android boot image (boot.img),
+// which bundles a kernel, a ramdisk, and optionally a second stage loader and
+// a device tree behind a header starting with "ANDROID!".
+//
+// Header versions 0 through 4 are supported. The kernel is kexec'ed with the
+// ramdisk as initrd and the command line embedded in the header.
+type AndroidBootImage struct {
+	Name string
+
+	// Image is the boot.img.
+	Image io.ReaderAt
+
+	// Cmdline, if set, takes precedence over the one embedded in the
+	// image.
+	Cmdline string
+
+	BootRank    int
+	LoadSyscall bool
+
+	// KexecOpts.DTB, if set, takes precedence over the device tree
+	// embedded in a version 2 image.
+	KexecOpts linux.KexecOptions
+}
+
+var _ OSImage = &AndroidBootImage{}
+
+// Android boot image header layouts, from AOSP's bootimg.h.
+const (
+	// androidV3PageSize is the fixed page size of version 3 and 4 images.
+	androidV3PageSize = 4096
+
+	androidMinPageSize = 2048
+	androidMaxPageSize = 65536
+
+	// Offsets in version 0 to 2 headers.
+	androidV0PageSizeOffset     = 36
+	androidV0CmdlineOffset      = 64
+	androidV0CmdlineSize        = 512
+	androidV0ExtraCmdlineOffset = 608
+	androidV0ExtraCmdlineSize   = 1024
+	androidV1DTBOSizeOffset     = 1632
+	androidV2DTBSizeOffset      = 1648
+	androidV2HeaderSize         = 1660
+
+	// Offsets in version 3 and 4 headers.
+	androidV3CmdlineOffset = 44
+	androidV3CmdlineSize   = 1536
+
+	// androidVersionOffset is the offset of the header version in all
+	// versions.
+	androidVersionOffset = 40
+)
+
+// androidSection is a component of an Android boot image.
+type androidSection struct {
+	offset int64
+	size   int64
+}
+
+func (s androidSection) reader(r io.ReaderAt) io.ReaderAt {
+	if s.size == 0 {
+		return nil
+	}
+	return io.NewSectionReader(r, s.offset, s.size)
+}
+
+// androidBoot is a parsed Android boot image header.
+type androidBoot struct {
+	version  uint32
+	pageSize int64
+
+	kernel  androidSection
+	ramdisk androidSection
+	second  androidSection
+	dtb     androidSection
+
+	cmdline string
+}
+
+// cString returns b up to the first NUL byte.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// parseAndroidBootImage parses the header of the Android boot image r.
+func parseAndroidBootImage(r io.ReaderAt) (*androidBoot, error) {
+	hdr := make([]byte, androidV2HeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading Android boot image header of %s: %v", stringer(r), err)
+	}
+	if !bytes.HasPrefix(hdr, androidMagic) {
+		return nil, fmt.Errorf("%w: %s is not an Android boot image", ErrUnsupportedImage, stringer(r))
+	}
+	u32 := func(off int) int64 {
+		return int64(binary.LittleEndian.Uint32(hdr[off:]))
+	}
+
+	ab := &androidBoot{version: uint32(u32(androidVersionOffset))}
+
+	// Components follow the header page, each padded to a full page.
+	var sizes []int64
+	switch ab.version {
+	case 0, 1, 2:
+		ab.pageSize = u32(androidV0PageSizeOffset)
+		// kernel, ramdisk and second stage sizes.
+		sizes = []int64{u32(8), u32(16), u32(24)}
+		if ab.version >= 1 {
+			sizes = append(sizes, u32(androidV1DTBOSizeOffset))
+		}
+		if ab.version >= 2 {
+			sizes = append(sizes, u32(androidV2DTBSizeOffset))
+		}
+		ab.cmdline = cString(hdr[androidV0CmdlineOffset:androidV0CmdlineOffset+androidV0CmdlineSize]) +
+			cString(hdr[androidV0ExtraCmdlineOffset:androidV0ExtraCmdlineOffset+androidV0ExtraCmdlineSize])
+
+	case 3, 4:
+		ab.pageSize = androidV3PageSize
+		// kernel and ramdisk sizes.
+		sizes = []int64{u32(8), u32(12)}
+		ab.cmdline = cString(hdr[androidV3CmdlineOffset : androidV3CmdlineOffset+androidV3CmdlineSize])
+
+	default:
+		return nil, fmt.Errorf("%w: %s has unsupported Android boot image header version %d", ErrUnsupportedImage, stringer(r), ab.version)
+	}
+	if ab.pageSize < androidMinPageSize || ab.pageSize > androidMaxPageSize || ab.pageSize&(ab.pageSize-1) != 0 {
+		return nil, fmt.Errorf("%s has invalid Android boot image page size %d", stringer(r), ab.pageSize)
+	}
+	ab.cmdline = strings.TrimSpace(ab.cmdline)
+
+	sections := make([]androidSection, len(sizes))
+	offset := ab.pageSize
+	for i, size := range sizes {
+		sections[i] = androidSection{offset: offset, size: size}
+		offset += (size + ab.pageSize - 1) &^ (ab.pageSize - 1)
+	}
+	ab.kernel, ab.ramdisk = sections[0], sections[1]
+	if len(sections) > 2 {
+		ab.second = sections[2]
+	}
+	if len(sections) > 4 {
+		ab.dtb = sections[4]
+	}
+	if ab.kernel.size == 0 {
+		return nil, fmt.Errorf("%w: Android boot image %s has no kernel", errNilKernel, stringer(r))
+	}
+	return ab, nil
+}
+
+// Label returns either the Name or a short description.
+func (ai *AndroidBootImage) Label() string {
+	if len(ai.Name) > 0 {
+		return ai.Name
+	}
+	return fmt.Sprintf("Android(image=%s)", stringer(ai.Image))
+}
+
+// Rank for the boot menu order
+func (ai *AndroidBootImage) Rank() int {
+	return ai.BootRank
+}
+
+// String prints a human-readable version of this Android boot image.
+func (ai *AndroidBootImage) String() string {
+	return fmt.Sprintf(
+		"AndroidBootImage(\n  Name: %s\n  Image: %s\n  Cmdline: %s\n  KexecOpts: %v\n)\n",
+		ai.Name, stringer(ai.Image), ai.Cmdline, ai.KexecOpts,
+	)
+}
+
+// Edit the kernel command line. If Cmdline is not set, f is given the
+// command line embedded in the image.
+func (ai *AndroidBootImage) Edit(f func(cmdline string) string) {
+	cmdline := ai.Cmdline
+	if cmdline == "" && ai.Image != nil {
+		if ab, err := parseAndroidBootImage(ai.Image); err == nil {
+			cmdline = ab.cmdline
+		}
+	}
+	ai.Cmdline = f(cmdline)
+}
+
+// linuxImage returns the LinuxImage kexec'ing the kernel in ai.
+func (ai *AndroidBootImage) linuxImage() (*LinuxImage, error) {
+	if ai.Image == nil {
+		return nil, errNilKernel
+	}
+	ab, err := parseAndroidBootImage(ai.Image)
+	if err != nil {
+		return nil, err
+	}
+	li := &LinuxImage{
+		Name:        ai.Name,
+		Kernel:      ab.kernel.reader(ai.Image),
+		Initrd:      ab.ramdisk.reader(ai.Image),
+		Cmdline:     ab.cmdline,
+		LoadSyscall: ai.LoadSyscall,
+		KexecOpts:   ai.KexecOpts,
+	}
+	if ai.Cmdline != "" {
+		li.Cmdline = ai.Cmdline
+	}
+	if li.KexecOpts.DTB == nil {
+		li.KexecOpts.DTB = ab.dtb.reader(ai.Image)
+	}
+	return li, nil
+}
+
+// Load implements OSImage.Load. It returns an error wrapping
+// ErrUnsupportedImage if Image is not an Android boot image.
+func (ai *AndroidBootImage) Load(verbose bool) error {
+	li, err := ai.linuxImage()
+	if err != nil {
+		return setStaged(ai, err)
+	}
+	return setStaged(ai, li.load(verbose))
+}
@@ -0,0 +1,184 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// androidImage returns an Android boot image of the given header version
+// and page size, with the header fields at the given offsets and the
+// components at the given offsets.
+func androidImage(version, pageSize uint32, fields map[int][]byte, components map[int][]byte) []byte {
+	size := 8 * int(pageSize)
+	for off, c := range components {
+		if off+len(c) > size {
+			size = off + len(c)
+		}
+	}
+	at := map[int][]byte{
+		0:  []byte("ANDROID!"),
+		36: le32(pageSize),
+		40: le32(version),
+	}
+	for off, v := range fields {
+		at[off] = v
+	}
+	for off, c := range components {
+		at[off] = c
+	}
+	return imageWith(size, at)
+}
+
+func TestParseAndroidBootImage(t *testing.T) {
+	kernel := imageWith(5000, map[int][]byte{0x38: []byte("ARM\x64")})
+	ramdisk := []byte("070701 ramdisk")
+	dtb := []byte("\xd0\x0d\xfe\xed dtb")
+
+	for _, tt := range []struct {
+		name        string
+		image       []byte
+		want        androidBoot
+		wantDTB     []byte
+		wantErr     error
+		wantInvalid bool
+	}{
+		{
+			name: "v0",
+			image: androidImage(0, 2048, map[int][]byte{
+				8:   le32(uint32(len(kernel))),
+				16:  le32(uint32(len(ramdisk))),
+				24:  le32(3),
+				64:  []byte("console=ttyMSM0"),
+				608: []byte(" androidboot.hardware=qcom"),
+			}, map[int][]byte{2048: kernel, 8192: ramdisk, 10240: []byte("2nd")}),
+			want: androidBoot{
+				version:  0,
+				pageSize: 2048,
+				kernel:   androidSection{offset: 2048, size: 5000},
+				ramdisk:  androidSection{offset: 8192, size: int64(len(ramdisk))},
+				second:   androidSection{offset: 10240, size: 3},
+				cmdline:  "console=ttyMSM0 androidboot.hardware=qcom",
+			},
+		},
+		{
+			name: "v2 with dtb",
+			image: androidImage(2, 4096, map[int][]byte{
+				8:    le32(uint32(len(kernel))),
+				16:   le32(uint32(len(ramdisk))),
+				64:   []byte("console=ttyS0"),
+				1632: le32(100),
+				1648: le32(uint32(len(dtb))),
+			}, map[int][]byte{4096: kernel, 12288: ramdisk, 20480: dtb}),
+			want: androidBoot{
+				version:  2,
+				pageSize: 4096,
+				kernel:   androidSection{offset: 4096, size: 5000},
+				ramdisk:  androidSection{offset: 12288, size: int64(len(ramdisk))},
+				second:   androidSection{offset: 16384},
+				dtb:      androidSection{offset: 20480, size: int64(len(dtb))},
+				cmdline:  "console=ttyS0",
+			},
+			wantDTB: dtb,
+		},
+		{
+			name: "v4",
+			image: androidImage(4, 0, map[int][]byte{
+				8:  le32(uint32(len(kernel))),
+				12: le32(uint32(len(ramdisk))),
+				44: []byte("console=ttyS0 quiet"),
+			}, map[int][]byte{4096: kernel, 12288: ramdisk}),
+			want: androidBoot{
+				version:  4,
+				pageSize: 4096,
+				kernel:   androidSection{offset: 4096, size: 5000},
+				ramdisk:  androidSection{offset: 12288, size: int64(len(ramdisk))},
+				cmdline:  "console=ttyS0 quiet",
+			},
+		},
+		{
+			name:    "bad magic",
+			image:   imageWith(4096, map[int][]byte{0: []byte("ANDROID?")}),
+			wantErr: ErrUnsupportedImage,
+		},
+		{
+			name:    "unknown version",
+			image:   androidImage(5, 4096, map[int][]byte{8: le32(1)}, nil),
+			wantErr: ErrUnsupportedImage,
+		},
+		{
+			name:        "bad page size",
+			image:       androidImage(0, 3000, map[int][]byte{8: le32(1)}, nil),
+			wantInvalid: true,
+		},
+		{
+			name:    "no kernel",
+			image:   androidImage(0, 2048, nil, nil),
+			wantErr: errNilKernel,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ab, err := parseAndroidBootImage(bytes.NewReader(tt.image))
+			if tt.wantInvalid {
+				if err == nil {
+					t.Fatalf("parseAndroidBootImage() = %+v, want error", ab)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseAndroidBootImage() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if *ab != tt.want {
+				t.Errorf("parseAndroidBootImage() = %+v, want %+v", *ab, tt.want)
+			}
+
+			ai := &AndroidBootImage{Image: bytes.NewReader(tt.image)}
+			li, err := ai.linuxImage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(t, li.Kernel); !bytes.Equal(got, kernel) {
+				t.Errorf("kernel differs from the embedded one")
+			}
+			if got := readAll(t, li.Initrd); !bytes.Equal(got, ramdisk) {
+				t.Errorf("initrd = %q, want %q", got, ramdisk)
+			}
+			if got := readAll(t, li.KexecOpts.DTB); !bytes.Equal(got, tt.wantDTB) {
+				t.Errorf("DTB = %q, want %q", got, tt.wantDTB)
+			}
+			if li.Cmdline != tt.want.cmdline {
+				t.Errorf("Cmdline = %q, want %q", li.Cmdline, tt.want.cmdline)
+			}
+		})
+	}
+}
+
+func TestAndroidBootImageEdit(t *testing.T) {
+	image := androidImage(0, 2048, map[int][]byte{
+		8:  le32(1),
+		64: []byte("console=ttyS0"),
+	}, map[int][]byte{2048: {0x1}})
+
+	ai := &AndroidBootImage{Image: bytes.NewReader(image)}
+	ai.Edit(func(cmdline string) string {
+		if cmdline != "console=ttyS0" {
+			t.Errorf("Edit() got cmdline %q, want the embedded one", cmdline)
+		}
+		return cmdline + " debug"
+	})
+
+	li, err := ai.linuxImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "console=ttyS0 debug"; li.Cmdline != want {
+		t.Errorf("Cmdline = %q, want %q", li.Cmdline, want)
+	}
+}
@@ -10,18 +10,20 @@
 //
 // This package also supports the systemd-boot loader.conf as described in
 // https://www.freedesktop.org/software/systemd/man/loader.conf.html. Only the
-// "default" keyword is implemented.
+// "default" and "timeout" keywords are implemented.
 package bls
 
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/ulog"
@@ -36,10 +38,44 @@ const (
 )
 
 func cutConf(s string) string {
-	if strings.HasSuffix(s, ".conf") {
-		return s[:len(s)-6]
+	return strings.TrimSuffix(s, ".conf")
+}
+
+// Entry is a Type #1 BLS entry.
+type Entry struct {
+	// ID is the entry's file name without the .conf suffix, which
+	// loader.conf's default key is matched against.
+	ID string
+
+	// MachineID is the machine-id key of the entry, if any.
+	MachineID string
+
+	Image boot.OSImage
+}
+
+// Config is the set of BLS entries found in a filesystem root along with
+// the systemd-boot loader.conf settings.
+type Config struct {
+	// Entries are sorted with the ones matching the loader.conf default
+	// key first.
+	Entries []*Entry
+
+	// Default is the index of the entry to boot by default, or -1 if
+	// there are no entries.
+	Default int
+
+	// Timeout is how long a menu should be shown before booting the
+	// default entry. It is negative if loader.conf sets none.
+	Timeout time.Duration
+}
+
+// Images returns the OS images of c's entries, in order.
+func (c *Config) Images() []boot.OSImage {
+	imgs := make([]boot.OSImage, 0, len(c.Entries))
+	for _, e := range c.Entries {
+		imgs = append(imgs, e.Image)
 	}
-	return s
+	return imgs
 }
 
 // ScanBLSEntries scans the filesystem root for valid BLS entries.
@@ -47,6 +83,17 @@ func cutConf(s string) string {
 // to return everything that is bootable. map variables is the parsed result
 // from Grub parser that should be used by BLS parser, pass nil if there's none.
 func ScanBLSEntries(log ulog.Logger, fsRoot string, variables map[string]string) ([]boot.OSImage, error) {
+	c, err := ScanBLSConfig(log, fsRoot, variables)
+	if err != nil {
+		return nil, err
+	}
+	return c.Images(), nil
+}
+
+// ScanBLSConfig is like ScanBLSEntries, but also returns the default entry
+// and timeout set in loader.conf. fsRoot is usually the mount point of the
+// ESP or of /boot, and relative paths in entries are resolved against it.
+func ScanBLSConfig(log ulog.Logger, fsRoot string, variables map[string]string) (*Config, error) {
 	entriesDir := filepath.Join(fsRoot, blsEntriesDir)
 
 	files, err := filepath.Glob(filepath.Join(entriesDir, "*.conf"))
@@ -70,24 +117,48 @@ func ScanBLSEntries(log ulog.Logger, fsRoot string, variables map[string]string)
 
 	// TODO: Rank entries by version or machine-id attribute as suggested
 	// in the spec (but not mandated, surprisingly).
-	imgs := make(map[string]boot.OSImage)
+	entries := make(map[string]*Entry)
 	for _, f := range files {
-		identifier := cutConf(filepath.Base(f))
-
-		img, err := parseBLSEntry(f, fsRoot, variables)
+		e, err := parseEntry(f, fsRoot, variables)
 		if err != nil {
 			log.Printf("BootLoaderSpec skipping entry %s: %v", f, err)
 			continue
 		}
-		imgs[identifier] = img
+		entries[e.ID] = e
+	}
+
+	c := &Config{
+		Entries: sortEntries(loaderConf, entries),
+		Default: -1,
+		Timeout: parseTimeout(log, loaderConf),
+	}
+	if len(c.Entries) > 0 {
+		c.Default = 0
 	}
+	return c, nil
+}
 
-	return sortImages(loaderConf, imgs), nil
+// parseTimeout returns the loader.conf timeout, which is a number of
+// seconds or "menu-hidden", or -1 if there is none.
+func parseTimeout(log ulog.Logger, loaderConf map[string]string) time.Duration {
+	v, ok := loaderConf["timeout"]
+	if !ok {
+		return -1
+	}
+	if v == "menu-hidden" {
+		return 0
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		log.Printf("BootLoaderSpec ignoring loader.conf timeout %q", v)
+		return -1
+	}
+	return time.Duration(secs) * time.Second
 }
 
-func sortImages(loaderConf map[string]string, imgs map[string]boot.OSImage) []boot.OSImage {
-	// rankedImages = sort(default-images) + sort(remaining images)
-	var rankedImages []boot.OSImage
+func sortEntries(loaderConf map[string]string, entries map[string]*Entry) []*Entry {
+	// ranked = sort(default entries) + sort(remaining entries)
+	var ranked []*Entry
 
 	pattern, ok := loaderConf["default"]
 	if !ok {
@@ -99,9 +170,9 @@ func sortImages(loaderConf map[string]string, imgs map[string]boot.OSImage) []bo
 	var otherIdents []string
 
 	// Find default and non-default identifiers.
-	for ident := range imgs {
+	for ident := range entries {
 		ok, err := filepath.Match(pattern, ident)
-		if err != nil && ok {
+		if err == nil && ok {
 			defaultIdents = append(defaultIdents, ident)
 		} else {
 			otherIdents = append(otherIdents, ident)
@@ -112,14 +183,21 @@ func sortImages(loaderConf map[string]string, imgs map[string]boot.OSImage) []bo
 	sort.Sort(sort.Reverse(sort.StringSlice(defaultIdents)))
 	sort.Sort(sort.Reverse(sort.StringSlice(otherIdents)))
 
-	// Add images to rankedImages in that sorted order, defaults first.
+	// Add entries to ranked in that sorted order, defaults first.
 	for _, ident := range defaultIdents {
-		rankedImages = append(rankedImages, imgs[ident])
+		ranked = append(ranked, entries[ident])
 	}
 	for _, ident := range otherIdents {
-		rankedImages = append(rankedImages, imgs[ident])
+		ranked = append(ranked, entries[ident])
 	}
-	return rankedImages
+	return ranked
+}
+
+// multiValueKeys may appear more than once in an entry, and their values
+// are concatenated.
+var multiValueKeys = map[string]bool{
+	"initrd":  true,
+	"options": true,
 }
 
 func parseConf(entryPath string) (map[string]string, error) {
@@ -143,7 +221,11 @@ func parseConf(entryPath string) (map[string]string, error) {
 		if len(sline) != 2 {
 			continue
 		}
-		vals[sline[0]] = strings.TrimSpace(sline[1])
+		key, val := sline[0], strings.TrimSpace(sline[1])
+		if prev, ok := vals[key]; ok && multiValueKeys[key] {
+			val = prev + " " + val
+		}
+		vals[key] = val
 	}
 	return vals, nil
 }
@@ -185,15 +267,28 @@ func parseLinuxImage(vals map[string]string, fsRoot string, variables map[string
 			}
 			linux.Kernel = f
 
-		// TODO: initrd may be specified more than once.
-		// TODO: For now only process the first token, the rest are ignored, e.g. '$tuned_initrd'.
+		// initrd may be specified more than once, and the initrds
+		// are concatenated in order.
+		// TODO: GRUB variables such as '$tuned_initrd' are ignored.
 		case "initrd":
-			tokens = strings.Split(val, " ")
-			f, err := os.Open(filePath(fsRoot, tokens[0]))
-			if err != nil {
-				return nil, err
+			var initrds []io.ReaderAt
+			for _, t := range strings.Fields(val) {
+				if strings.HasPrefix(t, "$") {
+					continue
+				}
+				f, err := os.Open(filePath(fsRoot, t))
+				if err != nil {
+					return nil, err
+				}
+				initrds = append(initrds, f)
+			}
+			switch len(initrds) {
+			case 0:
+			case 1:
+				linux.Initrd = initrds[0]
+			default:
+				linux.Initrd = boot.CatInitrds(initrds...)
 			}
-			linux.Initrd = f
 
 		case "devicetree":
 			// Explicitly return an error rather than ignore this,
@@ -263,6 +358,15 @@ func parseLinuxImage(vals map[string]string, fsRoot string, variables map[string
 // returns a LinuxImage.
 // An error is returned if the syntax is wrong or required keys are missing.
 func parseBLSEntry(entryPath, fsRoot string, variables map[string]string) (boot.OSImage, error) {
+	e, err := parseEntry(entryPath, fsRoot, variables)
+	if err != nil {
+		return nil, err
+	}
+	return e.Image, nil
+}
+
+// parseEntry is like parseBLSEntry, but also returns the entry metadata.
+func parseEntry(entryPath, fsRoot string, variables map[string]string) (*Entry, error) {
 	vals, err := parseConf(entryPath)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing config in %s: %w", entryPath, err)
@@ -280,5 +384,9 @@ func parseBLSEntry(entryPath, fsRoot string, variables map[string]string) (boot.
 	if err != nil {
 		return nil, fmt.Errorf("error parsing config in %s: %w", entryPath, err)
 	}
-	return img, nil
+	return &Entry{
+		ID:        cutConf(filepath.Base(entryPath)),
+		MachineID: vals["machine-id"],
+		Image:     img,
+	}, nil
 }
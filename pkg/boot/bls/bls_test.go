@@ -5,13 +5,17 @@
 package bls
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/boottest"
+	"github.com/u-root/u-root/pkg/uio"
 	"github.com/u-root/u-root/pkg/ulog/ulogtest"
 )
 
@@ -132,3 +136,84 @@ func TestSetBLSRank(t *testing.T) {
 
 	os.Setenv("BLS_BOOT_RANK", originRank)
 }
+
+func TestScanBLSConfig(t *testing.T) {
+	c, err := ScanBLSConfig(ulogtest.Logger{TB: t}, "./testdata/esp", nil)
+	if err != nil {
+		t.Fatalf("ScanBLSConfig() = %v", err)
+	}
+	if c.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", c.Timeout)
+	}
+	if len(c.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(c.Entries))
+	}
+	if c.Default != 0 {
+		t.Errorf("Default = %d, want 0", c.Default)
+	}
+
+	want := []struct {
+		id, name, cmdline, kernel, initrd string
+	}{
+		{
+			// The loader.conf default comes first.
+			id:      "4c1b2e0f9a8d4e7c8b6a5d4c3b2a1f0e-6.0",
+			name:    "Linux 6.0",
+			cmdline: "root=/dev/sda2 console=ttyS0",
+			kernel:  "kernel 6.0",
+			initrd:  readAll(t, boot.CatInitrds(strings.NewReader("ucode"), strings.NewReader("initrd 6.0"))),
+		},
+		{
+			id:      "4c1b2e0f9a8d4e7c8b6a5d4c3b2a1f0e-6.1",
+			name:    "Linux 6.1",
+			cmdline: "root=/dev/sda2",
+			kernel:  "kernel 6.1",
+			initrd:  "initrd 6.1",
+		},
+	}
+	for i, w := range want {
+		e := c.Entries[i]
+		if e.ID != w.id || e.MachineID != "4c1b2e0f9a8d4e7c8b6a5d4c3b2a1f0e" {
+			t.Errorf("entry %d = %s (machine-id %s), want %s", i, e.ID, e.MachineID, w.id)
+		}
+		li, ok := e.Image.(*boot.LinuxImage)
+		if !ok {
+			t.Fatalf("entry %d image is %T, want *boot.LinuxImage", i, e.Image)
+		}
+		if li.Name != w.name || li.Cmdline != w.cmdline {
+			t.Errorf("entry %d = %q with cmdline %q, want %q with cmdline %q", i, li.Name, li.Cmdline, w.name, w.cmdline)
+		}
+		if got := readAll(t, li.Kernel); got != w.kernel {
+			t.Errorf("entry %d kernel = %q, want %q", i, got, w.kernel)
+		}
+		if got := readAll(t, li.Initrd); got != w.initrd {
+			t.Errorf("entry %d initrd = %q, want %q", i, got, w.initrd)
+		}
+	}
+}
+
+func readAll(t *testing.T, r io.ReaderAt) string {
+	t.Helper()
+	b, err := uio.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestParseTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		conf map[string]string
+		want time.Duration
+	}{
+		{conf: map[string]string{}, want: -1},
+		{conf: map[string]string{"timeout": "10"}, want: 10 * time.Second},
+		{conf: map[string]string{"timeout": "0"}, want: 0},
+		{conf: map[string]string{"timeout": "menu-hidden"}, want: 0},
+		{conf: map[string]string{"timeout": "menu-force"}, want: -1},
+	} {
+		if got := parseTimeout(ulogtest.Logger{TB: t}, tt.conf); got != tt.want {
+			t.Errorf("parseTimeout(%v) = %v, want %v", tt.conf, got, tt.want)
+		}
+	}
+}
@@ -7,7 +7,11 @@
 package boot
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/u-root/u-root/pkg/boot/kexec"
 )
@@ -37,9 +41,63 @@ type OSImage interface {
 	Load(verbose bool) error
 }
 
-// Execute executes a previously loaded OSImage.
+// ErrNothingStaged is returned by Execute when no OS image is loaded into
+// kernel memory.
+var ErrNothingStaged = errors.New("no OS image staged for kexec")
+
+var (
+	stageMu sync.Mutex
+	// staged is the OSImage currently loaded into kernel memory.
+	staged OSImage
+)
+
+// setStaged records the result of loading img into kernel memory. The kernel
+// only holds one image, so loading an image replaces the staged one. A failed
+// load clears it, as it is unknown what the kernel holds afterwards.
+func setStaged(img OSImage, err error) error {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	if err != nil {
+		staged = nil
+		return err
+	}
+	staged = img
+	return nil
+}
+
+// Stage loads img into kernel memory, replacing any previously staged image,
+// so that Execute can boot it at a later moment, e.g. after measuring it.
 //
-// This will only work if OSImage.Load was called on some OSImage.
+// The OSImages in this package are recorded as staged on Load; Stage records
+// OSImages implemented elsewhere for Staged.
+func Stage(img OSImage, verbose bool) error {
+	return setStaged(img, img.Load(verbose))
+}
+
+// Staged returns the OSImage Execute would boot, or nil if no OSImage was
+// staged with Stage or loaded by this package.
+func Staged() OSImage {
+	stageMu.Lock()
+	defer stageMu.Unlock()
+	return staged
+}
+
+// kexecLoadedPath is where the kernel reports whether a kexec image is
+// loaded.
+const kexecLoadedPath = "/sys/kernel/kexec_loaded"
+
+// Execute stops Linux and boots the OSImage loaded into kernel memory.
+//
+// This will only work if OSImage.Load was called on some OSImage. It returns
+// ErrNothingStaged if the kernel reports that no image is loaded.
 func Execute() error {
-	return kexec.Reboot()
+	return execute(kexecLoadedPath, kexec.Reboot)
+}
+
+func execute(loadedPath string, reboot func() error) error {
+	// Without sysfs, the kernel cannot be asked; try to boot anyway.
+	if b, err := os.ReadFile(loadedPath); err == nil && strings.TrimSpace(string(b)) == "0" {
+		return ErrNothingStaged
+	}
+	return reboot()
 }
@@ -0,0 +1,124 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot/linux"
+)
+
+// mockKexec replaces the kexec system calls for the duration of the test.
+// load fails with loadErr.
+func mockKexec(t *testing.T, loadErr error) {
+	oldLoad, oldFileLoad, oldStaged := kexecLoad, kexecFileLoad, staged
+	t.Cleanup(func() {
+		kexecLoad, kexecFileLoad, staged = oldLoad, oldFileLoad, oldStaged
+	})
+
+	staged = nil
+	kexecLoad = func(*os.File, *os.File, string, linux.KexecOptions) error { return loadErr }
+	kexecFileLoad = func(*os.File, *os.File, string) error { return loadErr }
+}
+
+// fakeImage is an OSImage implemented outside of this package.
+type fakeImage struct {
+	LinuxImage
+	loaded bool
+}
+
+func (f *fakeImage) Load(verbose bool) error {
+	f.loaded = true
+	return nil
+}
+
+func TestExecute(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		name       string
+		loaded     string
+		wantErr    error
+		wantReboot bool
+	}{
+		{name: "loaded", loaded: "1\n", wantReboot: true},
+		{name: "nothing loaded", loaded: "0\n", wantErr: ErrNothingStaged},
+		// Without sysfs, Execute still tries to boot.
+		{name: "unknown", wantReboot: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if tt.loaded != "" {
+				if err := os.WriteFile(path, []byte(tt.loaded), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var rebooted bool
+			reboot := func() error {
+				rebooted = true
+				return nil
+			}
+			if err := execute(path, reboot); !errors.Is(err, tt.wantErr) {
+				t.Errorf("execute() = %v, want %v", err, tt.wantErr)
+			}
+			if rebooted != tt.wantReboot {
+				t.Errorf("execute() rebooted = %t, want %t", rebooted, tt.wantReboot)
+			}
+		})
+	}
+}
+
+func TestStage(t *testing.T) {
+	mockKexec(t, nil)
+
+	first := &LinuxImage{Name: "first", Kernel: strings.NewReader("kernel")}
+	if err := first.Stage(); err != nil {
+		t.Fatalf("Stage() = %v", err)
+	}
+	if got := Staged(); got != first {
+		t.Errorf("Staged() = %v, want %v", got, first)
+	}
+
+	// Only one image can be staged: the second one replaces the first.
+	second := &LinuxImage{Name: "second", Kernel: strings.NewReader("kernel")}
+	if err := second.Load(false); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if got := Staged(); got != second {
+		t.Errorf("Staged() = %v, want %v", got, second)
+	}
+}
+
+func TestStageFailureClearsStaged(t *testing.T) {
+	loadErr := errors.New("kexec failed")
+	mockKexec(t, loadErr)
+	staged = &LinuxImage{Name: "previous"}
+
+	li := &LinuxImage{Kernel: strings.NewReader("kernel")}
+	if err := li.Stage(); !errors.Is(err, loadErr) {
+		t.Errorf("Stage() = %v, want %v", err, loadErr)
+	}
+	if got := Staged(); got != nil {
+		t.Errorf("Staged() = %v after failed Stage, want nil", got)
+	}
+}
+
+func TestStageForeignImage(t *testing.T) {
+	mockKexec(t, nil)
+
+	img := &fakeImage{}
+	if err := Stage(img, false); err != nil {
+		t.Fatalf("Stage() = %v", err)
+	}
+	if !img.loaded {
+		t.Error("Stage() did not load the image")
+	}
+	if got := Staged(); got != img {
+		t.Errorf("Staged() = %v, want %v", got, img)
+	}
+}
@@ -7,20 +7,49 @@
 package bootcmd
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
 
+	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/menu"
 	"github.com/u-root/u-root/pkg/mount"
 )
 
+// PreBootHook is run after an OS image was loaded and right before it is
+// kexec'd, e.g. to extend a TPM PCR or write an audit log. An error aborts
+// booting the image.
+type PreBootHook func(img boot.OSImage) error
+
+// runPreBootHooks runs hooks in order for entry, if it boots an OS image.
+func runPreBootHooks(entry menu.Entry, hooks []PreBootHook) error {
+	ie, ok := entry.(interface{ Image() boot.OSImage })
+	if !ok {
+		return nil
+	}
+	for _, hook := range hooks {
+		if err := hook(ie.Image()); err != nil {
+			return fmt.Errorf("pre-boot hook for %s failed: %w", entry.Label(), err)
+		}
+	}
+	return nil
+}
+
 // ShowMenuAndBoot handles common cleanup functions and flags that all boot
 // commands should support.
 //
 // mountPool is unmounted before kexecing. noLoad prints the list of entries
-// and exits. If noLoad is false, a boot menu is shown to the user. The
+// and exits. If noLoad is false, a boot menu is shown to the user, who may
+// also edit the kernel command line of an entry before booting it. The
 // user-chosen boot entry will be kexec'd unless noExec is true.
-func ShowMenuAndBoot(entries []menu.Entry, mountPool *mount.Pool, noLoad, noExec bool) {
+//
+// If opts.Timeout is set, the menu counts down to booting the default entry
+// given by opts.Default, unless the user presses a key.
+//
+// hooks are run in order before kexecing. If one of them fails, the menu is
+// shown again.
+func ShowMenuAndBoot(entries []menu.Entry, mountPool *mount.Pool, noLoad, noExec bool, opts menu.Options, hooks ...PreBootHook) {
 	if noLoad {
 		log.Print("Not loading menu or kernel. Options:")
 		for i, entry := range entries {
@@ -30,7 +59,20 @@ func ShowMenuAndBoot(entries []menu.Entry, mountPool *mount.Pool, noLoad, noExec
 		os.Exit(0)
 	}
 
-	loadedEntry := menu.ShowMenuAndLoad(true, entries...)
+	var loadedEntry menu.Entry
+	for {
+		loadedEntry = menu.ShowMenuAndLoadWithOptions(opts, true, entries...)
+		if loadedEntry == nil || noExec {
+			break
+		}
+		err := runPreBootHooks(loadedEntry, hooks)
+		if err == nil {
+			break
+		}
+		log.Print(err)
+		// Don't count down to the default entry again.
+		opts.Timeout = 0
+	}
 
 	// Clean up.
 	if mountPool != nil {
@@ -53,3 +95,48 @@ func ShowMenuAndBoot(entries []menu.Entry, mountPool *mount.Pool, noLoad, noExec
 	// Kexec should either return an error or not return.
 	log.Fatalf("Kexec should have returned an error or not returned at all.")
 }
+
+// ErrNoEntryBooted is returned by BootWithFallback if none of the entries
+// could be booted.
+var ErrNoEntryBooted = errors.New("no entry could be booted")
+
+// BootWithFallback loads and kexecs entries in order, falling back to the
+// next entry if one fails to load or exec. Each failure is logged.
+//
+// hooks are run in order before exec'ing an entry, and a failing hook is
+// handled like a failing exec. mountPool is unmounted before
+// the first exec, so entries after an entry that failed to exec cannot use
+// files on it. If noExec is true, the first entry that loads is not exec'd.
+//
+// BootWithFallback does not return if an entry is kexec'd. It returns nil if
+// noExec is true or an entry's Exec returned nil, and ErrNoEntryBooted if
+// all entries failed.
+func BootWithFallback(entries []menu.Entry, mountPool *mount.Pool, noExec bool, hooks ...PreBootHook) error {
+	for _, entry := range entries {
+		log.Printf("Attempting to boot %s", entry.Label())
+		if err := entry.Load(); err != nil {
+			log.Printf("Failed to load %s: %v", entry.Label(), err)
+			continue
+		}
+		if noExec {
+			log.Printf("Chosen boot entry: %s", entry)
+			return nil
+		}
+		if err := runPreBootHooks(entry, hooks); err != nil {
+			log.Print(err)
+			continue
+		}
+
+		if mountPool != nil {
+			if err := mountPool.UnmountAll(mount.MNT_DETACH); err != nil {
+				log.Printf("Failed in UnmountAll: %v", err)
+			}
+		}
+		if err := entry.Exec(); err != nil {
+			log.Printf("Failed to exec %s: %v", entry.Label(), err)
+			continue
+		}
+		return nil
+	}
+	return ErrNoEntryBooted
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bootcmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/menu"
+)
+
+type fakeEntry struct {
+	label   string
+	loadErr error
+	execErr error
+
+	loaded bool
+	execed bool
+}
+
+func (f *fakeEntry) Label() string                    { return f.label }
+func (f *fakeEntry) String() string                   { return f.label }
+func (f *fakeEntry) Edit(func(cmdline string) string) {}
+func (f *fakeEntry) IsDefault() bool                  { return true }
+
+func (f *fakeEntry) Load() error {
+	f.loaded = true
+	return f.loadErr
+}
+
+func (f *fakeEntry) Exec() error {
+	f.execed = true
+	return f.execErr
+}
+
+func TestBootWithFallback(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		entries    []*fakeEntry
+		noExec     bool
+		wantErr    error
+		wantLoaded []bool
+		wantExeced []bool
+	}{
+		{
+			name: "third entry boots",
+			entries: []*fakeEntry{
+				{label: "bad kernel", loadErr: errors.New("not a kernel")},
+				{label: "kexec fails", execErr: errors.New("kexec failed")},
+				{label: "good"},
+				{label: "unused"},
+			},
+			wantLoaded: []bool{true, true, true, false},
+			wantExeced: []bool{false, true, true, false},
+		},
+		{
+			name: "no exec",
+			entries: []*fakeEntry{
+				{label: "bad kernel", loadErr: errors.New("not a kernel")},
+				{label: "good"},
+			},
+			noExec:     true,
+			wantLoaded: []bool{true, true},
+			wantExeced: []bool{false, false},
+		},
+		{
+			name: "all fail",
+			entries: []*fakeEntry{
+				{label: "bad kernel", loadErr: errors.New("not a kernel")},
+				{label: "kexec fails", execErr: errors.New("kexec failed")},
+			},
+			wantErr:    ErrNoEntryBooted,
+			wantLoaded: []bool{true, true},
+			wantExeced: []bool{false, true},
+		},
+		{
+			name:    "no entries",
+			wantErr: ErrNoEntryBooted,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var entries []menu.Entry
+			for _, e := range tt.entries {
+				entries = append(entries, e)
+			}
+			if err := BootWithFallback(entries, nil, tt.noExec); !errors.Is(err, tt.wantErr) {
+				t.Errorf("BootWithFallback() = %v, want %v", err, tt.wantErr)
+			}
+			for i, e := range tt.entries {
+				if e.loaded != tt.wantLoaded[i] || e.execed != tt.wantExeced[i] {
+					t.Errorf("entry %q loaded = %t, exec'd = %t, want %t, %t", e.label, e.loaded, e.execed, tt.wantLoaded[i], tt.wantExeced[i])
+				}
+			}
+		})
+	}
+}
+
+// fakeImageEntry is a fakeEntry booting an OS image.
+type fakeImageEntry struct {
+	*fakeEntry
+	img boot.OSImage
+}
+
+func (f fakeImageEntry) Image() boot.OSImage { return f.img }
+
+func TestPreBootHooks(t *testing.T) {
+	var calls []string
+	hooks := []PreBootHook{
+		func(img boot.OSImage) error {
+			calls = append(calls, "measure "+img.Label())
+			return nil
+		},
+		func(img boot.OSImage) error {
+			calls = append(calls, "audit "+img.Label())
+			if img.Label() == "untrusted" {
+				return errors.New("not allowed")
+			}
+			return nil
+		},
+		func(img boot.OSImage) error {
+			calls = append(calls, "sync "+img.Label())
+			return nil
+		},
+	}
+
+	untrusted := fakeImageEntry{&fakeEntry{label: "untrusted"}, &boot.LinuxImage{Name: "untrusted"}}
+	shell := &fakeEntry{label: "shell", execErr: errors.New("no shell")}
+	trusted := fakeImageEntry{&fakeEntry{label: "trusted"}, &boot.LinuxImage{Name: "trusted"}}
+
+	if err := BootWithFallback([]menu.Entry{untrusted, shell, trusted}, nil, false, hooks...); err != nil {
+		t.Fatalf("BootWithFallback() = %v", err)
+	}
+	if untrusted.execed {
+		t.Errorf("entry with a failing pre-boot hook was exec'd")
+	}
+	if !shell.execed || !trusted.execed {
+		t.Errorf("shell exec'd = %t, trusted exec'd = %t, want both", shell.execed, trusted.execed)
+	}
+	want := []string{"measure untrusted", "audit untrusted", "measure trusted", "audit trusted", "sync trusted"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("hooks called %q, want %q", calls, want)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bootcmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot/menu"
+)
+
+// goodBoot is the content of a counter file after a successful boot.
+const goodBoot = "good"
+
+// BootCounter counts boot attempts in a file, to fall back to a recovery
+// entry instead of trying a failing entry forever, like systemd-boot's boot
+// counting.
+//
+// The file holds the number of attempts left. Every attempt decrements it,
+// and once it reaches zero the recovery entry is booted and the counter is
+// reset. The booted system is expected to call MarkGood, or write "good" to
+// the file, once it booted successfully, which also resets the counter.
+// A missing file counts as a reset counter.
+type BootCounter struct {
+	// Path is the counter file.
+	Path string
+
+	// Attempts is the number of attempts after a reset.
+	Attempts int
+}
+
+// left returns the number of attempts left.
+func (c *BootCounter) left() (int, error) {
+	b, err := os.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return c.Attempts, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	s := strings.TrimSpace(string(b))
+	if s == goodBoot {
+		return c.Attempts, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid boot counter %q in %s", s, c.Path)
+	}
+	return n, nil
+}
+
+// write atomically replaces the counter file's content with s.
+func (c *BootCounter) write(s string) error {
+	f, err := os.CreateTemp(filepath.Dir(c.Path), filepath.Base(c.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(s + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.Path)
+}
+
+// Attempt records a boot attempt, and returns whether there were attempts
+// left. If there were none, the counter is reset, and the recovery entry
+// should be booted instead.
+func (c *BootCounter) Attempt() (bool, error) {
+	n, err := c.left()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, c.write(strconv.Itoa(c.Attempts))
+	}
+	return true, c.write(strconv.Itoa(n - 1))
+}
+
+// MarkGood marks the last boot as successful, resetting the counter.
+func (c *BootCounter) MarkGood() error {
+	return c.write(goodBoot)
+}
+
+// Entries records a boot attempt and returns the entries to boot: entries
+// if there were attempts left, and recovery otherwise.
+func (c *BootCounter) Entries(entries []menu.Entry, recovery menu.Entry) ([]menu.Entry, error) {
+	ok, err := c.Attempt()
+	if err != nil {
+		return nil, fmt.Errorf("boot counter: %w", err)
+	}
+	if !ok {
+		return []menu.Entry{recovery}, nil
+	}
+	return entries, nil
+}
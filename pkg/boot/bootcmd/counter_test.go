@@ -0,0 +1,69 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bootcmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot/menu"
+)
+
+func readCounter(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func TestBootCounter(t *testing.T) {
+	c := &BootCounter{Path: filepath.Join(t.TempDir(), "boot.attempts"), Attempts: 2}
+	defaultEntry := &fakeEntry{label: "default"}
+	recovery := &fakeEntry{label: "recovery"}
+
+	next := func(want menu.Entry, wantCounter string) {
+		t.Helper()
+		got, err := c.Entries([]menu.Entry{defaultEntry}, recovery)
+		if err != nil {
+			t.Fatalf("Entries() = %v", err)
+		}
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("Entries() = %v, want [%v]", got, want)
+		}
+		if got := readCounter(t, c.Path); got != wantCounter {
+			t.Errorf("counter = %q, want %q", got, wantCounter)
+		}
+	}
+
+	// A missing counter file starts with all attempts left.
+	next(defaultEntry, "1")
+	next(defaultEntry, "0")
+	// Exhausted: the recovery entry is booted, and the counter reset.
+	next(recovery, "2")
+	next(defaultEntry, "1")
+
+	// A successful boot resets the counter.
+	if err := c.MarkGood(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readCounter(t, c.Path); got != "good" {
+		t.Errorf("counter = %q, want %q", got, "good")
+	}
+	next(defaultEntry, "1")
+}
+
+func TestBootCounterInvalid(t *testing.T) {
+	c := &BootCounter{Path: filepath.Join(t.TempDir(), "boot.attempts"), Attempts: 2}
+	if err := os.WriteFile(c.Path, []byte("many"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Attempt(); err == nil {
+		t.Errorf("Attempt() = nil, want error for an invalid counter")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bootcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot/menu"
+)
+
+// Order is a preferred order of boot menu entries, e.g. loaded from a
+// boot-order file with LoadBootOrder.
+type Order struct {
+	// Entries are the titles of the preferred entries in order of
+	// priority. Each may also be a pattern as accepted by path.Match,
+	// e.g. "Ubuntu*".
+	Entries []string
+
+	// Timeout, if positive, is the default countdown to booting the
+	// first entry.
+	Timeout time.Duration
+}
+
+// orderFile is the JSON format of a boot-order file, e.g.
+//
+//	{
+//	  "entries": ["Ubuntu", "Ubuntu, with Linux 5.*", "Reboot"],
+//	  "timeout": "10s"
+//	}
+type orderFile struct {
+	Entries []string `json:"entries"`
+	Timeout string   `json:"timeout,omitempty"`
+}
+
+// LoadBootOrder reads a boot-order file at path.
+func LoadBootOrder(path string) (Order, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Order{}, err
+	}
+	var f orderFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return Order{}, fmt.Errorf("boot order %s: %v", path, err)
+	}
+	o := Order{Entries: f.Entries}
+	if f.Timeout != "" {
+		o.Timeout, err = time.ParseDuration(f.Timeout)
+		if err != nil {
+			return Order{}, fmt.Errorf("boot order %s: invalid timeout: %v", path, err)
+		}
+	}
+	return o, nil
+}
+
+// matchEntry returns whether label is the title or matches the pattern
+// name.
+func matchEntry(name, label string) bool {
+	if name == label {
+		return true
+	}
+	ok, _ := path.Match(name, label)
+	return ok
+}
+
+// Apply returns entries reordered: the ones named in o in its order, and
+// then the others in their original order. Names in o that match no entry
+// are ignored with a warning.
+func (o Order) Apply(entries []menu.Entry) []menu.Entry {
+	ordered := make([]menu.Entry, 0, len(entries))
+	used := make([]bool, len(entries))
+	for _, name := range o.Entries {
+		found := false
+		for i, e := range entries {
+			if !used[i] && matchEntry(name, e.Label()) {
+				ordered = append(ordered, e)
+				used[i] = true
+				found = true
+			}
+		}
+		if !found {
+			log.Printf("Boot order: no boot entry %q, ignoring it", name)
+		}
+	}
+	for i, e := range entries {
+		if !used[i] {
+			ordered = append(ordered, e)
+		}
+	}
+	return ordered
+}
+
+// ApplyWithOptions returns entries reordered like Apply, and opts with the
+// first entry as the default and, unless opts has a timeout, o's timeout,
+// to be passed on to ShowMenuAndBoot.
+func (o Order) ApplyWithOptions(entries []menu.Entry, opts menu.Options) ([]menu.Entry, menu.Options) {
+	entries = o.Apply(entries)
+	opts.Default = 0
+	if opts.Timeout == 0 {
+		opts.Timeout = o.Timeout
+	}
+	return entries, opts
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bootcmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot/menu"
+)
+
+func TestLoadBootOrder(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    Order
+		wantErr bool
+	}{
+		{
+			name:    "entries and timeout",
+			content: `{"entries": ["Ubuntu*", "Reboot"], "timeout": "10s"}`,
+			want:    Order{Entries: []string{"Ubuntu*", "Reboot"}, Timeout: 10 * time.Second},
+		},
+		{
+			name:    "no timeout",
+			content: `{"entries": ["Fedora"]}`,
+			want:    Order{Entries: []string{"Fedora"}},
+		},
+		{
+			name:    "bad timeout",
+			content: `{"entries": ["Fedora"], "timeout": "soon"}`,
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			content: `entries = Fedora`,
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "boot-order.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadBootOrder(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadBootOrder() = %v, want error %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadBootOrder() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadBootOrder(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("LoadBootOrder(missing file) = nil, want error")
+	}
+}
+
+func labels(entries []menu.Entry) []string {
+	var l []string
+	for _, e := range entries {
+		l = append(l, e.Label())
+	}
+	return l
+}
+
+func TestOrderApply(t *testing.T) {
+	var entries []menu.Entry
+	for _, l := range []string{"Fedora", "Ubuntu 22.04", "Ubuntu 20.04", "Reboot", "Shell"} {
+		entries = append(entries, &fakeEntry{label: l})
+	}
+
+	for _, tt := range []struct {
+		name  string
+		order Order
+		want  []string
+	}{
+		{
+			name: "no order",
+			want: []string{"Fedora", "Ubuntu 22.04", "Ubuntu 20.04", "Reboot", "Shell"},
+		},
+		{
+			name:  "titles",
+			order: Order{Entries: []string{"Shell", "Ubuntu 20.04"}},
+			want:  []string{"Shell", "Ubuntu 20.04", "Fedora", "Ubuntu 22.04", "Reboot"},
+		},
+		{
+			name:  "pattern",
+			order: Order{Entries: []string{"Ubuntu*", "Fedora"}},
+			want:  []string{"Ubuntu 22.04", "Ubuntu 20.04", "Fedora", "Reboot", "Shell"},
+		},
+		{
+			name:  "unknown entries ignored",
+			order: Order{Entries: []string{"Windows", "Reboot", "Fedora*", "Fedora"}},
+			want:  []string{"Reboot", "Fedora", "Ubuntu 22.04", "Ubuntu 20.04", "Shell"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := labels(tt.order.Apply(entries)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyWithOptions(t *testing.T) {
+	entries := []menu.Entry{&fakeEntry{label: "a"}, &fakeEntry{label: "b"}}
+	o := Order{Entries: []string{"b"}, Timeout: 5 * time.Second}
+
+	got, opts := o.ApplyWithOptions(entries, menu.Options{Default: 1})
+	if !reflect.DeepEqual(labels(got), []string{"b", "a"}) || opts.Default != 0 || opts.Timeout != 5*time.Second {
+		t.Errorf("ApplyWithOptions() = %q, %+v, want [b a] with default 0 and timeout 5s", labels(got), opts)
+	}
+
+	// An explicit timeout takes precedence.
+	if _, opts := o.ApplyWithOptions(entries, menu.Options{Timeout: time.Second}); opts.Timeout != time.Second {
+		t.Errorf("ApplyWithOptions() timeout = %v, want 1s", opts.Timeout)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"debug/pe"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot/linux"
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// EFIStubImage implements OSImage for a Linux kernel in PE/COFF format,
+// i.e. a kernel built with CONFIG_EFI_STUB or a unified kernel image (UKI)
+// embedding the kernel, initrd and command line as PE sections.
+//
+// The kernel is kexec'ed directly, bypassing the EFI stub; the command line
+// is passed to it the same way the stub would.
+type EFIStubImage struct {
+	Name string
+
+	Kernel io.ReaderAt
+
+	// Initrd and Cmdline, if set, take precedence over the ones embedded
+	// in a unified kernel image.
+	Initrd  io.ReaderAt
+	Cmdline string
+
+	BootRank    int
+	LoadSyscall bool
+	KexecOpts   linux.KexecOptions
+}
+
+var _ OSImage = &EFIStubImage{}
+
+// efiStub is the Linux kernel found in a PE image.
+type efiStub struct {
+	kernel  io.ReaderAt
+	initrd  io.ReaderAt
+	cmdline string
+}
+
+// PE sections of a unified kernel image, as defined by systemd-stub.
+const (
+	ukiSectionLinux   = ".linux"
+	ukiSectionInitrd  = ".initrd"
+	ukiSectionCmdline = ".cmdline"
+)
+
+// imageMagicOffset is the offset of the magic identifying arm64 and RISC-V
+// Linux images, which are also valid PE images when built with an EFI stub.
+const imageMagicOffset = 0x38
+
+// linuxImageMagics are the arm64 and RISC-V image magics.
+var linuxImageMagics = [][]byte{
+	[]byte("ARM\x64"),
+	[]byte("RSC\x05"),
+}
+
+// sectionReader returns the contents of s, without the padding to the file
+// alignment.
+func sectionReader(r io.ReaderAt, s *pe.Section) io.ReaderAt {
+	size := s.Size
+	if s.VirtualSize != 0 && s.VirtualSize < size {
+		size = s.VirtualSize
+	}
+	return io.NewSectionReader(r, int64(s.Offset), int64(size))
+}
+
+// parseEFIStub finds the Linux kernel in the PE image r.
+func parseEFIStub(r io.ReaderAt) (*efiStub, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not a PE image: %v", ErrUnsupportedImage, stringer(r), err)
+	}
+
+	if s := f.Section(ukiSectionLinux); s != nil {
+		stub := &efiStub{kernel: sectionReader(r, s)}
+		if s := f.Section(ukiSectionInitrd); s != nil {
+			stub.initrd = sectionReader(r, s)
+		}
+		if s := f.Section(ukiSectionCmdline); s != nil {
+			b, err := io.ReadAll(uio.Reader(sectionReader(r, s)))
+			if err != nil {
+				return nil, fmt.Errorf("reading %s section of %s: %v", ukiSectionCmdline, stringer(r), err)
+			}
+			if i := bytes.IndexByte(b, 0); i >= 0 {
+				b = b[:i]
+			}
+			stub.cmdline = strings.TrimSpace(string(b))
+		}
+		return stub, nil
+	}
+
+	// Not a UKI, so the PE image must be the kernel itself.
+	t, err := DetectImageType(r)
+	if err != nil {
+		return nil, err
+	}
+	if t == ImageBzImage {
+		return &efiStub{kernel: r}, nil
+	}
+	magic := make([]byte, imageMagicOffset+4)
+	if _, err := r.ReadAt(magic, 0); err == nil {
+		for _, m := range linuxImageMagics {
+			if bytes.Equal(magic[imageMagicOffset:], m) {
+				return &efiStub{kernel: r}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s is a PE image, but not a Linux EFI stub", ErrUnsupportedImage, stringer(r))
+}
+
+// Label returns either the Name or a short description.
+func (ei *EFIStubImage) Label() string {
+	if len(ei.Name) > 0 {
+		return ei.Name
+	}
+	return fmt.Sprintf("EFIStub(kernel=%s)", stringer(ei.Kernel))
+}
+
+// Rank for the boot menu order
+func (ei *EFIStubImage) Rank() int {
+	return ei.BootRank
+}
+
+// String prints a human-readable version of this EFI stub image.
+func (ei *EFIStubImage) String() string {
+	return fmt.Sprintf(
+		"EFIStubImage(\n  Name: %s\n  Kernel: %s\n  Initrd: %s\n  Cmdline: %s\n  KexecOpts: %v\n)\n",
+		ei.Name, stringer(ei.Kernel), stringer(ei.Initrd), ei.Cmdline, ei.KexecOpts,
+	)
+}
+
+// Edit the kernel command line. If Cmdline is not set, f is given the
+// command line embedded in the image, if any.
+func (ei *EFIStubImage) Edit(f func(cmdline string) string) {
+	cmdline := ei.Cmdline
+	if cmdline == "" {
+		if stub, err := parseEFIStub(ei.Kernel); err == nil {
+			cmdline = stub.cmdline
+		}
+	}
+	ei.Cmdline = f(cmdline)
+}
+
+// linuxImage returns the LinuxImage kexec'ing the kernel in ei.
+func (ei *EFIStubImage) linuxImage() (*LinuxImage, error) {
+	if ei.Kernel == nil {
+		return nil, errNilKernel
+	}
+	stub, err := parseEFIStub(ei.Kernel)
+	if err != nil {
+		return nil, err
+	}
+	li := &LinuxImage{
+		Name:        ei.Name,
+		Kernel:      stub.kernel,
+		Initrd:      stub.initrd,
+		Cmdline:     stub.cmdline,
+		LoadSyscall: ei.LoadSyscall,
+		KexecOpts:   ei.KexecOpts,
+	}
+	if ei.Initrd != nil {
+		li.Initrd = ei.Initrd
+	}
+	if ei.Cmdline != "" {
+		li.Cmdline = ei.Cmdline
+	}
+	return li, nil
+}
+
+// Load implements OSImage.Load. It returns an error wrapping
+// ErrUnsupportedImage if Kernel is not a Linux EFI stub.
+func (ei *EFIStubImage) Load(verbose bool) error {
+	li, err := ei.linuxImage()
+	if err != nil {
+		return setStaged(ei, err)
+	}
+	return setStaged(ei, li.load(verbose))
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+type peSection struct {
+	name string
+	data []byte
+}
+
+// buildPE returns a minimal PE image with the given sections. at is written
+// into the MS-DOS header, e.g. to add an arm64 image magic.
+func buildPE(t *testing.T, at map[int][]byte, sections ...peSection) []byte {
+	const peOffset = 0x80
+	const fileAlign = 0x200
+
+	var buf bytes.Buffer
+	buf.Write(imageWith(peOffset, at))
+	copy(buf.Bytes(), "MZ")
+	binary.LittleEndian.PutUint32(buf.Bytes()[0x3c:], peOffset)
+	buf.WriteString("PE\x00\x00")
+
+	w := func(v interface{}) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w(pe.FileHeader{
+		Machine:          pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections: uint16(len(sections)),
+	})
+
+	dataOff := fileAlign
+	for _, s := range sections {
+		h := pe.SectionHeader32{
+			VirtualSize:      uint32(len(s.data)),
+			SizeOfRawData:    uint32((len(s.data) + fileAlign - 1) &^ (fileAlign - 1)),
+			PointerToRawData: uint32(dataOff),
+		}
+		copy(h.Name[:], s.name)
+		w(h)
+		dataOff += int(h.SizeOfRawData)
+	}
+	for _, s := range sections {
+		buf.Write(make([]byte, (fileAlign-buf.Len()%fileAlign)%fileAlign))
+		buf.Write(s.data)
+	}
+	buf.Write(make([]byte, (fileAlign-buf.Len()%fileAlign)%fileAlign))
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, r io.ReaderAt) []byte {
+	if r == nil {
+		return nil
+	}
+	b, err := uio.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseEFIStub(t *testing.T) {
+	kernel := imageWith(1024, map[int][]byte{0x202: []byte("HdrS")})
+	initrd := []byte("070701 initrd")
+	uki := buildPE(t, nil,
+		peSection{".text", []byte{0xc3}},
+		peSection{".cmdline", []byte("console=ttyS0 quiet\n\x00")},
+		peSection{".linux", kernel},
+		peSection{".initrd", initrd},
+	)
+	arm64 := buildPE(t, map[int][]byte{0x38: []byte("ARM\x64")}, peSection{".text", []byte{0xc3}})
+
+	for _, tt := range []struct {
+		name        string
+		image       []byte
+		wantKernel  []byte
+		wantInitrd  []byte
+		wantCmdline string
+		wantErr     error
+	}{
+		{
+			name:        "unified kernel image",
+			image:       uki,
+			wantKernel:  kernel,
+			wantInitrd:  initrd,
+			wantCmdline: "console=ttyS0 quiet",
+		},
+		{
+			name:       "arm64 Image",
+			image:      arm64,
+			wantKernel: arm64,
+		},
+		{
+			name:    "PE, but not Linux",
+			image:   buildPE(t, nil, peSection{".text", []byte{0xc3}}),
+			wantErr: ErrUnsupportedImage,
+		},
+		{
+			name:    "not PE",
+			image:   []byte("\x7fELF not a PE image"),
+			wantErr: ErrUnsupportedImage,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stub, err := parseEFIStub(bytes.NewReader(tt.image))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseEFIStub() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := readAll(t, stub.kernel); !bytes.Equal(got, tt.wantKernel) {
+				t.Errorf("kernel = %q, want %q", got, tt.wantKernel)
+			}
+			if got := readAll(t, stub.initrd); !bytes.Equal(got, tt.wantInitrd) {
+				t.Errorf("initrd = %q, want %q", got, tt.wantInitrd)
+			}
+			if stub.cmdline != tt.wantCmdline {
+				t.Errorf("cmdline = %q, want %q", stub.cmdline, tt.wantCmdline)
+			}
+		})
+	}
+}
+
+func TestEFIStubImageOverrides(t *testing.T) {
+	uki := buildPE(t, nil,
+		peSection{".cmdline", []byte("console=ttyS0")},
+		peSection{".linux", imageWith(1024, map[int][]byte{0x202: []byte("HdrS")})},
+		peSection{".initrd", []byte("embedded")},
+	)
+
+	ei := &EFIStubImage{Kernel: bytes.NewReader(uki)}
+	ei.Edit(func(cmdline string) string {
+		if cmdline != "console=ttyS0" {
+			t.Errorf("Edit() got cmdline %q, want the embedded one", cmdline)
+		}
+		return cmdline + " debug"
+	})
+	ei.Initrd = bytes.NewReader([]byte("override"))
+
+	li, err := ei.linuxImage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "console=ttyS0 debug"; li.Cmdline != want {
+		t.Errorf("Cmdline = %q, want %q", li.Cmdline, want)
+	}
+	if got := readAll(t, li.Initrd); string(got) != "override" {
+		t.Errorf("Initrd = %q, want %q", got, "override")
+	}
+}
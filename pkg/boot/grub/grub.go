@@ -20,15 +20,18 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/bls"
 	"github.com/u-root/u-root/pkg/boot/multiboot"
+	"github.com/u-root/u-root/pkg/boot/util"
 	"github.com/u-root/u-root/pkg/curl"
 	"github.com/u-root/u-root/pkg/mount"
 	"github.com/u-root/u-root/pkg/mount/block"
@@ -140,14 +143,9 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, roo
 		return nil, err
 	}
 
-	// Don't add entries twice.
-	//
-	// Multiple labels can refer to the same image, so we have to dedup by pointer.
-	seenLinux := make(map[*boot.LinuxImage]struct{})
-	seenMB := make(map[*boot.MultibootImage]struct{})
-
+	labels := p.labelOrder
 	if defaultEntry, ok := p.variables["default"]; ok {
-		p.labelOrder = append([]string{defaultEntry}, p.labelOrder...)
+		labels = append([]string{defaultEntry}, labels...)
 	}
 
 	var images []boot.OSImage
@@ -156,22 +154,111 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, roo
 			images = append(images, imgs...)
 		}
 	}
-	for _, label := range p.labelOrder {
-		if img, ok := p.linuxEntries[label]; ok {
+	return append(images, p.images(labels)...), nil
+}
+
+// NetConfig is a GRUB configuration served by a network boot server.
+type NetConfig struct {
+	// Images are the boot entries in the order they appear in the
+	// configuration, including those nested in submenus.
+	Images []boot.OSImage
+
+	// Default is the index in Images of the entry selected by
+	// "set default=", or 0 if none was selected.
+	Default int
+
+	// Timeout is the value of "set timeout=". It is negative if the
+	// timeout is not set, in which case GRUB waits for the user
+	// indefinitely.
+	Timeout time.Duration
+}
+
+// ParseNetConfig fetches and parses the GRUB configuration at configURL.
+//
+// Unlike ParseConfigFile, variables are substituted in each line before it
+// is interpreted. $prefix defaults to the directory containing the
+// configuration, and absolute paths are requested from the root of the
+// server, so both
+//
+//     linux $prefix/vmlinuz
+//     linux /boot/grub/vmlinuz
+//
+// refer to the same file if the config is at http://server/boot/grub/grub.cfg.
+func ParseNetConfig(ctx context.Context, s curl.Schemes, configURL *url.URL) (*NetConfig, error) {
+	root := &url.URL{
+		Scheme: configURL.Scheme,
+		Host:   configURL.Host,
+		Path:   "/",
+	}
+	prefix := *configURL
+	prefix.Path = path.Dir(configURL.Path)
+	prefix.RawQuery = ""
+
+	p := newParser(root, nil, nil, s)
+	p.expandVars = true
+	p.variables["prefix"] = prefix.String()
+	if err := p.appendFile(ctx, configURL.String()); err != nil {
+		return nil, err
+	}
+
+	nc := &NetConfig{
+		Images:  p.images(p.labelOrder),
+		Timeout: -1,
+	}
+	if t, err := strconv.Atoi(p.variables["timeout"]); err == nil && t >= 0 {
+		nc.Timeout = time.Duration(t) * time.Second
+	}
+	if def, ok := p.lookup(p.variables["default"]); ok {
+		for i, img := range nc.Images {
+			if img == def {
+				nc.Default = i
+				break
+			}
+		}
+	}
+	return nc, nil
+}
+
+// images returns the images referred to by labels, in order.
+func (c *parser) images(labels []string) []boot.OSImage {
+	// Don't add entries twice.
+	//
+	// Multiple labels can refer to the same image, so we have to dedup by pointer.
+	seenLinux := make(map[*boot.LinuxImage]struct{})
+	seenMB := make(map[*boot.MultibootImage]struct{})
+
+	var images []boot.OSImage
+	for _, label := range labels {
+		if img, ok := c.linuxEntries[label]; ok {
 			if _, ok := seenLinux[img]; !ok {
 				images = append(images, img)
 				seenLinux[img] = struct{}{}
 			}
 		}
 
-		if img, ok := p.mbEntries[label]; ok {
+		if img, ok := c.mbEntries[label]; ok {
 			if _, ok := seenMB[img]; !ok {
 				images = append(images, img)
 				seenMB[img] = struct{}{}
 			}
 		}
 	}
-	return images, nil
+	return images
+}
+
+// lookup returns the image selected by a GRUB default value: a menu path
+// such as "1>0", or an entry title.
+func (c *parser) lookup(entry string) (boot.OSImage, bool) {
+	if img, ok := c.menuPaths[entry]; ok {
+		return img, true
+	}
+	if img, ok := c.linuxEntries[entry]; ok {
+		return img, true
+	}
+	if img, ok := c.mbEntries[entry]; ok {
+		return img, true
+	}
+	return nil, false
 }
 
 type parser struct {
@@ -195,6 +282,24 @@ type parser struct {
 	// curLabel is the last parsed label from a "menuentry".
 	curLabel string
 
+	// menuPaths maps GRUB menu paths such as "2" or "1>0" to images.
+	// Unlike curEntry numbers, paths count submenus as entries.
+	menuPaths map[string]boot.OSImage
+
+	// curPath is the menu path of the current "menuentry".
+	curPath string
+
+	// menus holds the number of entries seen so far at each level of
+	// submenu nesting, starting with the top-level menu.
+	menus []int
+
+	// blocks are the directives of the {} blocks that are currently
+	// open, innermost last.
+	blocks []string
+
+	// expandVars enables $var and ${var} substitution.
+	expandVars bool
+
 	devices   block.BlockDevices
 	mountPool *mount.Pool
 	schemes   curl.Schemes
@@ -221,6 +326,8 @@ func newParser(root *url.URL, devices block.BlockDevices, mountPool *mount.Pool,
 	return &parser{
 		linuxEntries: make(map[string]*boot.LinuxImage),
 		mbEntries:    make(map[string]*boot.MultibootImage),
+		menuPaths:    make(map[string]boot.OSImage),
+		menus:        []int{0},
 		variables: map[string]string{
 			"root": root.String(),
 		},
@@ -290,7 +397,7 @@ func (c *parser) appendFile(ctx context.Context, url string) error {
 	} else {
 		log.Printf("[grub] Got config file %s:\n%s\n", r, string(config))
 	}
-	return c.append(ctx, string(config))
+	return c.append(ctx, util.NormalizeScript(string(config)))
 }
 
 // CmdlineQuote quotes the command line as grub-core/lib/cmdline.c does
@@ -314,14 +421,106 @@ func cmdlineQuote(args []string) string {
 	return strings.Join(q, " ")
 }
 
+// varName returns the name of the variable referenced at the start of s,
+// which follows a '$', and the number of bytes the reference takes up.
+func varName(s string) (string, int) {
+	if strings.HasPrefix(s, "{") {
+		if i := strings.IndexByte(s, '}'); i > 0 {
+			return s[1:i], i + 1
+		}
+		return "", 0
+	}
+	n := 0
+	for n < len(s) && (s[n] == '_' || s[n] >= 'a' && s[n] <= 'z' || s[n] >= 'A' && s[n] <= 'Z' || s[n] >= '0' && s[n] <= '9') {
+		n++
+	}
+	return s[:n], n
+}
+
+// expand substitutes $name and ${name} in line with the values of c's
+// variables, except inside single quotes. Unset variables expand to the
+// empty string, as they do in GRUB.
+func (c *parser) expand(line string) string {
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch ch := line[i]; {
+		case ch == '\\' && !quoted && i+1 < len(line):
+			b.WriteString(line[i : i+2])
+			i++
+		case ch == '\'':
+			quoted = !quoted
+			b.WriteByte(ch)
+		case ch == '$' && !quoted:
+			name, n := varName(line[i+1:])
+			if n == 0 {
+				b.WriteByte(ch)
+				continue
+			}
+			b.WriteString(c.variables[name])
+			i += n
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// nextMenuPath returns the GRUB menu path of the next entry or submenu at
+// the current nesting level, e.g. "1>0".
+func (c *parser) nextMenuPath() string {
+	var p []string
+	for _, n := range c.menus[:len(c.menus)-1] {
+		p = append(p, strconv.Itoa(n-1))
+	}
+	p = append(p, strconv.Itoa(c.menus[len(c.menus)-1]))
+	c.menus[len(c.menus)-1]++
+	return strings.Join(p, ">")
+}
+
 // append parses `config` and adds the respective configuration to `c`.
 //
-// NOTE: This parser has outlived its usefulness already, given that it doesn't
-// even understand the {} scoping in GRUB. But let's get the tests to pass, and
-// then we can do a rewrite.
+// NOTE: This parser has outlived its usefulness already. It only tracks {}
+// blocks far enough to number entries in submenus. But let's get the tests to
+// pass, and then we can do a rewrite.
+// digestOptions removes leading --sha1 and --sha256 options from the
+// arguments of a linux or initrd directive, and returns the expected digest
+// of the file they give. The options are u-root extensions, as in iPXE
+// scripts, and are written --sha256=<hex> or --sha256 <hex>.
+func digestOptions(args []string) ([]string, *boot.Hash, error) {
+	var h *boot.Hash
+	for len(args) > 0 {
+		kv := strings.SplitN(args[0], "=", 2)
+		opt := kv[0]
+		if opt != "--sha1" && opt != "--sha256" {
+			break
+		}
+		var value string
+		switch {
+		case len(kv) == 2:
+			value = kv[1]
+		case len(args) < 2:
+			return nil, nil, fmt.Errorf("%s: missing digest", opt)
+		default:
+			value = args[1]
+			args = args[1:]
+		}
+		args = args[1:]
+
+		var err error
+		if h, err = boot.NewHash(strings.TrimPrefix(opt, "--"), value); err != nil {
+			return nil, nil, err
+		}
+	}
+	return args, h, nil
+}
+
 func (c *parser) append(ctx context.Context, config string) error {
 	// Here's a shitty parser.
 	for _, line := range strings.Split(config, "\n") {
+		if c.expandVars {
+			line = c.expand(line)
+		}
 		// Add extra backslash for OpenSUSE/Fedora/RHEL use case. shlex
 		// will convert it back to a single backslash.
 		line = hexEscape.ReplaceAllString(line, `\\$0`)
@@ -330,6 +529,15 @@ func (c *parser) append(ctx context.Context, config string) error {
 			continue
 		}
 		directive := strings.ToLower(kv[0])
+		if kv[len(kv)-1] == "{" {
+			c.blocks = append(c.blocks, directive)
+		}
+		if directive == "}" && len(c.blocks) > 0 {
+			if c.blocks[len(c.blocks)-1] == "submenu" {
+				c.menus = c.menus[:len(c.menus)-1]
+			}
+			c.blocks = c.blocks[:len(c.blocks)-1]
+		}
 		// blscfg len(kv) is 1 so need to be checked here
 		if directive == "blscfg" {
 			c.blscfgFound = true
@@ -468,30 +676,78 @@ func (c *parser) append(ctx context.Context, config string) error {
 		case "menuentry":
 			c.curEntry = strconv.Itoa(c.numEntry)
 			c.curLabel = arg
+			c.curPath = c.nextMenuPath()
 			c.numEntry++
 			c.labelOrder = append(c.labelOrder, c.curEntry, c.curLabel)
 
+		case "submenu":
+			c.nextMenuPath()
+			if kv[len(kv)-1] == "{" {
+				c.menus = append(c.menus, 0)
+			}
+
 		case "linux", "linux16", "linuxefi":
-			k, err := c.getFile(arg)
+			args, h, err := digestOptions(kv[1:])
+			if err != nil {
+				return err
+			}
+			if len(args) == 0 {
+				continue
+			}
+			k, err := c.getFile(args[0])
 			if err != nil {
 				return err
 			}
 			// from grub manual: "Any initrd must be reloaded after using this command" so we can replace the entry
 			entry := &boot.LinuxImage{
-				Name:    c.curLabel,
-				Kernel:  k,
-				Cmdline: cmdlineQuote(kv[2:]),
+				Name:       c.curLabel,
+				Kernel:     k,
+				KernelHash: h,
+				Cmdline:    cmdlineQuote(args[1:]),
 			}
 			c.linuxEntries[c.curEntry] = entry
 			c.linuxEntries[c.curLabel] = entry
+			c.menuPaths[c.curPath] = entry
 
 		case "initrd", "initrd16", "initrdefi":
+			// Several initrds, e.g. an early microcode cpio and then
+			// the initramfs, are loaded one after the other.
+			if e, ok := c.linuxEntries[c.curEntry]; ok {
+				args, h, err := digestOptions(kv[1:])
+				if err != nil {
+					return err
+				}
+				// The digest is of a single file, not of the
+				// padded concatenation of several.
+				if h != nil && len(args) != 1 {
+					return fmt.Errorf("initrd digest %s given for %d initrds, want 1", h, len(args))
+				}
+				e.InitrdHash = h
+
+				var initrds []io.ReaderAt
+				for _, name := range args {
+					i, err := c.getFile(name)
+					if err != nil {
+						return err
+					}
+					initrds = append(initrds, i)
+				}
+				switch len(initrds) {
+				case 0:
+				case 1:
+					e.Initrd = initrds[0]
+				default:
+					e.Initrd = boot.CatInitrds(initrds...)
+				}
+			}
+
+		case "devicetree", "dtb":
 			if e, ok := c.linuxEntries[c.curEntry]; ok {
-				i, err := c.getFile(arg)
+				d, err := c.getFile(arg)
 				if err != nil {
 					return err
 				}
-				e.Initrd = i
+				e.KexecOpts.DTB = d
 			}
 
 		case "multiboot":
@@ -508,6 +764,7 @@ func (c *parser) append(ctx context.Context, config string) error {
 			}
 			c.mbEntries[c.curEntry] = entry
 			c.mbEntries[c.curLabel] = entry
+			c.menuPaths[c.curPath] = entry
 
 		case "module":
 			// TODO handle --nounzip arguments ? (change parsing)
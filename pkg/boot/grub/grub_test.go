@@ -5,8 +5,18 @@
 package grub
 
 import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/uio"
 )
 
 func TestCmdlineQuote(t *testing.T) {
@@ -44,3 +54,309 @@ func TestCmdlineQuote(t *testing.T) {
 		})
 	}
 }
+
+const netGrubConfig = `
+set timeout=5
+set default="1>1"
+set kargs="console=ttyS0"
+
+menuentry 'Linux' {
+	linux $prefix/vmlinuz $kargs
+	initrd $prefix/initrd
+}
+
+submenu 'Advanced options' {
+	menuentry 'Linux (recovery)' {
+		linux /images/vmlinuz ${kargs} single
+		initrd /images/initrd
+	}
+	menuentry 'Linux (old)' {
+		linux vmlinuz-old '$kargs'
+	}
+}
+
+menuentry 'Xen' {
+	multiboot $prefix/xen
+	module $prefix/vmlinuz
+}
+`
+
+func TestParseNetConfig(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("server", "/boot/grub/grub.cfg", netGrubConfig)
+	fs.Add("server", "/boot/grub/vmlinuz", "kernel")
+	fs.Add("server", "/boot/grub/initrd", "initrd")
+	fs.Add("server", "/boot/grub/xen", "xen")
+	fs.Add("server", "/images/vmlinuz", "recovery kernel")
+	fs.Add("server", "/images/initrd", "recovery initrd")
+	fs.Add("server", "/vmlinuz-old", "old kernel")
+	s := curl.Schemes{"http": fs}
+
+	u, err := url.Parse("http://server/boot/grub/grub.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, err := ParseNetConfig(context.Background(), s, u)
+	if err != nil {
+		t.Fatalf("ParseNetConfig() = %v", err)
+	}
+
+	if nc.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", nc.Timeout)
+	}
+	if nc.Default != 2 {
+		t.Errorf("Default = %d, want 2", nc.Default)
+	}
+
+	type linux struct {
+		name, kernel, initrd, cmdline string
+	}
+	want := []linux{
+		{"Linux", "kernel", "initrd", "console=ttyS0"},
+		{"Linux (recovery)", "recovery kernel", "recovery initrd", "console=ttyS0 single"},
+		{"Linux (old)", "old kernel", "", "$kargs"},
+	}
+	if len(nc.Images) != len(want)+1 {
+		t.Fatalf("got %d images, want %d", len(nc.Images), len(want)+1)
+	}
+	for i, w := range want {
+		li, ok := nc.Images[i].(*boot.LinuxImage)
+		if !ok {
+			t.Fatalf("image %d is %T, want *boot.LinuxImage", i, nc.Images[i])
+		}
+		if li.Name != w.name || li.Cmdline != w.cmdline {
+			t.Errorf("image %d = %q with cmdline %q, want %q with cmdline %q", i, li.Name, li.Cmdline, w.name, w.cmdline)
+		}
+		if k, err := uio.ReadAll(li.Kernel); err != nil || string(k) != w.kernel {
+			t.Errorf("image %d kernel = %q, %v, want %q", i, k, err, w.kernel)
+		}
+		if w.initrd == "" {
+			if li.Initrd != nil {
+				t.Errorf("image %d has an initrd, want none", i)
+			}
+		} else if r, err := uio.ReadAll(li.Initrd); err != nil || string(r) != w.initrd {
+			t.Errorf("image %d initrd = %q, %v, want %q", i, r, err, w.initrd)
+		}
+	}
+
+	mb, ok := nc.Images[3].(*boot.MultibootImage)
+	if !ok {
+		t.Fatalf("image 3 is %T, want *boot.MultibootImage", nc.Images[3])
+	}
+	if k, err := uio.ReadAll(mb.Kernel); err != nil || string(k) != "xen" {
+		t.Errorf("multiboot kernel = %q, %v, want %q", k, err, "xen")
+	}
+	if len(mb.Modules) != 1 {
+		t.Errorf("got %d modules, want 1", len(mb.Modules))
+	}
+}
+
+// summarize describes an image parsed from a grub.cfg, including the
+// contents of its kernel.
+func summarize(img boot.OSImage) string {
+	switch img := img.(type) {
+	case *boot.LinuxImage:
+		k, _ := uio.ReadAll(img.Kernel)
+		return fmt.Sprintf("linux %q kernel=%q cmdline=%q initrd=%v", img.Name, k, img.Cmdline, img.Initrd != nil)
+	case *boot.MultibootImage:
+		k, _ := uio.ReadAll(img.Kernel)
+		return fmt.Sprintf("multiboot %q kernel=%q cmdline=%q modules=%d", img.Name, k, img.Cmdline, len(img.Modules))
+	}
+	return fmt.Sprintf("%T", img)
+}
+
+func TestParseNetConfigWindowsLineEndings(t *testing.T) {
+	parse := func(config string) *NetConfig {
+		fs := curl.NewMockScheme("http")
+		fs.Add("server", "/boot/grub/grub.cfg", config)
+		fs.Add("server", "/boot/grub/vmlinuz", "kernel")
+		fs.Add("server", "/boot/grub/initrd", "initrd")
+		fs.Add("server", "/boot/grub/xen", "xen")
+		fs.Add("server", "/images/vmlinuz", "recovery kernel")
+		fs.Add("server", "/images/initrd", "recovery initrd")
+		fs.Add("server", "/vmlinuz-old", "old kernel")
+		u, err := url.Parse("http://server/boot/grub/grub.cfg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		nc, err := ParseNetConfig(context.Background(), curl.Schemes{"http": fs}, u)
+		if err != nil {
+			t.Fatalf("ParseNetConfig() = %v", err)
+		}
+		return nc
+	}
+
+	clean := strings.TrimPrefix(netGrubConfig, "\n")
+	want := parse(clean)
+	got := parse("\ufeff" + strings.ReplaceAll(clean, "\n", " \t\r\n"))
+	if got.Timeout != want.Timeout || got.Default != want.Default {
+		t.Errorf("timeout and default = %v, %d, want %v, %d", got.Timeout, got.Default, want.Timeout, want.Default)
+	}
+	if len(got.Images) != len(want.Images) {
+		t.Fatalf("got %d images, want %d", len(got.Images), len(want.Images))
+	}
+	for i := range want.Images {
+		if g, w := summarize(got.Images[i]), summarize(want.Images[i]); g != w {
+			t.Errorf("image %d = %s, want %s", i, g, w)
+		}
+	}
+}
+
+func TestParseNetConfigNoTimeout(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("server", "/grub.cfg", "menuentry 'Linux' {\n\tlinux vmlinuz\n}\n")
+	fs.Add("server", "/vmlinuz", "kernel")
+
+	u, err := url.Parse("http://server/grub.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, err := ParseNetConfig(context.Background(), curl.Schemes{"http": fs}, u)
+	if err != nil {
+		t.Fatalf("ParseNetConfig() = %v", err)
+	}
+	if nc.Timeout >= 0 || nc.Default != 0 || len(nc.Images) != 1 {
+		t.Errorf("ParseNetConfig() = %+v, want one default image and no timeout", nc)
+	}
+}
+
+func TestParseNetConfigDevicetree(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("server", "/grub.cfg", "menuentry 'Linux' {\n\tlinux Image\n\tdevicetree dtbs/board.dtb\n}\n")
+	fs.Add("server", "/Image", "kernel")
+	fs.Add("server", "/dtbs/board.dtb", "dtb")
+
+	u, err := url.Parse("http://server/grub.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, err := ParseNetConfig(context.Background(), curl.Schemes{"http": fs}, u)
+	if err != nil {
+		t.Fatalf("ParseNetConfig() = %v", err)
+	}
+	if len(nc.Images) != 1 {
+		t.Fatalf("got %d images, want 1", len(nc.Images))
+	}
+	li, ok := nc.Images[0].(*boot.LinuxImage)
+	if !ok {
+		t.Fatalf("image is %T, want *boot.LinuxImage", nc.Images[0])
+	}
+	if li.KexecOpts.DTB == nil {
+		t.Fatal("image has no DTB")
+	}
+	if d, err := uio.ReadAll(li.KexecOpts.DTB); err != nil || string(d) != "dtb" {
+		t.Errorf("DTB = %q, %v, want %q", d, err, "dtb")
+	}
+}
+
+func TestParseNetConfigInitrds(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("server", "/grub.cfg", "menuentry 'Linux' {\n\tlinux vmlinuz\n\tinitrd intel-ucode.img initramfs.img\n}\n")
+	fs.Add("server", "/vmlinuz", "kernel")
+	fs.Add("server", "/intel-ucode.img", "microcode")
+	fs.Add("server", "/initramfs.img", "initramfs")
+
+	u, err := url.Parse("http://server/grub.cfg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc, err := ParseNetConfig(context.Background(), curl.Schemes{"http": fs}, u)
+	if err != nil {
+		t.Fatalf("ParseNetConfig() = %v", err)
+	}
+	if len(nc.Images) != 1 {
+		t.Fatalf("got %d images, want 1", len(nc.Images))
+	}
+	li, ok := nc.Images[0].(*boot.LinuxImage)
+	if !ok {
+		t.Fatalf("image is %T, want *boot.LinuxImage", nc.Images[0])
+	}
+	d, err := uio.ReadAll(li.Initrd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "microcode" + string(make([]byte, 512-len("microcode"))) + "initramfs"; string(d) != want {
+		t.Errorf("Initrd = %q, want %q", d, want)
+	}
+}
+
+func TestParseNetConfigDigests(t *testing.T) {
+	kernelSum := fmt.Sprintf("%x", sha256.Sum256([]byte("kernel")))
+	initrdSum := fmt.Sprintf("%x", sha1.Sum([]byte("initramfs")))
+
+	for _, tt := range []struct {
+		name       string
+		config     string
+		wantKernel string
+		wantInitrd string
+		wantErr    bool
+	}{
+		{
+			name:       "option with value",
+			config:     "menuentry 'Linux' {\n\tlinux --sha256 " + kernelSum + " vmlinuz console=ttyS0\n\tinitrd --sha1=" + initrdSum + " initramfs.img\n}\n",
+			wantKernel: "sha256:" + kernelSum,
+			wantInitrd: "sha1:" + initrdSum,
+		},
+		{
+			name:       "kernel only",
+			config:     "menuentry 'Linux' {\n\tlinux --sha256=" + kernelSum + " vmlinuz console=ttyS0\n\tinitrd initramfs.img\n}\n",
+			wantKernel: "sha256:" + kernelSum,
+		},
+		{
+			name:    "invalid digest",
+			config:  "menuentry 'Linux' {\n\tlinux --sha256=1234 vmlinuz console=ttyS0\n}\n",
+			wantErr: true,
+		},
+		{
+			name:    "digest for several initrds",
+			config:  "menuentry 'Linux' {\n\tlinux vmlinuz console=ttyS0\n\tinitrd --sha1=" + initrdSum + " ucode.img initramfs.img\n}\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := curl.NewMockScheme("http")
+			fs.Add("server", "/grub.cfg", tt.config)
+			fs.Add("server", "/vmlinuz", "kernel")
+			fs.Add("server", "/ucode.img", "microcode")
+			fs.Add("server", "/initramfs.img", "initramfs")
+
+			u, err := url.Parse("http://server/grub.cfg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			nc, err := ParseNetConfig(context.Background(), curl.Schemes{"http": fs}, u)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseNetConfig() = %v, want error", nc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseNetConfig() = %v", err)
+			}
+			if len(nc.Images) != 1 {
+				t.Fatalf("got %d images, want 1", len(nc.Images))
+			}
+			li, ok := nc.Images[0].(*boot.LinuxImage)
+			if !ok {
+				t.Fatalf("image is %T, want *boot.LinuxImage", nc.Images[0])
+			}
+			if got := hashString(li.KernelHash); got != tt.wantKernel {
+				t.Errorf("KernelHash = %q, want %q", got, tt.wantKernel)
+			}
+			if got := hashString(li.InitrdHash); got != tt.wantInitrd {
+				t.Errorf("InitrdHash = %q, want %q", got, tt.wantInitrd)
+			}
+			if li.Cmdline != "console=ttyS0" {
+				t.Errorf("Cmdline = %q, want %q", li.Cmdline, "console=ttyS0")
+			}
+		})
+	}
+}
+
+func hashString(h *boot.Hash) string {
+	if h == nil {
+		return ""
+	}
+	return h.String()
+}
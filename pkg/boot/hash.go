@@ -0,0 +1,117 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// ErrHashMismatch is returned when a file's digest does not match the
+// expected one.
+var ErrHashMismatch = errors.New("hash mismatch")
+
+// Supported hash algorithms.
+const (
+	SHA1   = "sha1"
+	SHA256 = "sha256"
+)
+
+// Hash is the expected digest of a file.
+type Hash struct {
+	// Algorithm is SHA1 or SHA256.
+	Algorithm string
+
+	// Digest is the raw digest.
+	Digest []byte
+}
+
+func newHasher(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+}
+
+// NewHash returns a Hash for algorithm and the hex-encoded digest.
+func NewHash(algorithm, digest string) (*Hash, error) {
+	h, err := newHasher(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	d, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s digest %q: %v", algorithm, digest, err)
+	}
+	if len(d) != h.Size() {
+		return nil, fmt.Errorf("invalid %s digest %q: got %d bytes, want %d", algorithm, digest, len(d), h.Size())
+	}
+	return &Hash{Algorithm: strings.ToLower(algorithm), Digest: d}, nil
+}
+
+// ParseHash parses a digest in "algorithm:hex" form, e.g.
+// "sha256:e3b0c442...".
+func ParseHash(s string) (*Hash, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid digest %q: want algorithm:hex", s)
+	}
+	return NewHash(parts[0], parts[1])
+}
+
+func (h *Hash) String() string {
+	return fmt.Sprintf("%s:%x", h.Algorithm, h.Digest)
+}
+
+// Verify reads all of r and returns an error wrapping ErrHashMismatch if its
+// digest does not match h.
+func (h *Hash) Verify(r io.ReaderAt) error {
+	hasher, err := newHasher(h.Algorithm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(hasher, uio.Reader(r)); err != nil {
+		return fmt.Errorf("reading %s to verify %s digest: %v", stringer(r), h.Algorithm, err)
+	}
+	if got := hasher.Sum(nil); !bytes.Equal(got, h.Digest) {
+		return fmt.Errorf("%w: %s has %s digest %x, want %x", ErrHashMismatch, stringer(r), h.Algorithm, got, h.Digest)
+	}
+	return nil
+}
+
+// copyVerified copies r to a read-only tmpfs file, computing its digest
+// while copying, so that a file that is fetched lazily is downloaded and
+// verified in a single pass. It returns an error wrapping ErrHashMismatch,
+// and removes the copy, if the digest does not match h.
+func (h *Hash) copyVerified(ctx context.Context, r io.ReaderAt, verbose bool) (*os.File, error) {
+	hasher, err := newHasher(h.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	f, err := copyToTempFile(ctx, r, hasher, verbose)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s to verify %s digest: %w", stringer(r), h.Algorithm, err)
+	}
+	if got := hasher.Sum(nil); !bytes.Equal(got, h.Digest) {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("%w: %s has %s digest %x, want %x", ErrHashMismatch, stringer(r), h.Algorithm, got, h.Digest)
+	}
+	return f, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseHash(t *testing.T) {
+	sum := sha256.Sum256([]byte("kernel"))
+
+	for _, tt := range []struct {
+		in      string
+		wantErr bool
+	}{
+		{in: fmt.Sprintf("sha256:%x", sum)},
+		{in: fmt.Sprintf("SHA256:%x", sum)},
+		{in: fmt.Sprintf("sha1:%x", sha1.Sum([]byte("kernel")))},
+		{in: fmt.Sprintf("%x", sum), wantErr: true},
+		{in: fmt.Sprintf("md5:%x", sum), wantErr: true},
+		{in: "sha256:nothex", wantErr: true},
+		{in: fmt.Sprintf("sha256:%x", sum[:20]), wantErr: true},
+	} {
+		h, err := ParseHash(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHash(%q) = %v, want error %t", tt.in, err, tt.wantErr)
+		}
+		if err == nil && h.String() != strings.ToLower(tt.in) {
+			t.Errorf("ParseHash(%q) = %s", tt.in, h)
+		}
+	}
+}
+
+func TestHashVerify(t *testing.T) {
+	kernel := "this is a kernel"
+	good := &Hash{Algorithm: SHA256, Digest: func() []byte { s := sha256.Sum256([]byte(kernel)); return s[:] }()}
+	goodSHA1 := &Hash{Algorithm: SHA1, Digest: func() []byte { s := sha1.Sum([]byte(kernel)); return s[:] }()}
+	wrong := &Hash{Algorithm: SHA256, Digest: make([]byte, sha256.Size)}
+
+	for _, tt := range []struct {
+		name    string
+		h       *Hash
+		content string
+		wantErr error
+	}{
+		{
+			name:    "good digest",
+			h:       good,
+			content: kernel,
+		},
+		{
+			name:    "good sha1 digest",
+			h:       goodSHA1,
+			content: kernel,
+		},
+		{
+			name:    "wrong digest",
+			h:       wrong,
+			content: kernel,
+			wantErr: ErrHashMismatch,
+		},
+		{
+			name:    "truncated file",
+			h:       good,
+			content: kernel[:10],
+			wantErr: ErrHashMismatch,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.h.Verify(strings.NewReader(tt.content)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadLinuxImageHash(t *testing.T) {
+	sum := sha256.Sum256([]byte("testkernel"))
+	good := &Hash{Algorithm: SHA256, Digest: sum[:]}
+
+	for _, tt := range []struct {
+		name    string
+		li      *LinuxImage
+		wantErr error
+	}{
+		{
+			name: "good kernel digest",
+			li: &LinuxImage{
+				Kernel:     strings.NewReader("testkernel"),
+				KernelHash: good,
+			},
+		},
+		{
+			name: "truncated kernel",
+			li: &LinuxImage{
+				Kernel:     strings.NewReader("testker"),
+				KernelHash: good,
+			},
+			wantErr: ErrHashMismatch,
+		},
+		{
+			name: "wrong initrd digest",
+			li: &LinuxImage{
+				Kernel:     strings.NewReader("testkernel"),
+				Initrd:     strings.NewReader("testinitrd"),
+				InitrdHash: good,
+			},
+			wantErr: ErrHashMismatch,
+		},
+		{
+			name: "missing initrd",
+			li: &LinuxImage{
+				Kernel:     strings.NewReader("testkernel"),
+				InitrdHash: good,
+			},
+			wantErr: ErrHashMismatch,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cleanup, err := loadLinuxImage(tt.li, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("loadLinuxImage() = %v, want %v", err, tt.wantErr)
+			}
+			if cleanup != nil {
+				cleanup()
+			}
+		})
+	}
+}
+
+// countingReaderAt counts the bytes read from it.
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestLoadLinuxImageHashSinglePass(t *testing.T) {
+	kernel := strings.Repeat("testkernel", 1000)
+	sum := sha256.Sum256([]byte(kernel))
+	r := &countingReaderAt{r: strings.NewReader(kernel)}
+
+	loaded, cleanup, err := loadLinuxImage(&LinuxImage{
+		Kernel:     r,
+		KernelHash: &Hash{Algorithm: SHA256, Digest: sum[:]},
+	}, false)
+	if err != nil {
+		t.Fatalf("loadLinuxImage() = %v", err)
+	}
+	defer cleanup()
+
+	// The digest is computed while copying, not in a separate read.
+	if r.n != int64(len(kernel)) {
+		t.Errorf("read %d bytes of the kernel, want %d", r.n, len(kernel))
+	}
+	got, err := io.ReadAll(loaded.Kernel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != kernel {
+		t.Errorf("loaded kernel differs from the original")
+	}
+}
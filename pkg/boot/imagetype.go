@@ -0,0 +1,132 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/boot/multiboot"
+	"github.com/u-root/u-root/pkg/boot/util"
+)
+
+// ErrUnsupportedImage is returned when a loader is given a kernel image
+// type it cannot boot.
+var ErrUnsupportedImage = errors.New("unsupported kernel image type")
+
+// ImageType is the format of a kernel image.
+type ImageType int
+
+// Kernel image types recognized by DetectImageType.
+const (
+	ImageUnknown ImageType = iota
+	ImageBzImage
+	ImageELF
+	ImageMultiboot
+	ImageMultiboot2
+	ImagePE
+	ImageAndroid
+)
+
+func (t ImageType) String() string {
+	switch t {
+	case ImageBzImage:
+		return "bzImage"
+	case ImageELF:
+		return "ELF"
+	case ImageMultiboot:
+		return "Multiboot"
+	case ImageMultiboot2:
+		return "Multiboot2"
+	case ImagePE:
+		return "PE/EFI stub"
+	case ImageAndroid:
+		return "Android boot image"
+	}
+	return "unknown"
+}
+
+const (
+	// bzImageMagicOffset is the offset of the "HdrS" magic in the x86
+	// Linux boot protocol setup header.
+	bzImageMagicOffset = 0x202
+
+	// peHeaderPointerOffset is the offset of e_lfanew in the MS-DOS
+	// header, which points to the PE signature.
+	peHeaderPointerOffset = 0x3c
+
+	// multiboot2Magic must be within the first multiboot2SearchLen bytes
+	// of a Multiboot2 kernel, 8-byte aligned.
+	multiboot2Magic     = 0xE85250D6
+	multiboot2SearchLen = 32768
+)
+
+var (
+	bzImageMagic = []byte("HdrS")
+	elfMagic     = []byte("\x7fELF")
+	mzMagic      = []byte("MZ")
+	peMagic      = []byte("PE\x00\x00")
+	androidMagic = []byte("ANDROID!")
+)
+
+// isMultiboot2 reports whether b contains a Multiboot2 header.
+func isMultiboot2(b []byte) bool {
+	for off := 0; off+16 <= len(b) && off < multiboot2SearchLen; off += 8 {
+		magic := binary.LittleEndian.Uint32(b[off:])
+		arch := binary.LittleEndian.Uint32(b[off+4:])
+		length := binary.LittleEndian.Uint32(b[off+8:])
+		checksum := binary.LittleEndian.Uint32(b[off+12:])
+		if magic == multiboot2Magic && magic+arch+length+checksum == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isPE reports whether b starts with an MS-DOS stub pointing to a PE
+// signature.
+func isPE(b []byte) bool {
+	if !bytes.HasPrefix(b, mzMagic) || len(b) < peHeaderPointerOffset+4 {
+		return false
+	}
+	off := int(binary.LittleEndian.Uint32(b[peHeaderPointerOffset:]))
+	return off+len(peMagic) <= len(b) && bytes.Equal(b[off:off+len(peMagic)], peMagic)
+}
+
+// DetectImageType sniffs the magic bytes of the kernel image r.
+//
+// Gzip-compressed images are detected by their decompressed contents, as
+// the loaders decompress them as well. x86 Linux kernels built with an EFI
+// stub are reported as ImageBzImage, since they can be loaded as such.
+func DetectImageType(r io.ReaderAt) (ImageType, error) {
+	r = util.TryGzipFilter(r)
+
+	b := make([]byte, multiboot2SearchLen)
+	n, err := r.ReadAt(b, 0)
+	if err != nil && err != io.EOF {
+		return ImageUnknown, fmt.Errorf("reading kernel image %s: %v", stringer(r), err)
+	}
+	b = b[:n]
+
+	switch {
+	case bytes.HasPrefix(b, androidMagic):
+		return ImageAndroid, nil
+	case len(b) >= bzImageMagicOffset+len(bzImageMagic) &&
+		bytes.Equal(b[bzImageMagicOffset:bzImageMagicOffset+len(bzImageMagic)], bzImageMagic):
+		return ImageBzImage, nil
+	case isPE(b):
+		return ImagePE, nil
+	case isMultiboot2(b):
+		return ImageMultiboot2, nil
+	case multiboot.Probe(r) == nil:
+		return ImageMultiboot, nil
+	case bytes.HasPrefix(b, elfMagic):
+		return ImageELF, nil
+	}
+	return ImageUnknown, nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// imageWith returns a zeroed image of size bytes with the given contents
+// written at the given offsets.
+func imageWith(size int, at map[int][]byte) []byte {
+	b := make([]byte, size)
+	for off, v := range at {
+		copy(b[off:], v)
+	}
+	return b
+}
+
+func le32(v ...uint32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], x)
+	}
+	return b
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectImageType(t *testing.T) {
+	var mb1Magic, mb1Flags uint32 = 0x1BADB002, 0
+	var mb2Magic, mb2Len uint32 = 0xE85250D6, 24
+
+	bzImage := imageWith(1024, map[int][]byte{0: []byte("MZ"), 0x202: []byte("HdrS")})
+	for _, tt := range []struct {
+		name  string
+		image []byte
+		want  ImageType
+	}{
+		{
+			name:  "bzImage",
+			image: bzImage,
+			want:  ImageBzImage,
+		},
+		{
+			name:  "gzipped bzImage",
+			image: gzipped(t, bzImage),
+			want:  ImageBzImage,
+		},
+		{
+			name:  "ELF",
+			image: imageWith(8192, map[int][]byte{0: []byte("\x7fELF\x02\x01\x01")}),
+			want:  ImageELF,
+		},
+		{
+			name: "Multiboot",
+			image: imageWith(8192, map[int][]byte{
+				0:    []byte("\x7fELF\x01\x01\x01"),
+				4096: le32(mb1Magic, mb1Flags, -(mb1Magic + mb1Flags)),
+			}),
+			want: ImageMultiboot,
+		},
+		{
+			name: "Multiboot2",
+			image: imageWith(8192, map[int][]byte{
+				0:    []byte("\x7fELF\x01\x01\x01"),
+				4096: le32(mb2Magic, 0, mb2Len, -(mb2Magic + mb2Len), 0, 8),
+			}),
+			want: ImageMultiboot2,
+		},
+		{
+			name: "Multiboot2 bad checksum",
+			image: imageWith(8192, map[int][]byte{
+				0:    []byte("\x7fELF\x01\x01\x01"),
+				4096: le32(mb2Magic, 0, mb2Len, 0, 0, 8),
+			}),
+			want: ImageELF,
+		},
+		{
+			name:  "PE",
+			image: imageWith(512, map[int][]byte{0: []byte("MZ"), 0x3c: le32(0x80), 0x80: []byte("PE\x00\x00")}),
+			want:  ImagePE,
+		},
+		{
+			name:  "MZ without PE signature",
+			image: imageWith(512, map[int][]byte{0: []byte("MZ"), 0x3c: le32(0x1000)}),
+			want:  ImageUnknown,
+		},
+		{
+			name:  "Android",
+			image: imageWith(2048, map[int][]byte{0: []byte("ANDROID!")}),
+			want:  ImageAndroid,
+		},
+		{
+			name:  "unknown",
+			image: []byte("this is not a kernel"),
+			want:  ImageUnknown,
+		},
+		{
+			name: "empty",
+			want: ImageUnknown,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectImageType(bytes.NewReader(tt.image))
+			if err != nil {
+				t.Fatalf("DetectImageType() = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("DetectImageType() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadLinuxImageUnsupportedType(t *testing.T) {
+	li := &LinuxImage{
+		Kernel: bytes.NewReader(imageWith(2048, map[int][]byte{0: []byte("ANDROID!")})),
+	}
+	if _, _, err := loadLinuxImage(li, false); !errors.Is(err, ErrUnsupportedImage) {
+		t.Errorf("loadLinuxImage() = %v, want %v", err, ErrUnsupportedImage)
+	}
+}
@@ -16,13 +16,20 @@ import (
 
 // CatInitrds concatenates initrds on first ReadAt call from a list of
 // io.ReaderAts, pads them to a 512 byte boundary.
+//
+// The initrds are kept in order, so that e.g. an early microcode cpio
+// archive comes before the initramfs. The kernel unpacks concatenated cpio
+// archives one after the other, skipping the zero padding between them.
+//
+// The returned io.ReaderAt has an Initrds method returning initrds, e.g. to
+// list their URLs without reading them.
 func CatInitrds(initrds ...io.ReaderAt) io.ReaderAt {
 	var names []string
 	for _, initrd := range initrds {
 		names = append(names, stringer(initrd))
 	}
 
-	return uio.NewLazyOpenerAt(strings.Join(names, ","), func() (io.ReaderAt, error) {
+	cat := uio.NewLazyOpenerAt(strings.Join(names, ","), func() (io.ReaderAt, error) {
 		buf := new(bytes.Buffer)
 		for i, ireader := range initrds {
 			size, err := buf.ReadFrom(uio.Reader(ireader))
@@ -38,6 +45,19 @@ func CatInitrds(initrds ...io.ReaderAt) io.ReaderAt {
 		// Buffer doesn't implement ReadAt, so wrap in NewReader
 		return bytes.NewReader(buf.Bytes()), nil
 	})
+	return &catInitrds{LazyOpenerAt: cat, initrds: initrds}
+}
+
+// catInitrds is the concatenation of initrds returned by CatInitrds.
+type catInitrds struct {
+	*uio.LazyOpenerAt
+
+	initrds []io.ReaderAt
+}
+
+// Initrds returns the initrds that are concatenated, in order.
+func (c *catInitrds) Initrds() []io.ReaderAt {
+	return c.initrds
 }
 
 // CreateInitrd creates an initrd with the collection of files passed in.
@@ -9,9 +9,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/u-root/u-root/pkg/cpio"
 	"github.com/u-root/u-root/pkg/uio"
 )
 
@@ -109,6 +111,74 @@ func TestCatInitrds(t *testing.T) {
 	}
 }
 
+// cpioArchive returns a newc archive of records.
+func cpioArchive(t *testing.T, records ...cpio.Record) []byte {
+	var b bytes.Buffer
+	w := cpio.Newc.Writer(&b)
+	if err := cpio.WriteRecords(w, records); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpio.WriteTrailer(w); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// cpioNames returns the names of the records of the archive at the start of
+// r.
+func cpioNames(t *testing.T, r io.ReaderAt) []string {
+	records, err := cpio.ReadAllRecords(cpio.EOFReader{RecordReader: cpio.Newc.Reader(r)})
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	var names []string
+	for _, rec := range records {
+		names = append(names, rec.Name)
+	}
+	return names
+}
+
+func TestCatInitrdsCPIO(t *testing.T) {
+	microcode := cpioArchive(t,
+		cpio.Directory("kernel", 0o755),
+		cpio.Directory("kernel/x86", 0o755),
+		cpio.Directory("kernel/x86/microcode", 0o755),
+		cpio.StaticFile("kernel/x86/microcode/GenuineIntel.bin", "microcode", 0o644),
+	)
+	initramfs := cpioArchive(t,
+		cpio.StaticFile("init", "#!/bin/sh\n", 0o755),
+	)
+
+	by, err := uio.ReadAll(CatInitrds(bytes.NewReader(microcode), bytes.NewReader(initramfs)))
+	if err != nil {
+		t.Fatalf("CatInitrds() = %v", err)
+	}
+
+	// The kernel unpacks one archive after another, skipping the zeros
+	// between them.
+	start := (len(microcode) + 511) / 512 * 512
+	if len(by) != start+len(initramfs) {
+		t.Fatalf("CatInitrds() = %d bytes, want %d", len(by), start+len(initramfs))
+	}
+	if !bytes.Equal(by[:len(microcode)], microcode) {
+		t.Errorf("CatInitrds() does not start with the microcode archive")
+	}
+	if !bytes.Equal(by[len(microcode):start], make([]byte, start-len(microcode))) {
+		t.Errorf("CatInitrds() padding = %x, want zeros", by[len(microcode):start])
+	}
+	if !bytes.Equal(by[start:], initramfs) {
+		t.Errorf("CatInitrds() does not end with the initramfs archive")
+	}
+
+	r := bytes.NewReader(by)
+	if got, want := cpioNames(t, r), []string{"kernel", "kernel/x86", "kernel/x86/microcode", "kernel/x86/microcode/GenuineIntel.bin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first archive has %v, want %v", got, want)
+	}
+	if got, want := cpioNames(t, io.NewSectionReader(r, int64(start), int64(len(by)-start))), []string{"init"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second archive has %v, want %v", got, want)
+	}
+}
+
 func TestCreateInitrd(t *testing.T) {
 	for _, tt := range []struct {
 		name        string
@@ -5,11 +5,13 @@
 package boot
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"runtime"
 	"strings"
 
 	"github.com/u-root/u-root/pkg/boot/kexec"
@@ -17,6 +19,7 @@ import (
 	"github.com/u-root/u-root/pkg/boot/util"
 	"github.com/u-root/u-root/pkg/mount"
 	"github.com/u-root/u-root/pkg/uio"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/sys/unix"
 )
 
@@ -30,6 +33,21 @@ type LinuxImage struct {
 	BootRank    int
 	LoadSyscall bool
 
+	// KernelHash and InitrdHash, if set, are the expected digests of
+	// Kernel and Initrd. Load fails if the files don't match them.
+	KernelHash *Hash
+	InitrdHash *Hash
+
+	// KernelSignature, if set, is the expected detached signature of
+	// Kernel. Load fails if it is missing or does not verify.
+	KernelSignature *Signature
+
+	// Overlay, if set, is an additional local initrd, e.g. a cpio archive
+	// with debugging tools, that is appended to Initrd when the image is
+	// loaded if UseOverlay is true. It is not covered by InitrdHash.
+	Overlay    io.ReaderAt
+	UseOverlay bool
+
 	KexecOpts linux.KexecOptions
 }
 
@@ -104,6 +122,30 @@ func (li *LinuxImage) String() string {
 	)
 }
 
+// maxConcurrentFetches is the most files of an image downloaded at once.
+const maxConcurrentFetches = 4
+
+// fetchConcurrently runs fetches, at most maxConcurrentFetches at a time.
+// The first fetch to fail cancels the context of the others, and its error
+// is returned.
+func fetchConcurrently(fetches ...func(ctx context.Context) error) error {
+	g, ctx := errgroup.WithContext(context.Background())
+	sem := make(chan struct{}, maxConcurrentFetches)
+	for _, fetch := range fetches {
+		fetch := fetch
+		g.Go(func() error {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-sem }()
+			return fetch(ctx)
+		})
+	}
+	return g.Wait()
+}
+
 // copyToFileIfNotRegular copies given io.ReadAt to a tmpfs file when
 // necessary. It skips copying when source file is a regular file under
 // tmpfs or ramfs, and it is not opened for writing.
@@ -114,13 +156,15 @@ func (li *LinuxImage) String() string {
 // execve) if anything has the file opened for writing. That's unfortunately
 // something we can't guarantee here - unless we make a copy of the file
 // and dump it somewhere.
-func copyToFileIfNotRegular(r io.ReaderAt, verbose bool) (*os.File, error) {
+//
+// The copy is abandoned with ctx's error once ctx is done.
+func copyToFileIfNotRegular(ctx context.Context, r io.ReaderAt, verbose bool) (*os.File, error) {
 	// If source is a regular file in tmpfs, simply re-use that than copy.
 	//
 	// The assumption (bad?) is original local file was opened as a type
 	// conforming to os.File. We then can derive file descriptor, and the
 	// name.
-	if f, ok := r.(*os.File); ok {
+	if f := fileOf(r); f != nil {
 		if fi, err := f.Stat(); err == nil && fi.Mode().IsRegular() {
 			if r, _ := mount.IsTmpRamfs(f.Name()); r {
 				// Check if original file is opened for write. Perform copy to
@@ -138,8 +182,31 @@ func copyToFileIfNotRegular(r io.ReaderAt, verbose bool) (*os.File, error) {
 		}
 		// Not a regular file, or could not confirm it is a regular file.
 	}
+	return copyToTempFile(ctx, r, nil, verbose)
+}
 
-	rdr := uio.Reader(r)
+// fileOf returns the file r reads, or nil if r is not an *os.File or backed
+// by one, like files memory-mapped by curl.LocalFileClient.
+func fileOf(r io.ReaderAt) *os.File {
+	switch f := r.(type) {
+	case *os.File:
+		return f
+	case interface{ File() *os.File }:
+		return f.File()
+	}
+	return nil
+}
+
+// copyToTempFile copies r to a new tmpfs file and returns it opened
+// read-only. If w is not nil, everything read from r is also written to it,
+// e.g. to compute a digest while copying.
+//
+// The copy is abandoned with ctx's error once ctx is done.
+func copyToTempFile(ctx context.Context, r io.ReaderAt, w io.Writer, verbose bool) (*os.File, error) {
+	rdr := uio.ContextReader(ctx, uio.Reader(r))
+	if w != nil {
+		rdr = io.TeeReader(rdr, w)
+	}
 
 	if verbose {
 		// In verbose mode, print a dot every 5MiB. It is not pretty,
@@ -160,15 +227,17 @@ func copyToFileIfNotRegular(r io.ReaderAt, verbose bool) (*os.File, error) {
 		return nil, err
 	}
 	defer f.Close()
-	if _, err := io.Copy(f, rdr); err != nil {
-		return nil, err
-	}
-	if err := f.Sync(); err != nil {
-		return nil, err
-	}
-
-	readOnlyF, err := os.Open(f.Name())
+	readOnlyF, err := func() (*os.File, error) {
+		if _, err := io.Copy(f, rdr); err != nil {
+			return nil, err
+		}
+		if err := f.Sync(); err != nil {
+			return nil, err
+		}
+		return os.Open(f.Name())
+	}()
 	if err != nil {
+		os.Remove(f.Name())
 		return nil, err
 	}
 	return readOnlyF, nil
@@ -180,33 +249,91 @@ func copyToFileIfNotRegular(r io.ReaderAt, verbose bool) (*os.File, error) {
 //
 //   - Acquiring a read-only copy of kernel and initrd as kernel
 //     don't like them being opened for writting by anyone while
-//     executing.
-//   - Append DTB, if present to end of initrd.
+//     executing. The kernel and initrd are fetched concurrently.
+//   - Verifying the kernel and initrd digests and the kernel signature, if
+//     given.
+//   - Rejecting kernel image types kexec cannot load as Linux.
+//   - Append the overlay, if enabled, to the end of initrd.
+//   - Append DTB, if present to end of initrd, unless kexec_load is given
+//     it directly.
 func loadLinuxImage(li *LinuxImage, verbose bool) (*LoadedLinuxImage, func(), error) {
 	if li.Kernel == nil {
 		return nil, nil, errNilKernel
 	}
-
-	k, err := copyToFileIfNotRegular(util.TryGzipFilter(li.Kernel), verbose)
-	if err != nil {
-		return nil, nil, err
+	if li.InitrdHash != nil && li.Initrd == nil {
+		return nil, nil, fmt.Errorf("initrd: %w: no initrd to verify", ErrHashMismatch)
 	}
 
-	// Append device-tree file to the end of initrd.
-	if li.KexecOpts.DTB != nil {
-		if li.Initrd != nil {
-			li.Initrd = CatInitrds(li.Initrd, li.KexecOpts.DTB)
-		} else {
-			li.Initrd = li.KexecOpts.DTB
+	// The files are usually fetched lazily. Those with an expected digest
+	// are copied to tmpfs first, computing the digest while they are
+	// downloaded, and are then only read from the verified copy.
+	var k, i *os.File
+	fetchKernel := func(ctx context.Context) error {
+		kernel := li.Kernel
+		if li.KernelHash != nil {
+			f, err := li.KernelHash.copyVerified(ctx, li.Kernel, verbose)
+			if err != nil {
+				return fmt.Errorf("kernel: %w", err)
+			}
+			defer removeUnless(f, &k)
+			kernel = f
+		}
+		if li.KernelSignature != nil {
+			if err := li.KernelSignature.Verify(kernel); err != nil {
+				return fmt.Errorf("kernel: %w", err)
+			}
 		}
-	}
 
-	var i *os.File
-	if li.Initrd != nil {
-		i, err = copyToFileIfNotRegular(li.Initrd, verbose)
+		t, err := DetectImageType(kernel)
 		if err != nil {
-			return nil, nil, err
+			return err
+		}
+		switch t {
+		case ImageMultiboot, ImageMultiboot2, ImageAndroid:
+			return fmt.Errorf("%w: kernel %s is a %s, not a Linux kernel", ErrUnsupportedImage, stringer(li.Kernel), t)
+		}
+		if verbose {
+			log.Printf("Kernel image type: %s", t)
+		}
+
+		k, err = copyToFileIfNotRegular(ctx, util.TryGzipFilter(kernel), verbose)
+		return err
+	}
+	fetchInitrd := func(ctx context.Context) error {
+		initrd := li.Initrd
+		if li.InitrdHash != nil {
+			f, err := li.InitrdHash.copyVerified(ctx, li.Initrd, verbose)
+			if err != nil {
+				return fmt.Errorf("initrd: %w", err)
+			}
+			defer removeUnless(f, &i)
+			initrd = f
 		}
+
+		// Append the overlay, if enabled, and then the device-tree file
+		// to the end of initrd. li is not changed, so the overlay can be
+		// toggled between loads.
+		if li.UseOverlay && li.Overlay != nil {
+			initrd = appendInitrd(initrd, li.Overlay)
+		}
+		if li.KexecOpts.DTB != nil && !li.loadsDTB() {
+			initrd = appendInitrd(initrd, li.KexecOpts.DTB)
+		}
+		if initrd == nil {
+			return nil
+		}
+
+		var err error
+		i, err = copyToFileIfNotRegular(ctx, initrd, verbose)
+		return err
+	}
+	cleanup := func() {
+		closeCopy(k, li.Kernel)
+		closeCopy(i, li.Initrd)
+	}
+	if err := fetchConcurrently(fetchKernel, fetchInitrd); err != nil {
+		cleanup()
+		return nil, nil, err
 	}
 
 	if verbose {
@@ -218,11 +345,6 @@ func loadLinuxImage(li *LinuxImage, verbose bool) (*LoadedLinuxImage, func(), er
 		log.Printf("KexecOpts: %v", li.KexecOpts)
 	}
 
-	cleanup := func() {
-		k.Close()
-		i.Close()
-	}
-
 	return &LoadedLinuxImage{
 		Name:        li.Name,
 		Kernel:      k,
@@ -233,21 +355,90 @@ func loadLinuxImage(li *LinuxImage, verbose bool) (*LoadedLinuxImage, func(), er
 	}, cleanup, nil
 }
 
+// closeCopy closes f, if any, and removes it if it is a temporary copy rather
+// than the file src reads.
+func closeCopy(f *os.File, src io.ReaderAt) {
+	if f == nil {
+		return
+	}
+	f.Close()
+	if f != fileOf(src) {
+		os.Remove(f.Name())
+	}
+}
+
+// removeUnless closes and removes the temporary file f, unless it ended up
+// as *kept, i.e. it was not copied again.
+func removeUnless(f *os.File, kept **os.File) {
+	if *kept == f {
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// appendInitrd returns initrd with extra appended, or extra if there is no
+// initrd.
+func appendInitrd(initrd, extra io.ReaderAt) io.ReaderAt {
+	if initrd == nil {
+		return extra
+	}
+	return CatInitrds(initrd, extra)
+}
+
 // Edit the kernel command line.
 func (li *LinuxImage) Edit(f func(cmdline string) string) {
 	li.Cmdline = f(li.Cmdline)
 }
 
+// goarch is runtime.GOARCH, overridden in tests.
+var goarch = runtime.GOARCH
+
+// loadsDTB returns whether kexec_load is given KexecOpts.DTB directly, which
+// only the arm64 implementation of linux.KexecLoad does.
+func (li *LinuxImage) loadsDTB() bool {
+	return li.LoadSyscall && goarch == "arm64"
+}
+
+// Mocked out in tests.
+var (
+	kexecLoad     = linux.KexecLoad
+	kexecFileLoad = kexec.FileLoad
+)
+
 // Load implements OSImage.Load and kexec_load's the kernel with its initramfs.
+//
+// On arm64, kexec_file_load cannot be given a device tree, so kexec_load is
+// used whenever KexecOpts.DTB is set.
 func (li *LinuxImage) Load(verbose bool) error {
+	return setStaged(li, li.load(verbose))
+}
+
+// Stage loads the image into kernel memory like Load, for Execute to boot it
+// later.
+func (li *LinuxImage) Stage() error {
+	return Stage(li, false)
+}
+
+func (li *LinuxImage) load(verbose bool) error {
+	if li.KexecOpts.DTB != nil && goarch == "arm64" && !li.LoadSyscall {
+		l := *li
+		l.LoadSyscall = true
+		li = &l
+	}
+
 	loadedImage, cleanup, err := loadLinuxImage(li, verbose)
 	if err != nil {
 		return err
 	}
 	defer cleanup()
 
+	if err := measureImage(loadedImage, verbose); err != nil {
+		return err
+	}
+
 	if li.LoadSyscall {
-		return linux.KexecLoad(loadedImage.Kernel, loadedImage.Initrd, loadedImage.Cmdline, loadedImage.KexecOpts)
+		return kexecLoad(loadedImage.Kernel, loadedImage.Initrd, loadedImage.Cmdline, loadedImage.KexecOpts)
 	}
-	return kexec.FileLoad(loadedImage.Kernel, loadedImage.Initrd, loadedImage.Cmdline)
+	return kexecFileLoad(loadedImage.Kernel, loadedImage.Initrd, loadedImage.Cmdline)
 }
@@ -6,13 +6,18 @@ package boot
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/u-root/u-root/pkg/boot/linux"
@@ -140,7 +145,7 @@ func TestCopyToFile(t *testing.T) {
 	want := "abcdefg hijklmnop"
 	buf := bytes.NewReader([]byte(want))
 
-	f, err := copyToFileIfNotRegular(buf, true)
+	f, err := copyToFileIfNotRegular(context.Background(), buf, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -184,6 +189,46 @@ func checkFilePath(t *testing.T, fsrc io.ReaderAt, fdst *os.File) {
 	}
 }
 
+// fileBacked is an in-memory copy of a file, like curl's memory-mapped files.
+type fileBacked struct {
+	*strings.Reader
+	f *os.File
+}
+
+func (fb fileBacked) File() *os.File {
+	return fb.f
+}
+
+func TestCopyFileBacked(t *testing.T) {
+	// Use tmpfs, where the file can be passed to kexec without copying.
+	dir, err := os.MkdirTemp("/dev/shm", "boot-test-")
+	if err != nil {
+		t.Skipf("No tmpfs: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kernel")
+	setupTestFile(t, path, "testkernel").Close()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fileBacked{Reader: strings.NewReader("testkernel"), f: f}
+
+	got, err := copyToFileIfNotRegular(context.Background(), src, false)
+	if err != nil {
+		t.Fatalf("copyToFileIfNotRegular() = %v", err)
+	}
+	if got != f {
+		t.Errorf("copyToFileIfNotRegular() copied %s to %s, want the file itself", path, got.Name())
+	}
+
+	// The original file is not removed like a copy.
+	closeCopy(got, src)
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("closeCopy() removed the original file: %v", err)
+	}
+}
+
 func setupTestFile(t *testing.T, path, content string) *os.File {
 	t.Helper()
 	f, err := os.Create(path)
@@ -344,7 +389,7 @@ func TestLoadLinuxImage(t *testing.T) {
 			}
 			// Initrd, if present, is opened as read only, and contents match that from original LinuxImage.
 			// OR original initrd, with DTB appended.
-			if tt.li.Initrd != nil {
+			if tt.want.loadedImage.Initrd != nil {
 				checkReadOnly(t, gotImage.Initrd)
 				// If src is a read-only *os.File on tmpfs, should skip copying.
 				checkFilePath(t, tt.li.Initrd, gotImage.Initrd)
@@ -364,3 +409,258 @@ func TestLoadLinuxImage(t *testing.T) {
 		})
 	}
 }
+
+func TestLinuxEdit(t *testing.T) {
+	li := &LinuxImage{Cmdline: "console=tty0"}
+	li.Edit(func(cmdline string) string { return "console=ttyS0 rd.break" })
+	if want := "console=ttyS0 rd.break"; li.Cmdline != want {
+		t.Errorf("Edit() cmdline = %q, want %q", li.Cmdline, want)
+	}
+
+	// Cancelling the edit keeps the command line.
+	li.Edit(func(cmdline string) string { return cmdline })
+	if want := "console=ttyS0 rd.break"; li.Cmdline != want {
+		t.Errorf("Edit() cmdline = %q, want %q", li.Cmdline, want)
+	}
+}
+
+func TestLinuxLoadDTB(t *testing.T) {
+	for _, tt := range []struct {
+		arch        string
+		loadSyscall bool
+		wantLoad    bool
+		wantInitrd  string
+	}{
+		{arch: "arm64", wantLoad: true, wantInitrd: "testinitrd"},
+		{arch: "arm64", loadSyscall: true, wantLoad: true, wantInitrd: "testinitrd"},
+		{arch: "amd64", wantInitrd: GenerateCatDummyInitrd(t, "testinitrd", "testdtb")},
+		// amd64 kexec_load ignores the DTB, so it is still appended.
+		{arch: "amd64", loadSyscall: true, wantLoad: true, wantInitrd: GenerateCatDummyInitrd(t, "testinitrd", "testdtb")},
+	} {
+		t.Run(fmt.Sprintf("%s,loadSyscall=%t", tt.arch, tt.loadSyscall), func(t *testing.T) {
+			oldArch, oldLoad, oldFileLoad := goarch, kexecLoad, kexecFileLoad
+			defer func() { goarch, kexecLoad, kexecFileLoad = oldArch, oldLoad, oldFileLoad }()
+			goarch = tt.arch
+
+			var gotLoad bool
+			var gotInitrd []byte
+			var gotDTB io.ReaderAt
+			kexecLoad = func(kernel, ramfs *os.File, cmdline string, opts linux.KexecOptions) error {
+				gotLoad = true
+				gotDTB = opts.DTB
+				gotInitrd, _ = io.ReadAll(ramfs)
+				return nil
+			}
+			kexecFileLoad = func(kernel, ramfs *os.File, cmdline string) error {
+				gotInitrd, _ = io.ReadAll(ramfs)
+				return nil
+			}
+
+			dtb := strings.NewReader("testdtb")
+			li := &LinuxImage{
+				Kernel:      strings.NewReader("testkernel"),
+				Initrd:      strings.NewReader("testinitrd"),
+				LoadSyscall: tt.loadSyscall,
+				KexecOpts:   linux.KexecOptions{DTB: dtb},
+			}
+			if err := li.Load(false); err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+			if gotLoad != tt.wantLoad {
+				t.Errorf("used kexec_load = %t, want %t", gotLoad, tt.wantLoad)
+			}
+			if tt.wantLoad && gotDTB != dtb {
+				t.Errorf("kexec_load got DTB %v, want %v", gotDTB, dtb)
+			}
+			if string(gotInitrd) != tt.wantInitrd {
+				t.Errorf("loaded initrd = %q, want %q", gotInitrd, tt.wantInitrd)
+			}
+		})
+	}
+}
+
+func TestLinuxLoadOverlay(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		initrd     io.ReaderAt
+		overlay    io.ReaderAt
+		useOverlay bool
+		dtb        io.ReaderAt
+		wantInitrd string
+	}{
+		{
+			name:       "disabled",
+			initrd:     strings.NewReader("testinitrd"),
+			overlay:    strings.NewReader("testoverlay"),
+			wantInitrd: "testinitrd",
+		},
+		{
+			name:       "enabled",
+			initrd:     strings.NewReader("testinitrd"),
+			overlay:    strings.NewReader("testoverlay"),
+			useOverlay: true,
+			wantInitrd: GenerateCatDummyInitrd(t, "testinitrd", "testoverlay"),
+		},
+		{
+			name:       "enabled without overlay",
+			initrd:     strings.NewReader("testinitrd"),
+			useOverlay: true,
+			wantInitrd: "testinitrd",
+		},
+		{
+			name:       "enabled without initrd",
+			overlay:    strings.NewReader("testoverlay"),
+			useOverlay: true,
+			wantInitrd: "testoverlay",
+		},
+		{
+			name:       "enabled with DTB",
+			initrd:     strings.NewReader("testinitrd"),
+			overlay:    strings.NewReader("testoverlay"),
+			useOverlay: true,
+			dtb:        strings.NewReader("testdtb"),
+			wantInitrd: GenerateCatDummyInitrd(t, "testinitrd", "testoverlay", "testdtb"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			oldArch, oldFileLoad := goarch, kexecFileLoad
+			defer func() { goarch, kexecFileLoad = oldArch, oldFileLoad }()
+			goarch = "amd64"
+
+			var gotInitrd []byte
+			kexecFileLoad = func(kernel, ramfs *os.File, cmdline string) error {
+				gotInitrd = nil
+				if ramfs != nil {
+					gotInitrd, _ = io.ReadAll(ramfs)
+				}
+				return nil
+			}
+
+			li := &LinuxImage{
+				Kernel:     strings.NewReader("testkernel"),
+				Initrd:     tt.initrd,
+				Overlay:    tt.overlay,
+				UseOverlay: tt.useOverlay,
+				KexecOpts:  linux.KexecOptions{DTB: tt.dtb},
+			}
+			// Loading twice must not append the overlay twice.
+			for i := 0; i < 2; i++ {
+				if err := li.Load(false); err != nil {
+					t.Fatalf("Load() = %v", err)
+				}
+				if string(gotInitrd) != tt.wantInitrd {
+					t.Errorf("loaded initrd = %q, want %q", gotInitrd, tt.wantInitrd)
+				}
+			}
+			if li.Initrd != tt.initrd {
+				t.Errorf("Load() changed Initrd to %v, want %v", li.Initrd, tt.initrd)
+			}
+		})
+	}
+}
+
+func TestLoadLinuxImageConcurrentFetch(t *testing.T) {
+	// Neither file is served until both have been requested.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	inFlight := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(inFlight)
+	}()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wg.Done()
+		select {
+		case <-inFlight:
+		case <-time.After(5 * time.Second):
+			http.Error(w, "other file was not requested concurrently", http.StatusRequestTimeout)
+			return
+		}
+		fmt.Fprintf(w, "test%s", strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer s.Close()
+
+	schemes := curl.Schemes{"http": curl.DefaultHTTPClient}
+	fetch := func(name string) io.ReaderAt {
+		u, err := url.Parse(s.URL + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := schemes.LazyFetch(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	li := &LinuxImage{
+		Kernel: fetch("kernel"),
+		Initrd: fetch("initrd"),
+	}
+	got, cleanup, err := loadLinuxImage(li, false)
+	if err != nil {
+		t.Fatalf("loadLinuxImage() = %v", err)
+	}
+
+	for _, tt := range []struct {
+		f    *os.File
+		want string
+	}{
+		{got.Kernel, "testkernel"},
+		{got.Initrd, "testinitrd"},
+	} {
+		b, err := io.ReadAll(tt.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("loaded %s = %q, want %q", tt.f.Name(), b, tt.want)
+		}
+	}
+
+	cleanup()
+	checkEmptyDir(t, tmp)
+}
+
+// checkEmptyDir fails the test if temporary files were left in dir.
+func checkEmptyDir(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("temporary file %s was not removed", e.Name())
+	}
+}
+
+func TestLoadLinuxImageFetchError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/initrd" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "testkernel")
+	}))
+	defer s.Close()
+
+	schemes := curl.Schemes{"http": curl.DefaultHTTPClient}
+	k, _ := url.Parse(s.URL + "/kernel")
+	i, _ := url.Parse(s.URL + "/initrd")
+	kernel, _ := schemes.LazyFetch(k)
+	initrd, _ := schemes.LazyFetch(i)
+
+	li := &LinuxImage{
+		Kernel: kernel,
+		Initrd: initrd,
+	}
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	if _, _, err := loadLinuxImage(li, false); err == nil {
+		t.Errorf("loadLinuxImage() = nil, want error for missing initrd")
+	}
+	checkEmptyDir(t, tmp)
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+// FindDevice returns the one device in devices identified by spec, which is
+// either UUID=<file system UUID>, LABEL=<file system label>,
+// PARTUUID=<GPT partition GUID>, or a device name such as /dev/sda1, as in
+// /etc/fstab.
+func FindDevice(devices block.BlockDevices, spec string) (*block.BlockDev, error) {
+	var found block.BlockDevices
+	kv := strings.SplitN(spec, "=", 2)
+	key := kv[0]
+	var value string
+	if len(kv) == 2 {
+		value = kv[1]
+	}
+	switch {
+	case len(kv) == 1:
+		found = devices.FilterNames(spec)
+	case key == "UUID":
+		found = devices.FilterFSUUID(strings.ToLower(value))
+	case key == "LABEL":
+		found = devices.FilterFSLabel(value)
+	case key == "PARTUUID":
+		found = devices.FilterPartID(value)
+	default:
+		return nil, fmt.Errorf("device %q: unknown key %q, want UUID, LABEL or PARTUUID", spec, key)
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no block device matches %q", spec)
+	case 1:
+		return found[0], nil
+	default:
+		return nil, fmt.Errorf("%d block devices match %q: %v", len(found), spec, found)
+	}
+}
+
+// LinuxImageFromDevice returns a Linux image with the kernel and, if set,
+// the initrd at the given paths on the file system of the device in devices
+// identified by spec, as in FindDevice.
+//
+// The file system is mounted read-only only while the files are read into
+// memory, so that nothing is left mounted when the image is booted.
+func LinuxImageFromDevice(devices block.BlockDevices, spec, kernelPath, initrdPath, cmdline string) (*boot.LinuxImage, error) {
+	device, err := FindDevice(devices, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "localboot-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dir)
+
+	mp, err := device.Mount(dir, mount.ReadOnly)
+	if err != nil {
+		return nil, fmt.Errorf("mounting %s: %w", device, err)
+	}
+
+	img := &boot.LinuxImage{
+		Name:    fmt.Sprintf("%s from %s", kernelPath, spec),
+		Cmdline: cmdline,
+	}
+	kernel, err := os.ReadFile(filepath.Join(dir, kernelPath))
+	if err == nil {
+		img.Kernel = bytes.NewReader(kernel)
+		if initrdPath != "" {
+			var initrd []byte
+			initrd, err = os.ReadFile(filepath.Join(dir, initrdPath))
+			img.Initrd = bytes.NewReader(initrd)
+		}
+	}
+	if uerr := mp.Unmount(0); uerr != nil && err == nil {
+		err = uerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/cp"
+	"github.com/u-root/u-root/pkg/mount/block"
+	"github.com/u-root/u-root/pkg/mount/loop"
+)
+
+// testdata/ext4.img was made with
+//
+//	mkfs.ext4 -b 1024 -N 16 -O ^has_journal -L localboot \
+//	  -U 5e3f7a1c-2b4d-4e6f-8a9b-0c1d2e3f4a5b -d root ext4.img 256k
+//
+// where root contains boot/vmlinuz and boot/initrd.img.
+const (
+	testUUID  = "5e3f7a1c-2b4d-4e6f-8a9b-0c1d2e3f4a5b"
+	testLabel = "localboot"
+)
+
+func TestFindDeviceErrors(t *testing.T) {
+	devices := block.BlockDevices{{Name: "sda1", FsUUID: "1234-abcd"}}
+	for _, spec := range []string{
+		"UUID=abcd-1234",
+		"sdb1",
+		"ID=1234-abcd",
+	} {
+		if d, err := FindDevice(devices, spec); err == nil {
+			t.Errorf("FindDevice(%q) = %v, want error", spec, d)
+		}
+	}
+}
+
+func TestFindDeviceAmbiguous(t *testing.T) {
+	devices := block.BlockDevices{
+		{Name: "sda1", FsUUID: "1234-abcd"},
+		{Name: "sdb1", FsUUID: "1234-abcd"},
+	}
+	if d, err := FindDevice(devices, "UUID=1234-abcd"); err == nil {
+		t.Errorf("FindDevice() = %v, want error", d)
+	}
+}
+
+// loopDevice attaches a copy of testdata/ext4.img to a loop device.
+func loopDevice(t *testing.T) *block.BlockDev {
+	t.Helper()
+	if os.Getuid() != 0 {
+		t.Skip("Skipping since we are not root")
+	}
+	img := filepath.Join(t.TempDir(), "ext4.img")
+	if err := cp.Copy("testdata/ext4.img", img); err != nil {
+		t.Fatal(err)
+	}
+	l, err := loop.New(img, "ext4", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := l.Free(); err != nil {
+			t.Errorf("freeing %s: %v", l.Dev, err)
+		}
+	})
+	device, err := block.Device(l.Dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return device
+}
+
+func TestLinuxImageFromDevice(t *testing.T) {
+	device := loopDevice(t)
+	devices := block.BlockDevices{{Name: "sda1", FsUUID: "1234-abcd"}, device}
+
+	for _, tt := range []struct {
+		name       string
+		spec       string
+		kernel     string
+		initrd     string
+		wantInitrd string
+		wantErr    bool
+	}{
+		{
+			name:       "UUID",
+			spec:       "UUID=" + testUUID,
+			kernel:     "/boot/vmlinuz",
+			initrd:     "/boot/initrd.img",
+			wantInitrd: "initrd",
+		},
+		{
+			name:   "upper case UUID",
+			spec:   "UUID=" + strings.ToUpper(testUUID),
+			kernel: "/boot/vmlinuz",
+		},
+		{
+			name:       "LABEL",
+			spec:       "LABEL=" + testLabel,
+			kernel:     "boot/vmlinuz",
+			initrd:     "boot/initrd.img",
+			wantInitrd: "initrd",
+		},
+		{
+			name:   "device name",
+			spec:   device.DevicePath(),
+			kernel: "/boot/vmlinuz",
+		},
+		{
+			name:    "PARTUUID",
+			spec:    "PARTUUID=" + testUUID,
+			kernel:  "/boot/vmlinuz",
+			wantErr: true,
+		},
+		{
+			name:    "no kernel",
+			spec:    "UUID=" + testUUID,
+			kernel:  "/boot/bzImage",
+			wantErr: true,
+		},
+		{
+			name:    "no initrd",
+			spec:    "UUID=" + testUUID,
+			kernel:  "/boot/vmlinuz",
+			initrd:  "/boot/initramfs.img",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := LinuxImageFromDevice(devices, tt.spec, tt.kernel, tt.initrd, "console=ttyS0")
+			if mp, _ := block.GetMountpointByDevice(device.DevicePath()); mp != nil {
+				t.Errorf("%s is still mounted at %s", device, *mp)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LinuxImageFromDevice() = %v, want error", img)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LinuxImageFromDevice() = %v", err)
+			}
+
+			if got, _ := io.ReadAll(io.NewSectionReader(img.Kernel, 0, 1<<20)); string(got) != "kernel" {
+				t.Errorf("Kernel = %q, want %q", got, "kernel")
+			}
+			if tt.initrd == "" {
+				if img.Initrd != nil {
+					t.Errorf("Initrd = %v, want nil", img.Initrd)
+				}
+			} else if got, _ := io.ReadAll(io.NewSectionReader(img.Initrd, 0, 1<<20)); string(got) != tt.wantInitrd {
+				t.Errorf("Initrd = %q, want %q", got, tt.wantInitrd)
+			}
+			if img.Cmdline != "console=ttyS0" {
+				t.Errorf("Cmdline = %q, want %q", img.Cmdline, "console=ttyS0")
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/tss"
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// Measurement is an event log entry of an image measured into a PCR.
+type Measurement struct {
+	PCR int
+
+	// Algorithm is SHA1 or SHA256, depending on the TPM version.
+	Algorithm string
+	Digest    []byte
+
+	Description string
+}
+
+var (
+	measureMu sync.Mutex
+	// measurePCR is the PCR images are measured into, or -1.
+	measurePCR = -1
+	// measureTPM opens the TPM images are measured with.
+	measureTPM func() (pcrExtender, error)
+	// measurements is the event log of measured images.
+	measurements []Measurement
+)
+
+// MeasureInto makes loading a LinuxImage extend pcr of the TPM with the
+// digests of its kernel, initrd, device tree and command line, for measured
+// boot. Each is extended and logged separately. A negative pcr turns
+// measuring off, which is the default.
+//
+// Images are loaded without being measured if there is no TPM.
+func MeasureInto(pcr int) {
+	measureWith(pcr, openTPM)
+}
+
+// measureWith is MeasureInto with the TPM opened by open.
+func measureWith(pcr int, open func() (pcrExtender, error)) {
+	measureMu.Lock()
+	defer measureMu.Unlock()
+	measurePCR = pcr
+	measureTPM = open
+}
+
+// Measurements returns the event log of the images measured so far.
+func Measurements() []Measurement {
+	measureMu.Lock()
+	defer measureMu.Unlock()
+	return append([]Measurement(nil), measurements...)
+}
+
+// pcrExtender is the part of a TPM used for measuring images.
+type pcrExtender interface {
+	GetVersion() tss.TPMVersion
+	Extend(hash []byte, pcrIndex uint32) error
+	Close() error
+}
+
+func openTPM() (pcrExtender, error) {
+	t, err := tss.NewTPM()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// measureImage extends the configured PCR with the digests of the kernel,
+// initrd, device tree and command line of li, if measuring is on and there
+// is a TPM.
+func measureImage(li *LoadedLinuxImage, verbose bool) error {
+	measureMu.Lock()
+	defer measureMu.Unlock()
+	if measurePCR < 0 {
+		return nil
+	}
+
+	t, err := measureTPM()
+	if err != nil {
+		if verbose {
+			log.Printf("Not measuring %s: %v", li.Name, err)
+		}
+		return nil
+	}
+	defer t.Close()
+
+	algorithm := SHA256
+	if t.GetVersion() == tss.TPMVersion12 {
+		algorithm = SHA1
+	}
+	// Components are measured one by one, so that the event log tells
+	// which of them changed.
+	measure := func(r io.Reader, desc string) error {
+		h, err := newHasher(algorithm)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(h, r); err != nil {
+			return fmt.Errorf("measuring %s: %v", desc, err)
+		}
+		digest := h.Sum(nil)
+		if err := t.Extend(digest, uint32(measurePCR)); err != nil {
+			return fmt.Errorf("extending PCR %d with %s digest %x of %s: %v", measurePCR, algorithm, digest, desc, err)
+		}
+		m := Measurement{
+			PCR:         measurePCR,
+			Algorithm:   algorithm,
+			Digest:      digest,
+			Description: desc,
+		}
+		measurements = append(measurements, m)
+		if verbose {
+			log.Printf("Measured %s into PCR %d: %s:%x", m.Description, m.PCR, m.Algorithm, m.Digest)
+		}
+		return nil
+	}
+
+	if err := measure(uio.Reader(li.Kernel), fmt.Sprintf("kernel=%s", li.Kernel.Name())); err != nil {
+		return err
+	}
+	if li.Initrd != nil {
+		if err := measure(uio.Reader(li.Initrd), fmt.Sprintf("initrd=%s", li.Initrd.Name())); err != nil {
+			return err
+		}
+	}
+	if dtb := li.KexecOpts.DTB; dtb != nil {
+		if err := measure(uio.Reader(dtb), fmt.Sprintf("dtb=%s", stringer(dtb))); err != nil {
+			return err
+		}
+	}
+	return measure(strings.NewReader(li.Cmdline), fmt.Sprintf("cmdline=%q", li.Cmdline))
+}
@@ -0,0 +1,169 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/tss"
+)
+
+type extendCall struct {
+	hash []byte
+	pcr  uint32
+}
+
+// fakeTPM records PCR extensions.
+type fakeTPM struct {
+	version tss.TPMVersion
+	extends []extendCall
+	closed  bool
+}
+
+func (f *fakeTPM) GetVersion() tss.TPMVersion {
+	return f.version
+}
+
+func (f *fakeTPM) Extend(hash []byte, pcr uint32) error {
+	f.extends = append(f.extends, extendCall{hash: hash, pcr: pcr})
+	return nil
+}
+
+func (f *fakeTPM) Close() error {
+	f.closed = true
+	return nil
+}
+
+// mockMeasure measures into pcr with tpm for the duration of the test.
+func mockMeasure(t *testing.T, pcr int, tpm pcrExtender, tpmErr error) {
+	oldPCR, oldTPM, oldMeasurements := measurePCR, measureTPM, measurements
+	t.Cleanup(func() {
+		measurePCR, measureTPM, measurements = oldPCR, oldTPM, oldMeasurements
+	})
+	measurements = nil
+	measureWith(pcr, func() (pcrExtender, error) {
+		return tpm, tpmErr
+	})
+}
+
+func sha256Sum(s string) []byte {
+	d := sha256.Sum256([]byte(s))
+	return d[:]
+}
+
+func sha1Sum(s string) []byte {
+	d := sha1.Sum([]byte(s))
+	return d[:]
+}
+
+func TestMeasureInto(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		version     tss.TPMVersion
+		pcr         int
+		dtb         string
+		sum         func(string) []byte
+		wantDigests []string
+		wantDescs   []string
+	}{
+		{
+			name:        "TPM 2.0",
+			version:     tss.TPMVersion20,
+			pcr:         9,
+			sum:         sha256Sum,
+			wantDigests: []string{"kernel", "initrd", "console=ttyS0"},
+			wantDescs:   []string{"kernel=", "initrd=", `cmdline="console=ttyS0"`},
+		},
+		{
+			name:        "TPM 1.2",
+			version:     tss.TPMVersion12,
+			pcr:         8,
+			sum:         sha1Sum,
+			wantDigests: []string{"kernel", "initrd", "console=ttyS0"},
+			wantDescs:   []string{"kernel=", "initrd=", `cmdline="console=ttyS0"`},
+		},
+		{
+			name:        "device tree",
+			version:     tss.TPMVersion20,
+			pcr:         9,
+			dtb:         "dtb",
+			sum:         sha256Sum,
+			wantDigests: []string{"kernel", "initrd", "dtb", "console=ttyS0"},
+			wantDescs:   []string{"kernel=", "initrd=", "dtb=", `cmdline="console=ttyS0"`},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockKexec(t, nil)
+			tpm := &fakeTPM{version: tt.version}
+			mockMeasure(t, tt.pcr, tpm, nil)
+
+			li := &LinuxImage{
+				Kernel:  strings.NewReader("kernel"),
+				Initrd:  strings.NewReader("initrd"),
+				Cmdline: "console=ttyS0",
+			}
+			if tt.dtb != "" {
+				li.KexecOpts.DTB = strings.NewReader(tt.dtb)
+			}
+			if err := li.Load(false); err != nil {
+				t.Fatalf("Load() = %v", err)
+			}
+
+			// The initrd may have the device tree appended, so only
+			// the other digests are known up front.
+			log := Measurements()
+			if len(tpm.extends) != len(tt.wantDigests) || len(log) != len(tt.wantDigests) {
+				t.Fatalf("Load() extended PCRs %d times and logged %+v, want %d entries", len(tpm.extends), log, len(tt.wantDigests))
+			}
+			for i, want := range tt.wantDigests {
+				got := tpm.extends[i]
+				if got.pcr != uint32(tt.pcr) {
+					t.Errorf("extension %d is of PCR %d, want %d", i, got.pcr, tt.pcr)
+				}
+				if want != "initrd" && !bytes.Equal(got.hash, tt.sum(want)) {
+					t.Errorf("extension %d = %x, want digest of %q", i, got.hash, want)
+				}
+				if log[i].PCR != tt.pcr || !bytes.Equal(log[i].Digest, got.hash) || !strings.HasPrefix(log[i].Description, tt.wantDescs[i]) {
+					t.Errorf("Measurements()[%d] = %+v, want %s entry with digest %x", i, log[i], tt.wantDescs[i], got.hash)
+				}
+			}
+			if !tpm.closed {
+				t.Errorf("Load() did not close the TPM")
+			}
+		})
+	}
+}
+
+func TestMeasureIntoWithoutTPM(t *testing.T) {
+	mockKexec(t, nil)
+	mockMeasure(t, 9, nil, errors.New("TPM device not available"))
+
+	li := &LinuxImage{Kernel: strings.NewReader("kernel")}
+	if err := li.Load(false); err != nil {
+		t.Fatalf("Load() without a TPM = %v, want nil", err)
+	}
+	if log := Measurements(); len(log) != 0 {
+		t.Errorf("Measurements() = %+v, want none", log)
+	}
+}
+
+func TestMeasureIntoOff(t *testing.T) {
+	mockKexec(t, nil)
+	tpm := &fakeTPM{version: tss.TPMVersion20}
+	mockMeasure(t, -1, tpm, nil)
+
+	li := &LinuxImage{Kernel: strings.NewReader("kernel")}
+	if err := li.Load(false); err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if len(tpm.extends) != 0 {
+		t.Errorf("Load() extended PCRs %d times, want 0", len(tpm.extends))
+	}
+}
@@ -7,6 +7,7 @@
 package menu
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
@@ -16,6 +17,7 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/sh"
@@ -27,6 +29,94 @@ var (
 	subsequentTimeout = 60 * time.Second
 )
 
+// Options configure how the menu is shown.
+type Options struct {
+	// Timeout, if positive, is how long a countdown to booting the
+	// default entry is shown before the user may choose an entry. Any key
+	// press stops the countdown.
+	//
+	// Otherwise, the default entry is booted if the user does not choose
+	// one within the initial timeout (see SetInitialTimeout).
+	Timeout time.Duration
+
+	// Default is the index of the entry booted if the user does not
+	// choose one, e.g. the default entry of a GRUB config. If that entry
+	// fails to load, or is not a default entry, the other default entries
+	// are tried in order.
+	Default int
+
+	// NoColor avoids ANSI escape sequences, e.g. clearing the screen or
+	// colors in entry titles.
+	NoColor bool
+
+	// Width, if positive, is the width of the terminal. Longer entry
+	// titles are wrapped.
+	Width int
+
+	// PlainASCII shows entry titles in printable ASCII only, e.g. for
+	// serial consoles. It implies NoColor.
+	PlainASCII bool
+
+	// In, if set, is read line by line for the user's input instead of
+	// the line-edited /dev/tty, e.g. to drive the menu over a serial pipe
+	// of a BMC.
+	In io.Reader
+
+	// Out is where the menu is written to. It defaults to os.Stdout.
+	Out io.Writer
+
+	// Progress, if set, renders the progress reported to it while the
+	// chosen entry loads, e.g. by a curl.HTTPClient fetching its kernel.
+	Progress *Progress
+}
+
+// out returns where the menu is written to.
+func (o Options) out() io.Writer {
+	if o.Out == nil {
+		return os.Stdout
+	}
+	return o.Out
+}
+
+// load loads e, rendering the progress of its downloads.
+func (o Options) load(e Entry) error {
+	if o.Progress != nil {
+		o.Progress.start(o.out(), o)
+		defer o.Progress.stop()
+	}
+	return e.Load()
+}
+
+// defaultOrder returns the entries to try booting if the user does not
+// choose one.
+func (o Options) defaultOrder(entries []Entry) []Entry {
+	var order []Entry
+	first := o.defaultIndex(entries)
+	if first >= 0 {
+		order = append(order, entries[first])
+	}
+	for i, e := range entries {
+		if i != first && e.IsDefault() && !isLocked(e) {
+			order = append(order, e)
+		}
+	}
+	return order
+}
+
+// defaultIndex returns the index of the first entry of defaultOrder, or -1
+// if there is none.
+func (o Options) defaultIndex(entries []Entry) int {
+	if o.Default >= 0 && o.Default < len(entries) && entries[o.Default].IsDefault() && !isLocked(entries[o.Default]) {
+		return o.Default
+	}
+	for i, e := range entries {
+		if e.IsDefault() && !isLocked(e) {
+			return i
+		}
+	}
+	return -1
+}
+
 // Entry is a menu entry.
 type Entry interface {
 	// Label is the string displayed to the user in the menu. It must be a
@@ -69,24 +159,86 @@ func parseBootNum(choice string, entries []Entry) (int, error) {
 	return num, nil
 }
 
+// filterEntries returns the entries whose label contains filter, ignoring
+// case.
+func filterEntries(entries []Entry, filter string) []Entry {
+	filter = strings.ToLower(filter)
+	var matches []Entry
+	for _, e := range entries {
+		if strings.Contains(strings.ToLower(e.Label()), filter) {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
 // SetInitialTimeout sets the initial timeout of the menu to the provided duration
 func SetInitialTimeout(timeout time.Duration) {
 	initialTimeout = timeout
 }
 
+// countdown counts down timeout to booting label on term, and returns
+// whether it elapsed without the user pressing a key.
+func countdown(term MenuTerminal, kw keyWaiter, label string, timeout time.Duration) bool {
+	defer fmt.Fprint(term, "\r\n")
+	for remaining := timeout; remaining > 0; remaining -= time.Second {
+		secs := (remaining + time.Second - 1) / time.Second
+		fmt.Fprintf(term, "\rBooting %s in %ds, press any key to choose another entry...", label, secs)
+
+		wait := time.Second
+		if remaining < wait {
+			wait = remaining
+		}
+		pressed, err := kw.WaitForKey(wait)
+		if err != nil {
+			fmt.Fprintf(term, "\r\nCannot read from terminal: %v", err)
+			return true
+		}
+		if pressed {
+			return false
+		}
+	}
+	return true
+}
+
 // Choose presents the user a menu on input to choose an entry from and returns that entry.
 // Note: This call can block if MenuTerminal or the underlying os.File does
 //       not support SetTimeout/SetDeadline.
 func Choose(term MenuTerminal, allowEdit bool, entries ...Entry) Entry {
-	fmt.Println("")
-	for i, e := range entries {
-		fmt.Printf("%02d. %s\r\n\r\n", i+1, e.Label())
+	return choose(term, Options{}, allowEdit, entries...)
+}
+
+// choose is Choose, showing a countdown to booting the default entry first
+// if opts.Timeout is set and term supports it. If term can read single
+// keys, the user may also select an entry with the arrow keys or j and k
+// and boot it with Enter.
+func choose(term MenuTerminal, opts Options, allowEdit bool, entries ...Entry) Entry {
+	out := opts.out()
+	fmt.Fprintln(out, "")
+
+	// If the terminal can read single keys, the user may also move a
+	// highlight over the entries, which are then drawn by selectEntry.
+	kr, nav := term.(keyReader)
+	nav = nav && kr.readsKeys()
+	kw, wait := term.(keyWaiter)
+	order := opts.defaultOrder(entries)
+	wait = wait && opts.Timeout > 0 && len(order) > 0
+	if !nav || wait {
+		renderEntries(out, opts, entries)
+		fmt.Fprintln(out, "\r")
+	}
+
+	timeout := initialTimeout
+	if wait {
+		if countdown(term, kw, opts.label(order[0].Label()), opts.Timeout) {
+			return nil
+		}
+		timeout = subsequentTimeout
 	}
-	fmt.Println("\r")
 
-	err := term.SetTimeout(initialTimeout)
+	err := term.SetTimeout(timeout)
 	if err != nil {
-		fmt.Printf("BUG: terminal does not support timeouts: %v\n", err)
+		fmt.Fprintf(out, "BUG: terminal does not support timeouts: %v\n", err)
 	}
 
 	// Reset the countdown timer when you press a key.
@@ -94,21 +246,66 @@ func Choose(term MenuTerminal, allowEdit bool, entries ...Entry) Entry {
 		_ = term.SetTimeout(subsequentTimeout)
 	})
 
+	// The highlighted entry starts out as the default entry.
+	sel := &selection{entries: entries, visible: entries}
+	defaultIndex := opts.defaultIndex(entries)
+	if defaultIndex >= 0 {
+		sel.selected = defaultIndex
+	}
 	for {
-		if allowEdit {
-			term.SetPrompt("Enter an option ('01' is the default, 'e' to edit kernel cmdline):\r\n > ")
+		if allowEdit && hasOverlay(entries) {
+			term.SetPrompt("Enter an option ('01' is the default, 'e' to edit kernel cmdline, 'o' to toggle initrd overlay, '/text' to filter):\r\n > ")
+		} else if allowEdit {
+			term.SetPrompt("Enter an option ('01' is the default, 'e' to edit kernel cmdline, '/text' to filter):\r\n > ")
 		} else {
-			term.SetPrompt("Enter an option ('01' is the default):\r\n > ")
+			term.SetPrompt("Enter an option ('01' is the default, '/text' to filter):\r\n > ")
+		}
+
+		if nav && len(sel.visible) > 0 {
+			chosen, err := selectEntry(out, kr, opts, sel, func() {
+				_ = term.SetTimeout(subsequentTimeout)
+			})
+			if err != nil {
+				if text := err.Error(); !strings.Contains(text, os.ErrDeadlineExceeded.Error()) && err != io.EOF {
+					fmt.Fprintf(out, "BUG: Please report: Terminal read error: %v.\n", err)
+				}
+				return nil
+			}
+			if chosen {
+				if len(sel.visible) == len(entries) && sel.selected == defaultIndex {
+					// nil will result in the default order.
+					return nil
+				}
+				if !unlock(term, sel.visible[sel.selected]) {
+					fmt.Fprintln(term, "Returning to main menu...")
+					continue
+				}
+				return sel.visible[sel.selected]
+			}
+			// The user started typing an option.
 		}
 
 		choice, err := term.ReadLine()
 		if err != nil {
 			if text := err.Error(); !strings.Contains(text, os.ErrDeadlineExceeded.Error()) && err != io.EOF {
-				fmt.Printf("BUG: Please report: Terminal read error: %v.\n", err)
+				fmt.Fprintf(out, "BUG: Please report: Terminal read error: %v.\n", err)
 			}
 			return nil
 		}
 
+		if filter := strings.TrimPrefix(choice, "/"); filter != choice {
+			// Filter entries, for terminals that cannot read single
+			// keys. An empty filter shows all entries again.
+			sel.setFilter(filter)
+			fmt.Fprintln(out, "\r")
+			if len(sel.visible) == 0 {
+				fmt.Fprintf(out, "No entries match %q\r\n\r\n", filter)
+			} else if !nav {
+				renderEntries(out, opts, sel.visible)
+			}
+			continue
+		}
+
 		if allowEdit && choice == "e" {
 			// Edit command line.
 			term.SetPrompt("Select a boot option to edit:\r\n > ")
@@ -118,22 +315,34 @@ func Choose(term MenuTerminal, allowEdit bool, entries ...Entry) Entry {
 				fmt.Fprintln(term, "Returning to main menu...")
 				continue
 			}
-			num, err := parseBootNum(choice, entries)
+			num, err := parseBootNum(choice, sel.visible)
 			if err != nil {
 				fmt.Fprintln(term, err)
 				fmt.Fprintln(term, "Returning to main menu...")
 				continue
 			}
-			entries[num-1].Edit(func(cmdline string) string {
+			if !unlock(term, sel.visible[num-1]) {
+				fmt.Fprintln(term, "Returning to main menu...")
+				continue
+			}
+			var bootNow bool
+			sel.visible[num-1].Edit(func(cmdline string) string {
 				fmt.Fprintf(term, "The current quoted cmdline for option %d is:\r\n > %q\r\n", num, cmdline)
 				fmt.Fprintln(term, ` * Note the cmdline is c-style quoted. Ex: \n => newline, \\ => \`)
-				term.SetPrompt("Enter an option:\r\n * (a)ppend, (o)verwrite, (r)eturn to main menu\r\n > ")
+				term.SetPrompt("Enter an option:\r\n * (a)ppend, (o)verwrite, (e)dit in place, (r)eturn to main menu\r\n > ")
 				choice, err := term.ReadLine()
 				if err != nil {
 					fmt.Fprintln(term, err)
 					return cmdline
 				}
 				switch choice {
+				case "e":
+					newCmdline, boot, ok := editInPlace(term, cmdline)
+					if !ok {
+						fmt.Fprintf(term, "Keeping the cmdline of option %d\r\n", num)
+						return cmdline
+					}
+					cmdline, bootNow = newCmdline, boot
 				case "a":
 					term.SetPrompt("Enter unquoted cmdline to append:\r\n > ")
 					appendCmdline, err := term.ReadLine()
@@ -159,6 +368,14 @@ func Choose(term MenuTerminal, allowEdit bool, entries ...Entry) Entry {
 				fmt.Fprintf(term, "The new quoted cmdline for option %d is:\r\n > %q\r\n", num, cmdline)
 				return cmdline
 			})
+			if bootNow {
+				return sel.visible[num-1]
+			}
+			fmt.Fprintln(term, "Returning to main menu...")
+			continue
+		}
+		if allowEdit && choice == "o" && hasOverlay(entries) {
+			toggleOverlay(term, sel.visible)
 			fmt.Fprintln(term, "Returning to main menu...")
 			continue
 		}
@@ -166,18 +383,238 @@ func Choose(term MenuTerminal, allowEdit bool, entries ...Entry) Entry {
 			// nil will result in the default order.
 			return nil
 		}
-		num, err := parseBootNum(choice, entries)
+		num, err := parseBootNum(choice, sel.visible)
 		if err != nil {
 			fmt.Fprintln(term, err)
 			continue
 		}
-		return entries[num-1]
+		if !unlock(term, sel.visible[num-1]) {
+			fmt.Fprintln(term, "Returning to main menu...")
+			continue
+		}
+		return sel.visible[num-1]
+	}
+}
+
+// Overlayable is implemented by entries with an initrd overlay the user can
+// enable or disable in the menu, e.g. a local archive with debugging tools.
+// See boot.LinuxImage.Overlay.
+type Overlayable interface {
+	// HasOverlay returns whether the entry has an overlay to toggle.
+	HasOverlay() bool
+
+	// OverlayEnabled returns whether the overlay is appended to the
+	// initrd when the entry is loaded.
+	OverlayEnabled() bool
+
+	// EnableOverlay enables or disables the overlay. Must be called
+	// prior to Load.
+	EnableOverlay(enabled bool)
+}
+
+// overlayable returns e as an Overlayable if it has an overlay.
+func overlayable(e Entry) (Overlayable, bool) {
+	o, ok := e.(Overlayable)
+	return o, ok && o.HasOverlay()
+}
+
+// hasOverlay returns whether any of entries has an overlay.
+func hasOverlay(entries []Entry) bool {
+	for _, e := range entries {
+		if _, ok := overlayable(e); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toggleOverlay asks the user for an entry of visible and enables its
+// overlay if it was disabled, or disables it otherwise.
+func toggleOverlay(term MenuTerminal, visible []Entry) {
+	term.SetPrompt("Select a boot option to toggle the initrd overlay of:\r\n > ")
+	choice, err := term.ReadLine()
+	if err != nil {
+		fmt.Fprintln(term, err)
+		return
+	}
+	num, err := parseBootNum(choice, visible)
+	if err != nil {
+		fmt.Fprintln(term, err)
+		return
+	}
+	o, ok := overlayable(visible[num-1])
+	if !ok {
+		fmt.Fprintf(term, "Option %d has no initrd overlay\r\n", num)
+		return
+	}
+	if !unlock(term, visible[num-1]) {
+		return
+	}
+	o.EnableOverlay(!o.OverlayEnabled())
+	state := "disabled"
+	if o.OverlayEnabled() {
+		state = "enabled"
+	}
+	fmt.Fprintf(term, "The initrd overlay of option %d is %s\r\n", num, state)
+}
+
+// navHint tells the user how to move the highlight drawn by selectEntry.
+const navHint = "Use the arrow keys or j/k to select an entry and Enter to boot it, / to filter, or type an option.\r\n"
+
+// selection is the part of the menu entries shown by selectEntry.
+type selection struct {
+	entries []Entry
+
+	// filter is what the entries shown are filtered by.
+	filter string
+
+	// visible are the entries matching filter, numbered as shown to the
+	// user. selected is the index of the highlighted one of them.
+	visible  []Entry
+	selected int
+}
+
+// setFilter shows the entries matching filter, highlighting the first one.
+func (s *selection) setFilter(filter string) {
+	s.filter = filter
+	s.visible = filterEntries(s.entries, filter)
+	s.selected = 0
+}
+
+// hint returns the line shown below the entries.
+func (s *selection) hint(filtering bool) string {
+	switch {
+	case !filtering:
+		return navHint
+	case len(s.visible) == 0:
+		return fmt.Sprintf("No entries match %q. Use Backspace to widen the filter.\r\n", s.filter)
+	}
+	return fmt.Sprintf("Filter: %s (type to narrow, Backspace to widen, Enter to boot)\r\n", s.filter)
+}
+
+// selectEntry draws the visible entries of sel with the selected one
+// highlighted, and lets the user move the highlight with the arrow keys or j
+// and k, calling onKey for every key pressed.
+//
+// After '/', typed keys narrow the entries shown to those whose label
+// contains the typed text, renumbering them, and Backspace widens them
+// again, until the filter is empty and Backspace is pressed once more.
+//
+// selectEntry returns true when the user presses Enter, and false when the
+// user starts typing an option instead, with the typed key left for the
+// next term.ReadLine.
+func selectEntry(out io.Writer, kr keyReader, opts Options, sel *selection, onKey func()) (bool, error) {
+	if sel.selected >= len(sel.visible) {
+		sel.selected = len(sel.visible) - 1
+	}
+	filtering := false
+	lines := drawSelection(out, opts, sel.visible, sel.selected, sel.hint(filtering), 0)
+	for {
+		key, err := kr.ReadKey()
+		if err != nil {
+			return false, err
+		}
+		onKey()
+
+		switch {
+		case key == keyUp || !filtering && key == 'k':
+			if sel.selected <= 0 {
+				continue
+			}
+			sel.selected--
+		case key == keyDown || !filtering && key == 'j':
+			if sel.selected >= len(sel.visible)-1 {
+				continue
+			}
+			sel.selected++
+		case key == '\r':
+			if len(sel.visible) == 0 {
+				continue
+			}
+			return true, nil
+		case filtering && (key == keyBackspace || key == keyCtrlH):
+			if sel.filter == "" {
+				filtering = false
+				break
+			}
+			r := []rune(sel.filter)
+			sel.setFilter(string(r[:len(r)-1]))
+		case filtering && key < keyUp && unicode.IsPrint(key):
+			sel.setFilter(sel.filter + string(key))
+		case key == '/':
+			filtering = true
+		case key < keyUp && unicode.IsPrint(key):
+			kr.UnreadKey(key)
+			return false, nil
+		default:
+			continue
+		}
+		lines = drawSelection(out, opts, sel.visible, sel.selected, sel.hint(filtering), lines)
 	}
 }
 
+// drawSelection writes entries with the selected one highlighted and the
+// hint, and returns the number of lines written. The previous drawing of
+// redraw lines is overwritten, unless opts asks for no ANSI escape
+// sequences, in which case the entries are written below it.
+func drawSelection(w io.Writer, opts Options, entries []Entry, selected int, hint string, redraw int) int {
+	var b bytes.Buffer
+	renderSelection(&b, opts, entries, selected)
+	b.WriteString(hint)
+	if redraw > 0 && !opts.NoColor && !opts.PlainASCII {
+		// Move the cursor up to the first line drawn before, and clear
+		// the previous drawing, which may have had more entries.
+		fmt.Fprintf(w, "\r\033[%dA\033[J", redraw)
+	}
+	w.Write(b.Bytes())
+	return bytes.Count(b.Bytes(), []byte("\n"))
+}
+
+// editInPlace lets the user edit cmdline, prefilled with its current value
+// if the terminal supports it. ok is false if the user cancelled the edit;
+// boot is true if the user wants to boot with the new cmdline right away.
+func editInPlace(term MenuTerminal, cmdline string) (newCmdline string, boot bool, ok bool) {
+	term.SetPrompt("Edit the unquoted cmdline:\r\n > ")
+	var err error
+	if ld, ok := term.(lineDefaulter); ok {
+		newCmdline, err = ld.ReadLineWithDefault(cmdline)
+	} else {
+		newCmdline, err = term.ReadLine()
+	}
+	if err != nil {
+		fmt.Fprintln(term, err)
+		return cmdline, false, false
+	}
+
+	term.SetPrompt("Enter an option:\r\n * (b)oot now, (s)ave and return to main menu, (c)ancel\r\n > ")
+	choice, err := term.ReadLine()
+	if err != nil {
+		fmt.Fprintln(term, err)
+		return cmdline, false, false
+	}
+	switch choice {
+	case "b":
+		return newCmdline, true, true
+	case "s":
+		return newCmdline, false, true
+	}
+	return cmdline, false, false
+}
+
 // ShowMenuAndLoad calls showMenuAndLoadFromFile using the default tty.
 // Use TTY because os.stdin does not support deadlines well.
 func ShowMenuAndLoad(allowEdit bool, entries ...Entry) Entry {
+	return ShowMenuAndLoadWithOptions(Options{}, allowEdit, entries...)
+}
+
+// ShowMenuAndLoadWithOptions is like ShowMenuAndLoad, but shows the menu as
+// configured by opts.
+func ShowMenuAndLoadWithOptions(opts Options, allowEdit bool, entries ...Entry) Entry {
+	if opts.In != nil {
+		t := newStreamTerminal(opts.In, opts.out())
+		return showMenuAndLoad(func() MenuTerminal { return t }, opts, allowEdit, entries...)
+	}
+
 	f, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
 		log.Printf("Failed to open /dev/tty: %s\n", err)
@@ -185,7 +622,7 @@ func ShowMenuAndLoad(allowEdit bool, entries ...Entry) Entry {
 	}
 	defer f.Close()
 
-	return showMenuAndLoadFromFile(f, allowEdit, entries...)
+	return showMenuAndLoadFromFile(f, opts, allowEdit, entries...)
 }
 
 // showMenuAndLoadFromFile lets the user choose one of entries and loads it.
@@ -193,19 +630,29 @@ func ShowMenuAndLoad(allowEdit bool, entries ...Entry) Entry {
 // returned.
 //
 // The user is left to call Entry.Exec when this function returns.
-func showMenuAndLoadFromFile(file *os.File, allowEdit bool, entries ...Entry) Entry {
-	// Clear the screen (ANSI terminal escape code for screen clear).
-	fmt.Printf("\033[1;1H\033[2J\n\n")
-	fmt.Printf("Welcome to LinuxBoot's Menu\n\n")
-	fmt.Printf("Enter a number to boot a kernel:\n")
+func showMenuAndLoadFromFile(file *os.File, opts Options, allowEdit bool, entries ...Entry) Entry {
+	return showMenuAndLoad(func() MenuTerminal { return NewTerminal(file) }, opts, allowEdit, entries...)
+}
+
+// showMenuAndLoad is showMenuAndLoadFromFile, using a terminal made by
+// newTerm every time the user is asked to choose.
+func showMenuAndLoad(newTerm func() MenuTerminal, opts Options, allowEdit bool, entries ...Entry) Entry {
+	out := opts.out()
+	if !opts.NoColor && !opts.PlainASCII {
+		// Clear the screen (ANSI terminal escape code for screen clear).
+		fmt.Fprintf(out, "\033[1;1H\033[2J\n\n")
+	}
+	fmt.Fprintf(out, "Welcome to LinuxBoot's Menu\n\n")
+	fmt.Fprintf(out, "Enter a number to boot a kernel:\n")
 
 	for {
-		t := NewTerminal(file)
+		t := newTerm()
 		// Allow the user to choose.
-		entry := Choose(t, allowEdit, entries...)
+		entry := choose(t, opts, allowEdit, entries...)
+		// The countdown is only shown the first time.
+		opts.Timeout = 0
 		if err := t.Close(); err != nil {
-			log.Printf("Failed to close terminal made from file %s "+
-				"(desc %d): %v", file.Name(), file.Fd(), err)
+			log.Printf("Failed to close terminal: %v", err)
 		}
 
 		if entry == nil {
@@ -215,7 +662,7 @@ func showMenuAndLoadFromFile(file *os.File, allowEdit bool, entries ...Entry) En
 			// If nothing was entered, fall back to default.
 			break
 		}
-		if err := entry.Load(); err != nil {
+		if err := opts.load(entry); err != nil {
 			log.Printf("Failed to load %s: %v", entry.Label(), err)
 			continue
 		}
@@ -226,27 +673,25 @@ func showMenuAndLoadFromFile(file *os.File, allowEdit bool, entries ...Entry) En
 		return entry
 	}
 
-	fmt.Println("")
+	fmt.Fprintln(out, "")
 
 	// We only get one shot at actually booting, so boot the first kernel
 	// that can be loaded correctly.
-	for _, e := range entries {
-		// Only perform actions that are default actions. I.e. don't
-		// drop to shell.
-		if e.IsDefault() {
-			fmt.Printf("Attempting to boot %s.\n\n", ExtendedLabel(e))
-
-			if err := e.Load(); err != nil {
-				log.Printf("Failed to load %s: %v", e.Label(), err)
-				continue
-			}
+	//
+	// Only perform actions that are default actions. I.e. don't drop to
+	// shell.
+	for _, e := range opts.defaultOrder(entries) {
+		fmt.Fprintf(out, "Attempting to boot %s.\n\n", ExtendedLabel(e))
 
-			// Entry was successfully loaded. Leave it to the
-			// caller to exec, so the caller can clean up the OS
-			// before rebooting or kexecing (e.g. unmount file
-			// systems).
-			return e
+		if err := opts.load(e); err != nil {
+			log.Printf("Failed to load %s: %v", e.Label(), err)
+			continue
 		}
+
+		// Entry was successfully loaded. Leave it to the caller to
+		// exec, so the caller can clean up the OS before rebooting or
+		// kexecing (e.g. unmount file systems).
+		return e
 	}
 	return nil
 }
@@ -271,12 +716,43 @@ type OSImageAction struct {
 
 // Load implements Entry.Load by loading the OS image into memory.
 func (oia OSImageAction) Load() error {
-	if err := oia.OSImage.Load(oia.Verbose); err != nil {
+	if err := boot.Stage(oia.OSImage, oia.Verbose); err != nil {
 		return fmt.Errorf("could not load image %s: %v", oia.OSImage, err)
 	}
 	return nil
 }
 
+// Image returns the OS image the entry boots.
+func (oia OSImageAction) Image() boot.OSImage {
+	return oia.OSImage
+}
+
+// linuxOverlay returns the image if it is a Linux image with an overlay.
+func (oia OSImageAction) linuxOverlay() (*boot.LinuxImage, bool) {
+	li, ok := oia.OSImage.(*boot.LinuxImage)
+	return li, ok && li.Overlay != nil
+}
+
+// HasOverlay implements Overlayable.
+func (oia OSImageAction) HasOverlay() bool {
+	_, ok := oia.linuxOverlay()
+	return ok
+}
+
+// OverlayEnabled implements Overlayable.
+func (oia OSImageAction) OverlayEnabled() bool {
+	li, ok := oia.linuxOverlay()
+	return ok && li.UseOverlay
+}
+
+// EnableOverlay implements Overlayable. It does nothing if the image has no
+// overlay.
+func (oia OSImageAction) EnableOverlay(enabled bool) {
+	if li, ok := oia.linuxOverlay(); ok {
+		li.UseOverlay = enabled
+	}
+}
+
 // Exec executes the loaded image.
 func (oia OSImageAction) Exec() error {
 	return boot.Execute()
@@ -287,7 +763,16 @@ func (oia OSImageAction) Exec() error {
 func (OSImageAction) IsDefault() bool { return true }
 
 // StartShell is a menu.Entry that starts a LinuxBoot shell.
-type StartShell struct{}
+type StartShell struct {
+	// Hash, if set, is the bcrypt hash of the password needed to start
+	// the shell.
+	Hash string
+}
+
+// PasswordHash implements Locked.
+func (s StartShell) PasswordHash() string {
+	return s.Hash
+}
 
 // Label is the label to show to the user.
 func (StartShell) Label() string {
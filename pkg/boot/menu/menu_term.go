@@ -5,12 +5,18 @@
 package menu
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/term"
 )
@@ -24,7 +30,60 @@ type MenuTerminal interface {
 	Close() error
 }
 
-var _ = MenuTerminal(&xterm{})
+// lineDefaulter is implemented by terminals that can prefill the line the
+// user edits.
+type lineDefaulter interface {
+	// ReadLineWithDefault is like ReadLine, but the line initially
+	// contains def.
+	ReadLineWithDefault(def string) (string, error)
+}
+
+// keyWaiter is implemented by terminals that can wait for a key press.
+type keyWaiter interface {
+	// WaitForKey waits up to timeout for a key press, and returns
+	// whether there was one. The key is still returned by the next
+	// ReadLine.
+	WaitForKey(timeout time.Duration) (bool, error)
+}
+
+// keyReader is implemented by terminals that can read single key presses,
+// e.g. to move a highlight over the entries with the arrow keys.
+type keyReader interface {
+	// readsKeys returns whether keys can be read one at a time, which
+	// needs the input to be a terminal in raw mode.
+	readsKeys() bool
+
+	// ReadKey returns the next key pressed, or keyUp or keyDown for the
+	// arrow keys.
+	ReadKey() (rune, error)
+
+	// UnreadKey makes key the start of the line read by the next
+	// ReadLine.
+	UnreadKey(key rune)
+}
+
+// Keys returned by ReadKey that are not typed characters.
+const (
+	keyUp rune = utf8.MaxRune + 1 + iota
+	keyDown
+	keyUnknown
+)
+
+// Control characters returned by ReadKey.
+const (
+	keyCtrlH     = 0x08
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+)
+
+var (
+	_ = MenuTerminal(&xterm{})
+	_ = lineDefaulter(&xterm{})
+	_ = keyWaiter(&xterm{})
+	_ = keyReader(&xterm{})
+	_ = MenuTerminal(&streamTerminal{})
+	_ = keyWaiter(&streamTerminal{})
+)
 
 // xterm is a wrapper for term.Terminal following the MenuTerminal interface
 type xterm struct {
@@ -32,6 +91,29 @@ type xterm struct {
 	// Save variables needed to close the xterm
 	fileInput *os.File
 	oldState  *term.State
+
+	input *prefillInput
+}
+
+// prefillInput is the input of an xterm. It returns pending bytes before
+// reading from the file, as if the user had typed them.
+type prefillInput struct {
+	*os.File
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (in *prefillInput) Read(p []byte) (int, error) {
+	in.mu.Lock()
+	if len(in.pending) > 0 {
+		n := copy(p, in.pending)
+		in.pending = in.pending[n:]
+		in.mu.Unlock()
+		return n, nil
+	}
+	in.mu.Unlock()
+	return in.File.Read(p)
 }
 
 // NewTerminal opens an xTerminal using the given file input.
@@ -58,13 +140,136 @@ func NewTerminal(f *os.File) *xterm {
 		log.Printf("BUG: Error setting Fd %d to nonblocking: %v", f.Fd(), err)
 	}
 
+	in := &prefillInput{File: f}
 	return &xterm{
-		*term.NewTerminal(f, ""),
+		*term.NewTerminal(in, ""),
 		f,
 		oldState,
+		in,
 	}
 }
 
+// ReadLineWithDefault implements lineDefaulter by feeding def to the
+// terminal as input, so the user can edit it with the usual line editing
+// keys.
+func (t *xterm) ReadLineWithDefault(def string) (string, error) {
+	// Only printable characters are inserted into the line. Anything
+	// else, e.g. a newline, would be interpreted as a key press.
+	def = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, def)
+
+	t.input.mu.Lock()
+	t.input.pending = []byte(def)
+	t.input.mu.Unlock()
+	return t.ReadLine()
+}
+
+// WaitForKey implements keyWaiter by reading a single key from the file,
+// and feeding it back to the terminal as input.
+func (t *xterm) WaitForKey(timeout time.Duration) (bool, error) {
+	if err := t.fileInput.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+	var key [1]byte
+	n, err := t.fileInput.Read(key[:])
+	if n > 0 {
+		t.input.mu.Lock()
+		t.input.pending = append(t.input.pending, key[:n]...)
+		t.input.mu.Unlock()
+		return true, nil
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return false, nil
+	}
+	return false, err
+}
+
+// readsKeys implements keyReader. Keys can only be read if the file is a
+// terminal that could be put in raw mode.
+func (t *xterm) readsKeys() bool {
+	return t.oldState != nil
+}
+
+// ReadKey implements keyReader by reading the key from the file, or the
+// key pressed during WaitForKey.
+func (t *xterm) ReadKey() (rune, error) {
+	return readKey(t.input)
+}
+
+// UnreadKey implements keyReader by feeding key back to the terminal as
+// input.
+func (t *xterm) UnreadKey(key rune) {
+	t.input.mu.Lock()
+	t.input.pending = append([]byte(string(key)), t.input.pending...)
+	t.input.mu.Unlock()
+}
+
+// readKey reads a single key press from r. The escape sequences sent by
+// VT100-compatible terminals for the up and down arrow keys are returned
+// as keyUp and keyDown, and other escape sequences as keyUnknown. Bytes
+// are read one at a time, so a sequence split over several reads, e.g.
+// on a slow serial link, is still decoded.
+func readKey(r io.Reader) (rune, error) {
+	b, err := readByte(r)
+	if err != nil {
+		return 0, err
+	}
+	if b == keyEscape {
+		return readEscape(r)
+	}
+	buf := []byte{b}
+	for !utf8.FullRune(buf) {
+		b, err := readByte(r)
+		if err != nil {
+			return 0, err
+		}
+		buf = append(buf, b)
+	}
+	key, _ := utf8.DecodeRune(buf)
+	return key, nil
+}
+
+// readEscape reads the rest of an escape sequence after the escape byte.
+// Cursor keys are sent as "[A" or, in application mode, as "OA".
+func readEscape(r io.Reader) (rune, error) {
+	b, err := readByte(r)
+	if err != nil {
+		return 0, err
+	}
+	if b != '[' && b != 'O' {
+		return keyUnknown, nil
+	}
+	// Parameter and intermediate bytes, e.g. of "[1;5A", precede the
+	// final byte of the sequence.
+	for {
+		if b, err = readByte(r); err != nil {
+			return 0, err
+		}
+		if b >= 0x40 && b <= 0x7e {
+			break
+		}
+	}
+	switch b {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	}
+	return keyUnknown, nil
+}
+
+func readByte(r io.Reader) (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
 func (t *xterm) Close() error {
 	if t.oldState == nil {
 		return fmt.Errorf("cannot restore terminal state to nil")
@@ -83,3 +288,150 @@ func (t *xterm) SetEntryCallback(f func()) {
 		return "", 0, false
 	}
 }
+
+// streamTerminal is a MenuTerminal reading whole lines from an io.Reader,
+// without any line editing, and writing to an io.Writer.
+type streamTerminal struct {
+	w  io.Writer
+	in *lineReader
+
+	// pending is a line that was already read by WaitForKey.
+	pending *string
+
+	prompt   string
+	deadline time.Time
+	onEntry  func()
+}
+
+// lineReader reads lines from an io.Reader in the background, as they
+// become available, until the reader returns an error.
+type lineReader struct {
+	// lines are the lines read. err is why reading stopped, and is set
+	// before lines is closed.
+	lines chan string
+	err   error
+}
+
+// lineReaders are the lineReaders of the inputs of stream terminals. All
+// terminals reading the same input share one, so that a line read in the
+// background is not lost when another menu is shown, e.g. after the chosen
+// entry failed to boot.
+var (
+	lineReadersMu sync.Mutex
+	lineReaders   = map[io.Reader]*lineReader{}
+)
+
+// readLines returns the lineReader of r, starting one if there is none.
+func readLines(r io.Reader) *lineReader {
+	// Readers that cannot be map keys cannot be shared.
+	shared := reflect.TypeOf(r).Comparable()
+	if shared {
+		lineReadersMu.Lock()
+		defer lineReadersMu.Unlock()
+		if lr, ok := lineReaders[r]; ok {
+			return lr
+		}
+	}
+
+	lr := &lineReader{lines: make(chan string)}
+	if shared {
+		lineReaders[r] = lr
+	}
+	go func() {
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			lr.lines <- strings.TrimSuffix(s.Text(), "\r")
+		}
+		lr.err = s.Err()
+		if lr.err == nil {
+			lr.err = io.EOF
+		}
+		if shared {
+			lineReadersMu.Lock()
+			delete(lineReaders, r)
+			lineReadersMu.Unlock()
+		}
+		close(lr.lines)
+	}()
+	return lr
+}
+
+// newStreamTerminal returns a terminal reading lines from r, sharing them
+// with the other terminals reading r.
+func newStreamTerminal(r io.Reader, w io.Writer) *streamTerminal {
+	return &streamTerminal{
+		w:  w,
+		in: readLines(r),
+	}
+}
+
+// next returns the next line, waiting for it until deadline if it is set.
+func (t *streamTerminal) next(deadline time.Time) (string, error) {
+	if t.pending != nil {
+		line := *t.pending
+		t.pending = nil
+		return line, nil
+	}
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case line, ok := <-t.in.lines:
+		if !ok {
+			return "", t.in.err
+		}
+		if t.onEntry != nil {
+			t.onEntry()
+		}
+		return line, nil
+	case <-timeout:
+		return "", os.ErrDeadlineExceeded
+	}
+}
+
+func (t *streamTerminal) Write(p []byte) (int, error) {
+	return t.w.Write(p)
+}
+
+func (t *streamTerminal) ReadLine() (string, error) {
+	fmt.Fprint(t.w, t.prompt)
+	line, err := t.next(t.deadline)
+	fmt.Fprint(t.w, "\r\n")
+	return line, err
+}
+
+// WaitForKey implements keyWaiter. As there is no line editing, a whole
+// line has to be entered to stop waiting.
+func (t *streamTerminal) WaitForKey(timeout time.Duration) (bool, error) {
+	line, err := t.next(time.Now().Add(timeout))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	t.pending = &line
+	return true, nil
+}
+
+func (t *streamTerminal) SetPrompt(prompt string) {
+	t.prompt = prompt
+}
+
+func (t *streamTerminal) SetEntryCallback(f func()) {
+	t.onEntry = f
+}
+
+func (t *streamTerminal) SetTimeout(dur time.Duration) error {
+	t.deadline = time.Now().Add(dur)
+	return nil
+}
+
+// Close does nothing, so that the terminal can be used for several menus.
+func (t *streamTerminal) Close() error {
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadKey(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		input string
+		want  []rune
+	}{
+		{name: "characters", input: "1j\r", want: []rune{'1', 'j', '\r'}},
+		{name: "utf-8", input: "é", want: []rune{'é'}},
+		{name: "arrow keys", input: "\x1b[A\x1b[B", want: []rune{keyUp, keyDown}},
+		{name: "application mode", input: "\x1bOA\x1bOB", want: []rune{keyUp, keyDown}},
+		{name: "with parameters", input: "\x1b[1;5B", want: []rune{keyDown}},
+		{name: "other sequences", input: "\x1b[C\x1b[5~\x1bx1", want: []rune{keyUnknown, keyUnknown, keyUnknown, '1'}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Keys are read one byte at a time, as on a slow serial
+			// link.
+			r := iotest.OneByteReader(strings.NewReader(tt.input))
+			var got []rune
+			for {
+				key, err := readKey(r)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("readKey() = %v", err)
+				}
+				got = append(got, key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadKeyTruncated(t *testing.T) {
+	for _, input := range []string{"\x1b", "\x1b[", "\x1b[1;", "\xc3"} {
+		if _, err := readKey(strings.NewReader(input)); err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.Errorf("readKey(%q) = %v, want EOF", input, err)
+		}
+	}
+}
@@ -5,14 +5,19 @@
 package menu
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/creack/pty"
+	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/testutil"
 )
 
@@ -210,6 +215,34 @@ func TestChoose(t *testing.T) {
 			expectedCmds:   []string{"before", "before", "before"},
 			wantedEntry:    1, // Edit attempt is parsed as a boot choice
 		},
+		{
+			name:           "edit_in_place_and_boot",
+			userEntry:      getInPlaceEditSequence("2", "before rd.break", "b"),
+			editingAllowed: true,
+			expectedCmds:   []string{"before", "before rd.break", "before"},
+			wantedEntry:    2,
+		},
+		{
+			name:           "edit_in_place_and_save",
+			userEntry:      getInPlaceEditSequence("2", "before rd.break", "s"),
+			editingAllowed: true,
+			expectedCmds:   []string{"before", "before rd.break", "before"},
+			wantedEntry:    -1, // expect nil
+		},
+		{
+			name:           "edit_in_place_cancelled",
+			userEntry:      getInPlaceEditSequence("2", "before rd.break", "c"),
+			editingAllowed: true,
+			expectedCmds:   []string{"before", "before", "before"},
+			wantedEntry:    -1, // expect nil
+		},
+		{
+			name:           "edit_in_place_fail_reading",
+			userEntry:      errorOn(3, getInPlaceEditSequence("2", "before rd.break", "b")),
+			editingAllowed: true,
+			expectedCmds:   []string{"before", "before", "before"},
+			wantedEntry:    -1, // expect nil
+		},
 		{
 			name:           "edit_fail_reading_1",
 			userEntry:      errorOn(1, getEditSequence(false, "1", "after")),
@@ -290,6 +323,7 @@ func TestShowMenuAndLoadFromFile(t *testing.T) {
 	tests := []struct {
 		name      string
 		entries   []*testEntry
+		opts      Options
 		userEntry []byte
 
 		// calledLabels are the entries for which Do was called.
@@ -359,6 +393,50 @@ func TestShowMenuAndLoadFromFile(t *testing.T) {
 			userEntry:    []byte{},
 			calledLabels: []string{"1"},
 		},
+		{
+			name: "countdown_boots_default_index",
+			entries: []*testEntry{
+				{label: "1", isDefault: true, load: nil},
+				{label: "2", isDefault: true, load: nil},
+			},
+			opts: Options{Timeout: time.Second, Default: 1},
+			// No input
+			userEntry:    []byte{},
+			calledLabels: []string{"2"},
+		},
+		{
+			name: "countdown_interrupted",
+			entries: []*testEntry{
+				{label: "1", isDefault: true, load: nil},
+				{label: "2", isDefault: true, load: nil},
+				{label: "3", isDefault: true, load: nil},
+			},
+			opts: Options{Timeout: 2 * time.Second},
+			// The key stopping the countdown is part of the choice.
+			userEntry:    []byte("3\r\n"),
+			calledLabels: []string{"3"},
+		},
+		{
+			name: "arrow_keys",
+			entries: []*testEntry{
+				{label: "1", isDefault: true, load: nil},
+				{label: "2", isDefault: true, load: nil},
+				{label: "3", isDefault: true, load: nil},
+			},
+			userEntry:    []byte("\x1b[B\x1b[B\x1b[A\r"),
+			calledLabels: []string{"2"},
+		},
+		{
+			name: "countdown_interrupted_by_arrow_key",
+			entries: []*testEntry{
+				{label: "1", isDefault: true, load: nil},
+				{label: "2", isDefault: true, load: nil},
+				{label: "3", isDefault: true, load: nil},
+			},
+			opts:         Options{Timeout: 2 * time.Second},
+			userEntry:    []byte("\x1b[Bj\r"),
+			calledLabels: []string{"3"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -377,7 +455,7 @@ func TestShowMenuAndLoadFromFile(t *testing.T) {
 			timer := time.NewTimer(initialTimeout * 4)
 			entry := make(chan Entry)
 			go func() {
-				entry <- showMenuAndLoadFromFile(slave, true, entries...)
+				entry <- showMenuAndLoadFromFile(slave, tt.opts, true, entries...)
 			}()
 
 			if tt.userEntry != nil && len(tt.userEntry) > 0 {
@@ -425,3 +503,559 @@ func getEditSequence(append bool, bootnum string, cmdline string) []ReadLine {
 		{cmdline, nil},
 	}
 }
+
+func getInPlaceEditSequence(bootnum string, cmdline string, action string) []ReadLine {
+	return []ReadLine{
+		{"e", nil},
+		{bootnum, nil},
+		{"e", nil},
+		{cmdline, nil},
+		{action, nil},
+	}
+}
+
+// defaultingTerm is a mockTerm that supports prefilled lines. The user
+// appends suffix to the prefilled line.
+type defaultingTerm struct {
+	mockTerm
+	suffix string
+}
+
+func (d *defaultingTerm) ReadLineWithDefault(def string) (string, error) {
+	return def + d.suffix, nil
+}
+
+func TestEditInPlacePrefill(t *testing.T) {
+	m := &defaultingTerm{
+		mockTerm: mockTerm{inputSequence: []ReadLine{{"b", nil}}},
+		suffix:   " rd.break",
+	}
+	got, boot, ok := editInPlace(m, "console=ttyS0")
+	if want := "console=ttyS0 rd.break"; got != want || !boot || !ok {
+		t.Errorf("editInPlace() = %q, %t, %t, want %q, true, true", got, boot, ok, want)
+	}
+}
+
+// keyTerm is a mockTerm that supports waiting for keys. A key is pressed
+// on the keyAfter-th wait, or never if keyAfter is 0.
+type keyTerm struct {
+	mockTerm
+	keyAfter int
+	waits    []time.Duration
+	output   strings.Builder
+}
+
+func (k *keyTerm) Write(p []byte) (int, error) {
+	return k.output.Write(p)
+}
+
+func (k *keyTerm) WaitForKey(timeout time.Duration) (bool, error) {
+	k.waits = append(k.waits, timeout)
+	return len(k.waits) == k.keyAfter, nil
+}
+
+func TestChooseCountdown(t *testing.T) {
+	entries := []Entry{
+		&testEntry{label: "1", isDefault: true},
+		&testEntry{label: "2", isDefault: true},
+		&testEntry{label: "shell"},
+	}
+
+	t.Run("elapsed", func(t *testing.T) {
+		k := &keyTerm{mockTerm: mockTerm{inputSequence: []ReadLine{{"3", nil}}}}
+		if got := choose(k, Options{Timeout: 2500 * time.Millisecond, Default: 1}, false, entries...); got != nil {
+			t.Errorf("choose() = %s, want nil to boot the default entry", got.Label())
+		}
+		want := []time.Duration{time.Second, time.Second, 500 * time.Millisecond}
+		if !reflect.DeepEqual(k.waits, want) {
+			t.Errorf("waited %v, want %v", k.waits, want)
+		}
+		for _, s := range []string{"Booting 2 in 3s", "Booting 2 in 2s", "Booting 2 in 1s"} {
+			if !strings.Contains(k.output.String(), s) {
+				t.Errorf("countdown %q does not show %q", k.output.String(), s)
+			}
+		}
+		if k.readLineCnt != 0 {
+			t.Errorf("read %d lines after the countdown elapsed, want 0", k.readLineCnt)
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		k := &keyTerm{
+			mockTerm: mockTerm{inputSequence: []ReadLine{{"3", nil}}},
+			keyAfter: 2,
+		}
+		if got := choose(k, Options{Timeout: 5 * time.Second}, false, entries...); got != entries[2] {
+			t.Errorf("choose() = %v, want %s", got, entries[2].Label())
+		}
+		if len(k.waits) != 2 {
+			t.Errorf("waited %d times, want 2", len(k.waits))
+		}
+	})
+
+	t.Run("no default entry", func(t *testing.T) {
+		k := &keyTerm{mockTerm: mockTerm{inputSequence: []ReadLine{{"3", nil}}}}
+		if got := choose(k, Options{Timeout: 5 * time.Second}, false, entries[2]); got != nil {
+			t.Errorf("choose() = %v, want nil", got)
+		}
+		if len(k.waits) != 0 {
+			t.Errorf("counted down to booting nothing")
+		}
+	})
+}
+
+func TestDefaultOrder(t *testing.T) {
+	entries := []Entry{
+		&testEntry{label: "1", isDefault: true},
+		&testEntry{label: "shell"},
+		&testEntry{label: "3", isDefault: true},
+	}
+	for _, tt := range []struct {
+		def  int
+		want []string
+	}{
+		{def: 0, want: []string{"1", "3"}},
+		{def: 2, want: []string{"3", "1"}},
+		// Non-default and out of range entries are ignored.
+		{def: 1, want: []string{"1", "3"}},
+		{def: 5, want: []string{"1", "3"}},
+	} {
+		var got []string
+		for _, e := range (Options{Default: tt.def}).defaultOrder(entries) {
+			got = append(got, e.Label())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("defaultOrder(Default: %d) = %v, want %v", tt.def, got, tt.want)
+		}
+	}
+}
+
+func TestShowMenuAndLoadSharesInput(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	entries := []Entry{
+		&testEntry{label: "1", isDefault: true},
+		&testEntry{label: "2", isDefault: true},
+		&testEntry{label: "3", isDefault: true},
+	}
+	opts := Options{In: pr, Out: io.Discard, NoColor: true}
+
+	// The menu is shown again on the same input, e.g. when the chosen
+	// entry fails to boot, and must see the lines typed after it.
+	for _, want := range []string{"2", "3"} {
+		go io.WriteString(pw, want+"\n")
+		if got := ShowMenuAndLoadWithOptions(opts, true, entries...); got == nil || got.Label() != want {
+			t.Fatalf("ShowMenuAndLoadWithOptions() = %v, want %s", got, want)
+		}
+	}
+}
+
+func TestShowMenuAndLoadFromReader(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	for _, tt := range []struct {
+		name string
+		opts Options
+		in   io.Reader
+		want string
+	}{
+		{
+			name: "choice",
+			in:   strings.NewReader("2\n"),
+			want: "2",
+		},
+		{
+			name: "invalid input is ignored",
+			in:   strings.NewReader("foo\r\n9\r\n3\r\n"),
+			want: "3",
+		},
+		{
+			name: "end of input boots default",
+			in:   strings.NewReader(""),
+			want: "1",
+		},
+		{
+			name: "timeout boots default",
+			in:   pr,
+			want: "1",
+		},
+		{
+			name: "countdown interrupted",
+			opts: Options{Timeout: time.Hour},
+			in:   strings.NewReader("3\n"),
+			want: "3",
+		},
+		{
+			name: "countdown elapsed",
+			opts: Options{Timeout: time.Second, Default: 1},
+			in:   pr,
+			want: "2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := []Entry{
+				&testEntry{label: "1", isDefault: true},
+				&testEntry{label: "2", isDefault: true},
+				&testEntry{label: "3", isDefault: true},
+			}
+			var out bytes.Buffer
+			tt.opts.In = tt.in
+			tt.opts.Out = &out
+			tt.opts.NoColor = true
+
+			got := ShowMenuAndLoadWithOptions(tt.opts, true, entries...)
+			if got == nil || got.Label() != tt.want {
+				t.Fatalf("ShowMenuAndLoadWithOptions() = %v, want %s", got, tt.want)
+			}
+			if !strings.Contains(out.String(), "03. 3") {
+				t.Errorf("menu %q does not list the entries", out.String())
+			}
+			if strings.Contains(out.String(), "\033") {
+				t.Errorf("menu %q contains escape sequences", out.String())
+			}
+		})
+	}
+}
+
+func TestFilterEntries(t *testing.T) {
+	entries := []Entry{
+		&testEntry{label: "Ubuntu 22.04"},
+		&testEntry{label: "Fedora 36"},
+		&testEntry{label: "ubuntu 20.04 (recovery)"},
+		StartShell{},
+	}
+	for _, tt := range []struct {
+		filter string
+		want   []string
+	}{
+		{filter: "", want: []string{"Ubuntu 22.04", "Fedora 36", "ubuntu 20.04 (recovery)", "Enter a LinuxBoot shell"}},
+		{filter: "UBU", want: []string{"Ubuntu 22.04", "ubuntu 20.04 (recovery)"}},
+		{filter: "ubuntu 2", want: []string{"Ubuntu 22.04", "ubuntu 20.04 (recovery)"}},
+		{filter: "ubuntu 22", want: []string{"Ubuntu 22.04"}},
+		{filter: "shell", want: []string{"Enter a LinuxBoot shell"}},
+		{filter: "windows", want: nil},
+	} {
+		var got []string
+		for _, e := range filterEntries(entries, tt.filter) {
+			got = append(got, e.Label())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterEntries(%q) = %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestChooseFilter(t *testing.T) {
+	entries := []Entry{
+		&testEntry{label: "Ubuntu 22.04"},
+		&testEntry{label: "Fedora 36"},
+		&testEntry{label: "ubuntu 20.04 (recovery)"},
+	}
+	for _, tt := range []struct {
+		name  string
+		input []ReadLine
+		want  Entry
+	}{
+		{
+			name:  "filtered entries are renumbered",
+			input: []ReadLine{{"/ubuntu", nil}, {"2", nil}},
+			want:  entries[2],
+		},
+		{
+			name:  "narrowed filter",
+			input: []ReadLine{{"/ubuntu", nil}, {"/ubuntu 20", nil}, {"1", nil}},
+			want:  entries[2],
+		},
+		{
+			name:  "widened filter",
+			input: []ReadLine{{"/ubuntu 20", nil}, {"/ubuntu", nil}, {"1", nil}},
+			want:  entries[0],
+		},
+		{
+			name:  "filtered out entries are not selectable",
+			input: []ReadLine{{"/fedora", nil}, {"3", nil}, {"1", nil}},
+			want:  entries[1],
+		},
+		{
+			name:  "cleared filter",
+			input: []ReadLine{{"/fedora", nil}, {"/", nil}, {"3", nil}},
+			want:  entries[2],
+		},
+		{
+			name:  "edit filtered entry",
+			input: []ReadLine{{"/fedora", nil}, {"e", nil}, {"1", nil}, {"a", nil}, {"quiet", nil}, {"1", nil}},
+			want:  entries[1],
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockTerm{inputSequence: tt.input}
+			if got := choose(m, Options{Out: io.Discard}, true, entries...); got != tt.want {
+				t.Errorf("choose() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got, want := entries[1].(*testEntry).cmdline, " quiet"; got != want {
+		t.Errorf("edited cmdline = %q, want %q", got, want)
+	}
+}
+
+func TestChooseToggleOverlay(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		allowEdit   bool
+		input       []ReadLine
+		wantOverlay bool
+	}{
+		{
+			name:      "not toggled",
+			allowEdit: true,
+			input:     []ReadLine{{"1", nil}},
+		},
+		{
+			name:        "enabled",
+			allowEdit:   true,
+			input:       []ReadLine{{"o", nil}, {"1", nil}, {"1", nil}},
+			wantOverlay: true,
+		},
+		{
+			name:      "enabled and disabled",
+			allowEdit: true,
+			input:     []ReadLine{{"o", nil}, {"1", nil}, {"o", nil}, {"1", nil}, {"1", nil}},
+		},
+		{
+			name:      "entry without overlay",
+			allowEdit: true,
+			input:     []ReadLine{{"o", nil}, {"2", nil}, {"1", nil}},
+		},
+		{
+			name:  "editing not allowed",
+			input: []ReadLine{{"o", nil}, {"1", nil}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			li := &boot.LinuxImage{
+				Kernel:  strings.NewReader("kernel"),
+				Overlay: strings.NewReader("overlay"),
+			}
+			entries := []Entry{
+				&OSImageAction{OSImage: li},
+				&OSImageAction{OSImage: &boot.LinuxImage{Kernel: strings.NewReader("kernel")}},
+			}
+			m := &mockTerm{inputSequence: tt.input}
+			if got := choose(m, Options{Out: io.Discard}, tt.allowEdit, entries...); got != entries[0] {
+				t.Errorf("choose() = %v, want %v", got, entries[0])
+			}
+			if li.UseOverlay != tt.wantOverlay {
+				t.Errorf("UseOverlay = %t, want %t", li.UseOverlay, tt.wantOverlay)
+			}
+			if o := entries[1].(Overlayable); o.HasOverlay() || o.OverlayEnabled() {
+				t.Errorf("entry without overlay: HasOverlay() = %t, OverlayEnabled() = %t, want false", o.HasOverlay(), o.OverlayEnabled())
+			}
+		})
+	}
+}
+
+// rawTerm is a mockTerm that also reads single keys from keys, like an
+// xterm in raw mode.
+type rawTerm struct {
+	mockTerm
+	keys   io.Reader
+	raw    bool
+	unread []rune
+}
+
+func (m *rawTerm) readsKeys() bool { return m.raw }
+
+func (m *rawTerm) ReadKey() (rune, error) {
+	key, err := readKey(m.keys)
+	if err == io.EOF {
+		// mimic timeout
+		return 0, os.ErrDeadlineExceeded
+	}
+	return key, err
+}
+
+func (m *rawTerm) UnreadKey(key rune) {
+	m.unread = append(m.unread, key)
+}
+
+func (m *rawTerm) ReadLine() (string, error) {
+	line, err := m.mockTerm.ReadLine()
+	typed := string(m.unread)
+	m.unread = nil
+	return typed + line, err
+}
+
+func TestChooseNavigate(t *testing.T) {
+	entries := []Entry{
+		&testEntry{label: "Ubuntu 22.04", isDefault: true},
+		&testEntry{label: "Fedora 36", isDefault: true},
+		&testEntry{label: "ubuntu 20.04 (recovery)", isDefault: true},
+	}
+	for _, tt := range []struct {
+		name  string
+		opts  Options
+		raw   bool
+		keys  string
+		lines []ReadLine
+		want  Entry
+	}{
+		{
+			name: "enter boots the default order",
+			raw:  true,
+			keys: "\r",
+			want: nil,
+		},
+		{
+			name: "arrow down",
+			raw:  true,
+			keys: "\x1b[B\r",
+			want: entries[1],
+		},
+		{
+			name: "arrow keys stop at the last entry",
+			raw:  true,
+			keys: "\x1b[B\x1b[B\x1b[B\x1b[A\r",
+			want: entries[1],
+		},
+		{
+			name: "application mode arrow keys",
+			raw:  true,
+			keys: "\x1bOB\x1bOB\r",
+			want: entries[2],
+		},
+		{
+			name: "j and k",
+			raw:  true,
+			keys: "jjk\r",
+			want: entries[1],
+		},
+		{
+			name: "starts at the default entry",
+			opts: Options{Default: 2},
+			raw:  true,
+			keys: "k\r",
+			want: entries[1],
+		},
+		{
+			name: "back to the default entry",
+			opts: Options{Default: 2},
+			raw:  true,
+			keys: "kj\r",
+			want: nil,
+		},
+		{
+			name:  "numeric hotkey",
+			raw:   true,
+			keys:  "3",
+			lines: []ReadLine{{"", nil}},
+			want:  entries[2],
+		},
+		{
+			name: "navigate filtered entries",
+			raw:  true,
+			keys: "/ubuntu\x1b[B\r",
+			want: entries[2],
+		},
+		{
+			name: "filter narrows as typed",
+			raw:  true,
+			keys: "/ubuntu 2\x1b[B\r",
+			want: entries[2],
+		},
+		{
+			name: "filter takes j and k",
+			raw:  true,
+			keys: "/fedora\r",
+			want: entries[1],
+		},
+		{
+			name: "backspace widens the filter",
+			raw:  true,
+			keys: "/ubuntu 20\x7f\x7f\x7f\r",
+			want: entries[0],
+		},
+		{
+			name: "backspace on an empty filter ends filtering",
+			raw:  true,
+			keys: "/x\x7f\x7fjj\r",
+			want: entries[2],
+		},
+		{
+			name: "enter does nothing without matches",
+			raw:  true,
+			keys: "/windows\r\x08\x08\x08\x08\x08\x08\x08\r",
+			want: nil,
+		},
+		{
+			name:  "numeric hotkey after filtering",
+			raw:   true,
+			keys:  "/ubuntu\x08\x08\x08\x08\x08\x08\x082",
+			lines: []ReadLine{{"", nil}},
+			want:  entries[1],
+		},
+		{
+			name: "timeout",
+			raw:  true,
+			want: nil,
+		},
+		{
+			name:  "not a terminal",
+			keys:  "\x1b[B\r",
+			lines: []ReadLine{{"3", nil}},
+			want:  entries[2],
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &rawTerm{
+				mockTerm: mockTerm{inputSequence: tt.lines},
+				keys:     strings.NewReader(tt.keys),
+				raw:      tt.raw,
+			}
+			tt.opts.Out = io.Discard
+			if got := choose(m, tt.opts, true, entries...); got != tt.want {
+				t.Errorf("choose() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrawSelection(t *testing.T) {
+	entries := []Entry{
+		&testEntry{label: "Ubuntu"},
+		&testEntry{label: "Fedora"},
+	}
+	for _, tt := range []struct {
+		name   string
+		opts   Options
+		redraw int
+		want   string
+	}{
+		{
+			name: "first drawing",
+			want: "  01. Ubuntu\r\n\r\n> 02. \033[7mFedora\033[0m\r\n\r\n" + navHint,
+		},
+		{
+			name:   "redraw",
+			redraw: 5,
+			want:   "\r\033[5A\033[J  01. Ubuntu\r\n\r\n> 02. \033[7mFedora\033[0m\r\n\r\n" + navHint,
+		},
+		{
+			name:   "no color",
+			opts:   Options{NoColor: true},
+			redraw: 5,
+			want:   "  01. Ubuntu\r\n\r\n> 02. Fedora\r\n\r\n" + navHint,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if got, want := drawSelection(&b, tt.opts, entries, 1, navHint, tt.redraw), 5; got != want {
+				t.Errorf("drawSelection() = %d lines, want %d", got, want)
+			}
+			if b.String() != tt.want {
+				t.Errorf("drawSelection() wrote %q, want %q", b.String(), tt.want)
+			}
+		})
+	}
+}
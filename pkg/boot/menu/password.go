@@ -0,0 +1,78 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Locked is implemented by entries that need a password to be chosen.
+//
+// Locked entries are never booted by default, only when the user chooses
+// them and enters the password.
+type Locked interface {
+	// PasswordHash returns the bcrypt hash of the password, or "" if
+	// the entry needs no password.
+	PasswordHash() string
+}
+
+// passwordReader is implemented by terminals that can read a line without
+// echoing it.
+type passwordReader interface {
+	ReadPassword(prompt string) (string, error)
+}
+
+var (
+	_ = passwordReader(&xterm{})
+	_ = Locked(StartShell{})
+	_ = Locked(&LockedEntry{})
+)
+
+// LockedEntry is a menu.Entry that needs a password to be chosen.
+type LockedEntry struct {
+	Entry
+
+	// Hash is the bcrypt hash of the password.
+	Hash string
+}
+
+// PasswordHash implements Locked.
+func (l *LockedEntry) PasswordHash() string {
+	return l.Hash
+}
+
+// isLocked returns whether e needs a password to be chosen.
+func isLocked(e Entry) bool {
+	l, ok := e.(Locked)
+	return ok && l.PasswordHash() != ""
+}
+
+// unlock asks the user for e's password if it needs one, and returns whether
+// e may be chosen.
+func unlock(term MenuTerminal, e Entry) bool {
+	if !isLocked(e) {
+		return true
+	}
+	const prompt = "Enter the password:\r\n > "
+	var password string
+	var err error
+	if pr, ok := term.(passwordReader); ok {
+		password, err = pr.ReadPassword(prompt)
+	} else {
+		term.SetPrompt(prompt)
+		password, err = term.ReadLine()
+	}
+	if err != nil {
+		fmt.Fprintln(term, err)
+		return false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(e.(Locked).PasswordHash()), []byte(password)); err != nil {
+		fmt.Fprintf(term, "Wrong password for %s\r\n", e.Label())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func hashPassword(t *testing.T, password string) string {
+	t.Helper()
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(h)
+}
+
+func TestChooseLocked(t *testing.T) {
+	hash := hashPassword(t, "hunter2")
+	recovery := &testEntry{label: "recovery"}
+	entries := []Entry{
+		&LockedEntry{Entry: recovery, Hash: hash},
+		&testEntry{label: "2", isDefault: true},
+		StartShell{Hash: hash},
+	}
+
+	for _, tt := range []struct {
+		name  string
+		input []ReadLine
+		want  Entry
+	}{
+		{
+			name:  "correct password",
+			input: []ReadLine{{"1", nil}, {"hunter2", nil}},
+			want:  entries[0],
+		},
+		{
+			name:  "wrong password returns to menu",
+			input: []ReadLine{{"1", nil}, {"hunter3", nil}, {"2", nil}},
+			want:  entries[1],
+		},
+		{
+			name:  "wrong password for shell returns to menu",
+			input: []ReadLine{{"3", nil}, {"", nil}, {"2", nil}},
+			want:  entries[1],
+		},
+		{
+			name:  "correct password for shell",
+			input: []ReadLine{{"3", nil}, {"hunter2", nil}},
+			want:  entries[2],
+		},
+		{
+			name:  "wrong password does not allow editing",
+			input: []ReadLine{{"e", nil}, {"1", nil}, {"hunter3", nil}, {"2", nil}},
+			want:  entries[1],
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockTerm{inputSequence: tt.input}
+			if got := Choose(m, true, entries...); got != tt.want {
+				t.Errorf("Choose() = %v, want %v", got, tt.want)
+			}
+			if recovery.LoadCalled() {
+				t.Errorf("locked entry was loaded by Choose")
+			}
+		})
+	}
+}
+
+func TestLockedEntriesAreNotDefault(t *testing.T) {
+	entries := []Entry{
+		&LockedEntry{Entry: &testEntry{label: "1", isDefault: true}, Hash: hashPassword(t, "hunter2")},
+		&testEntry{label: "2", isDefault: true},
+		// An empty hash does not lock the entry.
+		&LockedEntry{Entry: &testEntry{label: "3", isDefault: true}},
+	}
+	var got []string
+	for _, e := range (Options{}).defaultOrder(entries) {
+		got = append(got, e.Label())
+	}
+	if len(got) != 2 || got[0] != "2" || got[1] != "3" {
+		t.Errorf("defaultOrder() = %v, want [2 3]", got)
+	}
+}
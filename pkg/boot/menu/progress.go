@@ -0,0 +1,169 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the progress of a download is rendered, as a bar redrawn in
+// place on terminals, and as a line of text otherwise.
+const (
+	progressBarInterval  = 100 * time.Millisecond
+	progressTextInterval = 5 * time.Second
+	progressBarWidth     = 30
+)
+
+// Progress renders the progress of the downloads of an entry while the menu
+// loads it, e.g. of a netboot kernel and initramfs.
+//
+// Its Update method can be used as a curl.ProgressFunc, and does nothing
+// while no entry is being loaded.
+type Progress struct {
+	mu sync.Mutex
+
+	out     io.Writer
+	text    bool
+	active  bool
+	started time.Time
+	last    time.Time
+	drawn   bool
+
+	// streams are the files downloaded so far, by URL.
+	streams map[string]*stream
+
+	// now returns the current time. Tests override it.
+	now func() time.Time
+}
+
+// stream is the progress of the download of one file.
+type stream struct {
+	bytes, total int64
+}
+
+// NewProgress returns a Progress to be set in Options.
+func NewProgress() *Progress {
+	return &Progress{now: time.Now}
+}
+
+// start renders progress reported from now on to out, as periodic lines of
+// text if opts asks for no ANSI escape sequences, e.g. on serial consoles.
+func (p *Progress) start(out io.Writer, opts Options) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out = out
+	p.text = opts.NoColor || opts.PlainASCII
+	p.active = true
+	p.started = p.now()
+	p.last = time.Time{}
+	p.drawn = false
+	p.streams = nil
+}
+
+// stop ends rendering progress, moving on to a new line after the bar.
+func (p *Progress) stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active && p.drawn && !p.text {
+		fmt.Fprint(p.out, "\r\n")
+	}
+	p.active = false
+}
+
+// Update reports that bytesSoFar bytes of the file at u of size total, or
+// -1 if it is unknown, were downloaded.
+//
+// Files may be downloaded concurrently, e.g. a kernel and an initramfs, so
+// a single bar shows the sum of all files downloaded for the entry.
+func (p *Progress) Update(u *url.URL, bytesSoFar, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.active {
+		return
+	}
+
+	if p.streams == nil {
+		p.streams = make(map[string]*stream)
+	}
+	st, ok := p.streams[u.String()]
+	if !ok {
+		st = &stream{}
+		p.streams[u.String()] = st
+	}
+	st.bytes, st.total = bytesSoFar, total
+
+	// The total is only known if it is known for all files.
+	var sum, sumTotal int64
+	for _, st := range p.streams {
+		sum += st.bytes
+		if sumTotal >= 0 && st.total >= 0 {
+			sumTotal += st.total
+		} else {
+			sumTotal = -1
+		}
+	}
+
+	now := p.now()
+	done := sumTotal > 0 && sum >= sumTotal
+	interval := progressBarInterval
+	if p.text {
+		interval = progressTextInterval
+	}
+	if !done && !p.last.IsZero() && now.Sub(p.last) < interval {
+		return
+	}
+	p.last = now
+	p.drawn = true
+
+	var rate int64
+	if elapsed := now.Sub(p.started).Seconds(); elapsed > 0 {
+		rate = int64(float64(sum) / elapsed)
+	}
+	if p.text {
+		fmt.Fprintf(p.out, "Downloaded %s\r\n", progressStatus(sum, sumTotal, rate))
+	} else {
+		fmt.Fprintf(p.out, "\r\033[K%s %s", progressBar(sum, sumTotal), progressStatus(sum, sumTotal, rate))
+	}
+}
+
+// progressBar returns a bar filled according to the fraction of total
+// that was downloaded, or an empty bar if total is unknown.
+func progressBar(bytesSoFar, total int64) string {
+	filled := 0
+	if total > 0 {
+		filled = int(bytesSoFar * progressBarWidth / total)
+		if filled > progressBarWidth {
+			filled = progressBarWidth
+		}
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled) + "]"
+}
+
+// progressStatus returns the percentage, bytes and rate of a download.
+func progressStatus(bytesSoFar, total, rate int64) string {
+	if total <= 0 {
+		return fmt.Sprintf("%s (%s/s)", formatBytes(bytesSoFar), formatBytes(rate))
+	}
+	return fmt.Sprintf("%d%% %s / %s (%s/s)", bytesSoFar*100/total, formatBytes(bytesSoFar), formatBytes(total), formatBytes(rate))
+}
+
+// formatBytes returns n in human-readable binary units, e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
@@ -0,0 +1,191 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mib = 1 << 20
+
+// progressEvent is a download progress report of a file at a time after
+// the entry started loading.
+type progressEvent struct {
+	at         time.Duration
+	file       string
+	bytes      int64
+	totalBytes int64
+}
+
+// feed reports events to p, as a download would.
+func feed(p *Progress, clock *time.Time, start time.Time, events []progressEvent) {
+	for _, e := range events {
+		*clock = start.Add(e.at)
+		file := e.file
+		if file == "" {
+			file = "vmlinuz"
+		}
+		p.Update(&url.URL{Scheme: "http", Host: "10.0.0.1", Path: "/" + file}, e.bytes, e.totalBytes)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		opts   Options
+		events []progressEvent
+		want   string
+	}{
+		{
+			name: "bar",
+			events: []progressEvent{
+				{at: time.Second, bytes: 1 * mib, totalBytes: 4 * mib},
+				// Too soon after the last frame.
+				{at: time.Second + 50*time.Millisecond, bytes: 2 * mib, totalBytes: 4 * mib},
+				{at: 2 * time.Second, bytes: 4 * mib, totalBytes: 4 * mib},
+			},
+			want: "\r\033[K[#######-----------------------] 25% 1.0 MiB / 4.0 MiB (1.0 MiB/s)" +
+				"\r\033[K[##############################] 100% 4.0 MiB / 4.0 MiB (2.0 MiB/s)" +
+				"\r\n",
+		},
+		{
+			name: "unknown size",
+			events: []progressEvent{
+				{at: time.Second, bytes: 1536, totalBytes: -1},
+			},
+			want: "\r\033[K[------------------------------] 1.5 KiB (1.5 KiB/s)\r\n",
+		},
+		{
+			name: "two files",
+			events: []progressEvent{
+				{at: time.Second, bytes: 2 * mib, totalBytes: 2 * mib},
+				{at: 2 * time.Second, file: "initrd", bytes: mib, totalBytes: 1 * mib},
+			},
+			want: "\r\033[K[##############################] 100% 2.0 MiB / 2.0 MiB (2.0 MiB/s)" +
+				"\r\033[K[##############################] 100% 3.0 MiB / 3.0 MiB (1.5 MiB/s)" +
+				"\r\n",
+		},
+		{
+			name: "concurrent files",
+			events: []progressEvent{
+				{at: time.Second, bytes: 1 * mib, totalBytes: 4 * mib},
+				// Too soon after the last frame.
+				{at: time.Second + 50*time.Millisecond, file: "initrd", bytes: 1 * mib, totalBytes: 2 * mib},
+				{at: 2 * time.Second, bytes: 4 * mib, totalBytes: 4 * mib},
+				{at: 2*time.Second + 50*time.Millisecond, file: "initrd", bytes: 2 * mib, totalBytes: 2 * mib},
+			},
+			want: "\r\033[K[#######-----------------------] 25% 1.0 MiB / 4.0 MiB (1.0 MiB/s)" +
+				"\r\033[K[#########################-----] 83% 5.0 MiB / 6.0 MiB (2.5 MiB/s)" +
+				"\r\033[K[##############################] 100% 6.0 MiB / 6.0 MiB (2.9 MiB/s)" +
+				"\r\n",
+		},
+		{
+			name: "unknown size of one file",
+			events: []progressEvent{
+				{at: time.Second, bytes: 1 * mib, totalBytes: 1 * mib},
+				{at: 2 * time.Second, file: "initrd", bytes: 1 * mib, totalBytes: -1},
+			},
+			want: "\r\033[K[##############################] 100% 1.0 MiB / 1.0 MiB (1.0 MiB/s)" +
+				"\r\033[K[------------------------------] 2.0 MiB (1.0 MiB/s)" +
+				"\r\n",
+		},
+		{
+			name: "serial console",
+			opts: Options{NoColor: true},
+			events: []progressEvent{
+				{at: time.Second, bytes: 1 * mib, totalBytes: 4 * mib},
+				// Too soon after the last line.
+				{at: 3 * time.Second, bytes: 2 * mib, totalBytes: 4 * mib},
+				{at: 6 * time.Second, bytes: 3 * mib, totalBytes: 4 * mib},
+				{at: 7 * time.Second, bytes: 4 * mib, totalBytes: 4 * mib},
+			},
+			want: "Downloaded 25% 1.0 MiB / 4.0 MiB (1.0 MiB/s)\r\n" +
+				"Downloaded 75% 3.0 MiB / 4.0 MiB (512.0 KiB/s)\r\n" +
+				"Downloaded 100% 4.0 MiB / 4.0 MiB (585.1 KiB/s)\r\n",
+		},
+		{
+			name: "nothing downloaded",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Unix(1000, 0)
+			clock := start
+			p := NewProgress()
+			p.now = func() time.Time { return clock }
+
+			var out bytes.Buffer
+			p.start(&out, tt.opts)
+			feed(p, &clock, start, tt.events)
+			p.stop()
+
+			if got := out.String(); got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+			if tt.opts.NoColor && strings.Contains(out.String(), "\033") {
+				t.Errorf("rendered %q, want no escape sequences", out.String())
+			}
+		})
+	}
+}
+
+func TestProgressInactive(t *testing.T) {
+	p := NewProgress()
+	var out bytes.Buffer
+	u := &url.URL{Scheme: "http", Host: "10.0.0.1", Path: "/vmlinuz"}
+	p.Update(u, mib, 2*mib)
+
+	p.start(&out, Options{})
+	p.stop()
+	p.Update(u, 2*mib, 2*mib)
+	if out.Len() != 0 {
+		t.Errorf("rendered %q while no entry loads, want nothing", out.String())
+	}
+}
+
+// downloadEntry reports the download of a file while loading.
+type downloadEntry struct {
+	testEntry
+	progress *Progress
+}
+
+func (d *downloadEntry) Load() error {
+	d.progress.Update(&url.URL{Scheme: "http", Host: "10.0.0.1", Path: "/vmlinuz"}, mib, mib)
+	return d.testEntry.Load()
+}
+
+func TestShowMenuAndLoadProgress(t *testing.T) {
+	p := NewProgress()
+	entry := &downloadEntry{testEntry: testEntry{label: "netboot", isDefault: true}, progress: p}
+
+	var out bytes.Buffer
+	opts := Options{In: strings.NewReader("1\n"), Out: &out, NoColor: true, Progress: p}
+	if got := ShowMenuAndLoadWithOptions(opts, false, entry); got != entry {
+		t.Fatalf("ShowMenuAndLoadWithOptions() = %v, want %v", got, entry)
+	}
+	if !strings.Contains(out.String(), "Downloaded 100% 1.0 MiB / 1.0 MiB") {
+		t.Errorf("menu %q does not show the download progress", out.String())
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:                 "0 B",
+		1023:              "1023 B",
+		1024:              "1.0 KiB",
+		1536:              "1.5 KiB",
+		5 * mib:           "5.0 MiB",
+		3 * 1024 * mib:    "3.0 GiB",
+		2 << 40:           "2.0 TiB",
+		int64(1.25 * mib): "1.2 MiB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
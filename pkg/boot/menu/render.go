@@ -0,0 +1,100 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ansiEscape matches ANSI escape sequences, e.g. colors in entry titles.
+var ansiEscape = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|[@-Z\\-_])`)
+
+// label returns s as it should be shown to the user.
+func (o Options) label(s string) string {
+	if o.NoColor || o.PlainASCII {
+		s = ansiEscape.ReplaceAllString(s, "")
+	}
+	if !o.PlainASCII {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t':
+			return ' '
+		case r > unicode.MaxASCII || !unicode.IsPrint(r):
+			return '?'
+		}
+		return r
+	}, s)
+}
+
+// wrap splits s into lines of at most width characters, breaking at spaces
+// where possible. s is not split if width is not positive.
+func wrap(s string, width int) []string {
+	if width <= 0 {
+		return []string{s}
+	}
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(s) {
+		w := []rune(word)
+		if len(line) > 0 && len(line)+1+len(w) > width {
+			lines = append(lines, string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, w...)
+		for len(line) > width {
+			lines = append(lines, string(line[:width]))
+			line = line[width:]
+		}
+	}
+	return append(lines, string(line))
+}
+
+// renderEntries writes the numbered list of entries to w.
+func renderEntries(w io.Writer, opts Options, entries []Entry) {
+	renderSelection(w, opts, entries, -1)
+}
+
+// renderSelection is renderEntries with the entry at index selected marked
+// with "> ", and shown in reverse video unless opts asks for no colors. No
+// entry is marked if selected is negative.
+func renderSelection(w io.Writer, opts Options, entries []Entry, selected int) {
+	for i, e := range entries {
+		prefix := fmt.Sprintf("%02d. ", i+1)
+		highlight := false
+		if selected >= 0 {
+			marker := "  "
+			if i == selected {
+				marker = "> "
+				highlight = !opts.NoColor && !opts.PlainASCII
+			}
+			prefix = marker + prefix
+		}
+		indent := strings.Repeat(" ", len(prefix))
+
+		lines := []string{opts.label(e.Label())}
+		if opts.Width > 0 {
+			lines = wrap(lines[0], opts.Width-len(prefix))
+		}
+		if highlight {
+			for j, l := range lines {
+				lines[j] = "\033[7m" + l + "\033[0m"
+			}
+		}
+		fmt.Fprintf(w, "%s%s\r\n", prefix, lines[0])
+		for _, l := range lines[1:] {
+			fmt.Fprintf(w, "%s%s\r\n", indent, l)
+		}
+		fmt.Fprint(w, "\r\n")
+	}
+}
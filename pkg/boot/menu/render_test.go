@@ -0,0 +1,69 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "update the golden files of rendered menus")
+
+func TestRenderEntries(t *testing.T) {
+	entries := []Entry{
+		&testEntry{label: "Ubuntu 22.04 LTS \x1b[1;31m(recovery mode)\x1b[0m"},
+		&testEntry{label: "Fedora Linux 36 — Workstation Edition, with kernel 5.17.5-300.fc36.x86_64"},
+		StartShell{},
+	}
+
+	for _, tt := range []struct {
+		name string
+		opts Options
+	}{
+		{name: "default"},
+		{name: "nocolor", opts: Options{NoColor: true}},
+		{name: "plain", opts: Options{PlainASCII: true, Width: 40}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			renderEntries(&b, tt.opts, entries)
+
+			golden := filepath.Join("testdata", "render_"+tt.name+".golden")
+			if *updateGolden {
+				if err := os.WriteFile(golden, b.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("error loading file `%s`, %v", golden, err)
+			}
+			if !bytes.Equal(b.Bytes(), want) {
+				t.Errorf("renderEntries() = \n%q\nwant\n%q", b.Bytes(), want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	for _, tt := range []struct {
+		s     string
+		width int
+		want  []string
+	}{
+		{s: "a  b", width: 0, want: []string{"a  b"}},
+		{s: "boot the kernel", width: 8, want: []string{"boot the", "kernel"}},
+		{s: "vmlinuz-5.17.5", width: 6, want: []string{"vmlinu", "z-5.17", ".5"}},
+		{s: "", width: 6, want: []string{""}},
+	} {
+		if got := wrap(tt.s, tt.width); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("wrap(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
@@ -47,7 +47,7 @@ func (mi *MultibootImage) Edit(f func(cmdline string) string) {
 
 // Load implements OSImage.Load.
 func (mi *MultibootImage) Load(verbose bool) error {
-	return multiboot.Load(verbose, mi.Kernel, mi.Cmdline, mi.Modules, mi.IBFT)
+	return setStaged(mi, multiboot.Load(verbose, mi.Kernel, mi.Cmdline, mi.Modules, mi.IBFT))
 }
 
 // String implements fmt.Stringer.
@@ -0,0 +1,113 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Framebuffer ioctls, from include/uapi/linux/fb.h.
+const (
+	fbiogetVScreenInfo = 0x4600
+	fbiogetFScreenInfo = 0x4602
+
+	fbVisualTrueColor = 2
+)
+
+type fbBitfield struct {
+	Offset   uint32
+	Length   uint32
+	MSBRight uint32
+}
+
+// fbFixScreenInfo is struct fb_fix_screeninfo.
+type fbFixScreenInfo struct {
+	ID           [16]byte
+	SmemStart    uintptr
+	SmemLen      uint32
+	Type         uint32
+	TypeAux      uint32
+	Visual       uint32
+	XPanStep     uint16
+	YPanStep     uint16
+	YWrapStep    uint16
+	LineLength   uint32
+	MMIOStart    uintptr
+	MMIOLen      uint32
+	Accel        uint32
+	Capabilities uint16
+	Reserved     [2]uint16
+}
+
+// fbVarScreenInfo is struct fb_var_screeninfo.
+type fbVarScreenInfo struct {
+	XRes, YRes               uint32
+	XResVirtual, YResVirtual uint32
+	XOffset, YOffset         uint32
+	BitsPerPixel             uint32
+	Grayscale                uint32
+
+	Red, Green, Blue, Transp fbBitfield
+
+	Nonstd      uint32
+	Activate    uint32
+	Height      uint32
+	Width       uint32
+	AccelFlags  uint32
+	PixClock    uint32
+	LeftMargin  uint32
+	RightMargin uint32
+	UpperMargin uint32
+	LowerMargin uint32
+	HSyncLen    uint32
+	VSyncLen    uint32
+	Sync        uint32
+	VMode       uint32
+	Rotate      uint32
+	Colorspace  uint32
+	Reserved    [4]uint32
+}
+
+func fbIoctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// framebufferFromDevice returns the linear RGB framebuffer behind /dev/fb0.
+func framebufferFromDevice() (*framebuffer, error) {
+	f, err := os.Open("/dev/fb0")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var fix fbFixScreenInfo
+	if err := fbIoctl(f, fbiogetFScreenInfo, unsafe.Pointer(&fix)); err != nil {
+		return nil, fmt.Errorf("FBIOGET_FSCREENINFO: %v", err)
+	}
+	var v fbVarScreenInfo
+	if err := fbIoctl(f, fbiogetVScreenInfo, unsafe.Pointer(&v)); err != nil {
+		return nil, fmt.Errorf("FBIOGET_VSCREENINFO: %v", err)
+	}
+	if fix.Visual != fbVisualTrueColor {
+		return nil, fmt.Errorf("framebuffer visual %d is not true color", fix.Visual)
+	}
+	return &framebuffer{
+		Addr:   uint64(fix.SmemStart),
+		Pitch:  fix.LineLength,
+		Width:  v.XRes,
+		Height: v.YRes,
+		BPP:    uint8(v.BitsPerPixel),
+		Red:    colorField{Pos: uint8(v.Red.Offset), Size: uint8(v.Red.Length)},
+		Green:  colorField{Pos: uint8(v.Green.Offset), Size: uint8(v.Green.Length)},
+		Blue:   colorField{Pos: uint8(v.Blue.Offset), Size: uint8(v.Blue.Length)},
+	}, nil
+}
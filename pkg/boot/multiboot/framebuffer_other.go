@@ -0,0 +1,14 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package multiboot
+
+import "errors"
+
+func framebufferFromDevice() (*framebuffer, error) {
+	return nil, errors.New("framebuffer not supported on this platform")
+}
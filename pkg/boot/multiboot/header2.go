@@ -0,0 +1,222 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+const (
+	// header2Magic is the magic value found in a Multiboot2 kernel header.
+	header2Magic = 0xE85250D6
+
+	// boot2Magic is the magic expected by a Multiboot2 OS in EAX at boot
+	// handover.
+	boot2Magic = 0x36D76289
+
+	// header2ArchI386 is the 32-bit protected mode i386 architecture.
+	header2ArchI386 = 0
+
+	// header2SearchLen is the length of the start of the image the
+	// Multiboot2 header must be contained in.
+	header2SearchLen = 32768
+)
+
+type header2TagType uint16
+
+// Multiboot2 header tag types, as defined in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Header-tags.
+const (
+	header2TagEnd             header2TagType = 0
+	header2TagInfoRequest     header2TagType = 1
+	header2TagAddress         header2TagType = 2
+	header2TagEntryAddress    header2TagType = 3
+	header2TagConsoleFlags    header2TagType = 4
+	header2TagFramebuffer     header2TagType = 5
+	header2TagModuleAlign     header2TagType = 6
+	header2TagEFIBootServices header2TagType = 7
+	header2TagEntryEFI32      header2TagType = 8
+	header2TagEntryEFI64      header2TagType = 9
+	header2TagRelocatable     header2TagType = 10
+)
+
+// header2TagOptional is the header tag flag telling the boot loader it may
+// ignore the tag.
+const header2TagOptional = 1
+
+// header2Framebuffer is the framebuffer mode preferred by the OS image.
+// Zero fields have no preference.
+type header2Framebuffer struct {
+	Width  uint32
+	Height uint32
+	Depth  uint32
+
+	// Required is true if the OS cannot boot without a framebuffer.
+	Required bool
+}
+
+// matches returns whether fb has the preferred mode.
+func (p *header2Framebuffer) matches(fb *framebuffer) bool {
+	return (p.Width == 0 || p.Width == fb.Width) &&
+		(p.Height == 0 || p.Height == fb.Height) &&
+		(p.Depth == 0 || p.Depth == uint32(fb.BPP))
+}
+
+// header2 represents a Multiboot2 header loaded from the file.
+type header2 struct {
+	Architecture uint32
+
+	// Requests are the boot information tag types the OS cannot boot
+	// without. Optional requests are not recorded, as all supported
+	// tags are passed when available.
+	Requests []info2TagType
+
+	// EntryAddr is the physical address to jump to instead of the ELF
+	// entry point, if not zero.
+	EntryAddr uint32
+
+	// Framebuffer is the preferred framebuffer mode, if the OS
+	// expressed a preference.
+	Framebuffer *header2Framebuffer
+}
+
+func (h *header2) name() string {
+	return "multiboot2"
+}
+
+func (h *header2) bootMagic() uintptr {
+	return boot2Magic
+}
+
+// requires returns whether the OS cannot boot without boot information tag
+// typ.
+func (h *header2) requires(typ info2TagType) bool {
+	for _, req := range h.Requests {
+		if req == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// framebuffer returns the framebuffer read by readFramebuffer to pass to the
+// OS, or nil if there is none. It fails if the OS requires a framebuffer but
+// there is none, as u-root cannot set up one.
+func (h *header2) framebuffer(readFramebuffer func() (*framebuffer, error)) (*framebuffer, error) {
+	required := h.requires(info2TagFramebuffer) || (h.Framebuffer != nil && h.Framebuffer.Required)
+	fb, err := readFramebuffer()
+	if err != nil {
+		if required {
+			return nil, fmt.Errorf("multiboot2 kernel requires a framebuffer: %w", err)
+		}
+		log.Printf("Not passing a framebuffer to the multiboot2 kernel: %v", err)
+		return nil, nil
+	}
+	if p := h.Framebuffer; p != nil && !p.matches(fb) {
+		log.Printf("Passing a %dx%dx%d framebuffer to a multiboot2 kernel preferring %dx%dx%d", fb.Width, fb.Height, fb.BPP, p.Width, p.Height, p.Depth)
+	}
+	return fb, nil
+}
+
+// parseHeader2 parses a Multiboot2 header as defined in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#OS-image-format
+func parseHeader2(r io.Reader) (*header2, error) {
+	// The Multiboot2 header must be contained completely within the
+	// first 32768 bytes of the OS image.
+	buf := make([]byte, header2SearchLen)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	// The Multiboot2 header must be 64-bit aligned.
+	for off := 0; off+16 <= len(buf); off += 8 {
+		l := uio.NewNativeEndianBuffer(buf[off:])
+		magic, arch, length, checksum := l.Read32(), l.Read32(), l.Read32(), l.Read32()
+		if magic != header2Magic || magic+arch+length+checksum != 0 {
+			continue
+		}
+		if arch != header2ArchI386 {
+			return nil, fmt.Errorf("multiboot2 architecture %d not supported", arch)
+		}
+		if length < 16 || int(length) > len(buf)-off {
+			return nil, fmt.Errorf("multiboot2 header length %d out of bounds", length)
+		}
+		return parseHeader2Tags(buf[off+16 : off+int(length)])
+	}
+	return nil, ErrHeaderNotFound
+}
+
+// parseHeader2Tags parses the tags following the Multiboot2 header magic
+// fields.
+func parseHeader2Tags(b []byte) (*header2, error) {
+	h := &header2{Architecture: header2ArchI386}
+	for len(b) >= 8 {
+		l := uio.NewNativeEndianBuffer(b)
+		typ, flags, size := header2TagType(l.Read16()), l.Read16(), l.Read32()
+		if size < 8 || int(size) > len(b) {
+			return nil, fmt.Errorf("multiboot2 header tag %d has invalid size %d", typ, size)
+		}
+		optional := flags&header2TagOptional != 0
+		body := uio.NewNativeEndianBuffer(b[8:size])
+
+		switch typ {
+		case header2TagEnd:
+			return h, nil
+
+		case header2TagInfoRequest:
+			for body.Len() >= 4 {
+				req := info2TagType(body.Read32())
+				if optional {
+					continue
+				}
+				if !req.supported() {
+					return nil, fmt.Errorf("multiboot2 info request for tag type %d: %w", req, ErrFlagsNotSupported)
+				}
+				h.Requests = append(h.Requests, req)
+			}
+
+		case header2TagEntryAddress:
+			h.EntryAddr = body.Read32()
+
+		case header2TagFramebuffer:
+			h.Framebuffer = &header2Framebuffer{
+				Width:    body.Read32(),
+				Height:   body.Read32(),
+				Depth:    body.Read32(),
+				Required: !optional,
+			}
+
+		case header2TagConsoleFlags, header2TagModuleAlign, header2TagRelocatable:
+			// Modules are always page aligned, and the image is
+			// loaded where its ELF headers say, which is always
+			// a valid choice for relocatable images.
+
+		default:
+			// The a.out kludge and EFI entry points are not
+			// supported.
+			if !optional {
+				return nil, fmt.Errorf("multiboot2 header tag type %d: %w", typ, ErrFlagsNotSupported)
+			}
+			log.Printf("Ignoring optional multiboot2 header tag type %d", typ)
+		}
+		if err := body.Error(); err != nil {
+			return nil, fmt.Errorf("multiboot2 header tag type %d: %v", typ, err)
+		}
+
+		// Tags are padded to 8 bytes.
+		next := (int(size) + 7) &^ 7
+		if next > len(b) {
+			break
+		}
+		b = b[next:]
+	}
+	return nil, fmt.Errorf("multiboot2 header has no end tag")
+}
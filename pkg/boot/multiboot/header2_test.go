@@ -0,0 +1,304 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+type header2Tag struct {
+	typ   header2TagType
+	flags uint16
+	body  []uint32
+}
+
+// createHeader2 returns an image of size bytes with a Multiboot2 header
+// containing tags at offset.
+func createHeader2(offset, size int, checksumDelta uint32, tags ...header2Tag) []byte {
+	t := uio.NewNativeEndianBuffer(nil)
+	for _, tag := range tags {
+		t.Write16(uint16(tag.typ))
+		t.Write16(tag.flags)
+		t.Write32(uint32(8 + 4*len(tag.body)))
+		for _, v := range tag.body {
+			t.Write32(v)
+		}
+		t.Align(8)
+	}
+
+	length := uint32(16 + t.Len())
+	h := uio.NewNativeEndianBuffer(nil)
+	h.Write32(header2Magic)
+	h.Write32(header2ArchI386)
+	h.Write32(length)
+	h.Write32(-(header2Magic + header2ArchI386 + length) + checksumDelta)
+	h.WriteBytes(t.Data())
+
+	buf := bytes.Repeat([]byte{0xDE, 0xAD, 0xBE, 0xEF}, size/4)
+	copy(buf[offset:], h.Data())
+	return buf
+}
+
+func TestParseHeader2(t *testing.T) {
+	end := header2Tag{typ: header2TagEnd}
+	for _, tt := range []struct {
+		name          string
+		offset        int
+		checksumDelta uint32
+		tags          []header2Tag
+		want          *header2
+		wantErr       bool
+		errIs         error
+	}{
+		{
+			name:   "all supported tags",
+			offset: 64,
+			tags: []header2Tag{
+				{typ: header2TagInfoRequest, body: []uint32{uint32(info2TagCmdline), uint32(info2TagMmap)}},
+				{typ: header2TagEntryAddress, body: []uint32{0x100000}},
+				{typ: header2TagFramebuffer, body: []uint32{1024, 768, 32}},
+				{typ: header2TagModuleAlign},
+				end,
+			},
+			want: &header2{
+				Architecture: header2ArchI386,
+				Requests:     []info2TagType{info2TagCmdline, info2TagMmap},
+				EntryAddr:    0x100000,
+				Framebuffer:  &header2Framebuffer{Width: 1024, Height: 768, Depth: 32, Required: true},
+			},
+		},
+		{
+			name:   "optional tags",
+			offset: 8,
+			tags: []header2Tag{
+				{typ: header2TagInfoRequest, flags: header2TagOptional, body: []uint32{7, uint32(info2TagFramebuffer)}},
+				{typ: header2TagEntryEFI64, flags: header2TagOptional, body: []uint32{0x1000}},
+				{typ: header2TagFramebuffer, flags: header2TagOptional, body: []uint32{0, 0, 32}},
+				end,
+			},
+			want: &header2{
+				Architecture: header2ArchI386,
+				Framebuffer:  &header2Framebuffer{Depth: 32},
+			},
+		},
+		{
+			name:          "bad checksum",
+			checksumDelta: 1,
+			tags:          []header2Tag{end},
+			wantErr:       true,
+			errIs:         ErrHeaderNotFound,
+		},
+		{
+			name:    "unaligned",
+			offset:  4,
+			tags:    []header2Tag{end},
+			wantErr: true,
+			errIs:   ErrHeaderNotFound,
+		},
+		{
+			name:    "required unsupported info request",
+			tags:    []header2Tag{{typ: header2TagInfoRequest, body: []uint32{7}}, end},
+			wantErr: true,
+			errIs:   ErrFlagsNotSupported,
+		},
+		{
+			name:    "required unsupported tag",
+			tags:    []header2Tag{{typ: header2TagAddress, body: []uint32{1, 2, 3, 4}}, end},
+			wantErr: true,
+			errIs:   ErrFlagsNotSupported,
+		},
+		{
+			name:    "no end tag",
+			tags:    []header2Tag{{typ: header2TagModuleAlign}},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(createHeader2(tt.offset, 8192, tt.checksumDelta, tt.tags...))
+			got, err := parseHeader2(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseHeader2() = %+v, want error", got)
+				}
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Fatalf("parseHeader2() = %v, want %v", err, tt.errIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHeader2() = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseHeader2() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeader2Framebuffer(t *testing.T) {
+	fb := &framebuffer{Width: 1024, Height: 768, BPP: 32}
+	withFramebuffer := func() (*framebuffer, error) { return fb, nil }
+	noFramebuffer := func() (*framebuffer, error) { return nil, errors.New("no /dev/fb0") }
+
+	for _, tt := range []struct {
+		name    string
+		h       header2
+		read    func() (*framebuffer, error)
+		want    *framebuffer
+		wantErr bool
+	}{
+		{
+			name: "not asked for",
+			read: withFramebuffer,
+			want: fb,
+		},
+		{
+			name: "optional missing",
+			h:    header2{Framebuffer: &header2Framebuffer{Width: 800, Height: 600}},
+			read: noFramebuffer,
+		},
+		{
+			name: "required",
+			h:    header2{Framebuffer: &header2Framebuffer{Required: true}},
+			read: withFramebuffer,
+			want: fb,
+		},
+		{
+			name: "required other mode",
+			h:    header2{Framebuffer: &header2Framebuffer{Width: 800, Height: 600, Depth: 16, Required: true}},
+			read: withFramebuffer,
+			want: fb,
+		},
+		{
+			name:    "required missing",
+			h:       header2{Framebuffer: &header2Framebuffer{Required: true}},
+			read:    noFramebuffer,
+			wantErr: true,
+		},
+		{
+			name:    "required info request missing",
+			h:       header2{Requests: []info2TagType{info2TagCmdline, info2TagFramebuffer}},
+			read:    noFramebuffer,
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.h.framebuffer(tt.read)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("framebuffer() = %v, want error %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("framebuffer() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfo2Marshal(t *testing.T) {
+	i := info2{
+		Cmdline:        "console=ttyS0",
+		BootLoaderName: "u-root",
+		MemLower:       639,
+		MemUpper:       0x3ff00,
+		Mmap: memoryMaps{
+			{BaseAddr: 0, Length: 0x9fc00, Type: 1},
+			{BaseAddr: 0x100000, Length: 0x3ff00000, Type: 1},
+		},
+		Modules: []info2Module{
+			{Start: 0x200000, End: 0x201000, Cmdline: "mod arg"},
+		},
+		Framebuffer: &framebuffer{
+			Addr:   0xfd000000,
+			Pitch:  4096,
+			Width:  1024,
+			Height: 768,
+			BPP:    32,
+			Red:    colorField{Pos: 16, Size: 8},
+			Green:  colorField{Pos: 8, Size: 8},
+			Blue:   colorField{Pos: 0, Size: 8},
+		},
+	}
+	b := i.marshal()
+
+	l := uio.NewNativeEndianBuffer(b)
+	if total := l.Read32(); int(total) != len(b) {
+		t.Errorf("total_size = %d, want %d", total, len(b))
+	}
+	if total := len(b); total%8 != 0 {
+		t.Errorf("total_size %d is not 8-byte aligned", total)
+	}
+	l.Read32()
+
+	type tag struct {
+		typ  info2TagType
+		body []byte
+	}
+	var tags []tag
+	for l.Len() > 0 {
+		typ, size := info2TagType(l.Read32()), l.Read32()
+		tags = append(tags, tag{typ, l.CopyN(int(size) - 8)})
+		// Skip the padding to the next 8-byte aligned tag.
+		l.Consume((8 - (len(b)-l.Len())%8) % 8)
+		if typ == info2TagEnd {
+			break
+		}
+	}
+	if err := l.Error(); err != nil {
+		t.Fatalf("Reading tags: %v", err)
+	}
+	if l.Len() != 0 {
+		t.Errorf("%d bytes after the end tag", l.Len())
+	}
+
+	body := func(f func(*uio.Lexer)) []byte {
+		b := uio.NewNativeEndianBuffer(nil)
+		f(b)
+		return b.Data()
+	}
+	want := []tag{
+		{info2TagCmdline, []byte("console=ttyS0\x00")},
+		{info2TagBootLoaderName, []byte("u-root\x00")},
+		{info2TagBasicMeminfo, body(func(b *uio.Lexer) {
+			b.Write32(639)
+			b.Write32(0x3ff00)
+		})},
+		{info2TagMmap, body(func(b *uio.Lexer) {
+			b.Write32(24)
+			b.Write32(0)
+			b.Write64(0)
+			b.Write64(0x9fc00)
+			b.Write32(1)
+			b.Write32(0)
+			b.Write64(0x100000)
+			b.Write64(0x3ff00000)
+			b.Write32(1)
+			b.Write32(0)
+		})},
+		{info2TagModule, body(func(b *uio.Lexer) {
+			b.Write32(0x200000)
+			b.Write32(0x201000)
+			b.WriteBytes([]byte("mod arg\x00"))
+		})},
+		{info2TagFramebuffer, body(func(b *uio.Lexer) {
+			b.Write64(0xfd000000)
+			b.Write32(4096)
+			b.Write32(1024)
+			b.Write32(768)
+			b.Write8(32)
+			b.Write8(framebufferTypeRGB)
+			b.Write16(0)
+			b.WriteBytes([]byte{16, 8, 8, 8, 0, 8})
+		})},
+		{info2TagEnd, []byte{}},
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("marshal() tags = %v, want %v", tags, want)
+	}
+}
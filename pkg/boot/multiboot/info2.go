@@ -0,0 +1,189 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiboot
+
+import (
+	"os"
+
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/ubinary"
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+type info2TagType uint32
+
+// Multiboot2 boot information tag types, as defined in
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html#Boot-information-format.
+const (
+	info2TagEnd            info2TagType = 0
+	info2TagCmdline        info2TagType = 1
+	info2TagBootLoaderName info2TagType = 2
+	info2TagModule         info2TagType = 3
+	info2TagBasicMeminfo   info2TagType = 4
+	info2TagMmap           info2TagType = 6
+	info2TagFramebuffer    info2TagType = 8
+)
+
+// supported returns whether t may be passed to the loaded OS.
+func (t info2TagType) supported() bool {
+	switch t {
+	case info2TagEnd, info2TagCmdline, info2TagBootLoaderName, info2TagModule,
+		info2TagBasicMeminfo, info2TagMmap, info2TagFramebuffer:
+		return true
+	}
+	return false
+}
+
+// info2MmapEntrySize is the size of a Multiboot2 memory map entry.
+const info2MmapEntrySize = 24
+
+// framebufferTypeRGB is the Multiboot2 framebuffer type of direct RGB color.
+const framebufferTypeRGB = 1
+
+// colorField is the position and size in bits of a color in a pixel.
+type colorField struct {
+	Pos  uint8
+	Size uint8
+}
+
+// framebuffer describes a linear RGB framebuffer.
+type framebuffer struct {
+	Addr   uint64
+	Pitch  uint32
+	Width  uint32
+	Height uint32
+	BPP    uint8
+
+	Red, Green, Blue colorField
+}
+
+// info2Module is a module in the Multiboot2 boot information.
+type info2Module struct {
+	Start   uint32
+	End     uint32
+	Cmdline string
+}
+
+// info2 is the Multiboot2 boot information passed to the loaded kernel.
+type info2 struct {
+	Cmdline        string
+	BootLoaderName string
+
+	MemLower uint32
+	MemUpper uint32
+
+	Mmap        memoryMaps
+	Modules     []info2Module
+	Framebuffer *framebuffer
+}
+
+// marshal writes out the exact bytes of the Multiboot2 boot information:
+// a total size, followed by a list of 8-byte aligned tags.
+func (i *info2) marshal() []byte {
+	buf := uio.NewNativeEndianBuffer(nil)
+	// The total size is filled in at the end.
+	buf.Write32(0)
+	buf.Write32(0)
+
+	tag := func(typ info2TagType, body func(*uio.Lexer)) {
+		b := uio.NewNativeEndianBuffer(nil)
+		body(b)
+		buf.Write32(uint32(typ))
+		buf.Write32(uint32(8 + b.Len()))
+		buf.WriteBytes(b.Data())
+		buf.Align(8)
+	}
+	str := func(s string) func(*uio.Lexer) {
+		return func(b *uio.Lexer) {
+			b.WriteBytes([]byte(s))
+			b.Write8(0)
+		}
+	}
+
+	tag(info2TagCmdline, str(i.Cmdline))
+	tag(info2TagBootLoaderName, str(i.BootLoaderName))
+	tag(info2TagBasicMeminfo, func(b *uio.Lexer) {
+		b.Write32(i.MemLower)
+		b.Write32(i.MemUpper)
+	})
+	tag(info2TagMmap, func(b *uio.Lexer) {
+		b.Write32(info2MmapEntrySize)
+		b.Write32(0) // Entry version.
+		for _, m := range i.Mmap {
+			b.Write64(m.BaseAddr)
+			b.Write64(m.Length)
+			b.Write32(m.Type)
+			b.Write32(0)
+		}
+	})
+	for _, mod := range i.Modules {
+		mod := mod
+		tag(info2TagModule, func(b *uio.Lexer) {
+			b.Write32(mod.Start)
+			b.Write32(mod.End)
+			str(mod.Cmdline)(b)
+		})
+	}
+	if fb := i.Framebuffer; fb != nil {
+		tag(info2TagFramebuffer, func(b *uio.Lexer) {
+			b.Write64(fb.Addr)
+			b.Write32(fb.Pitch)
+			b.Write32(fb.Width)
+			b.Write32(fb.Height)
+			b.Write8(fb.BPP)
+			b.Write8(framebufferTypeRGB)
+			b.Write16(0)
+			for _, c := range []colorField{fb.Red, fb.Green, fb.Blue} {
+				b.Write8(c.Pos)
+				b.Write8(c.Size)
+			}
+		})
+	}
+	tag(info2TagEnd, func(*uio.Lexer) {})
+
+	d := buf.Data()
+	ubinary.NativeEndian.PutUint32(d[0:4], uint32(len(d)))
+	return d
+}
+
+// addInfo collects and adds the Multiboot2 boot information into the
+// segments.
+func (h *header2) addInfo(m *multiboot) (addr uintptr, err error) {
+	lower, upper := m.memoryBoundaries()
+	mi := info2{
+		Cmdline:        m.cmdLine,
+		BootLoaderName: m.bootloader,
+		MemLower:       lower >> 10,
+		MemUpper:       upper >> 10,
+		Mmap:           m.memoryMap(),
+	}
+
+	if len(m.modules) > 0 {
+		loaded, err := m.loadModules()
+		if err != nil {
+			return 0, err
+		}
+		for i, mod := range loaded {
+			mi.Modules = append(mi.Modules, info2Module{
+				Start:   mod.Start,
+				End:     mod.End,
+				Cmdline: m.modules[i].Cmdline,
+			})
+		}
+	}
+
+	mi.Framebuffer, err = h.framebuffer(framebufferFromDevice)
+	if err != nil {
+		return 0, err
+	}
+
+	b := mi.marshal()
+	r, err := m.mem.FindSpace(uint(len(b)), uint(os.Getpagesize()))
+	if err != nil {
+		return 0, err
+	}
+	m.mem.Segments.Insert(kexec.NewSegment(b, r))
+	return r.Start, nil
+}
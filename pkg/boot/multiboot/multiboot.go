@@ -3,7 +3,9 @@
 // license that can be found in the LICENSE file.
 
 // Package multiboot implements bootloading multiboot kernels as defined by
-// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html.
+// https://www.gnu.org/software/grub/manual/multiboot/multiboot.html and
+// Multiboot2 kernels as defined by
+// https://www.gnu.org/software/grub/manual/multiboot2/multiboot.html.
 //
 // Package multiboot crafts kexec segments that can be used with the kexec_load
 // system call.
@@ -130,12 +132,15 @@ func (m memoryMaps) String() string {
 	return strings.Join(s, "\n")
 }
 
-// Probe checks if `kernel` is multiboot v1 or esxBootInfo kernel.
+// Probe checks if `kernel` is multiboot v1, Multiboot2 or esxBootInfo kernel.
 // If the `kernel` is gzip'ed, it will decompress it.
 // Only Gzip decmpression is supported at present.
 func Probe(kernel io.ReaderAt) error {
 	r := util.TryGzipFilter(kernel)
 	_, err := parseHeader(uio.Reader(r))
+	if err == ErrHeaderNotFound {
+		_, err = parseHeader2(uio.Reader(r))
+	}
 	if err == ErrHeaderNotFound {
 		_, err = parseMutiHeader(uio.Reader(r))
 	}
@@ -249,10 +254,19 @@ func (m *multiboot) load(debug bool, ibft *ibft.IBFT) error {
 	// once and pass it around.
 
 	var header imageType
+	var entryAddr uint32
 	multibootHeader, err := parseHeader(uio.Reader(m.kernel))
 	if err == nil {
 		header = multibootHeader
 	} else if err == ErrHeaderNotFound {
+		var multiboot2Header *header2
+		multiboot2Header, err = parseHeader2(uio.Reader(m.kernel))
+		if err == nil {
+			header = multiboot2Header
+			entryAddr = multiboot2Header.EntryAddr
+		}
+	}
+	if err == ErrHeaderNotFound {
 		var esxBootInfoHeader *esxBootInfoHeader
 		// We don't even need the header at the moment. Just need to
 		// know it's there. Everything that matters is in the ELF.
@@ -269,6 +283,10 @@ func (m *multiboot) load(debug bool, ibft *ibft.IBFT) error {
 	if err != nil {
 		return fmt.Errorf("error getting kernel entry point: %v", err)
 	}
+	if entryAddr != 0 {
+		// The Multiboot2 entry address tag overrides the ELF entry.
+		kernelEntry = uintptr(entryAddr)
+	}
 	log.Printf("Kernel entry point at %#x", kernelEntry)
 
 	log.Printf("Parsing ELF segments")
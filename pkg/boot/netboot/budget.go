@@ -0,0 +1,96 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netboot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/boot"
+)
+
+// ErrBudgetExceeded is returned when reading the artifacts of a boot entry
+// needs more than Options.MaxTotalBytes.
+var ErrBudgetExceeded = errors.New("boot artifacts exceed the total size budget")
+
+// budget tracks the bytes downloaded for all artifacts of one boot entry.
+type budget struct {
+	max int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+func (b *budget) add(n int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used += n
+	if b.used > b.max {
+		return fmt.Errorf("%w: read %d bytes, budget is %d bytes", ErrBudgetExceeded, b.used, b.max)
+	}
+	return nil
+}
+
+// budgetReaderAt charges every byte of r read for the first time to a
+// budget.
+//
+// Artifacts are fetched as they are read, so the largest offset read so far
+// is what has been downloaded.
+type budgetReaderAt struct {
+	r io.ReaderAt
+	b *budget
+
+	mu   sync.Mutex
+	read int64
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *budgetReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(p, off)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if end := off + int64(n); end > r.read {
+		if berr := r.b.add(end - r.read); berr != nil {
+			return 0, fmt.Errorf("reading %s: %w", r, berr)
+		}
+		r.read = end
+	}
+	return n, err
+}
+
+// String returns the name of the underlying artifact, if it has one.
+func (r *budgetReaderAt) String() string {
+	if s, ok := r.r.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", r.r)
+}
+
+// limitImage makes reading all artifacts of img fail with ErrBudgetExceeded
+// once more than max bytes have been read in total.
+func limitImage(img boot.OSImage, max int64) {
+	b := &budget{max: max}
+	limit := func(r io.ReaderAt) io.ReaderAt {
+		if r == nil {
+			return nil
+		}
+		return &budgetReaderAt{r: r, b: b}
+	}
+
+	switch img := img.(type) {
+	case *boot.LinuxImage:
+		img.Kernel = limit(img.Kernel)
+		img.Initrd = limit(img.Initrd)
+		img.KexecOpts.DTB = limit(img.KexecOpts.DTB)
+	case *boot.MultibootImage:
+		img.Kernel = limit(img.Kernel)
+		for i := range img.Modules {
+			img.Modules[i].Module = limit(img.Modules[i].Module)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netboot
+
+import (
+	"context"
+	"io"
+	"net/url"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+// Entry is a boot entry found by Inspect, with the URLs of its files
+// resolved but not fetched.
+type Entry struct {
+	// Label is the label of Image in boot menus.
+	Label string
+
+	// Kernel, Initrds, DTB and Cmdline are those of a Linux image. URLs
+	// are nil for files that were not fetched from a URL.
+	Kernel  *url.URL
+	Initrds []*url.URL
+	DTB     *url.URL
+	Cmdline string
+
+	// Image is the image BootImagesWithOptions would return. Loading it
+	// downloads its files.
+	Image boot.OSImage
+}
+
+// fileURL returns the URL f was fetched from, or nil if it was not.
+func fileURL(f io.ReaderAt) *url.URL {
+	if f, ok := f.(interface{ URL() *url.URL }); ok {
+		return f.URL()
+	}
+	return nil
+}
+
+// initrdURLs returns the URLs of the initrds concatenated in initrd.
+func initrdURLs(initrd io.ReaderAt) []*url.URL {
+	if initrd == nil {
+		return nil
+	}
+	initrds := []io.ReaderAt{initrd}
+	if cat, ok := initrd.(interface{ Initrds() []io.ReaderAt }); ok {
+		initrds = cat.Initrds()
+	}
+	var urls []*url.URL
+	for _, i := range initrds {
+		urls = append(urls, fileURL(i))
+	}
+	return urls
+}
+
+// Inspect returns the entries BootImagesWithOptions would find for lease,
+// without downloading their kernels and initrds, e.g. to validate a
+// deployment's boot configuration in CI.
+//
+// Only the boot configs are fetched. A boot file that may be a kernel
+// rather than a config is not fetched to find out, so it yields no entry.
+func Inspect(ctx context.Context, l ulog.Logger, s curl.Schemes, lease dhclient.Lease, opts Options) ([]Entry, error) {
+	images, err := leaseBootImages(ctx, l, s, lease, opts.BootServer, false)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(images))
+	for _, img := range images {
+		// The URLs are taken before opts wraps the files.
+		e := Entry{Label: img.Label()}
+		if li, ok := img.(*boot.LinuxImage); ok {
+			e.Kernel = fileURL(li.Kernel)
+			e.Initrds = initrdURLs(li.Initrd)
+			e.DTB = fileURL(li.KexecOpts.DTB)
+			e.Cmdline = li.Cmdline
+		}
+		applied := applyOptions(l, s, []boot.OSImage{img}, opts)
+		if len(applied) == 0 {
+			continue
+		}
+		e.Image = applied[0]
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netboot
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/ulog/ulogtest"
+)
+
+func urlStrings(urls ...*url.URL) []string {
+	var s []string
+	for _, u := range urls {
+		s = append(s, u.String())
+	}
+	return s
+}
+
+func TestInspect(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("10.0.0.1", "/boot/boot.ipxe", "#!ipxe\nkernel vmlinuz console=ttyS0 BOOTIF=${mac}\ninitrd /ucode.img,initramfs.img\nboot\n")
+	fs.Add("10.0.0.1", "/boot/grub.cfg", "menuentry 'rescue' {\n\tlinux $prefix/rescue/vmlinuz rescue\n\tdevicetree $prefix/board.dtb\n}\n")
+	s := curl.Schemes{"http": fs}
+
+	entries, err := Inspect(context.Background(), ulogtest.Logger{TB: t}, s, testLease(t, "http://10.0.0.1/boot/boot.ipxe"), Options{})
+	if err != nil {
+		t.Fatalf("Inspect() = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Inspect() = %d entries, want 2: %+v", len(entries), entries)
+	}
+
+	ipxe := entries[0]
+	if got, want := ipxe.Kernel.String(), "http://10.0.0.1/boot/vmlinuz"; got != want {
+		t.Errorf("iPXE kernel = %s, want %s", got, want)
+	}
+	if got, want := urlStrings(ipxe.Initrds...), []string{"http://10.0.0.1/ucode.img", "http://10.0.0.1/boot/initramfs.img"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("iPXE initrds = %v, want %v", got, want)
+	}
+	if got, want := ipxe.Cmdline, "console=ttyS0 BOOTIF=02:00:00:00:00:01"; got != want {
+		t.Errorf("iPXE cmdline = %q, want %q", got, want)
+	}
+	if ipxe.DTB != nil {
+		t.Errorf("iPXE DTB = %s, want none", ipxe.DTB)
+	}
+
+	grub := entries[1]
+	if grub.Label != "rescue" || grub.Cmdline != "rescue" {
+		t.Errorf("GRUB entry = %q with cmdline %q, want %q with cmdline %q", grub.Label, grub.Cmdline, "rescue", "rescue")
+	}
+	if got, want := grub.Kernel.String(), "http://10.0.0.1/boot/rescue/vmlinuz"; got != want {
+		t.Errorf("GRUB kernel = %s, want %s", got, want)
+	}
+	if got, want := grub.DTB.String(), "http://10.0.0.1/boot/board.dtb"; got != want {
+		t.Errorf("GRUB DTB = %s, want %s", got, want)
+	}
+	if len(grub.Initrds) != 0 {
+		t.Errorf("GRUB initrds = %v, want none", grub.Initrds)
+	}
+
+	// None of the files were fetched, although they don't even exist.
+	for _, e := range entries {
+		for _, u := range append(append(ipxe.Initrds, e.Kernel), e.DTB) {
+			if u != nil && fs.NumCalled(u) != 0 {
+				t.Errorf("Inspect() fetched %s", u)
+			}
+		}
+	}
+}
+
+func TestInspectBinaryBootFile(t *testing.T) {
+	fs := curl.NewMockScheme("tftp")
+	fs.Add("10.0.0.1", "/vmlinuz.efi", "kernel")
+	s := curl.Schemes{"tftp": fs}
+
+	lease := testLease(t, "/vmlinuz.efi")
+	lease.(*dhclient.Packet4).P.ServerIPAddr = net.IP{10, 0, 0, 1}
+	entries, err := Inspect(context.Background(), ulogtest.Logger{TB: t}, s, lease, Options{})
+	if err != nil {
+		t.Fatalf("Inspect() = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Inspect() = %+v, want no entries", entries)
+	}
+	if u := (&url.URL{Scheme: "tftp", Host: "10.0.0.1", Path: "/vmlinuz.efi"}); fs.NumCalled(u) != 0 {
+		t.Errorf("Inspect() fetched %s", u)
+	}
+}
+
+func TestInspectBootServer(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("10.0.0.1", "/tftpboot/boot.ipxe", "#!ipxe\nkernel vmlinuz\nboot\n")
+	s := curl.Schemes{"http": fs}
+
+	lease := testLease(t, "boot.ipxe")
+	lease.(*dhclient.Packet4).P.ServerIPAddr = net.IP{10, 0, 0, 99}
+	opts := Options{BootServer: &url.URL{Scheme: "http", Host: "10.0.0.1", Path: "/tftpboot"}}
+	entries, err := Inspect(context.Background(), ulogtest.Logger{TB: t}, s, lease, opts)
+	if err != nil {
+		t.Fatalf("Inspect() = %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Inspect() = %+v, want 1 entry", entries)
+	}
+	if got, want := entries[0].Kernel.String(), "http://10.0.0.1/tftpboot/vmlinuz"; got != want {
+		t.Errorf("kernel = %s, want %s", got, want)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"strings"
 
 	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/util"
 	"github.com/u-root/u-root/pkg/curl"
 	"github.com/u-root/u-root/pkg/uio"
 	"github.com/u-root/u-root/pkg/ulog"
@@ -24,17 +25,35 @@ import (
 // ipxe script.
 var ErrNotIpxeScript = errors.New("config file is not ipxe as it does not start with #!ipxe")
 
+// ErrChainTooDeep is returned when scripts chain to each other more than
+// MaxChainDepth times, e.g. because they chain in a loop.
+var ErrChainTooDeep = errors.New("too many chained ipxe scripts")
+
+// MaxChainDepth is the maximum number of nested "chain" commands followed.
+const MaxChainDepth = 8
+
 // parser encapsulates a parsed ipxe configuration file.
 //
-// We currently only support kernel and initrd commands.
+// We currently only support the kernel, initrd, imgfetch, chain, set, isset
+// and iseq commands, joined by || and &&, as well as dtb to load a device
+// tree.
 type parser struct {
-	bootImage *boot.LinuxImage
+	bootImage  *boot.LinuxImage
+	initrds    []io.ReaderAt
+	initrdHash *boot.Hash
 
 	// wd is the current working directory.
 	//
 	// Relative file paths are interpreted relative to this URL.
 	wd *url.URL
 
+	// vars are the ipxe settings, e.g. "ip" or "mac", used to expand
+	// ${name} in commands.
+	vars map[string]string
+
+	// depth is the number of chain commands followed so far.
+	depth int
+
 	log ulog.Logger
 
 	schemes curl.Schemes
@@ -45,9 +64,21 @@ type parser struct {
 //
 // `s` is used to get files referred to by URLs in the configuration.
 func ParseConfig(ctx context.Context, l ulog.Logger, configURL *url.URL, s curl.Schemes) (*boot.LinuxImage, error) {
+	return ParseConfigWithVars(ctx, l, configURL, s, nil)
+}
+
+// ParseConfigWithVars is like ParseConfig, but expands ${name} in the
+// configuration with vars, e.g. values from the DHCP lease such as "ip",
+// "mac" or "next-server".
+func ParseConfigWithVars(ctx context.Context, l ulog.Logger, configURL *url.URL, s curl.Schemes, vars map[string]string) (*boot.LinuxImage, error) {
 	c := &parser{
-		schemes: s,
-		log:     l,
+		bootImage: &boot.LinuxImage{},
+		vars:      make(map[string]string),
+		schemes:   s,
+		log:       l,
+	}
+	for k, v := range vars {
+		c.vars[k] = v
 	}
 	if err := c.getAndParseFile(ctx, configURL); err != nil {
 		return nil, err
@@ -55,29 +86,41 @@ func ParseConfig(ctx context.Context, l ulog.Logger, configURL *url.URL, s curl.
 	return c.bootImage, nil
 }
 
-// getAndParse parses the config file downloaded from `url` and fills in `c`.
-func (c *parser) getAndParseFile(ctx context.Context, u *url.URL) error {
+// getScript downloads the ipxe script at `u`.
+func (c *parser) getScript(ctx context.Context, u *url.URL) (io.ReaderAt, string, error) {
 	r, err := c.schemes.Fetch(ctx, u)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	data, err := uio.ReadAll(r)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	config := string(data)
+	config := util.NormalizeScript(string(data))
 	if !strings.HasPrefix(config, "#!ipxe") {
-		return ErrNotIpxeScript
+		return r, "", ErrNotIpxeScript
 	}
 	c.log.Printf("Got ipxe config file %s:\n%s\n", r, config)
+	return r, config, nil
+}
 
-	// Parent dir of the config file.
+// getAndParse parses the config file downloaded from `url` and fills in `c`.
+func (c *parser) getAndParseFile(ctx context.Context, u *url.URL) error {
+	_, config, err := c.getScript(ctx, u)
+	if err != nil {
+		return err
+	}
+	c.setWD(u)
+	return c.parseIpxe(ctx, config)
+}
+
+// setWD sets the working directory to the parent dir of the config file at u.
+func (c *parser) setWD(u *url.URL) {
 	c.wd = &url.URL{
 		Scheme: u.Scheme,
 		Host:   u.Host,
 		Path:   path.Dir(u.Path),
 	}
-	return c.parseIpxe(config)
 }
 
 // getFile parses `surl` and returns an io.Reader for the requested url.
@@ -114,19 +157,92 @@ func parseURL(name string, wd *url.URL) (*url.URL, error) {
 	return u, nil
 }
 
-func (c *parser) createInitrd(initrds []io.ReaderAt) {
-	if len(initrds) > 0 {
-		c.bootImage.Initrd = boot.CatInitrds(initrds...)
+func (c *parser) createInitrd() error {
+	if c.initrdHash != nil {
+		// The digest is of a single file, not of the padded
+		// concatenation of several.
+		if len(c.initrds) != 1 {
+			return fmt.Errorf("initrd digest %s given for %d initrds, want 1", c.initrdHash, len(c.initrds))
+		}
+		c.bootImage.InitrdHash = c.initrdHash
+	}
+	if len(c.initrds) > 0 {
+		c.bootImage.Initrd = boot.CatInitrds(c.initrds...)
+	}
+	return nil
+}
+
+// expand replaces ${name} and ${name:type} in line with the value of the
+// named setting. Unknown settings expand to the empty string, as in ipxe.
+//
+// Of the types, only hexhyp, which separates bytes with hyphens instead of
+// colons, changes the value.
+func (c *parser) expand(line string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(line, "${")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(line[i:], '}')
+		if j < 0 {
+			break
+		}
+		name, typ := line[i+2:i+j], ""
+		if k := strings.IndexByte(name, ':'); k >= 0 {
+			name, typ = name[:k], name[k+1:]
+		}
+		value := c.vars[name]
+		if typ == "hexhyp" {
+			value = strings.ReplaceAll(value, ":", "-")
+		}
+		b.WriteString(line[:i])
+		b.WriteString(value)
+		line = line[i+j+1:]
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// optionsWithValue are the image command options that take a value.
+var optionsWithValue = map[string]bool{
+	"--name":    true,
+	"-n":        true,
+	"--timeout": true,
+	"-t":        true,
+	"--sha1":    true,
+	"--sha256":  true,
+}
+
+// parseOptions removes leading options such as --name or --autofree from
+// the arguments of an image command. It returns the expected digest of the
+// image given by --sha1 or --sha256, which are u-root extensions.
+func parseOptions(args []string) ([]string, *boot.Hash, error) {
+	var h *boot.Hash
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		opt, value := args[0], ""
+		if i := strings.IndexByte(opt, '='); i >= 0 {
+			opt, value = opt[:i], opt[i+1:]
+		} else if optionsWithValue[opt] && len(args) > 1 {
+			value = args[1]
+			args = args[1:]
+		}
+		args = args[1:]
+
+		switch opt {
+		case "--sha1", "--sha256":
+			var err error
+			if h, err = boot.NewHash(strings.TrimPrefix(opt, "--"), value); err != nil {
+				return nil, nil, err
+			}
+		}
 	}
+	return args, h, nil
 }
 
 // parseIpxe parses `config` and constructs a BootImage for `c`.
-func (c *parser) parseIpxe(config string) error {
+func (c *parser) parseIpxe(ctx context.Context, config string) error {
 	// A trivial ipxe script parser.
-	// Currently only supports kernel and initrd commands.
-	c.bootImage = &boot.LinuxImage{}
-
-	var initrds []io.ReaderAt
 	for _, line := range strings.Split(config, "\n") {
 		// Skip blank lines and comment lines.
 		line = strings.TrimSpace(line)
@@ -134,50 +250,172 @@ func (c *parser) parseIpxe(config string) error {
 			continue
 		}
 
-		args := strings.Fields(line)
+		args := strings.Fields(c.expand(line))
 		if len(args) == 0 {
 			continue
 		}
-		cmd := strings.ToLower(args[0])
 
-		switch cmd {
-		case "kernel":
-			if len(args) > 1 {
-				k, err := c.getFile(args[1])
-				if err != nil {
-					return err
+		// Commands are joined by || and &&, which run the next
+		// command if the previous one failed or succeeded,
+		// respectively.
+		var (
+			err  error
+			done bool
+			skip bool
+		)
+		for len(args) > 0 {
+			n := len(args)
+			for i, a := range args {
+				if a == "||" || a == "&&" {
+					n = i
+					break
 				}
-				c.bootImage.Kernel = k
 			}
+			if !skip {
+				done, err = c.runCmd(ctx, args[:n])
+				if done {
+					break
+				}
+			}
+			if n == len(args) {
+				break
+			}
+			if args[n] == "||" {
+				skip = err == nil
+			} else {
+				skip = err != nil
+			}
+			args = args[n+1:]
+		}
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
 
-			// Add cmdline if there are any.
-			if len(args) > 2 {
-				c.bootImage.Cmdline = strings.Join(args[2:], " ")
+	// EOF - we should go ahead and boot.
+	return c.createInitrd()
+}
+
+// runCmd runs a single ipxe command. done is true if parsing should stop
+// because the image is ready to boot.
+func (c *parser) runCmd(ctx context.Context, args []string) (done bool, err error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch cmd := strings.ToLower(args[0]); cmd {
+	case "kernel":
+		args, h, err := parseOptions(args[1:])
+		if err != nil {
+			return false, err
+		}
+		if len(args) > 0 {
+			k, err := c.getFile(args[0])
+			if err != nil {
+				return false, err
 			}
+			c.bootImage.Kernel = k
+			c.bootImage.KernelHash = h
+		}
+
+		// Add cmdline if there are any.
+		if len(args) > 1 {
+			c.bootImage.Cmdline = strings.Join(args[1:], " ")
+		}
 
-		case "initrd":
-			if len(args) > 1 {
-				for _, f := range strings.Split(args[1], ",") {
-					i, err := c.getFile(f)
-					if err != nil {
-						return err
-					}
-					initrds = append(initrds, i)
+	case "initrd", "imgfetch", "module":
+		args, h, err := parseOptions(args[1:])
+		if err != nil {
+			return false, err
+		}
+		if len(args) > 0 {
+			for _, f := range strings.Split(args[0], ",") {
+				i, err := c.getFile(f)
+				if err != nil {
+					return false, err
 				}
+				c.initrds = append(c.initrds, i)
 			}
+		}
+		if h != nil {
+			c.initrdHash = h
+		}
 
-		case "boot":
-			// Stop parsing at this point, we should go ahead and
-			// boot.
-			c.createInitrd(initrds)
-			return nil
+	case "dtb":
+		// Not an ipxe command: the device tree arm64 kernels need
+		// to be kexec'ed.
+		if len(args) < 2 {
+			return false, fmt.Errorf("dtb: missing URL")
+		}
+		d, err := c.getFile(args[1])
+		if err != nil {
+			return false, err
+		}
+		c.bootImage.KexecOpts.DTB = d
+
+	case "chain":
+		args, h, err := parseOptions(args[1:])
+		if err != nil {
+			return false, err
+		}
+		if len(args) == 0 {
+			return false, fmt.Errorf("chain: missing URL")
+		}
+		err = c.chain(ctx, args[0], args[1:], h)
+		return err == nil, err
 
-		default:
-			c.log.Printf("Ignoring unsupported ipxe cmd: %s", line)
+	case "set":
+		if len(args) < 2 {
+			return false, fmt.Errorf("set: missing setting name")
 		}
+		c.vars[args[1]] = strings.Join(args[2:], " ")
+
+	case "isset":
+		if len(args) < 2 {
+			return false, fmt.Errorf("setting is not set")
+		}
+
+	case "iseq":
+		if len(args) != 3 || args[1] != args[2] {
+			return false, fmt.Errorf("%q is not equal", args[1:])
+		}
+
+	case "boot":
+		// Stop parsing at this point, we should go ahead and
+		// boot.
+		return true, c.createInitrd()
+
+	default:
+		c.log.Printf("Ignoring unsupported ipxe cmd: %s", strings.Join(args, " "))
 	}
+	return false, nil
+}
 
-	// EOF - we should go ahead and boot.
-	c.createInitrd(initrds)
-	return nil
+// chain fetches the script or kernel at surl and continues with it. If it is
+// a kernel, cmdline is its command line and h its expected digest.
+func (c *parser) chain(ctx context.Context, surl string, cmdline []string, h *boot.Hash) error {
+	if c.depth >= MaxChainDepth {
+		return ErrChainTooDeep
+	}
+	c.depth++
+
+	u, err := parseURL(surl, c.wd)
+	if err != nil {
+		return err
+	}
+	r, config, err := c.getScript(ctx, u)
+	if err == ErrNotIpxeScript {
+		// Not a script, so boot it.
+		c.bootImage.Kernel = r
+		c.bootImage.KernelHash = h
+		c.bootImage.Cmdline = strings.Join(cmdline, " ")
+		return c.createInitrd()
+	}
+	if err != nil {
+		return err
+	}
+	c.setWD(u)
+	return c.parseIpxe(ctx, config)
 }
@@ -6,14 +6,19 @@ package ipxe
 
 import (
 	"context"
+	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/linux"
 	"github.com/u-root/u-root/pkg/curl"
 	"github.com/u-root/u-root/pkg/uio"
 	"github.com/u-root/u-root/pkg/ulog/ulogtest"
@@ -413,6 +418,36 @@ func TestIpxeConfig(t *testing.T) {
 				Initrd: strings.NewReader(content2),
 			},
 		},
+		{
+			desc: "config with a device tree",
+			schemeFunc: func() curl.Schemes {
+				s := make(curl.Schemes)
+				fs := curl.NewMockScheme("http")
+				conf := `#!ipxe
+				kernel http://someplace.com/foobar/pxefiles/kernel
+				initrd initrd-file
+				dtb board.dtb
+				boot`
+				fs.Add("someplace.com", "/foobar/pxefiles/ipxeconfig", conf)
+				fs.Add("someplace.com", "/foobar/pxefiles/kernel", content1)
+				fs.Add("someplace.com", "/foobar/pxefiles/initrd-file", content2)
+				fs.Add("someplace.com", "/foobar/pxefiles/board.dtb", "dtb")
+				s.Register(fs.Scheme, fs)
+				return s
+			},
+			curl: &url.URL{
+				Scheme: "http",
+				Host:   "someplace.com",
+				Path:   "/foobar/pxefiles/ipxeconfig",
+			},
+			want: &boot.LinuxImage{
+				Kernel: strings.NewReader(content1),
+				Initrd: strings.NewReader(content2),
+				KexecOpts: linux.KexecOptions{
+					DTB: strings.NewReader("dtb"),
+				},
+			},
+		},
 		{
 			desc: "valid config with unsupported cmds",
 			schemeFunc: func() curl.Schemes {
@@ -462,6 +497,198 @@ func TestIpxeConfig(t *testing.T) {
 			if got.Cmdline != want.Cmdline {
 				t.Errorf("got cmdline %s, want %s", got.Cmdline, want.Cmdline)
 			}
+			// Same DTB?
+			if !uio.ReaderAtEqual(got.KexecOpts.DTB, want.KexecOpts.DTB) {
+				t.Errorf("got DTB %s, want %s", mustReadAll(got.KexecOpts.DTB), mustReadAll(want.KexecOpts.DTB))
+			}
+		})
+	}
+}
+
+func TestIpxeConfigWindowsLineEndings(t *testing.T) {
+	const conf = "#!ipxe\n" +
+		"kernel vmlinuz console=ttyS0\n" +
+		"initrd initrd-file\n" +
+		"boot\n"
+	parse := func(conf string) *boot.LinuxImage {
+		fs := curl.NewMockScheme("http")
+		fs.Add("someplace.com", "/ipxeconfig", conf)
+		fs.Add("someplace.com", "/vmlinuz", "kernel")
+		fs.Add("someplace.com", "/initrd-file", "initrd")
+		u := mustParseURL("http://someplace.com/ipxeconfig")
+		img, err := ParseConfig(context.Background(), ulogtest.Logger{TB: t}, u, curl.Schemes{"http": fs})
+		if err != nil {
+			t.Fatalf("ParseConfig(%q) = %v", conf, err)
+		}
+		return img
+	}
+
+	want := parse(conf)
+	for _, tt := range []struct {
+		name string
+		conf string
+	}{
+		{"BOM", "\ufeff" + conf},
+		{"CRLF", strings.ReplaceAll(conf, "\n", "\r\n")},
+		{"trailing whitespace", strings.ReplaceAll(conf, "\n", " \t\n")},
+		{"all", "\ufeff" + strings.ReplaceAll(conf, "\n", " \r\n")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parse(tt.conf)
+			if !uio.ReaderAtEqual(got.Kernel, want.Kernel) {
+				t.Errorf("got kernel %s, want %s", mustReadAll(got.Kernel), mustReadAll(want.Kernel))
+			}
+			if !uio.ReaderAtEqual(got.Initrd, want.Initrd) {
+				t.Errorf("got initrd %s, want %s", mustReadAll(got.Initrd), mustReadAll(want.Initrd))
+			}
+			if got.Cmdline != want.Cmdline {
+				t.Errorf("got cmdline %q, want %q", got.Cmdline, want.Cmdline)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	files := map[string]string{
+		"/boot.ipxe": `#!ipxe
+isset ${console} || set console tty0
+set base ${scheme}://${host}/images
+chain hop1/${mac}.ipxe || chain hop1/default.ipxe
+kernel never-reached
+`,
+		"/hop1/default.ipxe": `#!ipxe
+chain --autofree ../hop2.ipxe`,
+		"/hop2.ipxe": `#!ipxe
+kernel ${base}/kernel console=${console:string}
+imgfetch --name initrd ${base}/initrd
+module ${base}/extra
+boot`,
+		"/loop.ipxe": `#!ipxe
+chain loop.ipxe`,
+		"/kernel.ipxe": `#!ipxe
+initrd images/initrd
+chain images/kernel quiet`,
+		"/images/kernel": "kernel",
+		"/images/initrd": "initrd",
+		"/images/extra":  "extra",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, content)
+	}))
+	defer srv.Close()
+	base := mustParseURL(srv.URL)
+	vars := map[string]string{
+		"scheme": base.Scheme,
+		"host":   base.Host,
+		"mac":    "02:00:00:00:00:01",
+	}
+
+	for _, tt := range []struct {
+		desc   string
+		config string
+		want   *boot.LinuxImage
+		err    error
+	}{
+		{
+			desc:   "two hops",
+			config: "/boot.ipxe",
+			want: &boot.LinuxImage{
+				Kernel:  strings.NewReader("kernel"),
+				Initrd:  boot.CatInitrds(strings.NewReader("initrd"), strings.NewReader("extra")),
+				Cmdline: "console=tty0",
+			},
+		},
+		{
+			desc:   "chain to kernel",
+			config: "/kernel.ipxe",
+			want: &boot.LinuxImage{
+				Kernel:  strings.NewReader("kernel"),
+				Initrd:  strings.NewReader("initrd"),
+				Cmdline: "quiet",
+			},
+		},
+		{
+			desc:   "loop",
+			config: "/loop.ipxe",
+			err:    ErrChainTooDeep,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			u := *base
+			u.Path = tt.config
+			got, err := ParseConfigWithVars(context.Background(), ulogtest.Logger{TB: t}, &u, curl.DefaultSchemes, vars)
+			if err != tt.err {
+				t.Fatalf("ParseConfigWithVars() = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if !uio.ReaderAtEqual(got.Kernel, tt.want.Kernel) {
+				t.Errorf("got kernel %s, want %s", mustReadAll(got.Kernel), mustReadAll(tt.want.Kernel))
+			}
+			if !uio.ReaderAtEqual(got.Initrd, tt.want.Initrd) {
+				t.Errorf("got initrd %s, want %s", mustReadAll(got.Initrd), mustReadAll(tt.want.Initrd))
+			}
+			if got.Cmdline != tt.want.Cmdline {
+				t.Errorf("got cmdline %s, want %s", got.Cmdline, tt.want.Cmdline)
+			}
+		})
+	}
+}
+
+func TestDigestOptions(t *testing.T) {
+	kernelSum := fmt.Sprintf("%x", sha256.Sum256([]byte("kernel")))
+	initrdSum := fmt.Sprintf("%x", sha1.Sum([]byte("initrd")))
+
+	for _, tt := range []struct {
+		desc           string
+		conf           string
+		wantKernelHash string
+		wantInitrdHash string
+		wantErr        bool
+	}{
+		{
+			desc:           "kernel and initrd digests",
+			conf:           "#!ipxe\nkernel --sha256=" + kernelSum + " kernel\ninitrd --sha1 " + initrdSum + " initrd\nboot",
+			wantKernelHash: "sha256:" + kernelSum,
+			wantInitrdHash: "sha1:" + initrdSum,
+		},
+		{
+			desc:    "invalid digest",
+			conf:    "#!ipxe\nkernel --sha256=abcd kernel\nboot",
+			wantErr: true,
+		},
+		{
+			desc:    "digest for several initrds",
+			conf:    "#!ipxe\nkernel kernel\ninitrd --sha1=" + initrdSum + " initrd,initrd\nboot",
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			fs := curl.NewMockScheme("http")
+			fs.Add("someplace.com", "/ipxeconfig", tt.conf)
+			fs.Add("someplace.com", "/kernel", "kernel")
+			fs.Add("someplace.com", "/initrd", "initrd")
+			s := curl.Schemes{"http": fs}
+
+			got, err := ParseConfig(context.Background(), ulogtest.Logger{TB: t}, mustParseURL("http://someplace.com/ipxeconfig"), s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConfig() = %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.KernelHash == nil || got.KernelHash.String() != tt.wantKernelHash {
+				t.Errorf("kernel hash = %v, want %s", got.KernelHash, tt.wantKernelHash)
+			}
+			if got.InitrdHash == nil || got.InitrdHash.String() != tt.wantInitrdHash {
+				t.Errorf("initrd hash = %v, want %s", got.InitrdHash, tt.wantInitrdHash)
+			}
 		})
 	}
 }
@@ -12,53 +12,353 @@ package netboot
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/url"
 	"path"
+	"strings"
 
 	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/grub"
 	"github.com/u-root/u-root/pkg/boot/netboot/ipxe"
 	"github.com/u-root/u-root/pkg/boot/netboot/pxe"
 	"github.com/u-root/u-root/pkg/boot/netboot/simple"
 	"github.com/u-root/u-root/pkg/curl"
 	"github.com/u-root/u-root/pkg/dhclient"
 	"github.com/u-root/u-root/pkg/ulog"
+	"golang.org/x/crypto/openpgp"
 )
 
+// Options are optional parameters to BootImagesWithOptions.
+type Options struct {
+	// MaxTotalBytes, if positive, is the maximum number of bytes that may
+	// be downloaded for all artifacts of a single boot entry together.
+	//
+	// Loading an entry that needs more fails with ErrBudgetExceeded, so
+	// boot menus move on to the next entry.
+	MaxTotalBytes int64
+
+	// KeyRing, if set, holds the keys trusted to sign Linux kernels.
+	//
+	// The detached signature of each kernel is fetched from the
+	// kernel's URL with ".sig" appended, and loading a kernel whose
+	// signature is missing or invalid fails with boot.ErrBadSignature.
+	// Images whose signatures cannot be checked this way, e.g.
+	// multiboot kernels, are dropped.
+	KeyRing openpgp.KeyRing
+
+	// BootServer, if set, is the base URL plain boot file names given by
+	// DHCP are resolved against, instead of the next server, server host
+	// name or PXE boot server, e.g. when a DHCP relay gives a wrong one.
+	// Relative references in the boot file, e.g. a kernel in an iPXE
+	// script, are then resolved against it too.
+	//
+	// It may be a TFTP root, e.g. tftp://10.0.0.5/tftpboot, or only name
+	// the server, e.g. tftp://10.0.0.5. Boot files given as full URLs are
+	// used as they are.
+	BootServer *url.URL
+}
+
 // BootImages figure out a ranked order of images to boot from the given DHCP lease.
 //
-// Tries, in order:
+// If the lease's boot file is a plain file name on the TFTP server rather
+// than a URL, and the name tells what it is, only the matching formats are
+// tried: pxelinux.cfg for pxelinux, grub.cfg for GRUB, and a kernel image
+// followed by pxelinux.cfg and grub.cfg for other binaries, e.g.
+// undionly.kpxe or shimx64.efi. Otherwise BootImages tries, in order:
 //
 // - to detect an iPXE script beginning with #!ipxe,
 //
 // - to detect a pxelinux.0, in which case we will ignore the pxelinux.0 and
-//   try to parse pxelinux.cfg/<files>.
+//   try to parse pxelinux.cfg/<files>,
+//
+// - to find a GRUB grub.cfg next to the boot file.
 func BootImages(ctx context.Context, l ulog.Logger, s curl.Schemes, lease dhclient.Lease) ([]boot.OSImage, error) {
-	uri, err := lease.Boot()
+	return BootImagesWithOptions(ctx, l, s, lease, Options{})
+}
+
+// BootImagesWithOptions is like BootImages, but applies opts to the
+// discovered images.
+func BootImagesWithOptions(ctx context.Context, l ulog.Logger, s curl.Schemes, lease dhclient.Lease, opts Options) ([]boot.OSImage, error) {
+	images, err := leaseBootImages(ctx, l, s, lease, opts.BootServer, true)
+	if err != nil {
+		return nil, err
+	}
+	return applyOptions(l, s, images, opts), nil
+}
+
+// applyOptions applies the KeyRing and MaxTotalBytes of opts to images, and
+// returns those that are left.
+func applyOptions(l ulog.Logger, s curl.Schemes, images []boot.OSImage, opts Options) []boot.OSImage {
+	if opts.KeyRing != nil {
+		signed := images[:0]
+		for _, img := range images {
+			if !requireSignature(img, s, opts.KeyRing) {
+				l.Printf("Dropping %s: its signature cannot be verified", img.Label())
+				continue
+			}
+			signed = append(signed, img)
+		}
+		images = signed
+	}
+	if opts.MaxTotalBytes > 0 {
+		for _, img := range images {
+			limitImage(img, opts.MaxTotalBytes)
+		}
+	}
+	return images
+}
+
+// leaseBootImages returns the images of the boot file given by lease. Plain
+// boot file names are resolved against server, if set. If probe is false, a
+// boot file that may be a kernel rather than a config is not fetched to find
+// out.
+func leaseBootImages(ctx context.Context, l ulog.Logger, s curl.Schemes, lease dhclient.Lease, server *url.URL, probe bool) ([]boot.OSImage, error) {
+	uri, err := bootURI(l, lease, server)
 	if err != nil {
 		return nil, err
 	}
 	l.Printf("Boot URI: %s", uri)
 
+	vars := ipxeVars(lease)
+	if server != nil && server.Hostname() != "" {
+		vars["next-server"] = server.Hostname()
+	}
+
 	// IP only makes sense for v4 anyway, because the PXE probing of files
 	// uses a MAC address and an IPv4 address to look at files.
 	var ip net.IP
+	kind := bootFileUnknown
 	if p4, ok := lease.(*dhclient.Packet4); ok {
 		ip = p4.Lease().IP
+		kind = classifyBootFile(p4.BootFileName())
+	}
+	return getBootImages(ctx, l, s, uri, kind, lease.Link().Attrs().HardwareAddr, ip, vars, probe), nil
+}
+
+// bootURI returns the URL of the boot file given by lease. A plain file name
+// is resolved against server if it is set, and otherwise against the boot
+// server given by DHCP.
+func bootURI(l ulog.Logger, lease dhclient.Lease, server *url.URL) (*url.URL, error) {
+	p4, isV4 := lease.(*dhclient.Packet4)
+	if server != nil && isV4 {
+		// Packet4.Boot fails without a server given by DHCP.
+		if file := p4.BootFileName(); file != "" {
+			if u, err := url.Parse(file); err == nil && u.Scheme == "" {
+				return resolveBootFile(server, file), nil
+			}
+		}
+	}
+
+	uri, err := lease.Boot()
+	if isV4 {
+		// Proxy DHCP servers give the boot server in PXE vendor
+		// options rather than as next server.
+		if pxeURI, perr := pxeBootURI(p4); perr != nil {
+			l.Printf("Ignoring PXE vendor options: %v", perr)
+		} else if pxeURI != nil {
+			uri, err = pxeURI, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if server != nil && uri.Scheme == "" {
+		return resolveBootFile(server, uri.Path), nil
+	}
+	return uri, nil
+}
+
+// resolveBootFile returns the URL of the boot file name on server. Names are
+// relative to the path of server even if they start with a slash, as TFTP
+// servers resolve them relative to their root.
+func resolveBootFile(server *url.URL, name string) *url.URL {
+	u := *server
+	u.Path = path.Join("/", server.Path, name)
+	u.RawPath = ""
+	u.RawQuery, u.Fragment = "", ""
+	return &u
+}
+
+// sigSuffix is appended to a kernel's URL to get its detached signature.
+const sigSuffix = ".sig"
+
+// requireSignature makes loading img fail unless its kernel is signed by a
+// key in keyring. It returns false if img is not a Linux image, whose
+// signature cannot be verified.
+func requireSignature(img boot.OSImage, s curl.Schemes, keyring openpgp.KeyRing) bool {
+	li, ok := img.(*boot.LinuxImage)
+	if !ok {
+		return false
+	}
+	sig := &boot.Signature{KeyRing: keyring}
+	if k, ok := li.Kernel.(interface{ URL() *url.URL }); ok {
+		u := *k.URL()
+		u.Path += sigSuffix
+		// Without a signature, verification fails.
+		sig.Sig, _ = s.LazyFetch(&u)
+	}
+	li.KernelSignature = sig
+	return true
+}
+
+// ErrNoBootImages is returned by BootImagesWithFallback when none of the
+// leases yields a boot image.
+var ErrNoBootImages = errors.New("no boot images found")
+
+// BootImagesWithFallback tries BootImages with each of the leases in order,
+// and returns the images of the first that yields at least one.
+//
+// If none does, the returned error wraps ErrNoBootImages and describes why
+// each lease failed.
+func BootImagesWithFallback(ctx context.Context, l ulog.Logger, s curl.Schemes, leases ...dhclient.Lease) ([]boot.OSImage, error) {
+	var errs []string
+	for i, lease := range leases {
+		images, err := BootImages(ctx, l, s, lease)
+		if err == nil && len(images) > 0 {
+			return images, nil
+		}
+		if err == nil {
+			err = ErrNoBootImages
+		}
+		if uri, uerr := lease.Boot(); uerr == nil {
+			err = fmt.Errorf("%s: %v", uri, err)
+		}
+		l.Printf("Boot source %d of %d failed: %v", i+1, len(leases), err)
+		errs = append(errs, err.Error())
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("%w: no boot sources given", ErrNoBootImages)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoBootImages, strings.Join(errs, "; "))
+}
+
+// ipxeVars returns the iPXE settings corresponding to the lease, so that
+// iPXE scripts can refer to them as e.g. ${ip} or ${next-server}.
+func ipxeVars(lease dhclient.Lease) map[string]string {
+	vars := map[string]string{
+		"mac": lease.Link().Attrs().HardwareAddr.String(),
+	}
+	set := func(name, value string) {
+		if value != "" && value != "<nil>" {
+			vars[name] = value
+		}
+	}
+	p4, ok := lease.(*dhclient.Packet4)
+	if !ok {
+		return vars
+	}
+	set("ip", p4.P.YourIPAddr.String())
+	if mask := p4.P.SubnetMask(); mask != nil {
+		set("netmask", net.IP(mask).String())
+	}
+	if routers := p4.P.Router(); len(routers) > 0 {
+		set("gateway", routers[0].String())
+	}
+	if dns := p4.P.DNS(); len(dns) > 0 {
+		set("dns", dns[0].String())
 	}
-	return getBootImages(ctx, l, s, uri, lease.Link().Attrs().HardwareAddr, ip), nil
+	set("hostname", p4.P.HostName())
+	set("domain", p4.P.DomainName())
+	set("filename", p4.P.BootFileName)
+	set("next-server", p4.P.ServerIPAddr.String())
+	return vars
+}
+
+// bootFileKind is what a boot file given by DHCP refers to.
+type bootFileKind int
+
+const (
+	// bootFileUnknown is a URL, or a file that may be anything, e.g. an
+	// iPXE script.
+	bootFileUnknown bootFileKind = iota
+
+	// bootFilePXELinux is a pxelinux binary, next to which its
+	// pxelinux.cfg directory is.
+	bootFilePXELinux
+
+	// bootFileGrub is a GRUB network boot binary, next to which its
+	// grub.cfg is.
+	bootFileGrub
+
+	// bootFileBinary is some other boot program, e.g. a kernel image.
+	bootFileBinary
+)
+
+// scriptExts are the extensions of plain boot file names that may be iPXE
+// scripts or other configs rather than binaries.
+var scriptExts = map[string]bool{
+	".cfg":  true,
+	".conf": true,
+	".ipxe": true,
+	".txt":  true,
+	"":      true,
+}
+
+// classifyBootFile returns the kind of the DHCP boot file name. URLs are
+// always bootFileUnknown, so that they are probed for every format.
+func classifyBootFile(name string) bootFileKind {
+	if u, err := url.Parse(name); err != nil || u.Scheme != "" {
+		return bootFileUnknown
+	}
+	base := strings.ToLower(path.Base(name))
+	switch {
+	case strings.HasSuffix(base, "pxelinux.0") || base == "syslinux.efi":
+		return bootFilePXELinux
+	case strings.Contains(base, "grub") && (strings.HasSuffix(base, ".efi") || strings.HasSuffix(base, ".0")):
+		return bootFileGrub
+	case scriptExts[path.Ext(base)]:
+		return bootFileUnknown
+	}
+	return bootFileBinary
 }
 
 // getBootImages attempts to parse the file at uri as an ipxe config and returns
 // the ipxe boot image. Otherwise falls back to pxe and uses the uri directory,
 // ip, and mac address to search for pxe configs.
-func getBootImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, uri *url.URL, mac net.HardwareAddr, ip net.IP) []boot.OSImage {
+//
+// If kind says what the file is, only the matching format is tried.
+//
+// vars are the settings iPXE scripts may refer to. If probe is false, the
+// file at uri is not probed for being a kernel image.
+func getBootImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, uri *url.URL, kind bootFileKind, mac net.HardwareAddr, ip net.IP, vars map[string]string, probe bool) []boot.OSImage {
+	// The directory of the boot file, where pxelinux.cfg or grub.cfg are.
+	wd := &url.URL{
+		Scheme: uri.Scheme,
+		Host:   uri.Host,
+		Path:   path.Dir(uri.Path),
+	}
+
+	switch kind {
+	case bootFilePXELinux:
+		l.Printf("Boot file is pxelinux, looking for pxelinux.cfg in %s", wd)
+		return getPXEImages(ctx, l, schemes, wd, mac, ip)
+
+	case bootFileGrub:
+		l.Printf("Boot file is GRUB, looking for grub.cfg in %s", wd)
+		return getGrubImages(ctx, l, schemes, wd)
+
+	case bootFileBinary:
+		// Boot programs such as undionly.kpxe, ipxe.efi or shimx64.efi
+		// are served next to a pxelinux or GRUB config.
+		var images []boot.OSImage
+		if probe {
+			l.Printf("Boot file is a binary, trying to parse it as an image...")
+			images = getSimpleImages(ctx, l, schemes, uri)
+		} else {
+			l.Printf("Boot file is a binary, not fetching it")
+		}
+		images = append(images, getPXEImages(ctx, l, schemes, wd, mac, ip)...)
+		return append(images, getGrubImages(ctx, l, schemes, wd)...)
+	}
+
 	var images []boot.OSImage
 
 	// 1: Attempt to download the given url as is.
 	//
 	// 1.1: Try ipxe config file.
-	ipc, err := ipxe.ParseConfig(ctx, l, uri, schemes)
+	ipc, err := ipxe.ParseConfigWithVars(ctx, l, uri, schemes, vars)
 	if err != nil {
 		l.Printf("Parsing boot files as iPXE failed, trying other formats...: %v", err)
 	}
@@ -67,29 +367,72 @@ func getBootImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, uri
 	}
 
 	// 1.2: Check if target is a simple file instead of config script
-	if ipc == nil {
+	if ipc == nil && probe {
 		l.Printf("Trying to parse file as a non config Image...")
-		sImages, err := simple.FetchAndProbe(ctx, uri, schemes)
-		if err != nil {
-			l.Printf("failed to parse boot file as simple file: %v", err)
-		}
-		if sImages != nil {
-			images = append(images, sImages...)
-		}
+		images = append(images, getSimpleImages(ctx, l, schemes, uri)...)
 	}
 
 	// 2: Fallback to pxe boot.
 	//
 	// Look for pxelinux.cfg from parent directory of given url path.
-	wd := &url.URL{
-		Scheme: uri.Scheme,
-		Host:   uri.Host,
-		Path:   path.Dir(uri.Path),
+	images = append(images, getPXEImages(ctx, l, schemes, wd, mac, ip)...)
+
+	// 3: Look for a GRUB config in the same directory.
+	return append(images, getGrubImages(ctx, l, schemes, wd)...)
+}
+
+// getSimpleImages returns the images in the file at uri, if it is an image
+// file rather than a config.
+func getSimpleImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, uri *url.URL) []boot.OSImage {
+	images, err := simple.FetchAndProbe(ctx, uri, schemes)
+	if err != nil {
+		l.Printf("failed to parse boot file as simple file: %v", err)
 	}
-	pxeImages, err := pxe.ParseConfig(ctx, wd, mac, ip, schemes)
+	return images
+}
+
+// getPXEImages returns the entries of the pxelinux config in wd for the
+// given mac and ip.
+func getPXEImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, wd *url.URL, mac net.HardwareAddr, ip net.IP) []boot.OSImage {
+	images, err := pxe.ParseConfig(ctx, wd, mac, ip, schemes)
 	if err != nil {
 		l.Printf("Failed to try parsing pxelinux config: %v", err)
 	}
+	return images
+}
+
+// grubConfigFiles are the paths relative to the boot file's directory at
+// which GRUB configs are looked for.
+var grubConfigFiles = []string{
+	"grub.cfg",
+	"grub/grub.cfg",
+	"boot/grub/grub.cfg",
+}
 
-	return append(images, pxeImages...)
+// getGrubImages returns the entries of the first GRUB config found in wd,
+// with the default entry first.
+func getGrubImages(ctx context.Context, l ulog.Logger, schemes curl.Schemes, wd *url.URL) []boot.OSImage {
+	for _, file := range grubConfigFiles {
+		u := *wd
+		u.Path = path.Join(wd.Path, file)
+		gc, err := grub.ParseNetConfig(ctx, schemes, &u)
+		if curl.IsURLError(err) {
+			continue
+		}
+		if err != nil {
+			l.Printf("Failed to parse GRUB config %s: %v", &u, err)
+			return nil
+		}
+		if len(gc.Images) == 0 {
+			return nil
+		}
+		images := []boot.OSImage{gc.Images[gc.Default]}
+		for i, img := range gc.Images {
+			if i != gc.Default {
+				images = append(images, img)
+			}
+		}
+		return images
+	}
+	return nil
 }
@@ -0,0 +1,518 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netboot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/uio"
+	"github.com/u-root/u-root/pkg/ulog/ulogtest"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func testLease(t *testing.T, bootFile string) dhclient.Lease {
+	m, err := dhcpv4.New(func(m *dhcpv4.DHCPv4) {
+		m.BootFileName = bootFile
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := &netlink.Dummy{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:         "eth0",
+			HardwareAddr: net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		},
+	}
+	return dhclient.NewPacket4(link, m)
+}
+
+func TestMaxTotalBytes(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("10.0.0.1", "/ipxe", "#!ipxe\nkernel kernel\ninitrd initrd\nboot\n")
+	fs.Add("10.0.0.1", "/kernel", strings.Repeat("k", 600))
+	fs.Add("10.0.0.1", "/initrd", strings.Repeat("i", 600))
+	s := curl.Schemes{"http": fs}
+
+	for _, tt := range []struct {
+		name          string
+		maxTotalBytes int64
+		wantErr       error
+	}{
+		{
+			name: "no budget",
+		},
+		{
+			name:          "within budget",
+			maxTotalBytes: 1200,
+		},
+		{
+			name:          "exceeds budget",
+			maxTotalBytes: 1000,
+			wantErr:       ErrBudgetExceeded,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := BootImagesWithOptions(context.Background(), ulogtest.Logger{TB: t}, s,
+				testLease(t, "http://10.0.0.1/ipxe"), Options{MaxTotalBytes: tt.maxTotalBytes})
+			if err != nil {
+				t.Fatalf("BootImagesWithOptions() = %v", err)
+			}
+			if len(images) == 0 {
+				t.Fatal("BootImagesWithOptions() returned no images")
+			}
+			li, ok := images[0].(*boot.LinuxImage)
+			if !ok {
+				t.Fatalf("image is %T, want *boot.LinuxImage", images[0])
+			}
+
+			// The kernel alone fits in every budget.
+			if _, err := uio.ReadAll(li.Kernel); err != nil {
+				t.Fatalf("reading kernel = %v", err)
+			}
+			if _, err := uio.ReadAll(li.Initrd); !errors.Is(err, tt.wantErr) {
+				t.Errorf("reading initrd = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBudgetPerImage(t *testing.T) {
+	a := &boot.LinuxImage{Kernel: strings.NewReader(strings.Repeat("a", 600))}
+	b := &boot.LinuxImage{Kernel: strings.NewReader(strings.Repeat("b", 600))}
+	limitImage(a, 1000)
+	limitImage(b, 1000)
+
+	for _, img := range []*boot.LinuxImage{a, b} {
+		// Reading the same bytes twice only counts once.
+		for i := 0; i < 2; i++ {
+			if _, err := uio.ReadAll(img.Kernel); err != nil {
+				t.Errorf("reading %s = %v, want nil", img.Kernel, err)
+			}
+		}
+	}
+}
+
+func TestGrubConfig(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("10.0.0.1", "/boot/grubnetx64.efi", "not a kernel")
+	fs.Add("10.0.0.1", "/boot/grub/grub.cfg", `set default=1
+menuentry 'first' {
+	linux $prefix/vmlinuz first
+}
+menuentry 'second' {
+	linux $prefix/vmlinuz second
+}
+`)
+	fs.Add("10.0.0.1", "/boot/grub/vmlinuz", "kernel")
+	s := curl.Schemes{"http": fs}
+
+	images, err := BootImages(context.Background(), ulogtest.Logger{TB: t}, s, testLease(t, "http://10.0.0.1/boot/grubnetx64.efi"))
+	if err != nil {
+		t.Fatalf("BootImages() = %v", err)
+	}
+	var got []string
+	for _, img := range images {
+		got = append(got, img.Label())
+	}
+	if len(got) != 2 || !strings.Contains(got[0], "second") || !strings.Contains(got[1], "first") {
+		t.Errorf("BootImages() = %q, want the second entry first", got)
+	}
+}
+
+func TestIpxeVars(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("10.0.0.1", "/ipxe", "#!ipxe\nchain ${mac:hexhyp}.ipxe\n")
+	fs.Add("10.0.0.1", "/02-00-00-00-00-01.ipxe", "#!ipxe\nkernel kernel ip=${ip}\nboot\n")
+	fs.Add("10.0.0.1", "/kernel", "kernel")
+	s := curl.Schemes{"http": fs}
+
+	lease := testLease(t, "http://10.0.0.1/ipxe")
+	lease.(*dhclient.Packet4).P.YourIPAddr = net.IP{10, 0, 0, 5}
+	images, err := BootImages(context.Background(), ulogtest.Logger{TB: t}, s, lease)
+	if err != nil {
+		t.Fatalf("BootImages() = %v", err)
+	}
+	if len(images) == 0 {
+		t.Fatal("BootImages() returned no images")
+	}
+	li, ok := images[0].(*boot.LinuxImage)
+	if !ok {
+		t.Fatalf("image is %T, want *boot.LinuxImage", images[0])
+	}
+	if want := "ip=10.0.0.5"; li.Cmdline != want {
+		t.Errorf("cmdline = %q, want %q", li.Cmdline, want)
+	}
+}
+
+func TestBootServer(t *testing.T) {
+	hfs := curl.NewMockScheme("http")
+	hfs.Add("10.0.0.1", "/tftpboot/boot.ipxe", "#!ipxe\nkernel vmlinuz\ninitrd tftp://${next-server}/initrd\nboot\n")
+	hfs.Add("10.0.0.99", "/boot.ipxe", "#!ipxe\nkernel wrong\nboot\n")
+	tfs := curl.NewMockScheme("tftp")
+	tfs.Add("10.0.0.99", "/boot.ipxe", "#!ipxe\nkernel wrong\nboot\n")
+	s := curl.Schemes{"http": hfs, "tftp": tfs}
+
+	server := &url.URL{Scheme: "http", Host: "10.0.0.1", Path: "/tftpboot"}
+	for _, tt := range []struct {
+		name       string
+		bootFile   string
+		nextServer net.IP
+		server     *url.URL
+		wantKernel string
+		wantInitrd string
+	}{
+		{
+			name:       "overrides next server",
+			bootFile:   "boot.ipxe",
+			nextServer: net.IP{10, 0, 0, 99},
+			server:     server,
+			wantKernel: "http://10.0.0.1/tftpboot/vmlinuz",
+			wantInitrd: "tftp://10.0.0.1/initrd",
+		},
+		{
+			name:       "without next server",
+			bootFile:   "/boot.ipxe",
+			server:     server,
+			wantKernel: "http://10.0.0.1/tftpboot/vmlinuz",
+			wantInitrd: "tftp://10.0.0.1/initrd",
+		},
+		{
+			name:       "next server",
+			bootFile:   "/boot.ipxe",
+			nextServer: net.IP{10, 0, 0, 99},
+			wantKernel: "tftp://10.0.0.99/wrong",
+		},
+		{
+			name:       "full URL",
+			bootFile:   "http://10.0.0.99/boot.ipxe",
+			server:     server,
+			wantKernel: "http://10.0.0.99/wrong",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			lease := testLease(t, tt.bootFile)
+			if tt.nextServer != nil {
+				lease.(*dhclient.Packet4).P.ServerIPAddr = tt.nextServer
+			}
+			images, err := BootImagesWithOptions(context.Background(), ulogtest.Logger{TB: t}, s, lease, Options{BootServer: tt.server})
+			if err != nil {
+				t.Fatalf("BootImagesWithOptions() = %v", err)
+			}
+			if len(images) == 0 {
+				t.Fatal("BootImagesWithOptions() returned no images")
+			}
+			li, ok := images[0].(*boot.LinuxImage)
+			if !ok {
+				t.Fatalf("image is %T, want *boot.LinuxImage", images[0])
+			}
+			if got := fileURL(li.Kernel).String(); got != tt.wantKernel {
+				t.Errorf("kernel = %s, want %s", got, tt.wantKernel)
+			}
+			var want []string
+			if tt.wantInitrd != "" {
+				want = []string{tt.wantInitrd}
+			}
+			if got := urlStrings(initrdURLs(li.Initrd)...); !reflect.DeepEqual(got, want) {
+				t.Errorf("initrds = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResolveBootFile(t *testing.T) {
+	for _, tt := range []struct {
+		server string
+		file   string
+		want   string
+	}{
+		{server: "tftp://10.0.0.5", file: "pxelinux.0", want: "tftp://10.0.0.5/pxelinux.0"},
+		{server: "tftp://10.0.0.5", file: "/boot/grub.cfg", want: "tftp://10.0.0.5/boot/grub.cfg"},
+		{server: "tftp://10.0.0.5/tftpboot", file: "/boot/grub.cfg", want: "tftp://10.0.0.5/tftpboot/boot/grub.cfg"},
+		{server: "http://boot.example.com:8080/root/", file: "boot.ipxe", want: "http://boot.example.com:8080/root/boot.ipxe"},
+	} {
+		server, err := url.Parse(tt.server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resolveBootFile(server, tt.file).String(); got != tt.want {
+			t.Errorf("resolveBootFile(%s, %q) = %s, want %s", tt.server, tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestBootImagesWithFallback(t *testing.T) {
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/boot.ipxe":
+			fmt.Fprint(w, "#!ipxe\nkernel kernel good\nboot\n")
+		case "/kernel":
+			fmt.Fprint(w, "kernel")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer good.Close()
+
+	s := curl.Schemes{"http": curl.DefaultHTTPClient}
+	first := testLease(t, missing.URL+"/boot.ipxe")
+	second := testLease(t, good.URL+"/boot.ipxe")
+
+	images, err := BootImagesWithFallback(context.Background(), ulogtest.Logger{TB: t}, s, first, second)
+	if err != nil {
+		t.Fatalf("BootImagesWithFallback() = %v", err)
+	}
+	if len(images) == 0 {
+		t.Fatal("BootImagesWithFallback() returned no images")
+	}
+	li, ok := images[0].(*boot.LinuxImage)
+	if !ok {
+		t.Fatalf("image is %T, want *boot.LinuxImage", images[0])
+	}
+	if want := "good"; li.Cmdline != want {
+		t.Errorf("cmdline = %q, want %q", li.Cmdline, want)
+	}
+
+	// With only failing sources, every failure is reported.
+	_, err = BootImagesWithFallback(context.Background(), ulogtest.Logger{TB: t}, s, first, first)
+	if !errors.Is(err, ErrNoBootImages) {
+		t.Fatalf("BootImagesWithFallback() = %v, want %v", err, ErrNoBootImages)
+	}
+	if n := strings.Count(err.Error(), missing.URL); n != 2 {
+		t.Errorf("BootImagesWithFallback() = %v, want both sources in the error", err)
+	}
+
+	if _, err := BootImagesWithFallback(context.Background(), ulogtest.Logger{TB: t}, s); !errors.Is(err, ErrNoBootImages) {
+		t.Errorf("BootImagesWithFallback() without leases = %v, want %v", err, ErrNoBootImages)
+	}
+}
+
+func TestBootFileKinds(t *testing.T) {
+	fs := curl.NewMockScheme("tftp")
+	fs.Add("10.0.0.1", "/boot.ipxe", "#!ipxe\nkernel kernel ipxe\nboot\n")
+	fs.Add("10.0.0.1", "/pxelinux.cfg/default", "default linux\nlabel linux\nkernel kernel\nappend pxelinux\n")
+	fs.Add("10.0.0.1", "/grub.cfg", "menuentry 'grub' {\n\tlinux $prefix/kernel grub\n}\n")
+	fs.Add("10.0.0.1", "/kernel", "kernel")
+	s := curl.Schemes{"tftp": fs}
+
+	for _, tt := range []struct {
+		bootFile    string
+		wantImages  int
+		wantCmdline string
+	}{
+		// URLs are probed for every format.
+		{bootFile: "tftp://10.0.0.1/boot.ipxe", wantImages: 3, wantCmdline: "ipxe"},
+		{bootFile: "/pxelinux.0", wantImages: 1, wantCmdline: "pxelinux"},
+		{bootFile: "/grubx64.efi", wantImages: 1, wantCmdline: "grub"},
+		// Other binaries fall back to both configs.
+		{bootFile: "/undionly.kpxe", wantImages: 2, wantCmdline: "pxelinux"},
+		{bootFile: "/shimx64.efi", wantImages: 2, wantCmdline: "pxelinux"},
+	} {
+		t.Run(tt.bootFile, func(t *testing.T) {
+			lease := testLease(t, tt.bootFile)
+			lease.(*dhclient.Packet4).P.ServerIPAddr = net.IP{10, 0, 0, 1}
+
+			images, err := BootImages(context.Background(), ulogtest.Logger{TB: t}, s, lease)
+			if err != nil {
+				t.Fatalf("BootImages() = %v", err)
+			}
+			if len(images) != tt.wantImages {
+				t.Fatalf("BootImages() = %v, want %d images", images, tt.wantImages)
+			}
+			li, ok := images[0].(*boot.LinuxImage)
+			if !ok {
+				t.Fatalf("image is %T, want *boot.LinuxImage", images[0])
+			}
+			if li.Cmdline != tt.wantCmdline {
+				t.Errorf("cmdline = %q, want %q", li.Cmdline, tt.wantCmdline)
+			}
+		})
+	}
+}
+
+func TestClassifyBootFile(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want bootFileKind
+	}{
+		{"http://10.0.0.1/pxelinux.0", bootFileUnknown},
+		{"boot.ipxe", bootFileUnknown},
+		{"pxelinux.0", bootFilePXELinux},
+		{"bios/lpxelinux.0", bootFilePXELinux},
+		{"efi64/syslinux.efi", bootFilePXELinux},
+		{"grubx64.efi", bootFileGrub},
+		{"boot/grub/i386-pc/core.0-grub.0", bootFileGrub},
+		{"vmlinuz.efi", bootFileBinary},
+		{"image.itb", bootFileBinary},
+		{"undionly.kpxe", bootFileBinary},
+		{"ipxe.efi", bootFileBinary},
+	} {
+		if got := classifyBootFile(tt.name); got != tt.want {
+			t.Errorf("classifyBootFile(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// pxeVendorOptions is option 43 as sent by a proxy DHCP server offering a
+// boot menu with a Linux entry served by 10.0.0.2 and 10.0.0.3.
+var pxeVendorOptions = []byte{
+	// Discovery control: only use listed boot servers.
+	6, 1, 0x04,
+	// Boot servers: type 0x8001 at 10.0.0.2 and 10.0.0.3.
+	8, 11, 0x80, 0x01, 2, 10, 0, 0, 2, 10, 0, 0, 3,
+	// Boot menu: "Linux" of type 0x8001, local boot.
+	9, 16, 0x80, 0x01, 5, 'L', 'i', 'n', 'u', 'x', 0x00, 0x00, 5, 'L', 'o', 'c', 'a', 'l',
+	// Menu prompt: 10 seconds.
+	10, 5, 10, 'B', 'o', 'o', 't',
+	255,
+}
+
+func TestParsePXEOptions(t *testing.T) {
+	o, err := ParsePXEOptions(pxeVendorOptions)
+	if err != nil {
+		t.Fatalf("ParsePXEOptions() = %v", err)
+	}
+	want := &PXEOptions{
+		DiscoveryControl: 0x04,
+		BootServers: []PXEBootServer{
+			{Type: 0x8001, IPs: []net.IP{{10, 0, 0, 2}, {10, 0, 0, 3}}},
+		},
+		Menu: []PXEMenuItem{
+			{Type: 0x8001, Description: "Linux"},
+			{Type: 0, Description: "Local"},
+		},
+		Prompt:        "Boot",
+		PromptTimeout: 10,
+	}
+	if !reflect.DeepEqual(o, want) {
+		t.Errorf("ParsePXEOptions() = %+v, want %+v", o, want)
+	}
+	if ip, err := o.BootServer(); err != nil || !ip.Equal(net.IP{10, 0, 0, 2}) {
+		t.Errorf("BootServer() = %v, %v, want 10.0.0.2", ip, err)
+	}
+
+	// Selecting local boot has no boot server.
+	o.BootItem, o.HasBootItem = 0, true
+	if _, err := o.BootServer(); err == nil {
+		t.Errorf("BootServer() for local boot = nil, want error")
+	}
+
+	if _, err := ParsePXEOptions([]byte{8, 5, 0x80, 0x01, 2, 10, 0}); err == nil {
+		t.Errorf("ParsePXEOptions(truncated) = nil, want error")
+	}
+}
+
+func TestPXEBootURI(t *testing.T) {
+	fs := curl.NewMockScheme("tftp")
+	fs.Add("10.0.0.2", "/pxelinux.cfg/default", "default linux\nlabel linux\nkernel kernel\nappend pxe\n")
+	fs.Add("10.0.0.2", "/kernel", "kernel")
+	s := curl.Schemes{"tftp": fs}
+
+	// A proxy DHCP reply has no next server.
+	lease := testLease(t, "/pxelinux.0")
+	p := lease.(*dhclient.Packet4).P
+	p.UpdateOption(dhcpv4.OptClassIdentifier("PXEClient"))
+	p.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, pxeVendorOptions))
+
+	images, err := BootImages(context.Background(), ulogtest.Logger{TB: t}, s, lease)
+	if err != nil {
+		t.Fatalf("BootImages() = %v", err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("BootImages() = %v, want 1 image", images)
+	}
+	if li, ok := images[0].(*boot.LinuxImage); !ok || li.Cmdline != "pxe" {
+		t.Errorf("BootImages() = %v, want the image from 10.0.0.2", images[0])
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	signer, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, signer, strings.NewReader("kernel"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := curl.NewMockScheme("http")
+	fs.Add("10.0.0.1", "/signed.ipxe", "#!ipxe\nkernel kernel\nboot\n")
+	fs.Add("10.0.0.1", "/unsigned.ipxe", "#!ipxe\nkernel unsigned\nboot\n")
+	fs.Add("10.0.0.1", "/kernel", "kernel")
+	fs.Add("10.0.0.1", "/kernel.sig", sig.String())
+	fs.Add("10.0.0.1", "/unsigned", "kernel")
+	s := curl.Schemes{"http": fs}
+
+	for _, tt := range []struct {
+		bootFile string
+		wantErr  error
+	}{
+		{bootFile: "http://10.0.0.1/signed.ipxe"},
+		{bootFile: "http://10.0.0.1/unsigned.ipxe", wantErr: boot.ErrBadSignature},
+	} {
+		t.Run(tt.bootFile, func(t *testing.T) {
+			images, err := BootImagesWithOptions(context.Background(), ulogtest.Logger{TB: t}, s,
+				testLease(t, tt.bootFile), Options{KeyRing: openpgp.EntityList{signer}})
+			if err != nil {
+				t.Fatalf("BootImagesWithOptions() = %v", err)
+			}
+			if len(images) == 0 {
+				t.Fatal("BootImagesWithOptions() returned no images")
+			}
+			li, ok := images[0].(*boot.LinuxImage)
+			if !ok || li.KernelSignature == nil {
+				t.Fatalf("image is %v, want a *boot.LinuxImage with a signature", images[0])
+			}
+			if err := li.KernelSignature.Verify(li.Kernel); !errors.Is(err, tt.wantErr) {
+				t.Errorf("verifying kernel = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyRingDropsUnverifiable(t *testing.T) {
+	fs := curl.NewMockScheme("http")
+	fs.Add("10.0.0.1", "/boot/grubnetx64.efi", "not a kernel")
+	fs.Add("10.0.0.1", "/boot/grub/grub.cfg", `menuentry 'xen' {
+	multiboot $prefix/xen
+}
+menuentry 'linux' {
+	linux $prefix/vmlinuz
+}
+`)
+	fs.Add("10.0.0.1", "/boot/grub/xen", "xen")
+	fs.Add("10.0.0.1", "/boot/grub/vmlinuz", "kernel")
+	s := curl.Schemes{"http": fs}
+
+	images, err := BootImagesWithOptions(context.Background(), ulogtest.Logger{TB: t}, s,
+		testLease(t, "http://10.0.0.1/boot/grubnetx64.efi"), Options{KeyRing: openpgp.EntityList{}})
+	if err != nil {
+		t.Fatalf("BootImagesWithOptions() = %v", err)
+	}
+	if len(images) != 1 {
+		t.Fatalf("BootImagesWithOptions() = %v, want only the Linux image", images)
+	}
+	if _, ok := images[0].(*boot.LinuxImage); !ok {
+		t.Errorf("BootImagesWithOptions() = %v, want a *boot.LinuxImage", images[0])
+	}
+}
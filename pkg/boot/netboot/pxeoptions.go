@@ -0,0 +1,210 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netboot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/u-root/u-root/pkg/dhclient"
+)
+
+// pxeClassID is the vendor class identifier with which PXE servers mark
+// option 43 as holding PXE suboptions.
+const pxeClassID = "PXEClient"
+
+// PXE vendor suboptions of DHCP option 43, from the PXE 2.1 specification.
+const (
+	pxeDiscoveryControl = 6
+	pxeBootServers      = 8
+	pxeBootMenu         = 9
+	pxeMenuPrompt       = 10
+	pxeBootItem         = 71
+	pxeEnd              = 255
+)
+
+// PXEDiscoveryUseBootFile is the PXE discovery control bit telling clients
+// to download the boot file given by DHCP rather than discover a boot
+// server.
+const PXEDiscoveryUseBootFile = 1 << 3
+
+// PXEBootServer is a boot server of a type offered by a PXE boot menu.
+type PXEBootServer struct {
+	Type uint16
+	IPs  []net.IP
+}
+
+// PXEMenuItem is an entry of a PXE boot menu. Type 0 means local boot.
+type PXEMenuItem struct {
+	Type        uint16
+	Description string
+}
+
+// PXEOptions are the PXEClient suboptions of DHCP option 43, with which
+// proxy DHCP servers describe where to boot from.
+type PXEOptions struct {
+	// DiscoveryControl are the boot server discovery bits, e.g.
+	// PXEDiscoveryUseBootFile.
+	DiscoveryControl byte
+
+	// BootServers are the boot servers by type.
+	BootServers []PXEBootServer
+
+	// Menu is the boot menu.
+	Menu []PXEMenuItem
+
+	// Prompt is the boot menu prompt, shown for PromptTimeout seconds.
+	Prompt        string
+	PromptTimeout byte
+
+	// BootItem is the type of the boot item the server selected, if
+	// HasBootItem.
+	BootItem    uint16
+	HasBootItem bool
+}
+
+// ParsePXEOptions parses the PXEClient suboptions in the value of DHCP
+// option 43.
+func ParsePXEOptions(b []byte) (*PXEOptions, error) {
+	o := &PXEOptions{}
+	for len(b) > 0 {
+		code := b[0]
+		if code == pxeEnd {
+			break
+		}
+		// Pad.
+		if code == 0 {
+			b = b[1:]
+			continue
+		}
+		if len(b) < 2 || len(b) < 2+int(b[1]) {
+			return nil, fmt.Errorf("PXE suboption %d is truncated", code)
+		}
+		data := b[2 : 2+int(b[1])]
+		b = b[2+int(b[1]):]
+
+		var err error
+		switch code {
+		case pxeDiscoveryControl:
+			if len(data) != 1 {
+				err = errors.New("want 1 byte")
+				break
+			}
+			o.DiscoveryControl = data[0]
+
+		case pxeBootServers:
+			for len(data) > 0 {
+				if len(data) < 3 || len(data) < 3+4*int(data[2]) {
+					err = errors.New("truncated boot server")
+					break
+				}
+				s := PXEBootServer{Type: binary.BigEndian.Uint16(data)}
+				for i := 0; i < int(data[2]); i++ {
+					s.IPs = append(s.IPs, net.IP(data[3+4*i:7+4*i]))
+				}
+				o.BootServers = append(o.BootServers, s)
+				data = data[3+4*int(data[2]):]
+			}
+
+		case pxeBootMenu:
+			for len(data) > 0 {
+				if len(data) < 3 || len(data) < 3+int(data[2]) {
+					err = errors.New("truncated menu item")
+					break
+				}
+				o.Menu = append(o.Menu, PXEMenuItem{
+					Type:        binary.BigEndian.Uint16(data),
+					Description: string(data[3 : 3+int(data[2])]),
+				})
+				data = data[3+int(data[2]):]
+			}
+
+		case pxeMenuPrompt:
+			if len(data) < 1 {
+				err = errors.New("want at least 1 byte")
+				break
+			}
+			o.PromptTimeout = data[0]
+			o.Prompt = string(data[1:])
+
+		case pxeBootItem:
+			if len(data) != 4 {
+				err = errors.New("want 4 bytes")
+				break
+			}
+			o.BootItem = binary.BigEndian.Uint16(data)
+			o.HasBootItem = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("PXE suboption %d: %v", code, err)
+		}
+	}
+	return o, nil
+}
+
+// BootServer returns the boot server to boot from: one of the selected boot
+// item's type, or else of the first menu item's type.
+func (o *PXEOptions) BootServer() (net.IP, error) {
+	var typ uint16
+	switch {
+	case o.HasBootItem:
+		typ = o.BootItem
+	case len(o.Menu) > 0:
+		typ = o.Menu[0].Type
+	default:
+		return nil, errors.New("no PXE boot item or menu")
+	}
+	if typ == 0 {
+		return nil, errors.New("PXE boot item is local boot")
+	}
+	for _, s := range o.BootServers {
+		if s.Type == typ && len(s.IPs) > 0 {
+			return s.IPs[0], nil
+		}
+	}
+	return nil, fmt.Errorf("no PXE boot server of type %d", typ)
+}
+
+// pxeBootURI returns the boot file URL derived from the PXEClient vendor
+// options of p, or nil if p has none or they say to use p's boot file as is.
+func pxeBootURI(p *dhclient.Packet4) (*url.URL, error) {
+	if !strings.HasPrefix(p.P.ClassIdentifier(), pxeClassID) {
+		return nil, nil
+	}
+	v := p.P.GetOneOption(dhcpv4.OptionVendorSpecificInformation)
+	if len(v) == 0 {
+		return nil, nil
+	}
+	o, err := ParsePXEOptions(v)
+	if err != nil {
+		return nil, err
+	}
+	if o.DiscoveryControl&PXEDiscoveryUseBootFile != 0 || len(o.BootServers) == 0 {
+		return nil, nil
+	}
+
+	file := p.BootFileName()
+	if file == "" {
+		return nil, dhclient.ErrNoBootFile
+	}
+	if u, err := url.Parse(file); err == nil && u.Scheme != "" {
+		// A full URL already names its server.
+		return nil, nil
+	}
+	server, err := o.BootServer()
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{
+		Scheme: dhclient.DefaultScheme,
+		Host:   server.String(),
+		Path:   file,
+	}, nil
+}
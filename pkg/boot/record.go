@@ -0,0 +1,131 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/u-root/u-root/pkg/uio"
+	"golang.org/x/sys/unix"
+)
+
+// BootRecord is a record of an OS image about to be booted, as written by
+// RecordBoot. Files are identified by their URL or path.
+type BootRecord struct {
+	Time    time.Time `json:"time"`
+	Title   string    `json:"title"`
+	Kernel  string    `json:"kernel,omitempty"`
+	Initrd  string    `json:"initrd,omitempty"`
+	Cmdline string    `json:"cmdline,omitempty"`
+
+	// KernelDigest and InitrdDigest are SHA-256 digests in Hash form,
+	// e.g. "sha256:e3b0c442...".
+	KernelDigest string `json:"kernel_digest,omitempty"`
+	InitrdDigest string `json:"initrd_digest,omitempty"`
+}
+
+// digest returns the SHA-256 digest of f in Hash form.
+func digest(f io.ReaderAt) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, uio.Reader(f)); err != nil {
+		return "", fmt.Errorf("hashing %s: %v", stringer(f), err)
+	}
+	return (&Hash{Algorithm: SHA256, Digest: h.Sum(nil)}).String(), nil
+}
+
+// NewBootRecord returns a record of img, with the digests of its files if
+// it is a LinuxImage or MultibootImage.
+func NewBootRecord(img OSImage) (*BootRecord, error) {
+	return newBootRecord(img, time.Now())
+}
+
+// newBootRecord returns a record of img booted at now.
+func newBootRecord(img OSImage, now time.Time) (*BootRecord, error) {
+	r := &BootRecord{
+		Time:  now.UTC(),
+		Title: img.Label(),
+	}
+	var err error
+	switch img := img.(type) {
+	case *LinuxImage:
+		r.Cmdline = img.Cmdline
+		if img.Kernel != nil {
+			r.Kernel = stringer(img.Kernel)
+			if r.KernelDigest, err = digest(img.Kernel); err != nil {
+				return nil, err
+			}
+		}
+		if img.Initrd != nil {
+			r.Initrd = stringer(img.Initrd)
+			if r.InitrdDigest, err = digest(img.Initrd); err != nil {
+				return nil, err
+			}
+		}
+	case *MultibootImage:
+		r.Cmdline = img.Cmdline
+		if img.Kernel != nil {
+			r.Kernel = stringer(img.Kernel)
+			if r.KernelDigest, err = digest(img.Kernel); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// RecordBoot appends a BootRecord of img as a line of JSON to the log file
+// at path, e.g. on a persistent partition for post-mortem debugging. It is
+// meant to be called after img was loaded and right before it is executed,
+// e.g. as a bootcmd.PreBootHook, and syncs the file so the record survives
+// the kexec.
+//
+// If path is on a read-only file system, RecordBoot only logs a warning, so
+// that booting can go on.
+func RecordBoot(path string, img OSImage) error {
+	return recordBoot(path, img, time.Now(), openRecord)
+}
+
+// openRecord opens the boot log at path for appending.
+func openRecord(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+}
+
+// recordBoot is RecordBoot with the boot time and the way the log file is
+// opened given.
+func recordBoot(path string, img OSImage, now time.Time, open func(string) (*os.File, error)) error {
+	r, err := newBootRecord(img, now)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	f, err := open(path)
+	if errors.Is(err, unix.EROFS) {
+		log.Printf("Warning: not recording boot of %s: %v", r.Title, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("recording boot of %s: %v", r.Title, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("recording boot of %s: %v", r.Title, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// openTestFile writes content to a file named name in dir and opens it.
+func openTestFile(t *testing.T, dir, name, content string) *os.File {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func sha256Digest(s string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(s)))
+}
+
+func TestRecordBoot(t *testing.T) {
+	now := time.Date(2022, 5, 4, 12, 30, 0, 0, time.UTC)
+
+	dir := t.TempDir()
+	kernel := openTestFile(t, dir, "vmlinuz", "kernel")
+	initrd := openTestFile(t, dir, "initramfs", "initrd")
+
+	logPath := filepath.Join(dir, "boot.log")
+	for _, img := range []OSImage{
+		&LinuxImage{
+			Name:    "Linux",
+			Kernel:  kernel,
+			Initrd:  initrd,
+			Cmdline: "console=ttyS0",
+		},
+		&MultibootImage{
+			Name:    "Multiboot",
+			Kernel:  kernel,
+			Cmdline: "debug",
+		},
+	} {
+		if err := recordBoot(logPath, img, now, openRecord); err != nil {
+			t.Fatalf("RecordBoot(%s) = %v", img.Label(), err)
+		}
+	}
+
+	want := []BootRecord{
+		{
+			Time:         now,
+			Title:        "Linux",
+			Kernel:       kernel.Name(),
+			Initrd:       initrd.Name(),
+			Cmdline:      "console=ttyS0",
+			KernelDigest: sha256Digest("kernel"),
+			InitrdDigest: sha256Digest("initrd"),
+		},
+		{
+			Time:         now,
+			Title:        "Multiboot",
+			Kernel:       kernel.Name(),
+			Cmdline:      "debug",
+			KernelDigest: sha256Digest("kernel"),
+		},
+	}
+	b, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("boot log has %d lines, want %d:\n%s", len(lines), len(want), b)
+	}
+	for i, line := range lines {
+		var got BootRecord
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d %q: %v", i, line, err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("line %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if !strings.Contains(lines[0], `"kernel_digest":"sha256:`) {
+		t.Errorf("line 0 = %s, want a kernel_digest field", lines[0])
+	}
+}
+
+func TestRecordBootReadOnly(t *testing.T) {
+	readOnly := func(path string) (*os.File, error) {
+		return nil, &os.PathError{Op: "open", Path: path, Err: unix.EROFS}
+	}
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	img := &LinuxImage{Name: "Linux", Kernel: openTestFile(t, t.TempDir(), "vmlinuz", "kernel")}
+	if err := recordBoot("/ro/boot.log", img, time.Now(), readOnly); err != nil {
+		t.Errorf("RecordBoot on a read-only file system = %v, want nil", err)
+	}
+	if !strings.Contains(buf.String(), "not recording boot of Linux") {
+		t.Errorf("RecordBoot logged %q, want a warning", buf.String())
+	}
+}
+
+func TestRecordBootError(t *testing.T) {
+	img := &LinuxImage{Name: "Linux", Kernel: openTestFile(t, t.TempDir(), "vmlinuz", "kernel")}
+	if err := RecordBoot(filepath.Join(t.TempDir(), "missing", "boot.log"), img); err == nil {
+		t.Errorf("RecordBoot in a missing directory succeeded, want error")
+	}
+}
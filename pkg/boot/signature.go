@@ -0,0 +1,56 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/uio"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ErrBadSignature is returned when a file's signature is missing or was not
+// made by a trusted key.
+var ErrBadSignature = errors.New("bad signature")
+
+// armorPrefix starts ASCII-armored OpenPGP signatures.
+var armorPrefix = []byte("-----BEGIN")
+
+// Signature is the expected detached OpenPGP signature of a file.
+type Signature struct {
+	// Sig is the binary or ASCII-armored detached signature, e.g.
+	// fetched lazily from the file's URL with ".sig" appended.
+	Sig io.ReaderAt
+
+	// KeyRing holds the keys trusted to sign the file.
+	KeyRing openpgp.KeyRing
+}
+
+// Verify reads all of r and returns an error wrapping ErrBadSignature if s
+// is missing or is not a valid signature of r by a key in s.KeyRing.
+func (s *Signature) Verify(r io.ReaderAt) error {
+	if s.Sig == nil {
+		return fmt.Errorf("%w: no signature for %s", ErrBadSignature, stringer(r))
+	}
+	if s.KeyRing == nil {
+		return fmt.Errorf("%w: no keys to verify %s", ErrBadSignature, stringer(r))
+	}
+	sig, err := uio.ReadAll(s.Sig)
+	if err != nil {
+		return fmt.Errorf("%w: reading signature %s of %s: %v", ErrBadSignature, stringer(s.Sig), stringer(r), err)
+	}
+
+	check := openpgp.CheckDetachedSignature
+	if bytes.HasPrefix(bytes.TrimSpace(sig), armorPrefix) {
+		check = openpgp.CheckArmoredDetachedSignature
+	}
+	if _, err := check(s.KeyRing, uio.Reader(r), bytes.NewReader(sig)); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrBadSignature, stringer(r), err)
+	}
+	return nil
+}
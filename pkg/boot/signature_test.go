@@ -0,0 +1,103 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func newSigner(t *testing.T) *openpgp.Entity {
+	e, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func detachSign(t *testing.T, signer *openpgp.Entity, data string, armored bool) io.ReaderAt {
+	sign := openpgp.DetachSign
+	if armored {
+		sign = openpgp.ArmoredDetachSign
+	}
+	var b bytes.Buffer
+	if err := sign(&b, signer, strings.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(b.Bytes())
+}
+
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt([]byte, int64) (int, error) {
+	return 0, errors.New("404 Not Found")
+}
+
+func TestLoadLinuxImageSignature(t *testing.T) {
+	trusted := newSigner(t)
+	other := newSigner(t)
+	keyring := openpgp.EntityList{trusted}
+
+	for _, tt := range []struct {
+		name    string
+		kernel  string
+		sig     io.ReaderAt
+		wantErr error
+	}{
+		{
+			name:   "valid signature",
+			kernel: "testkernel",
+			sig:    detachSign(t, trusted, "testkernel", false),
+		},
+		{
+			name:   "valid armored signature",
+			kernel: "testkernel",
+			sig:    detachSign(t, trusted, "testkernel", true),
+		},
+		{
+			name:    "tampered kernel",
+			kernel:  "evilkernel",
+			sig:     detachSign(t, trusted, "testkernel", false),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "untrusted signer",
+			kernel:  "testkernel",
+			sig:     detachSign(t, other, "testkernel", false),
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "missing signature",
+			kernel:  "testkernel",
+			wantErr: ErrBadSignature,
+		},
+		{
+			name:    "signature not found",
+			kernel:  "testkernel",
+			sig:     failingReaderAt{},
+			wantErr: ErrBadSignature,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			li := &LinuxImage{
+				Kernel:          strings.NewReader(tt.kernel),
+				KernelSignature: &Signature{Sig: tt.sig, KeyRing: keyring},
+			}
+			_, cleanup, err := loadLinuxImage(li, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("loadLinuxImage() = %v, want %v", err, tt.wantErr)
+			}
+			if cleanup != nil {
+				cleanup()
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import (
+	"strings"
+)
+
+// utf8BOM is the UTF-8 encoded byte order mark, which Windows tools like to
+// put at the start of text files.
+const utf8BOM = "\ufeff"
+
+// NormalizeScript returns the text of a boot script, e.g. an iPXE script or
+// grub.cfg, with a leading UTF-8 byte order mark stripped, CRLF line endings
+// converted to LF, and trailing whitespace trimmed from every line, so that
+// scripts written on Windows parse like any other.
+func NormalizeScript(script string) string {
+	script = strings.TrimPrefix(script, utf8BOM)
+	lines := strings.Split(script, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package util
+
+import "testing"
+
+func TestNormalizeScript(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{
+			name:   "clean",
+			script: "#!ipxe\nkernel vmlinuz\nboot\n",
+			want:   "#!ipxe\nkernel vmlinuz\nboot\n",
+		},
+		{
+			name:   "BOM",
+			script: "\ufeff#!ipxe\nboot\n",
+			want:   "#!ipxe\nboot\n",
+		},
+		{
+			name:   "CRLF",
+			script: "#!ipxe\r\nkernel vmlinuz\r\nboot\r\n",
+			want:   "#!ipxe\nkernel vmlinuz\nboot\n",
+		},
+		{
+			name:   "trailing whitespace",
+			script: "menuentry 'Linux' { \t\n\tlinux vmlinuz  \r\n}",
+			want:   "menuentry 'Linux' {\n\tlinux vmlinuz\n}",
+		},
+		{
+			name:   "BOM only at the start",
+			script: "echo \ufeff\n",
+			want:   "echo \ufeff\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeScript(tt.script); got != tt.want {
+				t.Errorf("NormalizeScript(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
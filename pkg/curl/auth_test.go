@@ -0,0 +1,82 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHTTPAuth(t *testing.T) {
+	var gotAuth, gotTrace string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotTrace = r.Header.Get("X-Trace")
+	}))
+	defer s.Close()
+
+	for _, tt := range []struct {
+		name      string
+		user      *url.Userinfo
+		token     string
+		header    http.Header
+		wantAuth  string
+		wantTrace string
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "basic from URL",
+			user:     url.UserPassword("boot", "s3cret"),
+			wantAuth: "Basic Ym9vdDpzM2NyZXQ=",
+		},
+		{
+			name:     "bearer token",
+			token:    "abc.def",
+			wantAuth: "Bearer abc.def",
+		},
+		{
+			name:     "URL credentials take precedence",
+			user:     url.UserPassword("boot", "s3cret"),
+			token:    "abc.def",
+			wantAuth: "Basic Ym9vdDpzM2NyZXQ=",
+		},
+		{
+			name:      "headers",
+			header:    http.Header{"x-trace": {"1"}, "Authorization": {"Custom xyz"}},
+			wantAuth:  "Custom xyz",
+			wantTrace: "1",
+		},
+		{
+			name:     "bearer token overrides header",
+			token:    "abc.def",
+			header:   http.Header{"Authorization": {"Custom xyz"}},
+			wantAuth: "Bearer abc.def",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAuth, gotTrace = "", ""
+			h := NewHTTPClient(http.DefaultClient)
+			h.BearerToken = tt.token
+			h.Header = tt.header
+
+			u, _ := url.Parse(s.URL + "/file")
+			u.User = tt.user
+			if _, err := h.FetchWithoutCache(context.Background(), u); err != nil {
+				t.Fatalf("Fetch(%s) = %v", u, err)
+			}
+			if gotAuth != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", gotAuth, tt.wantAuth)
+			}
+			if gotTrace != tt.wantTrace {
+				t.Errorf("X-Trace = %q, want %q", gotTrace, tt.wantTrace)
+			}
+		})
+	}
+}
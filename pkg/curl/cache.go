@@ -0,0 +1,233 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// metaSuffix is the suffix of the files holding the validators of cached
+// files.
+const metaSuffix = ".meta"
+
+// cacheMeta is what is needed to revalidate a cached file.
+type cacheMeta struct {
+	URL          string
+	ETag         string `json:",omitempty"`
+	LastModified string `json:",omitempty"`
+}
+
+// CachingHTTPClient implements FileScheme for HTTP files, keeping the files
+// fetched by an HTTPClient in a directory across fetches.
+//
+// A cached file is revalidated with a conditional request on every fetch,
+// and only downloaded again if the server has a different version. Files
+// without an ETag or Last-Modified header are not cached.
+//
+// Files are cached as the HTTPClient returns them, e.g. decompressed if
+// its DecompressFiles is set, so a directory should not be shared by
+// differently configured clients.
+type CachingHTTPClient struct {
+	h        *HTTPClient
+	dir      string
+	maxBytes int64
+
+	// mu serializes updating and evicting cached files.
+	mu sync.Mutex
+}
+
+// NewCachingHTTPClient returns a new HTTP FileScheme fetching files with h,
+// which caches them in dir.
+//
+// If maxBytes is positive, the least recently used files are evicted to
+// keep the cached files below it in total.
+func NewCachingHTTPClient(h *HTTPClient, dir string, maxBytes int64) *CachingHTTPClient {
+	return &CachingHTTPClient{
+		h:        h,
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+}
+
+// cachePath returns the path of u's cached file.
+func (h *CachingHTTPClient) cachePath(u *url.URL) string {
+	sum := sha256.Sum256([]byte(u.String()))
+	return filepath.Join(h.dir, hex.EncodeToString(sum[:]))
+}
+
+// readMeta returns the validators of the file cached at path, or nil if
+// there is none.
+func readMeta(path string, u *url.URL) *cacheMeta {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	b, err := os.ReadFile(path + metaSuffix)
+	if err != nil {
+		return nil
+	}
+	var m cacheMeta
+	if err := json.Unmarshal(b, &m); err != nil || m.URL != u.String() {
+		return nil
+	}
+	return &m
+}
+
+func (h *CachingHTTPClient) fetch(ctx context.Context, u *url.URL) (io.Reader, error) {
+	path := h.cachePath(u)
+	req, err := h.h.newRequest(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	m := readMeta(path, u)
+	h.mu.Unlock()
+	if m != nil {
+		if m.ETag != "" {
+			req.Header.Set("If-None-Match", m.ETag)
+		}
+		if m.LastModified != "" {
+			req.Header.Set("If-Modified-Since", m.LastModified)
+		}
+	}
+
+	resp, err := h.h.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && m != nil {
+		resp.Body.Close()
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		// The modification time orders files for eviction.
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return f, nil
+	}
+
+	r, err := h.h.readBody(ctx, u, resp)
+	if err != nil {
+		return nil, err
+	}
+	m = &cacheMeta{
+		URL:          u.String(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	if m.ETag == "" && m.LastModified == "" {
+		return r, nil
+	}
+	defer resp.Body.Close()
+	return h.store(path, m, r)
+}
+
+// store writes the file read from r to path, and returns it.
+func (h *CachingHTTPClient) store(path string, m *cacheMeta, r io.Reader) (*os.File, error) {
+	if err := os.MkdirAll(h.dir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(h.dir, "download-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, err
+	}
+	meta, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+metaSuffix, meta, 0o644); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h.evict(path)
+	return f, nil
+}
+
+// evict removes the least recently used cached files, except keep, until
+// they are below maxBytes in total. h.mu must be held.
+func (h *CachingHTTPClient) evict(keep string) {
+	if h.maxBytes <= 0 {
+		return
+	}
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return
+	}
+	var files []os.FileInfo
+	var total int64
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasSuffix(e.Name(), metaSuffix) || strings.HasPrefix(e.Name(), "download-") {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, fi)
+		total += fi.Size()
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, fi := range files {
+		if total <= h.maxBytes {
+			return
+		}
+		path := filepath.Join(h.dir, fi.Name())
+		if path == keep {
+			continue
+		}
+		os.Remove(path + metaSuffix)
+		if os.Remove(path) == nil {
+			total -= fi.Size()
+		}
+	}
+}
+
+// Fetch implements FileScheme.Fetch for HTTP, using cached files.
+func (h *CachingHTTPClient) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+	r, err := h.fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := r.(*os.File); ok {
+		return f, nil
+	}
+	return uio.NewCachingReader(r), nil
+}
+
+// FetchWithoutCache implements FileScheme.FetchWithoutCache for HTTP, using
+// cached files.
+func (h *CachingHTTPClient) FetchWithoutCache(ctx context.Context, u *url.URL) (io.Reader, error) {
+	return h.fetch(ctx, u)
+}
@@ -0,0 +1,178 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// versionedServer serves files with an ETag, and counts full downloads.
+type versionedServer struct {
+	mu        sync.Mutex
+	files     map[string]string
+	etags     map[string]string
+	downloads int
+}
+
+func (s *versionedServer) set(path, content, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = content
+	s.etags[path] = etag
+}
+
+func (s *versionedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok := s.files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("If-None-Match") != s.etags[r.URL.Path] {
+		s.downloads++
+	}
+	w.Header().Set("ETag", s.etags[r.URL.Path])
+	http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+}
+
+func TestCachingHTTPClient(t *testing.T) {
+	vs := &versionedServer{files: map[string]string{}, etags: map[string]string{}}
+	vs.set("/kernel", "kernel v1", `"v1"`)
+	ts := httptest.NewServer(vs)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/kernel")
+
+	c := NewCachingHTTPClient(NewHTTPClient(http.DefaultClient), t.TempDir(), 0)
+	fetch := func(want string, wantDownloads int) {
+		t.Helper()
+		r, err := c.Fetch(context.Background(), u)
+		if err != nil {
+			t.Fatalf("Fetch() = %v", err)
+		}
+		if got, err := uio.ReadAll(r); err != nil || string(got) != want {
+			t.Errorf("Fetch() = %q, %v, want %q", got, err, want)
+		}
+		if vs.downloads != wantDownloads {
+			t.Errorf("server sent the file %d times, want %d", vs.downloads, wantDownloads)
+		}
+	}
+
+	fetch("kernel v1", 1)
+	// A second fetch is served from the cache.
+	fetch("kernel v1", 1)
+
+	// A changed ETag invalidates the cached file.
+	vs.set("/kernel", "kernel v2", `"v2"`)
+	fetch("kernel v2", 2)
+	fetch("kernel v2", 2)
+}
+
+func TestCachingHTTPClientEviction(t *testing.T) {
+	vs := &versionedServer{files: map[string]string{}, etags: map[string]string{}}
+	vs.set("/kernel", strings.Repeat("k", 600), `"k"`)
+	vs.set("/initrd", strings.Repeat("i", 600), `"i"`)
+	ts := httptest.NewServer(vs)
+	defer ts.Close()
+	kernel, _ := url.Parse(ts.URL + "/kernel")
+	initrd, _ := url.Parse(ts.URL + "/initrd")
+
+	dir := t.TempDir()
+	c := NewCachingHTTPClient(NewHTTPClient(http.DefaultClient), dir, 1000)
+	for _, u := range []*url.URL{kernel, initrd} {
+		if _, err := c.FetchWithoutCache(context.Background(), u); err != nil {
+			t.Fatalf("FetchWithoutCache(%s) = %v", u, err)
+		}
+	}
+
+	// Only the most recently fetched file fits.
+	if _, err := os.Stat(c.cachePath(kernel)); !os.IsNotExist(err) {
+		t.Errorf("kernel is still cached (%v), want it evicted", err)
+	}
+	if _, err := os.Stat(c.cachePath(initrd)); err != nil {
+		t.Errorf("initrd is not cached: %v", err)
+	}
+	if _, err := c.FetchWithoutCache(context.Background(), kernel); err != nil {
+		t.Fatal(err)
+	}
+	if vs.downloads != 3 {
+		t.Errorf("server sent %d files, want 3", vs.downloads)
+	}
+}
+
+func TestCachingHTTPClientNoValidators(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("kernel"))
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL + "/kernel")
+
+	dir := t.TempDir()
+	c := NewCachingHTTPClient(NewHTTPClient(http.DefaultClient), dir, 0)
+	r, err := c.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	}
+	if got, err := uio.ReadAll(r); err != nil || string(got) != "kernel" {
+		t.Errorf("Fetch() = %q, %v, want %q", got, err, "kernel")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("cached %d files, want none without ETag or Last-Modified", len(entries))
+	}
+}
+
+func TestCachingHTTPClientOptions(t *testing.T) {
+	vs := &versionedServer{files: map[string]string{}, etags: map[string]string{}}
+	vs.set("/kernel", "kernel", `"k"`)
+	vs.set("/initrd", strings.Repeat("i", 600), `"i"`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		vs.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	kernel, _ := url.Parse(ts.URL + "/kernel")
+	initrd, _ := url.Parse(ts.URL + "/initrd")
+
+	// Files are fetched as configured by the HTTPClient.
+	h := NewHTTPClient(http.DefaultClient)
+	h.BearerToken = "secret"
+	h.MaxSize = 100
+	var progress int64
+	h.Progress = func(_ *url.URL, n, _ int64) { progress = n }
+	c := NewCachingHTTPClient(h, t.TempDir(), 0)
+
+	r, err := c.Fetch(context.Background(), kernel)
+	if err != nil {
+		t.Fatalf("Fetch(%s) = %v", kernel, err)
+	}
+	if got, err := uio.ReadAll(r); err != nil || string(got) != "kernel" {
+		t.Errorf("Fetch(%s) = %q, %v, want %q", kernel, got, err, "kernel")
+	}
+	if progress != int64(len("kernel")) {
+		t.Errorf("Progress reported %d bytes, want %d", progress, len("kernel"))
+	}
+
+	var tooBig *FileTooLargeError
+	if _, err := c.FetchWithoutCache(context.Background(), initrd); !errors.As(err, &tooBig) {
+		t.Errorf("FetchWithoutCache(%s) = %v, want FileTooLargeError", initrd, err)
+	}
+	if _, err := os.Stat(c.cachePath(initrd)); !os.IsNotExist(err) {
+		t.Errorf("initrd is cached (%v), want it not to be", err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func compress(t *testing.T, newWriter func(io.Writer) (io.WriteCloser, error), data string) []byte {
+	var b bytes.Buffer
+	w, err := newWriter(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestHTTPDecompress(t *testing.T) {
+	const kernel = "a kernel, which compresses well well well well"
+	gzipped := compress(t, func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }, kernel)
+	xzed := compress(t, func(w io.Writer) (io.WriteCloser, error) { return xz.NewWriter(w) }, kernel)
+	zstded := compress(t, func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) }, kernel)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped)
+		case "/vmlinuz.gz":
+			w.Write(gzipped)
+		case "/vmlinuz.xz":
+			w.Write(xzed)
+		case "/vmlinuz.zst":
+			w.Write(zstded)
+		case "/vmlinuz":
+			io.WriteString(w, kernel)
+		}
+	}))
+	defer s.Close()
+
+	for _, tt := range []struct {
+		path       string
+		decompress bool
+		want       []byte
+	}{
+		{path: "/encoded", want: []byte(kernel)},
+		{path: "/vmlinuz.gz", want: gzipped},
+		{path: "/vmlinuz.xz", want: xzed},
+		{path: "/vmlinuz", want: []byte(kernel)},
+		{path: "/encoded", decompress: true, want: []byte(kernel)},
+		{path: "/vmlinuz.gz", decompress: true, want: []byte(kernel)},
+		{path: "/vmlinuz.xz", decompress: true, want: []byte(kernel)},
+		{path: "/vmlinuz.zst", decompress: true, want: []byte(kernel)},
+		{path: "/vmlinuz", decompress: true, want: []byte(kernel)},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			h := NewHTTPClient(http.DefaultClient)
+			h.DecompressFiles = tt.decompress
+
+			u, _ := url.Parse(s.URL + tt.path)
+			r, err := h.Fetch(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Fetch(%s) = %v", u, err)
+			}
+			got, err := io.ReadAll(io.NewSectionReader(r, 0, 1<<20))
+			if err != nil {
+				t.Fatalf("reading %s = %v", u, err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Fetch(%s) = %q, want %q", u, got, tt.want)
+			}
+		})
+	}
+}
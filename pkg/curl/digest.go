@@ -0,0 +1,114 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+var (
+	// ErrDigestMismatch is returned when a fetched file does not have the
+	// expected digest.
+	ErrDigestMismatch = errors.New("digest mismatch")
+
+	// ErrUnsupportedDigest is returned for digests of unknown algorithms.
+	ErrUnsupportedDigest = errors.New("unsupported digest algorithm")
+)
+
+// Digest is the expected digest of a file.
+type Digest struct {
+	// Algorithm is one of "sha1", "sha256" or "sha512".
+	Algorithm string
+
+	// Sum is the raw digest.
+	Sum []byte
+}
+
+func newDigestHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedDigest, algorithm)
+}
+
+// NewDigest returns a Digest for algorithm and the hex-encoded sum.
+func NewDigest(algorithm, sum string) (*Digest, error) {
+	h, err := newDigestHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	s, err := hex.DecodeString(sum)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s digest %q: %v", algorithm, sum, err)
+	}
+	if len(s) != h.Size() {
+		return nil, fmt.Errorf("invalid %s digest %q: got %d bytes, want %d", algorithm, sum, len(s), h.Size())
+	}
+	return &Digest{Algorithm: strings.ToLower(algorithm), Sum: s}, nil
+}
+
+func (d *Digest) String() string {
+	return fmt.Sprintf("%s:%x", d.Algorithm, d.Sum)
+}
+
+// FetchVerified fetches the file at u like Fetch, but computes its digest
+// as it is downloaded.
+//
+// If the digest does not match d, an error wrapping ErrDigestMismatch is
+// returned, and none of the file is.
+func (s Schemes) FetchVerified(ctx context.Context, u *url.URL, d *Digest) (FileWithCache, error) {
+	h, err := newDigestHash(d.Algorithm)
+	if err != nil {
+		return nil, &URLError{URL: u, Err: err}
+	}
+	r, err := s.FetchWithoutCache(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(io.MultiWriter(&buf, h), r); err != nil {
+		return nil, &URLError{URL: u, Err: err}
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, d.Sum) {
+		return nil, &URLError{URL: u, Err: fmt.Errorf("%w: got %s:%x, want %s", ErrDigestMismatch, d.Algorithm, got, d)}
+	}
+	return &cacheFile{ReaderAt: bytes.NewReader(buf.Bytes()), url: u}, nil
+}
+
+// LazyFetchVerified returns a reader that will FetchVerified the file given
+// by `u` when Read is called.
+func (s Schemes) LazyFetchVerified(u *url.URL, d *Digest) (FileWithCache, error) {
+	if _, ok := s[u.Scheme]; !ok {
+		return nil, &URLError{URL: u, Err: ErrNoSuchScheme}
+	}
+	if _, err := newDigestHash(d.Algorithm); err != nil {
+		return nil, &URLError{URL: u, Err: err}
+	}
+	return &cacheFile{
+		url: u,
+		ReaderAt: uio.NewLazyOpenerAt(u.String(), func() (io.ReaderAt, error) {
+			return s.FetchVerified(context.TODO(), u, d)
+		}),
+	}, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+func TestFetchVerified(t *testing.T) {
+	const content = "initramfs"
+	fs := NewMockScheme("fooftp")
+	fs.Add("10.0.0.1", "/initrd", content)
+	s := Schemes{"fooftp": fs}
+	u := &url.URL{Scheme: "fooftp", Host: "10.0.0.1", Path: "/initrd"}
+
+	for _, tt := range []struct {
+		algorithm string
+		sum       string
+		wantErr   error
+	}{
+		{algorithm: "sha1", sum: fmt.Sprintf("%x", sha1.Sum([]byte(content)))},
+		{algorithm: "sha256", sum: fmt.Sprintf("%x", sha256.Sum256([]byte(content)))},
+		{algorithm: "SHA512", sum: fmt.Sprintf("%x", sha512.Sum512([]byte(content)))},
+		{algorithm: "sha256", sum: fmt.Sprintf("%x", sha256.Sum256([]byte("corrupt"))), wantErr: ErrDigestMismatch},
+	} {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			d, err := NewDigest(tt.algorithm, tt.sum)
+			if err != nil {
+				t.Fatalf("NewDigest() = %v", err)
+			}
+
+			f, err := s.FetchVerified(context.Background(), u, d)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FetchVerified() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if f != nil {
+					t.Errorf("FetchVerified() returned the file despite mismatch")
+				}
+				return
+			}
+			if got, err := uio.ReadAll(f); err != nil || string(got) != content {
+				t.Errorf("FetchVerified() = %q, %v, want %q", got, err, content)
+			}
+
+			lazy, err := s.LazyFetchVerified(u, d)
+			if err != nil {
+				t.Fatalf("LazyFetchVerified() = %v", err)
+			}
+			if got, err := uio.ReadAll(lazy); err != nil || string(got) != content {
+				t.Errorf("LazyFetchVerified() = %q, %v, want %q", got, err, content)
+			}
+		})
+	}
+}
+
+func TestFetchVerifiedUnsupported(t *testing.T) {
+	if _, err := NewDigest("md5", "d41d8cd98f00b204e9800998ecf8427e"); !errors.Is(err, ErrUnsupportedDigest) {
+		t.Errorf("NewDigest(md5) = %v, want %v", err, ErrUnsupportedDigest)
+	}
+
+	fs := NewMockScheme("fooftp")
+	fs.Add("10.0.0.1", "/initrd", "initramfs")
+	s := Schemes{"fooftp": fs}
+	u := &url.URL{Scheme: "fooftp", Host: "10.0.0.1", Path: "/initrd"}
+	d := &Digest{Algorithm: "md5", Sum: make([]byte, 16)}
+
+	if _, err := s.FetchVerified(context.Background(), u, d); !errors.Is(err, ErrUnsupportedDigest) {
+		t.Errorf("FetchVerified() = %v, want %v", err, ErrUnsupportedDigest)
+	}
+	if _, err := s.LazyFetchVerified(u, d); !errors.Is(err, ErrUnsupportedDigest) {
+		t.Errorf("LazyFetchVerified() = %v, want %v", err, ErrUnsupportedDigest)
+	}
+	if n := fs.NumCalled(u); n != 0 {
+		t.Errorf("fetched the file %d times, want 0", n)
+	}
+}
+
+func TestNewDigest(t *testing.T) {
+	for _, tt := range []struct {
+		algorithm, sum string
+	}{
+		{algorithm: "sha256", sum: "zz"},
+		{algorithm: "sha256", sum: "abcd"},
+		{algorithm: "sha1", sum: fmt.Sprintf("%x", sha256.Sum256(nil))},
+	} {
+		if _, err := NewDigest(tt.algorithm, tt.sum); err == nil {
+			t.Errorf("NewDigest(%s, %s) = nil, want error", tt.algorithm, tt.sum)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+// FetchAllError is returned by FetchAll if some files failed to download.
+type FetchAllError struct {
+	// Errs are the errors of the files that failed, in the order of
+	// their URLs. Each is a *URLError.
+	Errs []error
+}
+
+// Error implements error.Error.
+func (e *FetchAllError) Error() string {
+	s := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		s = append(s, err.Error())
+	}
+	return fmt.Sprintf("%d downloads failed: %s", len(e.Errs), strings.Join(s, "; "))
+}
+
+// Unwrap returns the first error.
+func (e *FetchAllError) Unwrap() error {
+	return e.Errs[0]
+}
+
+// FetchAll downloads the files at urls to the paths returned by dest, e.g.
+// the modules referenced by a grub.cfg, with at most concurrency downloads
+// at a time. The downloads share the FileSchemes of s, so e.g. HTTP
+// downloads share the connection pool of their http.Client.
+//
+// A file is only created at its path once it was downloaded completely. If
+// any downloads fail, the others are still completed, and a *FetchAllError
+// holding all errors is returned.
+func FetchAll(ctx context.Context, s Schemes, urls []*url.URL, dest func(*url.URL) string, concurrency int) error {
+	return fetchAll(ctx, s, urls, dest, concurrency, false)
+}
+
+// FetchAllFailFast is like FetchAll, but cancels the other downloads once
+// one fails.
+func FetchAllFailFast(ctx context.Context, s Schemes, urls []*url.URL, dest func(*url.URL) string, concurrency int) error {
+	return fetchAll(ctx, s, urls, dest, concurrency, true)
+}
+
+func fetchAll(ctx context.Context, s Schemes, urls []*url.URL, dest func(*url.URL) string, concurrency int, failFast bool) error {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(urls))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		select {
+		case sem <- struct{}{}:
+		case <-fetchCtx.Done():
+		}
+		if err := fetchCtx.Err(); err != nil {
+			errs[i] = &URLError{URL: u, Err: err}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, u *url.URL) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fetchTo(fetchCtx, s, u, dest(u)); err != nil {
+				errs[i] = err
+				if failFast {
+					cancel()
+				}
+			}
+		}(i, u)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		// Downloads canceled because another one failed are not
+		// failures of their own.
+		if err == nil || (failFast && ctx.Err() == nil && errors.Is(err, context.Canceled)) {
+			continue
+		}
+		failed = append(failed, err)
+	}
+	if len(failed) > 0 {
+		return &FetchAllError{Errs: failed}
+	}
+	return nil
+}
+
+// fetchTo downloads the file at u to path, through a temporary file in the
+// same directory.
+func fetchTo(ctx context.Context, s Schemes, u *url.URL, path string) error {
+	r, err := s.FetchWithoutCache(ctx, u)
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return &URLError{URL: u, Err: err}
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return &URLError{URL: u, Err: err}
+	}
+	if _, err := io.Copy(f, uio.ContextReader(ctx, r)); err != nil {
+		f.Close()
+		return &URLError{URL: u, Err: err}
+	}
+	if err := f.Close(); err != nil {
+		return &URLError{URL: u, Err: err}
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return &URLError{URL: u, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// moduleServer serves files named /mod<N> after a delay, counting how many
+// requests it handles at once.
+type moduleServer struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	served   []string
+}
+
+func (m *moduleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	m.inFlight++
+	if m.inFlight > m.max {
+		m.max = m.inFlight
+	}
+	m.served = append(m.served, r.URL.Path)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.inFlight--
+		m.mu.Unlock()
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if r.URL.Path == "/missing" {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprintf(w, "contents of %s", r.URL.Path)
+}
+
+func moduleURLs(t *testing.T, base string, names ...string) []*url.URL {
+	var urls []*url.URL
+	for _, name := range names {
+		u, err := url.Parse(base + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+func TestFetchAll(t *testing.T) {
+	m := &moduleServer{}
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+	s := Schemes{"http": NewHTTPClient(ts.Client())}
+
+	dir := t.TempDir()
+	dest := func(u *url.URL) string { return filepath.Join(dir, path.Base(u.Path)) }
+	urls := moduleURLs(t, ts.URL, "mod1", "mod2", "mod3", "mod4", "mod5", "mod6")
+	if err := FetchAll(context.Background(), s, urls, dest, 3); err != nil {
+		t.Fatalf("FetchAll() = %v", err)
+	}
+
+	if m.max != 3 {
+		t.Errorf("FetchAll() ran %d downloads at once, want 3", m.max)
+	}
+	for _, u := range urls {
+		b, err := os.ReadFile(dest(u))
+		if err != nil {
+			t.Errorf("%s was not downloaded: %v", u, err)
+			continue
+		}
+		if want := "contents of " + u.Path; string(b) != want {
+			t.Errorf("%s = %q, want %q", dest(u), b, want)
+		}
+	}
+}
+
+func TestFetchAllErrors(t *testing.T) {
+	m := &moduleServer{}
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+	s := Schemes{"http": NewHTTPClient(ts.Client())}
+
+	dir := t.TempDir()
+	dest := func(u *url.URL) string { return filepath.Join(dir, path.Base(u.Path)) }
+	urls := moduleURLs(t, ts.URL, "mod1", "missing", "mod2")
+	urls = append(urls, &url.URL{Scheme: "gopher", Host: "example.com", Path: "/mod3"})
+
+	err := FetchAll(context.Background(), s, urls, dest, 2)
+	var fe *FetchAllError
+	if !errors.As(err, &fe) || len(fe.Errs) != 2 {
+		t.Fatalf("FetchAll() = %v, want 2 errors", err)
+	}
+	var code *HTTPClientCodeError
+	if !errors.As(fe.Errs[0], &code) || code.HTTPCode != http.StatusNotFound {
+		t.Errorf("first error = %v, want a 404", fe.Errs[0])
+	}
+	if !errors.Is(fe.Errs[1], ErrNoSuchScheme) {
+		t.Errorf("second error = %v, want %v", fe.Errs[1], ErrNoSuchScheme)
+	}
+	for _, name := range []string{"mod1", "mod2"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was not downloaded despite other failures: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("a file was created for a failed download: %v", err)
+	}
+}
+
+func TestFetchAllFailFast(t *testing.T) {
+	m := &moduleServer{}
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+	s := Schemes{"http": NewHTTPClient(ts.Client())}
+
+	dir := t.TempDir()
+	dest := func(u *url.URL) string { return filepath.Join(dir, path.Base(u.Path)) }
+	urls := moduleURLs(t, ts.URL, "missing", "mod1", "mod2", "mod3")
+
+	err := FetchAllFailFast(context.Background(), s, urls, dest, 1)
+	var fe *FetchAllError
+	if !errors.As(err, &fe) || len(fe.Errs) != 1 {
+		t.Fatalf("FetchAllFailFast() = %v, want only the 404", err)
+	}
+	if len(m.served) != 1 {
+		t.Errorf("FetchAllFailFast() requested %v, want only /missing", m.served)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// mappedFile is a file mapped into memory. It is unmapped and the file is
+// closed when it is closed, or when it is garbage collected.
+type mappedFile struct {
+	*bytes.Reader
+
+	file *os.File
+	data []byte
+}
+
+// mmapFile maps the first size bytes of f read-only into memory. f is kept
+// open until the returned mappedFile is closed.
+func mmapFile(f *os.File, size int64) (*mappedFile, error) {
+	data, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: f.Name(), Err: err}
+	}
+	m := &mappedFile{
+		Reader: bytes.NewReader(data),
+		file:   f,
+		data:   data,
+	}
+	runtime.SetFinalizer(m, (*mappedFile).Close)
+	return m, nil
+}
+
+// Name returns the name of the mapped file.
+func (m *mappedFile) Name() string {
+	return m.file.Name()
+}
+
+// File returns the mapped file, e.g. to pass it to kexec_file_load without
+// copying it.
+func (m *mappedFile) File() *os.File {
+	return m.file
+}
+
+// Close unmaps and closes the file. It must not be read afterwards.
+func (m *mappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	runtime.SetFinalizer(m, nil)
+	err := unix.Munmap(m.data)
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	m.data = nil
+	m.Reader = bytes.NewReader(nil)
+	return err
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+func TestLocalFileMmap(t *testing.T) {
+	content := strings.Repeat("vmlinuz", 1000)
+	path := filepath.Join(t.TempDir(), "vmlinuz")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	u := &url.URL{Scheme: "file", Path: path}
+
+	for _, tt := range []struct {
+		name      string
+		threshold int64
+		wantMmap  bool
+	}{
+		{name: "no threshold"},
+		{name: "below threshold", threshold: int64(len(content)) + 1},
+		{name: "at threshold", threshold: int64(len(content)), wantMmap: true},
+		{name: "above threshold", threshold: 1, wantMmap: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			lfs := LocalFileClient{MmapThreshold: tt.threshold}
+			r, err := lfs.Fetch(context.Background(), u)
+			if err != nil {
+				t.Fatalf("Fetch() = %v", err)
+			}
+			defer r.(io.Closer).Close()
+
+			if _, ok := r.(*mappedFile); ok != tt.wantMmap {
+				t.Errorf("Fetch() = %T, want mmap %t", r, tt.wantMmap)
+			}
+			if got, err := uio.ReadAll(r); err != nil || string(got) != content {
+				t.Errorf("reading Fetch() = %d bytes, %v, want %d bytes", len(got), err, len(content))
+			}
+
+			rd, err := lfs.FetchWithoutCache(context.Background(), u)
+			if err != nil {
+				t.Fatalf("FetchWithoutCache() = %v", err)
+			}
+			defer rd.(io.Closer).Close()
+			if got, err := io.ReadAll(rd); err != nil || string(got) != content {
+				t.Errorf("reading FetchWithoutCache() = %d bytes, %v, want %d bytes", len(got), err, len(content))
+			}
+		})
+	}
+}
+
+func TestLocalFileMmapFallback(t *testing.T) {
+	// Character devices cannot be mapped, and are read normally.
+	lfs := LocalFileClient{MmapThreshold: 1}
+	r, err := lfs.FetchWithoutCache(context.Background(), &url.URL{Scheme: "file", Path: "/dev/zero"})
+	if err != nil {
+		t.Fatalf("FetchWithoutCache() = %v", err)
+	}
+	defer r.(io.Closer).Close()
+	if _, ok := r.(*os.File); !ok {
+		t.Errorf("FetchWithoutCache() = %T, want *os.File", r)
+	}
+
+	// An empty mapping fails.
+	path := filepath.Join(t.TempDir(), "empty")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := mmapFile(f, 0); err == nil {
+		t.Error("mmapFile(empty) = nil, want error")
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package curl
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+func mmapFile(f *os.File, size int64) (io.ReaderAt, error) {
+	return nil, errors.New("mmap not supported on this platform")
+}
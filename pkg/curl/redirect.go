@@ -0,0 +1,77 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+// ErrRedirect is returned when fetching a file over HTTP needs a redirect
+// that HTTPClient's redirect policy does not allow.
+var ErrRedirect = errors.New("redirect not allowed")
+
+// defaultMaxRedirects is the most redirects followed by default, as by
+// http.Client.
+const defaultMaxRedirects = 10
+
+// hasRedirectPolicy returns whether h changes how redirects are followed.
+func (h HTTPClient) hasRedirectPolicy() bool {
+	return h.MaxRedirects > 0 || h.RedirectHosts != nil || h.Logger != nil
+}
+
+// client returns the http.Client fetching files, which follows redirects
+// as configured by h.
+func (h HTTPClient) client() *http.Client {
+	if !h.hasRedirectPolicy() {
+		return h.c
+	}
+	rc := *h.c
+	rc.CheckRedirect = h.checkRedirect
+	return &rc
+}
+
+// checkRedirect implements http.Client.CheckRedirect.
+func (h HTTPClient) checkRedirect(req *http.Request, via []*http.Request) error {
+	max := h.MaxRedirects
+	if max <= 0 {
+		max = defaultMaxRedirects
+	}
+	if len(via) > max {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrRedirect, max)
+	}
+
+	orig := via[0].URL
+	if h.RedirectHosts != nil {
+		if req.URL.Scheme != orig.Scheme {
+			return fmt.Errorf("%w: %s changes the scheme of %s", ErrRedirect, req.URL, orig)
+		}
+		if !h.redirectHostAllowed(req.URL.Hostname(), orig.Hostname()) {
+			return fmt.Errorf("%w: %s is not an allowed host for %s", ErrRedirect, req.URL, orig)
+		}
+	}
+
+	if h.Logger != nil {
+		ulog.Logf(h.Logger, ulog.LevelDebug, "Redirect %d of %s: %s -> %s", len(via), orig, via[len(via)-1].URL, req.URL)
+	}
+	return nil
+}
+
+// redirectHostAllowed returns whether a redirect of a request to origHost
+// may lead to host.
+func (h HTTPClient) redirectHostAllowed(host, origHost string) bool {
+	if host == origHost {
+		return true
+	}
+	for _, allowed := range h.RedirectHosts {
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+// redirectChain serves /N, which redirects to /N-1, down to /0, which
+// serves "done".
+func redirectChain(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if n == 0 {
+		fmt.Fprint(w, "done")
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/%d", n-1), http.StatusFound)
+}
+
+type recordLogger struct {
+	lines []string
+}
+
+func (l *recordLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *recordLogger) Print(v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(v...))
+}
+
+func TestMaxRedirects(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(redirectChain))
+	defer s.Close()
+
+	var log recordLogger
+	h := NewHTTPClient(http.DefaultClient)
+	h.MaxRedirects = 3
+	h.Logger = ulog.NewLevelLogger(&log, ulog.LevelDebug)
+
+	u, _ := url.Parse(s.URL + "/3")
+	r, err := h.FetchWithoutCache(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Fetch(%s) = %v, want nil", u, err)
+	}
+	if b, _ := io.ReadAll(r); string(b) != "done" {
+		t.Errorf("Fetch(%s) = %q, want %q", u, b, "done")
+	}
+	if len(log.lines) != 3 || !strings.HasPrefix(log.lines[0], "debug: Redirect 1 of ") {
+		t.Errorf("logged redirects %q, want 3 debug messages", log.lines)
+	}
+
+	u, _ = url.Parse(s.URL + "/4")
+	if _, err := h.FetchWithoutCache(context.Background(), u); !errors.Is(err, ErrRedirect) {
+		t.Errorf("Fetch(%s) = %v, want %v", u, err, ErrRedirect)
+	}
+}
+
+func TestRedirectHosts(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(redirectChain))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Redirect to the same port on another name of the loopback
+		// address, so that only the host differs.
+		u := *targetURL
+		u.Host = "localhost:" + u.Port()
+		u.Path = "/0"
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	}))
+	defer s.Close()
+	u, _ := url.Parse(s.URL + "/")
+
+	for _, tt := range []struct {
+		name    string
+		hosts   []string
+		wantErr error
+	}{
+		{name: "no policy"},
+		{name: "allowed host", hosts: []string{"localhost"}},
+		{name: "disallowed host", hosts: []string{"example.com"}, wantErr: ErrRedirect},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHTTPClient(http.DefaultClient)
+			h.RedirectHosts = tt.hosts
+			if _, err := h.FetchWithoutCache(context.Background(), u); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Fetch(%s) = %v, want %v", u, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver overrides how HTTPClient resolves host names, e.g. to reach a
+// server by IP address in early boot, when DNS may not work. Requests are
+// still made to the host name, so the Host header, TLS server name and
+// certificate verification are unaffected.
+type Resolver struct {
+	// Hosts maps host names to IP addresses, like /etc/hosts. Names are
+	// matched case-insensitively.
+	Hosts map[string]string
+
+	// LookupIPAddr, if set, resolves host names not in Hosts instead of
+	// net.DefaultResolver, e.g. to ask a specific DNS server.
+	LookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// lookup returns the IP addresses of host.
+func (r *Resolver) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	for name, addr := range r.Hosts {
+		if strings.EqualFold(name, host) {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q for host %s", addr, host)
+			}
+			return []net.IPAddr{{IP: ip}}, nil
+		}
+	}
+	if r.LookupIPAddr != nil {
+		return r.LookupIPAddr(ctx, host)
+	}
+	return net.DefaultResolver.LookupIPAddr(ctx, host)
+}
+
+// DialContext connects to address like net.Dialer.DialContext, but resolves
+// its host with r. The addresses it resolves to are tried in order.
+func (r *Resolver) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IP addresses for host %s", host)
+	}
+
+	var d net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		conn, err = d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// SetResolver makes h resolve the host names of requested URLs with r
+// instead of the system resolver. The transport of h's http.Client, which
+// must be nil or an *http.Transport, is copied once to dial with r, so that
+// connections are still reused across fetches.
+func (h *HTTPClient) SetResolver(r *Resolver) error {
+	rt := h.c.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("cannot set a resolver on transport %T, want *http.Transport", rt)
+	}
+	tr = tr.Clone()
+	tr.DialContext = r.DialContext
+	c := *h.c
+	c.Transport = tr
+	h.c = &c
+	return nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+// hostURL returns the URL of ts with its IP address replaced by host.
+func hostURL(t *testing.T, ts *httptest.Server, host string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Host = net.JoinHostPort(host, u.Port())
+	u.Path = "/kernel"
+	return u
+}
+
+func TestResolver(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	}))
+	defer ts.Close()
+
+	errLookup := errors.New("no such host")
+	var looked []string
+	lookup := func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		looked = append(looked, host)
+		if host == "api.example.invalid" {
+			return []net.IPAddr{{IP: net.IPv6loopback}, {IP: net.IPv4(127, 0, 0, 1)}}, nil
+		}
+		return nil, errLookup
+	}
+
+	for _, tt := range []struct {
+		name       string
+		host       string
+		resolver   *Resolver
+		wantLooked []string
+		wantErr    error
+	}{
+		{
+			name:     "hosts",
+			host:     "api.example.invalid",
+			resolver: &Resolver{Hosts: map[string]string{"api.example.invalid": "127.0.0.1"}},
+		},
+		{
+			name:     "hosts ignore case",
+			host:     "API.Example.Invalid",
+			resolver: &Resolver{Hosts: map[string]string{"api.example.invalid": "127.0.0.1"}},
+		},
+		{
+			name: "hosts before lookup",
+			host: "api.example.invalid",
+			resolver: &Resolver{
+				Hosts:        map[string]string{"api.example.invalid": "127.0.0.1"},
+				LookupIPAddr: lookup,
+			},
+		},
+		{
+			name:       "lookup tries all addresses",
+			host:       "api.example.invalid",
+			resolver:   &Resolver{LookupIPAddr: lookup},
+			wantLooked: []string{"api.example.invalid"},
+		},
+		{
+			name:       "lookup fails",
+			host:       "other.example.invalid",
+			resolver:   &Resolver{LookupIPAddr: lookup},
+			wantLooked: []string{"other.example.invalid"},
+			wantErr:    errLookup,
+		},
+		{
+			name:     "IP address",
+			host:     "127.0.0.1",
+			resolver: &Resolver{LookupIPAddr: lookup},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			looked = nil
+			c := NewHTTPClient(http.DefaultClient)
+			if err := c.SetResolver(tt.resolver); err != nil {
+				t.Fatalf("SetResolver() = %v", err)
+			}
+			u := hostURL(t, ts, tt.host)
+
+			r, err := c.FetchWithoutCache(context.Background(), u)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FetchWithoutCache(%s) = %v, want %v", u, err, tt.wantErr)
+			}
+			if fmt.Sprint(looked) != fmt.Sprint(tt.wantLooked) {
+				t.Errorf("looked up %v, want %v", looked, tt.wantLooked)
+			}
+			if err != nil {
+				return
+			}
+			// The server sees the original host name.
+			if got, _ := io.ReadAll(r); string(got) != u.Host {
+				t.Errorf("Host = %q, want %q", got, u.Host)
+			}
+		})
+	}
+}
+
+func TestResolverInvalidIP(t *testing.T) {
+	c := NewHTTPClient(http.DefaultClient)
+	if err := c.SetResolver(&Resolver{Hosts: map[string]string{"api.example.invalid": "not an IP"}}); err != nil {
+		t.Fatalf("SetResolver() = %v", err)
+	}
+	u, _ := url.Parse("http://api.example.invalid/kernel")
+	if _, err := c.FetchWithoutCache(context.Background(), u); err == nil {
+		t.Errorf("FetchWithoutCache(%s) = nil, want error", u)
+	}
+}
+
+func TestResolverReusesConnections(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "kernel")
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	c := NewHTTPClient(&http.Client{Transport: &http.Transport{}})
+	if err := c.SetResolver(&Resolver{Hosts: map[string]string{"boot.example": "127.0.0.1"}}); err != nil {
+		t.Fatalf("SetResolver() = %v", err)
+	}
+	u := hostURL(t, ts, "boot.example")
+	for i := 0; i < 3; i++ {
+		r, err := c.FetchWithoutCache(context.Background(), u)
+		if err != nil {
+			t.Fatalf("FetchWithoutCache(%s) = %v", u, err)
+		}
+		if _, err := io.ReadAll(r); err != nil {
+			t.Fatalf("reading %s: %v", u, err)
+		}
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("3 fetches opened %d connections, want 1", n)
+	}
+}
+
+// roundTripFunc is an http.RoundTripper that is not an *http.Transport.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSetResolverUnsupportedTransport(t *testing.T) {
+	c := NewHTTPClient(&http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("unused")
+	})})
+	if err := c.SetResolver(&Resolver{}); err == nil {
+		t.Errorf("SetResolver() = nil, want error")
+	}
+}
+
+func TestResolverTLS(t *testing.T) {
+	serverCert, serverKey := selfSigned(t, t.TempDir(), "server")
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var serverName string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverName = r.TLS.ServerName
+		fmt.Fprint(w, "kernel")
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.StartTLS()
+	defer ts.Close()
+
+	c, err := NewHTTPSClient(&TLSConfig{CAFile: serverCert})
+	if err != nil {
+		t.Fatalf("NewHTTPSClient() = %v", err)
+	}
+	if err := c.SetResolver(&Resolver{Hosts: map[string]string{"boot.example": "127.0.0.1"}}); err != nil {
+		t.Fatalf("SetResolver() = %v", err)
+	}
+
+	// The certificate is verified against the host name, which is also
+	// sent as SNI.
+	u := hostURL(t, ts, "boot.example")
+	r, err := c.FetchWithoutCache(context.Background(), u)
+	if err != nil {
+		t.Fatalf("FetchWithoutCache(%s) = %v", u, err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "kernel" {
+		t.Errorf("FetchWithoutCache(%s) = %q, want %q", u, got, "kernel")
+	}
+	if serverName != "boot.example" {
+		t.Errorf("SNI server name = %q, want %q", serverName, "boot.example")
+	}
+}
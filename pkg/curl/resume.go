@@ -0,0 +1,127 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// parseContentRange returns the first byte position and the complete length
+// of a Content-Range header such as "bytes 100-199/200" or "bytes */200". The
+// complete length is -1 if it is unknown.
+func parseContentRange(v string) (start, length int64, err error) {
+	var rng, size string
+	if n, _ := fmt.Sscanf(v, "bytes %s", &rng); n != 1 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	i := strings.IndexByte(rng, '/')
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", v)
+	}
+	rng, size = rng[:i], rng[i+1:]
+
+	length = -1
+	if size != "*" {
+		if _, err := fmt.Sscanf(size, "%d", &length); err != nil {
+			return 0, 0, fmt.Errorf("invalid Content-Range %q: %v", v, err)
+		}
+	}
+	if rng == "*" {
+		return -1, length, nil
+	}
+	if _, err := fmt.Sscanf(rng, "%d-", &start); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q: %v", v, err)
+	}
+	return start, length, nil
+}
+
+// FetchResume writes the file at u to f, and returns its ETag.
+//
+// If f is not empty, it is assumed to hold the beginning of the file, as
+// left by an interrupted FetchResume that returned etag. Only the rest of
+// the file is then requested. If the server does not support ranges, or the
+// file has changed since, i.e. its ETag is no longer etag, f is truncated
+// and the file is downloaded again in full.
+//
+// If the transfer is interrupted, the ETag is returned along with the error,
+// so that the download can be resumed.
+//
+// Without a strong etag, the beginning of the file cannot be validated, so
+// it is always downloaded in full.
+func (h HTTPClient) FetchResume(ctx context.Context, u *url.URL, f *os.File, etag string) (string, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := fi.Size()
+	if etag == "" || strings.HasPrefix(etag, "W/") {
+		offset = 0
+	}
+
+	req, err := h.newRequest(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// The server only honors Range if the file still has this ETag.
+		req.Header.Set("If-Range", etag)
+	}
+	resp, err := h.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Range was ignored, or the file changed.
+		offset = 0
+
+	case http.StatusPartialContent:
+		start, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return "", err
+		}
+		if start != offset {
+			return "", fmt.Errorf("server sent range starting at %d, want %d", start, offset)
+		}
+		if e := resp.Header.Get("ETag"); e != "" && e != etag {
+			return "", fmt.Errorf("server sent range of %s with ETag %s, want %s", u, e, etag)
+		}
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// f may already hold the whole file.
+		if _, length, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && length == offset {
+			return etag, nil
+		}
+		return "", &HTTPClientCodeError{HTTPCode: resp.StatusCode}
+
+	default:
+		return "", &HTTPClientCodeError{
+			HTTPCode:   resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	_, err = io.Copy(f, h.body(ctx, u, resp.Body, offset, total))
+	return resp.Header.Get("ETag"), err
+}
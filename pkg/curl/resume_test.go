@@ -0,0 +1,143 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchResume(t *testing.T) {
+	const content = "0123456789abcdefghij"
+
+	// serveContent serves content with etag, honoring Range and If-Range.
+	serveContent := func(etag string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", etag)
+			http.ServeContent(w, r, "initrd", time.Time{}, strings.NewReader(content))
+		}
+	}
+	// ignoreRange always serves all of content.
+	ignoreRange := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(content))
+	}
+
+	for _, tt := range []struct {
+		name      string
+		handler   http.HandlerFunc
+		partial   string
+		etag      string
+		wantRange string
+	}{
+		{
+			name:      "resume",
+			handler:   serveContent(`"v1"`),
+			partial:   content[:7],
+			etag:      `"v1"`,
+			wantRange: "bytes=7-",
+		},
+		{
+			name:    "empty file",
+			handler: serveContent(`"v1"`),
+			etag:    `"v1"`,
+		},
+		{
+			name:      "already complete",
+			handler:   serveContent(`"v1"`),
+			partial:   content,
+			etag:      `"v1"`,
+			wantRange: "bytes=20-",
+		},
+		{
+			name:      "server ignores range",
+			handler:   ignoreRange,
+			partial:   content[:7],
+			etag:      `"v1"`,
+			wantRange: "bytes=7-",
+		},
+		{
+			name:      "file changed",
+			handler:   serveContent(`"v1"`),
+			partial:   "stale",
+			etag:      `"v0"`,
+			wantRange: "bytes=5-",
+		},
+		{
+			name:    "no etag to validate",
+			handler: serveContent(`"v1"`),
+			partial: "stale",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRange = r.Header.Get("Range")
+				tt.handler(w, r)
+			}))
+			defer ts.Close()
+			u, _ := url.Parse(ts.URL)
+
+			path := filepath.Join(t.TempDir(), "initrd")
+			if err := os.WriteFile(path, []byte(tt.partial), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			etag, err := DefaultHTTPClient.FetchResume(context.Background(), u, f, tt.etag)
+			if err != nil {
+				t.Fatalf("FetchResume() = %v", err)
+			}
+			if etag != `"v1"` {
+				t.Errorf("FetchResume() = %s, want ETag %s", etag, `"v1"`)
+			}
+			if gotRange != tt.wantRange {
+				t.Errorf("requested Range %q, want %q", gotRange, tt.wantRange)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != content {
+				t.Errorf("downloaded file = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	for _, tt := range []struct {
+		v                     string
+		wantStart, wantLength int64
+		wantErr               bool
+	}{
+		{v: "bytes 100-199/200", wantStart: 100, wantLength: 200},
+		{v: "bytes 0-9/*", wantStart: 0, wantLength: -1},
+		{v: "bytes */200", wantStart: -1, wantLength: 200},
+		{v: "bytes 100-199", wantErr: true},
+		{v: "items 1-2/3", wantErr: true},
+		{v: "", wantErr: true},
+	} {
+		start, length, err := parseContentRange(tt.v)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseContentRange(%q) = %v, want error %t", tt.v, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (start != tt.wantStart || length != tt.wantLength) {
+			t.Errorf("parseContentRange(%q) = %d, %d, want %d, %d", tt.v, start, length, tt.wantStart, tt.wantLength)
+		}
+	}
+}
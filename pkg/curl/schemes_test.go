@@ -9,13 +9,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/u-root/u-root/pkg/uio"
+	"pack.ag/tftp"
 )
 
 var (
@@ -316,6 +321,41 @@ func TestLazyFetch(t *testing.T) {
 	}
 }
 
+func TestSchemesRegisterClone(t *testing.T) {
+	ms := NewMockScheme("test")
+	ms.Add("artifacts", "/kernel", "vmlinuz")
+
+	s := DefaultSchemes.Clone()
+	s.Register("TEST", ms)
+	override := NewMockScheme("http")
+	s.Register("http", override)
+
+	u, err := url.Parse("Test://artifacts/kernel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Fetch(%s) = %v", u, err)
+	}
+	if got, err := io.ReadAll(uio.Reader(f)); err != nil || string(got) != "vmlinuz" {
+		t.Errorf("Fetch(%s) = %q, %v, want %q", u, got, err, "vmlinuz")
+	}
+	if s["tftp"] != DefaultTFTPClient {
+		t.Errorf("Clone() did not keep the tftp scheme")
+	}
+
+	if _, ok := DefaultSchemes["test"]; ok {
+		t.Errorf("registering in a Clone() added the test scheme to DefaultSchemes")
+	}
+	if DefaultSchemes["http"] != DefaultHTTPClient {
+		t.Errorf("registering in a Clone() replaced the http scheme of DefaultSchemes")
+	}
+	if _, err := DefaultSchemes.Fetch(context.Background(), u); !errors.Is(err, ErrNoSuchScheme) {
+		t.Errorf("DefaultSchemes.Fetch(%s) = %v, want %v", u, err, ErrNoSuchScheme)
+	}
+}
+
 func TestHttpFetches(t *testing.T) {
 	c := "fetch content"
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -354,3 +394,347 @@ func TestHttpFetches(t *testing.T) {
 		t.Errorf("got %s, want %s", got, c)
 	}
 }
+
+// flakyServer returns a server that replies to the first failures requests
+// with code, and with content afterwards.
+func flakyServer(failures int, code int, header http.Header, content string) (*httptest.Server, *int) {
+	var requests int
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(code)
+			return
+		}
+		fmt.Fprint(w, content)
+	})), &requests
+}
+
+func TestHTTPRetries(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		failures     int
+		code         int
+		maxAttempts  int
+		want         string
+		wantCode     int
+		wantRequests int
+	}{
+		{
+			name:         "recovers from 503",
+			failures:     3,
+			code:         http.StatusServiceUnavailable,
+			want:         "content",
+			wantRequests: 4,
+		},
+		{
+			name:         "recovers from 429",
+			failures:     1,
+			code:         http.StatusTooManyRequests,
+			want:         "content",
+			wantRequests: 2,
+		},
+		{
+			name:         "404 is not retried",
+			failures:     1,
+			code:         http.StatusNotFound,
+			wantCode:     http.StatusNotFound,
+			wantRequests: 1,
+		},
+		{
+			name:         "max attempts",
+			failures:     5,
+			code:         http.StatusInternalServerError,
+			maxAttempts:  3,
+			wantCode:     http.StatusInternalServerError,
+			wantRequests: 3,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, requests := flakyServer(tt.failures, tt.code, nil, "content")
+			defer ts.Close()
+			u, _ := url.Parse(ts.URL)
+
+			s := &SchemeWithRetries{
+				Scheme:      DefaultHTTPClient,
+				DoRetry:     RetryOr(RetryHTTP, RetryTemporaryNetworkErrors),
+				BackOff:     backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 10),
+				MaxAttempts: tt.maxAttempts,
+			}
+			r, err := s.FetchWithoutCache(context.Background(), u)
+			var herr *HTTPClientCodeError
+			if tt.wantCode != 0 {
+				if !errors.As(err, &herr) || herr.HTTPCode != tt.wantCode {
+					t.Errorf("FetchWithoutCache() = %v, want HTTP code %d", err, tt.wantCode)
+				}
+			} else if err != nil {
+				t.Fatalf("FetchWithoutCache() = %v", err)
+			} else if got, _ := io.ReadAll(r); string(got) != tt.want {
+				t.Errorf("FetchWithoutCache() = %q, want %q", got, tt.want)
+			}
+			if *requests != tt.wantRequests {
+				t.Errorf("got %d requests, want %d", *requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestHTTPRetryAfter(t *testing.T) {
+	ts, requests := flakyServer(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"1"}}, "content")
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	s := &SchemeWithRetries{
+		Scheme:  DefaultHTTPClient,
+		DoRetry: RetryHTTP,
+		BackOff: backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1),
+	}
+	start := time.Now()
+	if _, err := s.Fetch(context.Background(), u); err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	}
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("Fetch() retried after %v, want at least the 1s from Retry-After", d)
+	}
+	if *requests != 2 {
+		t.Errorf("got %d requests, want 2", *requests)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// Hang until the attempt is canceled.
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "content")
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	s := &SchemeWithRetries{
+		Scheme:  DefaultHTTPClient,
+		BackOff: backoff.WithMaxRetries(&backoff.ZeroBackOff{}, 1),
+		Timeout: 100 * time.Millisecond,
+	}
+	r, err := s.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	}
+	if got, _ := io.ReadAll(uio.Reader(r)); string(got) != "content" {
+		t.Errorf("Fetch() = %q, want %q", got, "content")
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("got %d requests, want 2", n)
+	}
+}
+
+func TestRetryTimeoutDetached(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/hang" {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "content")
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	s := &SchemeWithRetries{
+		Scheme:  DefaultHTTPClient,
+		BackOff: &backoff.StopBackOff{},
+		Timeout: time.Minute,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := s.FetchWithoutCache(ctx, u)
+	if err != nil {
+		t.Fatalf("FetchWithoutCache() = %v", err)
+	}
+
+	// The file is read independently of ctx once the attempt succeeded.
+	cancel()
+	close(release)
+	if got, err := io.ReadAll(r); err != nil || string(got) != "content" {
+		t.Errorf("FetchWithoutCache() = %q, %v, want %q", got, err, "content")
+	}
+
+	// ctx still cancels attempts.
+	u.Path = "/hang"
+	if _, err := s.FetchWithoutCache(ctx, u); !errors.Is(err, context.Canceled) {
+		t.Errorf("FetchWithoutCache() with a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for _, tt := range []struct {
+		v    string
+		want time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"soon", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0},
+	} {
+		if got := parseRetryAfter(tt.v); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+
+	v := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(v); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("parseRetryAfter(%q) = %v, want about an hour", v, got)
+	}
+}
+
+func TestHTTPProgress(t *testing.T) {
+	content := strings.Repeat("u-root", 10000)
+	for _, tt := range []struct {
+		name      string
+		length    bool
+		wantTotal int64
+	}{
+		{name: "Content-Length", length: true, wantTotal: int64(len(content))},
+		{name: "unknown length", wantTotal: -1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.length {
+					w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+				}
+				// Flushing before writing sends a chunked response of
+				// unknown length.
+				w.(http.Flusher).Flush()
+				fmt.Fprint(w, content)
+			}))
+			defer ts.Close()
+			u, _ := url.Parse(ts.URL)
+
+			var calls, last int64
+			c := NewHTTPClient(http.DefaultClient)
+			c.Progress = func(pu *url.URL, bytesSoFar, total int64) {
+				if pu.String() != u.String() {
+					t.Errorf("progress of %s, want %s", pu, u)
+				}
+				calls++
+				if bytesSoFar <= last {
+					t.Errorf("progress went from %d to %d bytes", last, bytesSoFar)
+				}
+				if total != tt.wantTotal {
+					t.Errorf("progress total = %d, want %d", total, tt.wantTotal)
+				}
+				last = bytesSoFar
+			}
+
+			r, err := c.FetchWithoutCache(context.Background(), u)
+			if err != nil {
+				t.Fatalf("FetchWithoutCache() = %v", err)
+			}
+			if _, err := io.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+			if calls == 0 {
+				t.Fatal("progress was never reported")
+			}
+			if last != int64(len(content)) {
+				t.Errorf("progress ended at %d bytes, want %d", last, len(content))
+			}
+		})
+	}
+}
+
+// tftpServer serves files over TFTP on localhost.
+func tftpServer(t *testing.T, files map[string]string) string {
+	t.Helper()
+	s, err := tftp.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ReadHandler(tftp.ReadHandlerFunc(func(r tftp.ReadRequest) {
+		content, ok := files[r.Name()]
+		if !ok {
+			r.WriteError(tftp.ErrCodeFileNotFound, "no such file")
+			return
+		}
+		r.WriteSize(int64(len(content)))
+		r.Write([]byte(content))
+	}))
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(conn)
+	t.Cleanup(func() { s.Close() })
+	return conn.LocalAddr().String()
+}
+
+func TestTFTPFetch(t *testing.T) {
+	files := map[string]string{
+		"small":  "pxelinux config",
+		"blocks": strings.Repeat("b", 1450*3),
+		"large":  strings.Repeat("u-root", 100000),
+	}
+	addr := tftpServer(t, files)
+
+	for _, tt := range []struct {
+		name   string
+		client *TFTPClient
+	}{
+		{name: "default options", client: NewTFTPClient()},
+		{name: "negotiated blksize and windowsize", client: DefaultTFTPClient},
+	} {
+		for file, content := range files {
+			t.Run(tt.name+"/"+file, func(t *testing.T) {
+				u := &url.URL{Scheme: "tftp", Host: addr, Path: "/" + file}
+				r, err := tt.client.FetchWithoutCache(context.Background(), u)
+				if err != nil {
+					t.Fatalf("FetchWithoutCache(%s) = %v", u, err)
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("reading %s = %v", u, err)
+				}
+				if string(got) != content {
+					t.Errorf("FetchWithoutCache(%s) = %d bytes, want %d", u, len(got), len(content))
+				}
+			})
+		}
+	}
+
+	t.Run("progress", func(t *testing.T) {
+		c := NewTFTPClient(tftp.ClientBlocksize(1450), tftp.ClientTransferSize(true))
+		var last, total int64
+		c.Progress = func(_ *url.URL, bytesSoFar, size int64) {
+			last, total = bytesSoFar, size
+		}
+		u := &url.URL{Scheme: "tftp", Host: addr, Path: "/large"}
+		r, err := c.Fetch(context.Background(), u)
+		if err != nil {
+			t.Fatalf("Fetch(%s) = %v", u, err)
+		}
+		if _, err := io.ReadAll(uio.Reader(r)); err != nil {
+			t.Fatal(err)
+		}
+		if want := int64(len(files["large"])); last != want || total != want {
+			t.Errorf("progress ended at %d of %d bytes, want %d of %d", last, total, want, want)
+		}
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		u := &url.URL{Scheme: "tftp", Host: addr, Path: "/missing"}
+		_, err := DefaultTFTPClient.FetchWithoutCache(context.Background(), u)
+		if err == nil {
+			t.Fatalf("FetchWithoutCache(%s) = nil, want error", u)
+		}
+		if RetryTFTP(u, err) {
+			t.Errorf("RetryTFTP(%v) = true, want false", err)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+)
+
+// ErrTruncated is returned when the body of a file ends before its
+// Content-Length.
+var ErrTruncated = errors.New("file is shorter than its Content-Length")
+
+// FileTooLargeError is returned when a file is larger than
+// HTTPClient.MaxSize.
+type FileTooLargeError struct {
+	URL     *url.URL
+	MaxSize int64
+}
+
+// Error implements error for FileTooLargeError.
+func (e *FileTooLargeError) Error() string {
+	return fmt.Sprintf("%s: file exceeds the maximum size of %d bytes", e.URL, e.MaxSize)
+}
+
+// sizeReader checks the size of the file at u read from r. Reading fails
+// once more than max bytes were read, if max is positive, and at the end of
+// the file if fewer than total bytes were read, if total is not negative.
+//
+// body, if set, is closed once the file is too large, to abort the
+// transfer.
+type sizeReader struct {
+	u          *url.URL
+	r          io.Reader
+	body       io.Closer
+	n          int64
+	max, total int64
+
+	// tooLarge is set once more than max bytes were read.
+	tooLarge bool
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	if s.tooLarge {
+		return 0, &FileTooLargeError{URL: s.u, MaxSize: s.max}
+	}
+	n, err := s.r.Read(p)
+	s.n += int64(n)
+	if s.max > 0 && s.n > s.max {
+		s.tooLarge = true
+		if s.body != nil {
+			s.body.Close()
+		}
+		// Only return the bytes up to the maximum size.
+		n -= int(s.n - s.max)
+		if n < 0 {
+			n = 0
+		}
+		return n, &FileTooLargeError{URL: s.u, MaxSize: s.max}
+	}
+	if (err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF)) && s.total >= 0 && s.n < s.total {
+		return n, fmt.Errorf("%s: %w: got %d of %d bytes", s.u, ErrTruncated, s.n, s.total)
+	}
+	return n, err
+}
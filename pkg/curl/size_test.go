@@ -0,0 +1,152 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestMaxSize(t *testing.T) {
+	payload := bytes.Repeat([]byte("u"), 1000)
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write(bytes.Repeat([]byte("u"), 100000))
+	zw.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file":
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.Write(payload)
+		case "/endless":
+			// No Content-Length, and a body that never ends.
+			for {
+				if _, err := w.Write(payload); err != nil {
+					return
+				}
+			}
+		case "/truncated":
+			w.Header().Set("Content-Length", strconv.Itoa(2*len(payload)))
+			w.Write(payload)
+			// Closing the connection ends the body early.
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		case "/encoded":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped.Bytes())
+		}
+	}))
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		name        string
+		path        string
+		maxSize     int64
+		want        []byte
+		wantTooBig  bool
+		wantErr     error
+		wantFetched bool
+	}{
+		{
+			name: "correct length",
+			path: "/file",
+			want: payload,
+		},
+		{
+			name:    "correct length within max size",
+			path:    "/file",
+			maxSize: 1000,
+			want:    payload,
+		},
+		{
+			name:       "content length exceeds max size",
+			path:       "/file",
+			maxSize:    999,
+			wantTooBig: true,
+		},
+		{
+			name:        "endless body",
+			path:        "/endless",
+			maxSize:     10000,
+			wantTooBig:  true,
+			wantFetched: true,
+		},
+		{
+			name:        "decoded file exceeds max size",
+			path:        "/encoded",
+			maxSize:     10000,
+			wantTooBig:  true,
+			wantFetched: true,
+		},
+		{
+			name:        "truncated",
+			path:        "/truncated",
+			wantErr:     ErrTruncated,
+			wantFetched: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(ts.URL + tt.path)
+			c := NewHTTPClient(http.DefaultClient)
+			c.MaxSize = tt.maxSize
+
+			var tooBig *FileTooLargeError
+			r, err := c.FetchWithoutCache(context.Background(), u)
+			if err == nil {
+				var got []byte
+				got, err = io.ReadAll(r)
+				if err == nil && !bytes.Equal(got, tt.want) {
+					t.Errorf("read %d bytes, want %d", len(got), len(tt.want))
+				}
+				if errors.As(err, &tooBig) && int64(len(got)) != tt.maxSize {
+					t.Errorf("read %d bytes before failing, want %d", len(got), tt.maxSize)
+				}
+			} else if tt.wantFetched {
+				t.Fatalf("FetchWithoutCache() = %v, want the error while reading", err)
+			}
+
+			switch {
+			case tt.wantTooBig:
+				if !errors.As(err, &tooBig) || tooBig.MaxSize != tt.maxSize || tooBig.URL != u {
+					t.Errorf("error = %v, want a *FileTooLargeError for %s and %d bytes", err, u, tt.maxSize)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Errorf("error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestSizeReaderAfterMaxSize(t *testing.T) {
+	u, _ := url.Parse("http://example.com/file")
+	s := &sizeReader{u: u, r: bytes.NewReader(bytes.Repeat([]byte("u"), 100)), max: 10, total: -1}
+
+	p := make([]byte, 8)
+	for i, want := range []int{8, 2, 0, 0} {
+		n, err := s.Read(p)
+		if n != want {
+			t.Errorf("Read %d = %d bytes, want %d", i, n, want)
+		}
+		var tooBig *FileTooLargeError
+		if gotErr := errors.As(err, &tooBig); gotErr != (i > 0) {
+			t.Errorf("Read %d = %v, want FileTooLargeError: %t", i, err, i > 0)
+		}
+	}
+}
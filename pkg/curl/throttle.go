@@ -0,0 +1,60 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// throttledReader limits reading from r to rate bytes per second.
+//
+// It is a token bucket holding up to a second's worth of bytes. Reads take
+// tokens as they return bytes, and wait for the bucket to refill when it
+// runs out.
+type throttledReader struct {
+	ctx    context.Context
+	r      io.Reader
+	rate   int64
+	tokens int64
+	last   time.Time
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, rate int64) *throttledReader {
+	return &throttledReader{
+		ctx:  ctx,
+		r:    r,
+		rate: rate,
+		last: time.Now(),
+	}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	now := time.Now()
+	t.tokens += int64(now.Sub(t.last).Seconds() * float64(t.rate))
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+	t.last = now
+
+	if int64(len(p)) > t.rate {
+		p = p[:t.rate]
+	}
+	n, err := t.r.Read(p)
+	t.tokens -= int64(n)
+	if t.tokens >= 0 {
+		return n, err
+	}
+
+	// Wait until the bytes just read are paid for.
+	wait := time.Duration(float64(-t.tokens) / float64(t.rate) * float64(time.Second))
+	select {
+	case <-time.After(wait):
+		return n, err
+	case <-t.ctx.Done():
+		return n, t.ctx.Err()
+	}
+}
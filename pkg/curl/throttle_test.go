@@ -0,0 +1,57 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMaxBytesPerSecond(t *testing.T) {
+	const rate = 64 << 10
+	payload := bytes.Repeat([]byte("u"), rate*3/2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	c := NewHTTPClient(http.DefaultClient)
+	c.MaxBytesPerSecond = rate
+	start := time.Now()
+	r, err := c.FetchWithoutCache(context.Background(), u)
+	if err != nil {
+		t.Fatalf("FetchWithoutCache() = %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+
+	if !bytes.Equal(got, payload) {
+		t.Errorf("FetchWithoutCache() = %d bytes, want %d", len(got), len(payload))
+	}
+	// 1.5 seconds worth of bytes.
+	if elapsed < 1400*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("downloading at %d bytes/s took %v, want about 1.5s", rate, elapsed)
+	}
+}
+
+func TestThrottledReaderCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := newThrottledReader(ctx, bytes.NewReader(make([]byte, 100)), 10)
+	if _, err := io.ReadAll(r); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadAll() = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSConfig configures how HTTPS servers are verified, and how the client
+// authenticates itself to them.
+type TLSConfig struct {
+	// CAFile, if set, is a PEM file of the CA certificates trusted to
+	// sign server certificates, instead of the system's.
+	CAFile string
+
+	// CertFile and KeyFile, if set, are the PEM files of a client
+	// certificate and its private key.
+	CertFile string
+	KeyFile  string
+
+	// ServerName, if set, is the name server certificates are verified
+	// against, instead of the host name of the URL.
+	ServerName string
+}
+
+// Config returns the tls.Config described by c. Server certificates are
+// always verified.
+func (c *TLSConfig) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: c.ServerName,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificates: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates found in %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, errors.New("client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// NewHTTPSClient returns a new HTTP FileScheme that verifies servers and
+// authenticates to them as configured by c.
+func NewHTTPSClient(c *TLSConfig) (*HTTPClient, error) {
+	config, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = config
+	return NewHTTPClient(&http.Client{Transport: tr}), nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfSigned writes a self-signed certificate for boot.example and
+// 127.0.0.1, usable by both servers and clients, and its key to dir.
+func selfSigned(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"boot.example"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestHTTPSClient(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := selfSigned(t, dir, "server")
+	clientCert, clientKey := selfSigned(t, dir, "client")
+	otherCA, _ := selfSigned(t, dir, "other")
+
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	b, err := os.ReadFile(clientCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs.AppendCertsFromPEM(b)
+
+	for _, tt := range []struct {
+		name       string
+		clientAuth bool
+		config     *TLSConfig
+		wantErr    bool
+	}{
+		{
+			name:   "trusted CA",
+			config: &TLSConfig{CAFile: serverCert},
+		},
+		{
+			name:   "server name",
+			config: &TLSConfig{CAFile: serverCert, ServerName: "boot.example"},
+		},
+		{
+			name:       "client certificate",
+			clientAuth: true,
+			config:     &TLSConfig{CAFile: serverCert, CertFile: clientCert, KeyFile: clientKey},
+		},
+		{
+			name:    "system CAs",
+			config:  &TLSConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "untrusted CA",
+			config:  &TLSConfig{CAFile: otherCA},
+			wantErr: true,
+		},
+		{
+			name:    "wrong server name",
+			config:  &TLSConfig{CAFile: serverCert, ServerName: "evil.example"},
+			wantErr: true,
+		},
+		{
+			name:       "missing client certificate",
+			clientAuth: true,
+			config:     &TLSConfig{CAFile: serverCert},
+			wantErr:    true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "kernel")
+			}))
+			ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+			if tt.clientAuth {
+				ts.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+				ts.TLS.ClientCAs = clientCAs
+			}
+			// Don't log the expected handshake errors.
+			ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+			ts.StartTLS()
+			defer ts.Close()
+
+			c, err := NewHTTPSClient(tt.config)
+			if err != nil {
+				t.Fatalf("NewHTTPSClient() = %v", err)
+			}
+			u, _ := url.Parse(ts.URL)
+			r, err := c.FetchWithoutCache(context.Background(), u)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("FetchWithoutCache() = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchWithoutCache() = %v", err)
+			}
+			if got, _ := io.ReadAll(r); string(got) != "kernel" {
+				t.Errorf("FetchWithoutCache() = %q, want %q", got, "kernel")
+			}
+		})
+	}
+}
+
+func TestDefaultSchemesHTTPS(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "kernel")
+	}))
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.StartTLS()
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+
+	// The test server's certificate is not signed by a system CA.
+	if _, err := DefaultSchemes.FetchWithoutCache(context.Background(), u); err == nil {
+		t.Errorf("DefaultSchemes.FetchWithoutCache(%s) = nil, want certificate error", u)
+	}
+
+	certFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewHTTPSClient(&TLSConfig{CAFile: certFile})
+	if err != nil {
+		t.Fatalf("NewHTTPSClient() = %v", err)
+	}
+	s := DefaultSchemes.Clone()
+	s.Register("https", c)
+	r, err := s.FetchWithoutCache(context.Background(), u)
+	if err != nil {
+		t.Fatalf("FetchWithoutCache(%s) = %v", u, err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "kernel" {
+		t.Errorf("FetchWithoutCache(%s) = %q, want %q", u, got, "kernel")
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := selfSigned(t, dir, "ca")
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []*TLSConfig{
+		{CAFile: filepath.Join(dir, "missing.pem")},
+		{CAFile: notPEM},
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: notPEM},
+	} {
+		if _, err := c.Config(); err == nil {
+			t.Errorf("%+v.Config() = nil, want error", c)
+		}
+	}
+
+	config, err := (&TLSConfig{CAFile: certFile}).Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.InsecureSkipVerify {
+		t.Error("Config() skips verification")
+	}
+	if config.RootCAs == nil {
+		t.Error("Config() does not use the CA file")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+	"github.com/vishvananda/netlink"
+)
+
+// Defaults for IPv4 duplicate address detection, as suggested by RFC 5227
+// Section 1.1.
+const (
+	DefaultARPProbeCount    = 3
+	DefaultARPProbeInterval = 1 * time.Second
+)
+
+// DefaultDeclineBackoff is how long to wait after declining an address that
+// is already in use before asking for another, as required by RFC 2131
+// Section 3.1.5 to avoid looping when a server keeps offering it.
+const DefaultDeclineBackoff = 10 * time.Second
+
+// ARP operation codes.
+const (
+	arpRequest uint16 = 1
+	arpReply   uint16 = 2
+)
+
+// arpPacketLen is the length of an ARP packet for Ethernet and IPv4.
+const arpPacketLen = 28
+
+// arpPacket is an ARP packet for Ethernet hardware and IPv4 protocol
+// addresses.
+type arpPacket struct {
+	Operation uint16
+	SenderHW  net.HardwareAddr
+	SenderIP  net.IP
+	TargetHW  net.HardwareAddr
+	TargetIP  net.IP
+}
+
+// MarshalBinary encodes the packet as specified by RFC 826.
+func (p *arpPacket) MarshalBinary() ([]byte, error) {
+	if len(p.SenderHW) != 6 || len(p.TargetHW) != 6 {
+		return nil, fmt.Errorf("ARP hardware addresses must be 6 bytes long")
+	}
+	spa, tpa := p.SenderIP.To4(), p.TargetIP.To4()
+	if spa == nil || tpa == nil {
+		return nil, fmt.Errorf("ARP protocol addresses must be IPv4 addresses")
+	}
+
+	b := make([]byte, arpPacketLen)
+	binary.BigEndian.PutUint16(b[0:2], 1) // Hardware type Ethernet.
+	binary.BigEndian.PutUint16(b[2:4], uint16(ethernet.EtherTypeIPv4))
+	b[4] = 6
+	b[5] = 4
+	binary.BigEndian.PutUint16(b[6:8], p.Operation)
+	copy(b[8:14], p.SenderHW)
+	copy(b[14:18], spa)
+	copy(b[18:24], p.TargetHW)
+	copy(b[24:28], tpa)
+	return b, nil
+}
+
+// UnmarshalBinary decodes an Ethernet/IPv4 ARP packet.
+func (p *arpPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < arpPacketLen {
+		return fmt.Errorf("ARP packet too short: %d bytes", len(b))
+	}
+	if b[4] != 6 || b[5] != 4 {
+		return fmt.Errorf("not an Ethernet/IPv4 ARP packet")
+	}
+	p.Operation = binary.BigEndian.Uint16(b[6:8])
+	p.SenderHW = net.HardwareAddr(append([]byte(nil), b[8:14]...))
+	p.SenderIP = net.IP(append([]byte(nil), b[14:18]...))
+	p.TargetHW = net.HardwareAddr(append([]byte(nil), b[18:24]...))
+	p.TargetIP = net.IP(append([]byte(nil), b[24:28]...))
+	return nil
+}
+
+// newARPConn opens a packet connection sending and receiving ARP payloads on
+// iface.
+//
+// It is a variable so that tests can substitute a fake ARP responder.
+var newARPConn = func(iface netlink.Link) (net.PacketConn, error) {
+	ifi, err := net.InterfaceByIndex(iface.Attrs().Index)
+	if err != nil {
+		return nil, err
+	}
+	return raw.ListenPacket(ifi, uint16(ethernet.EtherTypeARP), &raw.Config{LinuxSockDGRAM: true})
+}
+
+// probeARP sends count ARP probes for ip from hwaddr, waiting interval for
+// replies after each one, as described in RFC 5227 Section 2.1.1.
+//
+// It returns the hardware address of the first other host claiming ip, or
+// nil if no host did.
+func probeARP(ctx context.Context, conn net.PacketConn, hwaddr net.HardwareAddr, ip net.IP, count int, interval time.Duration) (net.HardwareAddr, error) {
+	probe := &arpPacket{
+		Operation: arpRequest,
+		SenderHW:  hwaddr,
+		SenderIP:  net.IPv4zero,
+		TargetHW:  make(net.HardwareAddr, 6),
+		TargetIP:  ip,
+	}
+	pb, err := probe.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	bcast := &raw.Addr{HardwareAddr: ethernet.Broadcast}
+
+	b := make([]byte, 1500)
+	for i := 0; i < count; i++ {
+		if _, err := conn.WriteTo(pb, bcast); err != nil {
+			return nil, fmt.Errorf("sending ARP probe for %s: %v", ip, err)
+		}
+
+		deadline := time.Now().Add(interval)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		for {
+			n, _, err := conn.ReadFrom(b)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+
+			var p arpPacket
+			if err := p.UnmarshalBinary(b[:n]); err != nil {
+				continue
+			}
+			if bytes.Equal(p.SenderHW, hwaddr) {
+				continue
+			}
+			// Either someone already uses the address, or someone
+			// else is probing for it at the same time (RFC 5227
+			// Section 2.1.1).
+			if p.SenderIP.Equal(ip) || (p.Operation == arpRequest && p.SenderIP.Equal(net.IPv4zero) && p.TargetIP.Equal(ip)) {
+				return p.SenderHW, nil
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
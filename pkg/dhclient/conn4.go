@@ -0,0 +1,187 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/mdlayher/ethernet"
+	"github.com/mdlayher/raw"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/bpf"
+)
+
+// maxXIDs is how many of the most recently sent transaction IDs an xidConn
+// accepts replies for.
+const maxXIDs = 8
+
+// clientPort returns the UDP port DHCPv4 messages are sent from and received
+// on.
+func (c Config) clientPort() int {
+	if c.ClientPort != 0 {
+		return c.ClientPort
+	}
+	return nclient4.ClientPort
+}
+
+// bpfConn is a packet connection whose incoming packets can be filtered
+// with BPF, e.g. a *raw.Conn.
+type bpfConn interface {
+	net.PacketConn
+	SetBPF(filter []bpf.RawInstruction) error
+}
+
+// newRawConn4 opens a connection sending and receiving DHCPv4 messages on
+// iface from and to UDP port port, on a raw socket so that iface can be
+// unconfigured.
+//
+// It is a variable so that tests can substitute a fake connection.
+var newRawConn4 = func(iface netlink.Link, port int) (net.PacketConn, error) {
+	ifi, err := net.InterfaceByName(iface.Attrs().Name)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := bpf.Assemble(dhcp4Filter(port, nil))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := raw.ListenPacket(ifi, uint16(ethernet.EtherTypeIPv4), &raw.Config{
+		LinuxSockDGRAM: true,
+		Filter:         filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newXIDConn(conn, port), nil
+}
+
+// dhcp4Filter returns a BPF program for IP packets that accepts UDP
+// datagrams to port carrying a DHCPv4 message with one of xids, and drops
+// all other packets.
+func dhcp4Filter(port int, xids []dhcpv4.TransactionID) []bpf.Instruction {
+	// Jump targets, counted from the end of the program.
+	const (
+		drop   = 2
+		accept = 1
+	)
+	prog := []bpf.Instruction{
+		// UDP only.
+		bpf.LoadAbsolute{Off: 9, Size: 1},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: 17, SkipTrue: drop},
+		// Fragments after the first have no UDP header.
+		bpf.LoadAbsolute{Off: 6, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff, SkipTrue: drop},
+		// X is the length of the IP header.
+		bpf.LoadMemShift{Off: 0},
+		// UDP destination port.
+		bpf.LoadIndirect{Off: 2, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpNotEqual, Val: uint32(port), SkipTrue: drop},
+		// The transaction ID follows the 8-byte UDP header and the op,
+		// htype, hlen and hops fields.
+		bpf.LoadIndirect{Off: 8 + 4, Size: 4},
+	}
+	for _, xid := range xids {
+		prog = append(prog, bpf.JumpIf{Cond: bpf.JumpEqual, Val: binary.BigEndian.Uint32(xid[:]), SkipTrue: accept})
+	}
+	prog = append(prog,
+		bpf.RetConstant{Val: 0},
+		bpf.RetConstant{Val: 0xffff},
+	)
+
+	// Resolve the jump targets now that the length is known.
+	for i, inst := range prog {
+		if j, ok := inst.(bpf.JumpIf); ok {
+			j.SkipTrue = uint8(len(prog) - int(j.SkipTrue) - i - 1)
+			prog[i] = j
+		}
+	}
+	return prog
+}
+
+// xid returns the transaction ID of the DHCPv4 message b.
+func xid(b []byte) (dhcpv4.TransactionID, bool) {
+	var id dhcpv4.TransactionID
+	if len(b) < 8 {
+		return id, false
+	}
+	copy(id[:], b[4:8])
+	return id, true
+}
+
+// xidConn is a DHCPv4 connection on a raw socket that only receives replies
+// to the messages sent on it, by their transaction ID, so that it doesn't
+// pick up the packets of other DHCP clients on the same host.
+//
+// The transaction IDs are filtered by BPF in the kernel, and checked again
+// for packets that were queued before the filter changed.
+type xidConn struct {
+	net.PacketConn
+
+	raw  bpfConn
+	port int
+
+	mu   sync.Mutex
+	xids []dhcpv4.TransactionID
+}
+
+// newXIDConn returns an xidConn sending and receiving IP packets from and
+// to UDP port port on conn.
+func newXIDConn(conn bpfConn, port int) *xidConn {
+	return &xidConn{
+		PacketConn: nclient4.NewBroadcastUDPConn(conn, &net.UDPAddr{Port: port}),
+		raw:        conn,
+		port:       port,
+	}
+}
+
+func (c *xidConn) accepts(id dhcpv4.TransactionID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, x := range c.xids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTo implements net.PacketConn.WriteTo, and makes the connection accept
+// replies to b.
+func (c *xidConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if id, ok := xid(b); ok && !c.accepts(id) {
+		c.mu.Lock()
+		c.xids = append(c.xids, id)
+		if len(c.xids) > maxXIDs {
+			c.xids = c.xids[len(c.xids)-maxXIDs:]
+		}
+		filter, err := bpf.Assemble(dhcp4Filter(c.port, c.xids))
+		if err == nil {
+			err = c.raw.SetBPF(filter)
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// ReadFrom implements net.PacketConn.ReadFrom, skipping messages that are
+// not replies to the ones sent.
+func (c *xidConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil {
+			return n, addr, err
+		}
+		if id, ok := xid(b[:n]); ok && c.accepts(id) {
+			return n, addr, nil
+		}
+	}
+}
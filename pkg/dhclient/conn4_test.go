@@ -0,0 +1,232 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/bpf"
+)
+
+// udp4Packet returns an IPv4 packet with a UDP datagram from the DHCP server
+// port to port, carrying payload.
+func udp4Packet(proto byte, port int, payload []byte) []byte {
+	b := make([]byte, 20+8+len(payload))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	b[8] = 64
+	b[9] = proto
+	copy(b[12:16], testServerIP)
+	copy(b[16:20], net.IPv4bcast.To4())
+	binary.BigEndian.PutUint16(b[20:22], dhcpv4.ServerPort)
+	binary.BigEndian.PutUint16(b[22:24], uint16(port))
+	binary.BigEndian.PutUint16(b[24:26], uint16(8+len(payload)))
+	copy(b[28:], payload)
+	return b
+}
+
+func testMessage(t *testing.T, id dhcpv4.TransactionID) []byte {
+	m, err := dhcpv4.NewDiscovery(testHWAddr, dhcpv4.WithTransactionID(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m.ToBytes()
+}
+
+func runFilter(t *testing.T, prog []bpf.Instruction, pkt []byte) bool {
+	vm, err := bpf.NewVM(prog)
+	if err != nil {
+		t.Fatalf("bpf.NewVM() = %v", err)
+	}
+	n, err := vm.Run(pkt)
+	if err != nil {
+		t.Fatalf("running filter: %v", err)
+	}
+	return n > 0
+}
+
+func TestDHCP4Filter(t *testing.T) {
+	ours := dhcpv4.TransactionID{1, 2, 3, 4}
+	other := dhcpv4.TransactionID{5, 6, 7, 8}
+
+	fragment := udp4Packet(17, 1068, testMessage(t, ours))
+	binary.BigEndian.PutUint16(fragment[6:8], 0x00b9)
+
+	for _, tt := range []struct {
+		name string
+		xids []dhcpv4.TransactionID
+		pkt  []byte
+		want bool
+	}{
+		{
+			name: "our transaction",
+			xids: []dhcpv4.TransactionID{other, ours},
+			pkt:  udp4Packet(17, 1068, testMessage(t, ours)),
+			want: true,
+		},
+		{
+			name: "other transaction",
+			xids: []dhcpv4.TransactionID{ours},
+			pkt:  udp4Packet(17, 1068, testMessage(t, other)),
+		},
+		{
+			name: "no transaction",
+			pkt:  udp4Packet(17, 1068, testMessage(t, ours)),
+		},
+		{
+			name: "other port",
+			xids: []dhcpv4.TransactionID{ours},
+			pkt:  udp4Packet(17, 68, testMessage(t, ours)),
+		},
+		{
+			name: "not UDP",
+			xids: []dhcpv4.TransactionID{ours},
+			pkt:  udp4Packet(6, 1068, testMessage(t, ours)),
+		},
+		{
+			name: "fragment",
+			xids: []dhcpv4.TransactionID{ours},
+			pkt:  fragment,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			prog := dhcp4Filter(1068, tt.xids)
+			if _, err := bpf.Assemble(prog); err != nil {
+				t.Fatalf("bpf.Assemble() = %v", err)
+			}
+			if got := runFilter(t, prog, tt.pkt); got != tt.want {
+				t.Errorf("filter accepts packet = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeRawConn is a bpfConn sending and receiving IP packets.
+type fakeRawConn struct {
+	mu      sync.Mutex
+	written [][]byte
+	filter  []bpf.RawInstruction
+
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFakeRawConn() *fakeRawConn {
+	return &fakeRawConn{
+		in:     make(chan []byte, 10),
+		closed: make(chan struct{}),
+	}
+}
+
+func (f *fakeRawConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.written = append(f.written, append([]byte(nil), b...))
+	return len(b), nil
+}
+
+func (f *fakeRawConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case p := <-f.in:
+		return copy(b, p), nil, nil
+	case <-f.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (f *fakeRawConn) SetBPF(filter []bpf.RawInstruction) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filter = filter
+	return nil
+}
+
+func (f *fakeRawConn) Close() error {
+	f.once.Do(func() { close(f.closed) })
+	return nil
+}
+
+func (f *fakeRawConn) LocalAddr() net.Addr              { return nil }
+func (f *fakeRawConn) SetDeadline(time.Time) error      { return nil }
+func (f *fakeRawConn) SetReadDeadline(time.Time) error  { return nil }
+func (f *fakeRawConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestXIDConn(t *testing.T) {
+	ours := dhcpv4.TransactionID{1, 2, 3, 4}
+	other := dhcpv4.TransactionID{5, 6, 7, 8}
+	raw := newFakeRawConn()
+	conn := newXIDConn(raw, 1068)
+	defer conn.Close()
+
+	if _, err := conn.WriteTo(testMessage(t, ours), testServerAddr); err != nil {
+		t.Fatalf("WriteTo() = %v", err)
+	}
+
+	raw.mu.Lock()
+	written, filter := raw.written, raw.filter
+	raw.mu.Unlock()
+	if len(written) != 1 {
+		t.Fatalf("wrote %d packets, want 1", len(written))
+	}
+	if port := binary.BigEndian.Uint16(written[0][20:22]); port != 1068 {
+		t.Errorf("sent from UDP port %d, want 1068", port)
+	}
+	prog, ok := bpf.Disassemble(filter)
+	if !ok {
+		t.Fatalf("filter %v does not disassemble", filter)
+	}
+	if !runFilter(t, prog, udp4Packet(17, 1068, testMessage(t, ours))) {
+		t.Errorf("filter drops replies to our message")
+	}
+	if runFilter(t, prog, udp4Packet(17, 1068, testMessage(t, other))) {
+		t.Errorf("filter accepts another client's messages")
+	}
+
+	// A packet queued before the filter was set is skipped.
+	raw.in <- udp4Packet(17, 1068, testMessage(t, other))
+	raw.in <- udp4Packet(17, 1068, testMessage(t, ours))
+	b := make([]byte, 1500)
+	n, _, err := conn.ReadFrom(b)
+	if err != nil {
+		t.Fatalf("ReadFrom() = %v", err)
+	}
+	if id, _ := xid(b[:n]); id != ours {
+		t.Errorf("ReadFrom() returned transaction %v, want %v", id, ours)
+	}
+}
+
+func TestClientPort(t *testing.T) {
+	defer func(old func(netlink.Link, int) (net.PacketConn, error)) { newRawConn4 = old }(newRawConn4)
+	errFake := errors.New("no socket")
+	var port int
+	newRawConn4 = func(iface netlink.Link, p int) (net.PacketConn, error) {
+		port = p
+		return nil, errFake
+	}
+
+	for _, tt := range []struct {
+		clientPort int
+		want       int
+	}{
+		{0, 68},
+		{1068, 1068},
+	} {
+		if _, err := lease4(context.Background(), testLink(), Config{ClientPort: tt.clientPort}); !errors.Is(err, errFake) {
+			t.Fatalf("lease4() = %v, want %v", err, errFake)
+		}
+		if port != tt.want {
+			t.Errorf("ClientPort %d: bound port %d, want %d", tt.clientPort, port, tt.want)
+		}
+	}
+}
@@ -90,6 +90,16 @@ func WriteDNSSettings(ns []net.IP, sl []string, domain string) error {
 	return os.WriteFile("/etc/resolv.conf", rc.Bytes(), 0o644)
 }
 
+// WriteNTPSettings writes the given NTP servers to path in ntp.conf format,
+// e.g. for syncing the time before making HTTPS requests.
+func WriteNTPSettings(path string, servers []net.IP) error {
+	conf := &bytes.Buffer{}
+	for _, ip := range servers {
+		conf.WriteString(fmt.Sprintf("server %s iburst\n", ip))
+	}
+	return os.WriteFile(path, conf.Bytes(), 0o644)
+}
+
 // Lease is a network configuration obtained by DHCP.
 type Lease interface {
 	fmt.Stringer
@@ -143,6 +153,15 @@ type Config struct {
 	// Modifiers6 allows modifications to the IPv6 DHCP request.
 	Modifiers6 []dhcpv6.Modifier
 
+	// NewTransactionID, if set, returns the transaction ID of each IPv4
+	// DHCP exchange instead of a random one, e.g. to pin it in tests.
+	NewTransactionID func() dhcpv4.TransactionID
+
+	// ModifyPacket, if set, is called on every outgoing IPv4 DHCP packet
+	// after all other options were set, including those of Modifiers4
+	// and ClientID, so it has the last word.
+	ModifyPacket func(*dhcpv4.DHCPv4)
+
 	// V6ServerAddr can be a unicast or broadcast destination for DHCPv6
 	// messages.
 	//
@@ -157,8 +176,84 @@ type Config struct {
 	// address).
 	V4ServerAddr *net.UDPAddr
 
+	// ClientPort is the UDP port IPv4 DHCP messages are sent from and
+	// received on, e.g. to not get in the way of another DHCP client on
+	// the host. If zero, the standard port 68 is used.
+	ClientPort int
+
 	// If true, add Client Identifier (61) option to the IPv4 request.
 	V4ClientIdentifier bool
+
+	// ClientID, if set, is sent verbatim as the Client Identifier (61)
+	// option of IPv4 requests instead of the one V4ClientIdentifier
+	// derives from the hardware address. By RFC 2132 Section 9.14, its
+	// first byte is a type, e.g. 1 for an Ethernet address or 0 for
+	// anything else.
+	//
+	// If it is an RFC 4361 node-specific identifier, i.e. type 255
+	// followed by a 4-byte IAID and a DUID, and DUID is unset, that DUID
+	// is also used for DHCPv6.
+	ClientID []byte
+
+	// DuplicateAddressDetection, if true, ARP-probes the IPv4 address
+	// acknowledged by the server before accepting the lease (RFC 5227).
+	// If another host answers, the address is declined and a new lease
+	// is requested, up to Retries times.
+	DuplicateAddressDetection bool
+
+	// ARPProbeCount is the number of ARP probes sent for duplicate
+	// address detection. If zero, DefaultARPProbeCount is used.
+	ARPProbeCount int
+
+	// ARPProbeInterval is how long to wait for replies after each ARP
+	// probe. If zero, DefaultARPProbeInterval is used.
+	ARPProbeInterval time.Duration
+
+	// DeclineBackoff is how long to wait after declining an address in
+	// use before requesting a new lease. If zero, DefaultDeclineBackoff
+	// is used.
+	DeclineBackoff time.Duration
+
+	// Events, if set, receives an Event for every step of each DHCP
+	// exchange. Sends block until the event is received or the request
+	// context is done.
+	Events chan<- Event
+
+	// HookScript, if set, is run by the Configure method of the returned
+	// leases after the interface has been configured. Lease details are
+	// passed in environment variables named like those of ISC dhclient,
+	// e.g. new_ip_address, new_routers and new_domain_name_servers.
+	// A failing hook is logged, and does not fail Configure.
+	HookScript string
+
+	// DUID is the DHCP Unique Identifier presented in DHCPv6 requests,
+	// e.g. a stable DUID-EN. If unset, a DUID-LLT is derived from the
+	// interface's hardware address.
+	DUID dhcpv6.Duid
+
+	// RapidCommit, if true, asks DHCPv6 servers for a two-message
+	// SOLICIT-REPLY exchange with the Rapid Commit option (RFC 8415
+	// Section 18.2.1). If the server answers with an ADVERTISE instead,
+	// the client falls back to the SOLICIT-ADVERTISE-REQUEST-REPLY
+	// exchange.
+	RapidCommit bool
+
+	// VLAN, if non-zero, is an 802.1Q VLAN ID in [1, 4094]. SendRequests
+	// then runs DHCP on the VLAN's subinterface of each interface, e.g.
+	// eth0.100, creating it with CreateVLAN if needed. Subinterfaces
+	// created for this are deleted again if they got no lease.
+	VLAN int
+
+	// SLAAC, if true, makes SendRequests solicit an IPv6 Router
+	// Advertisement before DHCPv6, and return a SLAACLease with the
+	// addresses autoconfigured from it (RFC 4862). DHCPv6 is then only
+	// run if the router's M or O flag asks for it.
+	SLAAC bool
+
+	// SLAACSecret, if set, is the secret key from which SLAAC derives
+	// stable privacy addresses (RFC 7217), instead of deriving addresses
+	// from the interface's hardware address.
+	SLAACSecret []byte
 }
 
 func lease4(ctx context.Context, iface netlink.Link, c Config) (Lease, error) {
@@ -175,40 +270,151 @@ func lease4(ctx context.Context, iface netlink.Link, c Config) (Lease, error) {
 	if c.V4ServerAddr != nil {
 		mods = append(mods, nclient4.WithServerAddr(c.V4ServerAddr))
 	}
-	client, err := nclient4.New(iface.Attrs().Name, mods...)
+	conn, err := newRawConn4(iface, c.clientPort())
 	if err != nil {
 		return nil, err
 	}
+	client, err := nclient4.NewWithConn(conn, iface.Attrs().HardwareAddr, mods...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
 	defer client.Close()
 
-	// Prepend modifiers with default options, so they can be overriden.
-	reqmods := append(
-		[]dhcpv4.Modifier{
-			dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXE UROOT")),
-			dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask),
-			dhcpv4.WithNetboot,
-		},
-		c.Modifiers4...)
+	return requestLease4(ctx, client, conn, iface, c)
+}
 
-	if c.V4ClientIdentifier {
-		// Client Id is hardware type + mac per RFC 2132 9.14.
-		ident := []byte{0x01} // Type ethernet
-		ident = append(ident, iface.Attrs().HardwareAddr...)
-		reqmods = append(reqmods, dhcpv4.WithOption(dhcpv4.OptClientIdentifier(ident)))
+// requestLease4 obtains a DHCPv4 lease using client, which sends and receives
+// its messages on conn.
+func requestLease4(ctx context.Context, client *nclient4.Client, conn net.PacketConn, iface netlink.Link, c Config) (Lease, error) {
+	reqmods := modifiers4(c, iface)
+	for attempt := 0; ; attempt++ {
+		log.Printf("Attempting to get DHCPv4 lease on %s", iface.Attrs().Name)
+		lease, err := handshake4(ctx, client, iface, c, reqmods)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.DuplicateAddressDetection {
+			owner, err := checkAddress4(ctx, iface, lease.ACK.YourIPAddr, c)
+			if err != nil {
+				return nil, err
+			}
+			if owner != nil {
+				log.Printf("DHCPv4 address %s on %s is already in use by %s, declining", lease.ACK.YourIPAddr, iface.Attrs().Name, owner)
+				if err := decline4(conn, client.RemoteAddr(), iface, lease.ACK, c.exchangeMods4(nil)...); err != nil {
+					return nil, err
+				}
+				if attempt >= c.Retries {
+					return nil, fmt.Errorf("DHCPv4 address %s is already in use by %s", lease.ACK.YourIPAddr, owner)
+				}
+				backoff := c.DeclineBackoff
+				if backoff == 0 {
+					backoff = DefaultDeclineBackoff
+				}
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				continue
+			}
+		}
+
+		packet := NewPacket4(iface, lease.ACK)
+		packet.hookScript = c.HookScript
+		packet.clientPort = c.clientPort()
+		log.Printf("Got DHCPv4 lease on %s: %v", iface.Attrs().Name, lease.ACK.Summary())
+		return packet, nil
 	}
+}
+
+// exchangeMods4 returns reqmods for the packets of one IPv4 exchange,
+// followed by c's transaction ID and ModifyPacket.
+func (c Config) exchangeMods4(reqmods []dhcpv4.Modifier) []dhcpv4.Modifier {
+	mods := append([]dhcpv4.Modifier(nil), reqmods...)
+	if c.NewTransactionID != nil {
+		mods = append(mods, dhcpv4.WithTransactionID(c.NewTransactionID()))
+	}
+	if c.ModifyPacket != nil {
+		mods = append(mods, c.ModifyPacket)
+	}
+	return mods
+}
 
-	log.Printf("Attempting to get DHCPv4 lease on %s", iface.Attrs().Name)
-	lease, err := client.Request(ctx, reqmods...)
+// handshake4 runs the Discover-Offer-Request-Ack exchange, reporting each
+// step to c.Events.
+func handshake4(ctx context.Context, client *nclient4.Client, iface netlink.Link, c Config, reqmods []dhcpv4.Modifier) (*nclient4.Lease, error) {
+	ifname := iface.Attrs().Name
+	reqmods = c.exchangeMods4(reqmods)
+	c.emit(ctx, EventDiscover, NetIPv4, ifname)
+	offer, err := client.DiscoverOffer(ctx, reqmods...)
 	if err != nil {
+		if errors.Is(err, nclient4.ErrNoResponse) {
+			c.emit(ctx, EventTimeout, NetIPv4, ifname)
+		}
+		return nil, fmt.Errorf("unable to receive an offer: %w", err)
+	}
+	c.emit(ctx, EventOffer, NetIPv4, ifname)
+
+	c.emit(ctx, EventRequest, NetIPv4, ifname)
+	lease, err := client.RequestFromOffer(ctx, offer, reqmods...)
+	var nak *nclient4.ErrNak
+	switch {
+	case errors.As(err, &nak):
+		c.emit(ctx, EventNak, NetIPv4, ifname)
+		return nil, err
+	case errors.Is(err, nclient4.ErrNoResponse):
+		c.emit(ctx, EventTimeout, NetIPv4, ifname)
+		return nil, err
+	case err != nil:
 		return nil, err
 	}
+	c.emit(ctx, EventAck, NetIPv4, ifname)
+	return lease, nil
+}
 
-	packet := NewPacket4(iface, lease.ACK)
-	log.Printf("Got DHCPv4 lease on %s: %v", iface.Attrs().Name, lease.ACK.Summary())
-	return packet, nil
+// checkAddress4 ARP-probes ip on iface and returns the hardware address of
+// the host already using it, if any.
+func checkAddress4(ctx context.Context, iface netlink.Link, ip net.IP, c Config) (net.HardwareAddr, error) {
+	count := c.ARPProbeCount
+	if count == 0 {
+		count = DefaultARPProbeCount
+	}
+	interval := c.ARPProbeInterval
+	if interval == 0 {
+		interval = DefaultARPProbeInterval
+	}
+
+	conn, err := newARPConn(iface)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open ARP socket on %s: %v", iface.Attrs().Name, err)
+	}
+	defer conn.Close()
+	return probeARP(ctx, conn, iface.Attrs().HardwareAddr, ip, count, interval)
 }
 
-func lease6(ctx context.Context, iface netlink.Link, c Config, linkUpTimeout time.Duration) (Lease, error) {
+// decline4 tells the server that the address in ack is already in use, as
+// described in RFC 2131 Section 4.4.4. mods are applied to the DECLINE
+// last.
+func decline4(conn net.PacketConn, server *net.UDPAddr, iface netlink.Link, ack *dhcpv4.DHCPv4, mods ...dhcpv4.Modifier) error {
+	decline, err := dhcpv4.New(append([]dhcpv4.Modifier{
+		dhcpv4.WithMessageType(dhcpv4.MessageTypeDecline),
+		dhcpv4.WithHwAddr(iface.Attrs().HardwareAddr),
+		dhcpv4.WithOption(dhcpv4.OptRequestedIPAddress(ack.YourIPAddr)),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(ack.ServerIdentifier())),
+	}, mods...)...)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(decline.ToBytes(), server); err != nil {
+		return fmt.Errorf("sending DHCPv4 decline on %s: %v", iface.Attrs().Name, err)
+	}
+	return nil
+}
+
+// waitIPv6Link waits for iface to have a non-tentative link-local address.
+func waitIPv6Link(ctx context.Context, iface netlink.Link, linkUpTimeout time.Duration) error {
 	// For ipv6, we cannot bind to the port until Duplicate Address
 	// Detection (DAD) is complete which is indicated by the link being no
 	// longer marked as "tentative". This usually takes about a second.
@@ -220,19 +426,25 @@ func lease6(ctx context.Context, iface netlink.Link, c Config, linkUpTimeout tim
 	linkTimeout := time.After(linkUpTimeout)
 	for {
 		if ready, err := isIpv6LinkReady(iface); err != nil {
-			return nil, err
+			return err
 		} else if ready {
-			break
+			return nil
 		}
 		select {
 		case <-time.After(100 * time.Millisecond):
 			continue
 		case <-linkTimeout:
-			return nil, errors.New("timeout after waiting for a non-tentative IPv6 address")
+			return errors.New("timeout after waiting for a non-tentative IPv6 address")
 		case <-ctx.Done():
-			return nil, errors.New("timeout after waiting for a non-tentative IPv6 address")
+			return errors.New("timeout after waiting for a non-tentative IPv6 address")
 		}
 	}
+}
+
+func lease6(ctx context.Context, iface netlink.Link, c Config, linkUpTimeout time.Duration) (Lease, error) {
+	if err := waitIPv6Link(ctx, iface, linkUpTimeout); err != nil {
+		return nil, err
+	}
 
 	mods := []nclient6.ClientOpt{
 		nclient6.WithTimeout(c.Timeout),
@@ -253,24 +465,128 @@ func lease6(ctx context.Context, iface netlink.Link, c Config, linkUpTimeout tim
 	}
 	defer client.Close()
 
-	// Prepend modifiers with default options, so they can be overriden.
-	reqmods := append(
-		[]dhcpv6.Modifier{
-			dhcpv6.WithNetboot,
-		},
-		c.Modifiers6...)
+	return requestLease6(ctx, client, iface, c)
+}
 
+// requestLease6 obtains a DHCPv6 lease using client.
+func requestLease6(ctx context.Context, client *nclient6.Client, iface netlink.Link, c Config) (Lease, error) {
 	log.Printf("Attempting to get DHCPv6 lease on %s", iface.Attrs().Name)
-	p, err := client.RapidSolicit(ctx, reqmods...)
+	p, err := handshake6(ctx, client, iface, c, modifiers6(c))
 	if err != nil {
 		return nil, err
 	}
 
 	packet := NewPacket6(iface, p)
+	packet.hookScript = c.HookScript
 	log.Printf("Got DHCPv6 lease on %s: %v", iface.Attrs().Name, p.Summary())
 	return packet, nil
 }
 
+// handshake6 runs the Solicit-Advertise-Request-Reply exchange, or the
+// Solicit-Reply one if c.RapidCommit is set and the server supports it,
+// reporting each step to c.Events.
+func handshake6(ctx context.Context, client *nclient6.Client, iface netlink.Link, c Config, reqmods []dhcpv6.Modifier) (*dhcpv6.Message, error) {
+	ifname := iface.Attrs().Name
+	c.emit(ctx, EventDiscover, NetIPv6, ifname)
+	msg, err := solicit6(ctx, client, c, reqmods)
+	if err != nil {
+		if errors.Is(err, nclient6.ErrNoResponse) {
+			c.emit(ctx, EventTimeout, NetIPv6, ifname)
+		}
+		return nil, err
+	}
+	if msg.MessageType == dhcpv6.MessageTypeReply {
+		c.emit(ctx, EventAck, NetIPv6, ifname)
+		return msg, nil
+	}
+	c.emit(ctx, EventOffer, NetIPv6, ifname)
+
+	c.emit(ctx, EventRequest, NetIPv6, ifname)
+	reply, err := client.Request(ctx, msg, reqmods...)
+	if err != nil {
+		if errors.Is(err, nclient6.ErrNoResponse) {
+			c.emit(ctx, EventTimeout, NetIPv6, ifname)
+		}
+		return nil, err
+	}
+	c.emit(ctx, EventAck, NetIPv6, ifname)
+	return reply, nil
+}
+
+// solicit6 sends a SOLICIT and returns the first ADVERTISE received, or, if
+// c.RapidCommit is set, a REPLY committing to the lease.
+func solicit6(ctx context.Context, client *nclient6.Client, c Config, reqmods []dhcpv6.Modifier) (*dhcpv6.Message, error) {
+	if !c.RapidCommit {
+		return client.Solicit(ctx, reqmods...)
+	}
+	solicit, err := dhcpv6.NewSolicit(client.InterfaceAddr(), append(append([]dhcpv6.Modifier(nil), reqmods...), dhcpv6.WithRapidCommit)...)
+	if err != nil {
+		return nil, err
+	}
+	// By RFC 8415 Section 18.2.10, a REPLY without Rapid Commit is not
+	// an answer to a rapid SOLICIT, so wait for an ADVERTISE instead.
+	return client.SendAndRead(ctx, client.RemoteAddr(), solicit, func(m *dhcpv6.Message) bool {
+		switch m.MessageType {
+		case dhcpv6.MessageTypeAdvertise:
+			return true
+		case dhcpv6.MessageTypeReply:
+			return m.GetOneOption(dhcpv6.OptionRapidCommit) != nil
+		}
+		return false
+	})
+}
+
+// modifiers6 returns the modifiers applied to DHCPv6 requests.
+func modifiers6(c Config) []dhcpv6.Modifier {
+	// Prepend modifiers with default options, so they can be overriden.
+	reqmods := []dhcpv6.Modifier{
+		dhcpv6.WithNetboot,
+	}
+	if c.DUID.Type != 0 {
+		reqmods = append(reqmods, dhcpv6.WithClientID(c.DUID))
+	} else if duid := clientIDDUID(c.ClientID); duid != nil {
+		reqmods = append(reqmods, dhcpv6.WithClientID(*duid))
+	}
+	return append(reqmods, c.Modifiers6...)
+}
+
+// clientIDDUID returns the DUID of an RFC 4361 node-specific DHCPv4 client
+// identifier, or nil if id is not one.
+func clientIDDUID(id []byte) *dhcpv6.Duid {
+	// Type 255, 4-byte IAID, DUID.
+	if len(id) <= 5 || id[0] != 0xff {
+		return nil
+	}
+	duid, err := dhcpv6.DuidFromBytes(id[5:])
+	if err != nil {
+		return nil
+	}
+	return duid
+}
+
+// modifiers4 returns the modifiers of IPv4 requests on iface.
+func modifiers4(c Config, iface netlink.Link) []dhcpv4.Modifier {
+	// Prepend modifiers with default options, so they can be overriden.
+	reqmods := append(
+		[]dhcpv4.Modifier{
+			dhcpv4.WithOption(dhcpv4.OptClassIdentifier("PXE UROOT")),
+			dhcpv4.WithRequestedOptions(dhcpv4.OptionSubnetMask, dhcpv4.OptionInterfaceMTU, dhcpv4.OptionNTPServers),
+			dhcpv4.WithNetboot,
+		},
+		c.Modifiers4...)
+
+	switch {
+	case len(c.ClientID) > 0:
+		reqmods = append(reqmods, dhcpv4.WithOption(dhcpv4.OptClientIdentifier(c.ClientID)))
+	case c.V4ClientIdentifier:
+		// Client Id is hardware type + mac per RFC 2132 9.14.
+		ident := []byte{0x01} // Type ethernet
+		ident = append(ident, iface.Attrs().HardwareAddr...)
+		reqmods = append(reqmods, dhcpv4.WithOption(dhcpv4.OptClientIdentifier(ident)))
+	}
+	return reqmods
+}
+
 // NetworkProtocol is either IPv4 or IPv6.
 type NetworkProtocol int
 
@@ -332,23 +648,64 @@ func SendRequests(ctx context.Context, ifs []netlink.Link, ipv4, ipv6 bool, c Co
 				return
 			}
 
+			var createdVLAN bool
+			if c.VLAN != 0 {
+				vlan, created, err := createVLAN(iface, c.VLAN)
+				if err != nil {
+					log.Printf("Could not set up VLAN %d on %s: %v", c.VLAN, iface.Attrs().Name, err)
+					return
+				}
+				iface, createdVLAN = vlan, created
+			}
+
+			var ifwg sync.WaitGroup
+			var mu sync.Mutex
+			var leased bool
+			send := func(res *Result) {
+				if res.Err == nil {
+					mu.Lock()
+					leased = true
+					mu.Unlock()
+				}
+				r <- res
+			}
+
 			if ipv4 {
-				wg.Add(1)
+				ifwg.Add(1)
 				go func(iface netlink.Link) {
-					defer wg.Done()
+					defer ifwg.Done()
 					lease, err := lease4(ctx, iface, c)
-					r <- &Result{NetIPv4, iface, lease, err}
+					send(&Result{NetIPv4, iface, lease, err})
 				}(iface)
 			}
 
 			if ipv6 {
-				wg.Add(1)
+				ifwg.Add(1)
 				go func(iface netlink.Link) {
-					defer wg.Done()
+					defer ifwg.Done()
+					if c.SLAAC {
+						lease, err := leaseSLAAC(ctx, iface, c, linkUpTimeout)
+						if err != nil {
+							send(&Result{NetIPv6, iface, nil, err})
+							return
+						}
+						send(&Result{NetIPv6, iface, lease, nil})
+						if !lease.WantsDHCPv6() {
+							return
+						}
+					}
 					lease, err := lease6(ctx, iface, c, linkUpTimeout)
-					r <- &Result{NetIPv6, iface, lease, err}
+					send(&Result{NetIPv6, iface, lease, err})
 				}(iface)
 			}
+			ifwg.Wait()
+
+			if createdVLAN && !leased {
+				log.Printf("Deleting VLAN interface %s, which got no lease", iface.Attrs().Name)
+				if err := linkDel(iface); err != nil {
+					log.Printf("Could not delete VLAN interface %s: %v", iface.Attrs().Name, err)
+				}
+			}
 		}(iface)
 	}
 
@@ -0,0 +1,687 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/insomniacslk/dhcp/dhcpv6/nclient6"
+	"github.com/vishvananda/netlink"
+)
+
+var (
+	testHWAddr     = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	testServerIP   = net.IP{10, 0, 0, 1}
+	testServerAddr = &net.UDPAddr{IP: testServerIP, Port: nclient4.ServerPort}
+)
+
+func testLink() netlink.Link {
+	return &netlink.Dummy{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:         "eth0",
+			Index:        1,
+			HardwareAddr: testHWAddr,
+		},
+	}
+}
+
+// fakeServer4 is a net.PacketConn that answers DHCPv4 requests like a
+// server would.
+type fakeServer4 struct {
+	// offers are the addresses offered, one per DISCOVER.
+	offers []net.IP
+
+	mu       sync.Mutex
+	next     int
+	received []*dhcpv4.DHCPv4
+
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFakeServer4(offers ...net.IP) *fakeServer4 {
+	return &fakeServer4{
+		offers: offers,
+		in:     make(chan []byte, 10),
+		closed: make(chan struct{}),
+	}
+}
+
+// messages returns all messages the server received.
+func (s *fakeServer4) messages() []*dhcpv4.DHCPv4 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*dhcpv4.DHCPv4(nil), s.received...)
+}
+
+func (s *fakeServer4) reply(req *dhcpv4.DHCPv4, mt dhcpv4.MessageType, ip net.IP) {
+	resp, err := dhcpv4.NewReplyFromRequest(req,
+		dhcpv4.WithMessageType(mt),
+		dhcpv4.WithYourIP(ip),
+		dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		dhcpv4.WithServerIP(testServerIP),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(testServerIP)),
+	)
+	if err != nil {
+		panic(err)
+	}
+	s.in <- resp.ToBytes()
+}
+
+func (s *fakeServer4) WriteTo(b []byte, addr net.Addr) (int, error) {
+	m, err := dhcpv4.FromBytes(b)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, m)
+
+	switch m.MessageType() {
+	case dhcpv4.MessageTypeDiscover:
+		if s.next < len(s.offers) {
+			s.reply(m, dhcpv4.MessageTypeOffer, s.offers[s.next])
+			s.next++
+		}
+	case dhcpv4.MessageTypeRequest:
+		s.reply(m, dhcpv4.MessageTypeAck, m.RequestedIPAddress())
+	}
+	return len(b), nil
+}
+
+func (s *fakeServer4) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case p := <-s.in:
+		return copy(b, p), testServerAddr, nil
+	case <-s.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (s *fakeServer4) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func (s *fakeServer4) LocalAddr() net.Addr {
+	return &net.UDPAddr{Port: nclient4.ClientPort}
+}
+
+func (s *fakeServer4) SetDeadline(time.Time) error      { return nil }
+func (s *fakeServer4) SetReadDeadline(time.Time) error  { return nil }
+func (s *fakeServer4) SetWriteDeadline(time.Time) error { return nil }
+
+func newTestClient4(t *testing.T, s *fakeServer4) *nclient4.Client {
+	client, err := nclient4.NewWithConn(s, testHWAddr,
+		nclient4.WithTimeout(time.Second),
+		nclient4.WithRetry(1),
+		nclient4.WithServerAddr(testServerAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// fakeServer6 is a net.PacketConn that answers DHCPv6 requests like a
+// server would.
+type fakeServer6 struct {
+	// addr is the address leased.
+	addr net.IP
+
+	// rapid is whether the server honors Rapid Commit.
+	rapid bool
+
+	// replyWithoutRapidCommit makes the server first answer each
+	// SOLICIT with a REPLY that lacks the Rapid Commit option.
+	replyWithoutRapidCommit bool
+
+	mu       sync.Mutex
+	received []*dhcpv6.Message
+
+	in     chan []byte
+	closed chan struct{}
+	once   sync.Once
+}
+
+var (
+	testServerDUID = dhcpv6.Duid{
+		Type:          dhcpv6.DUID_LL,
+		HwType:        1,
+		LinkLayerAddr: net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0xfe},
+	}
+	testServerAddr6 = &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: dhcpv6.DefaultServerPort}
+)
+
+func newFakeServer6(addr net.IP, rapid bool) *fakeServer6 {
+	return &fakeServer6{
+		addr:   addr,
+		rapid:  rapid,
+		in:     make(chan []byte, 10),
+		closed: make(chan struct{}),
+	}
+}
+
+// messageTypes returns the types of all messages the server received.
+func (s *fakeServer6) messageTypes() []dhcpv6.MessageType {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var types []dhcpv6.MessageType
+	for _, m := range s.received {
+		types = append(types, m.MessageType)
+	}
+	return types
+}
+
+func (s *fakeServer6) send(m *dhcpv6.Message, err error) {
+	if err != nil {
+		panic(err)
+	}
+	s.in <- m.ToBytes()
+}
+
+func (s *fakeServer6) WriteTo(b []byte, addr net.Addr) (int, error) {
+	m, err := dhcpv6.MessageFromBytes(b)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, m)
+
+	lease := []dhcpv6.Modifier{
+		dhcpv6.WithServerID(testServerDUID),
+		dhcpv6.WithIANA(dhcpv6.OptIAAddress{
+			IPv6Addr:          s.addr,
+			PreferredLifetime: time.Hour,
+			ValidLifetime:     2 * time.Hour,
+		}),
+	}
+	switch m.MessageType {
+	case dhcpv6.MessageTypeSolicit:
+		if s.replyWithoutRapidCommit {
+			reply := &dhcpv6.Message{
+				MessageType:   dhcpv6.MessageTypeReply,
+				TransactionID: m.TransactionID,
+			}
+			reply.AddOption(m.GetOneOption(dhcpv6.OptionClientID))
+			for _, mod := range lease {
+				mod(reply)
+			}
+			s.send(reply, nil)
+		}
+		if s.rapid && m.GetOneOption(dhcpv6.OptionRapidCommit) != nil {
+			s.send(dhcpv6.NewReplyFromMessage(m, lease...))
+		} else {
+			s.send(dhcpv6.NewAdvertiseFromSolicit(m, lease...))
+		}
+	case dhcpv6.MessageTypeRequest:
+		s.send(dhcpv6.NewReplyFromMessage(m, lease...))
+	}
+	return len(b), nil
+}
+
+func (s *fakeServer6) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case p := <-s.in:
+		return copy(b, p), testServerAddr6, nil
+	case <-s.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (s *fakeServer6) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func (s *fakeServer6) LocalAddr() net.Addr {
+	return &net.UDPAddr{Port: dhcpv6.DefaultClientPort}
+}
+
+func (s *fakeServer6) SetDeadline(time.Time) error      { return nil }
+func (s *fakeServer6) SetReadDeadline(time.Time) error  { return nil }
+func (s *fakeServer6) SetWriteDeadline(time.Time) error { return nil }
+
+func newTestClient6(t *testing.T, s *fakeServer6) *nclient6.Client {
+	client, err := nclient6.NewWithConn(s, testHWAddr,
+		nclient6.WithTimeout(time.Second),
+		nclient6.WithRetry(1),
+		nclient6.WithBroadcastAddr(testServerAddr6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// fakeARPResponder is a net.PacketConn answering ARP probes for the
+// addresses in claimed.
+type fakeARPResponder struct {
+	hwaddr  net.HardwareAddr
+	claimed []net.IP
+
+	mu       sync.Mutex
+	deadline time.Time
+	probes   []net.IP
+
+	in chan []byte
+}
+
+func newFakeARPResponder(claimed ...net.IP) *fakeARPResponder {
+	return &fakeARPResponder{
+		hwaddr:  net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x99},
+		claimed: claimed,
+		in:      make(chan []byte, 10),
+	}
+}
+
+func (r *fakeARPResponder) WriteTo(b []byte, addr net.Addr) (int, error) {
+	var p arpPacket
+	if err := p.UnmarshalBinary(b); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	r.probes = append(r.probes, p.TargetIP)
+	r.mu.Unlock()
+
+	for _, ip := range r.claimed {
+		if p.TargetIP.Equal(ip) {
+			reply := &arpPacket{
+				Operation: arpReply,
+				SenderHW:  r.hwaddr,
+				SenderIP:  ip,
+				TargetHW:  p.SenderHW,
+				TargetIP:  p.SenderIP,
+			}
+			rb, err := reply.MarshalBinary()
+			if err != nil {
+				return 0, err
+			}
+			r.in <- rb
+		}
+	}
+	return len(b), nil
+}
+
+func (r *fakeARPResponder) ReadFrom(b []byte) (int, net.Addr, error) {
+	r.mu.Lock()
+	d := r.deadline
+	r.mu.Unlock()
+
+	select {
+	case p := <-r.in:
+		return copy(b, p), nil, nil
+	case <-time.After(time.Until(d)):
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (r *fakeARPResponder) SetReadDeadline(t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deadline = t
+	return nil
+}
+
+func (r *fakeARPResponder) Close() error                     { return nil }
+func (r *fakeARPResponder) LocalAddr() net.Addr              { return nil }
+func (r *fakeARPResponder) SetDeadline(t time.Time) error    { return r.SetReadDeadline(t) }
+func (r *fakeARPResponder) SetWriteDeadline(time.Time) error { return nil }
+
+func withFakeARP(t *testing.T, r *fakeARPResponder) {
+	old := newARPConn
+	newARPConn = func(netlink.Link) (net.PacketConn, error) {
+		return r, nil
+	}
+	t.Cleanup(func() { newARPConn = old })
+}
+
+func TestDuplicateAddressDetection(t *testing.T) {
+	taken := net.IP{10, 0, 0, 5}
+	free := net.IP{10, 0, 0, 6}
+
+	for _, tt := range []struct {
+		name        string
+		offers      []net.IP
+		wantIP      net.IP
+		wantDecline bool
+		wantErr     bool
+	}{
+		{
+			name:   "no conflict",
+			offers: []net.IP{free},
+			wantIP: free,
+		},
+		{
+			name:        "conflict then free",
+			offers:      []net.IP{taken, free},
+			wantIP:      free,
+			wantDecline: true,
+		},
+		{
+			name:        "conflict only",
+			offers:      []net.IP{taken, taken},
+			wantDecline: true,
+			wantErr:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			arp := newFakeARPResponder(taken)
+			withFakeARP(t, arp)
+			s := newFakeServer4(tt.offers...)
+			c := Config{
+				Retries:                   1,
+				DuplicateAddressDetection: true,
+				ARPProbeCount:             2,
+				ARPProbeInterval:          10 * time.Millisecond,
+				DeclineBackoff:            50 * time.Millisecond,
+			}
+
+			start := time.Now()
+			lease, err := requestLease4(context.Background(), newTestClient4(t, s), s, testLink(), c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("requestLease4() = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantDecline && !tt.wantErr && time.Since(start) < c.DeclineBackoff {
+				t.Errorf("requested a new lease after %v, want a back-off of %v", time.Since(start), c.DeclineBackoff)
+			}
+			if err == nil {
+				if got := lease.(*Packet4).Lease().IP; !got.Equal(tt.wantIP) {
+					t.Errorf("lease IP = %s, want %s", got, tt.wantIP)
+				}
+			}
+
+			var declined []net.IP
+			for _, m := range s.messages() {
+				if m.MessageType() == dhcpv4.MessageTypeDecline {
+					declined = append(declined, m.RequestedIPAddress())
+				}
+			}
+			if gotDecline := len(declined) > 0; gotDecline != tt.wantDecline {
+				t.Errorf("declined %v, want decline %t", declined, tt.wantDecline)
+			}
+			for _, ip := range declined {
+				if !ip.Equal(taken) {
+					t.Errorf("declined %s, want %s", ip, taken)
+				}
+			}
+		})
+	}
+}
+
+func TestProbeARPNoReply(t *testing.T) {
+	arp := newFakeARPResponder()
+	owner, err := probeARP(context.Background(), arp, testHWAddr, net.IP{10, 0, 0, 7}, 3, time.Millisecond)
+	if err != nil || owner != nil {
+		t.Fatalf("probeARP() = %v, %v, want nil, nil", owner, err)
+	}
+	if len(arp.probes) != 3 {
+		t.Errorf("sent %d probes, want 3", len(arp.probes))
+	}
+}
+
+func TestEvents(t *testing.T) {
+	s := newFakeServer4(net.IP{10, 0, 0, 5})
+	events := make(chan Event, 10)
+	c := Config{Events: events}
+
+	if _, err := requestLease4(context.Background(), newTestClient4(t, s), s, testLink(), c); err != nil {
+		t.Fatalf("requestLease4() = %v", err)
+	}
+	close(events)
+
+	var got []EventKind
+	for e := range events {
+		if e.Interface != "eth0" || e.Protocol != NetIPv4 || e.Time.IsZero() {
+			t.Errorf("event %v has wrong interface, protocol or time", e)
+		}
+		got = append(got, e.Kind)
+	}
+	want := []EventKind{EventDiscover, EventOffer, EventRequest, EventAck}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
+
+func TestTransactionIDAndModifyPacket(t *testing.T) {
+	taken := net.IP{10, 0, 0, 5}
+	withFakeARP(t, newFakeARPResponder(taken))
+	s := newFakeServer4(taken, net.IP{10, 0, 0, 6})
+
+	var next uint32
+	siteOption := dhcpv4.OptGeneric(dhcpv4.GenericOptionCode(224), []byte("rack-7"))
+	c := Config{
+		Retries:                   1,
+		DuplicateAddressDetection: true,
+		ARPProbeCount:             1,
+		ARPProbeInterval:          10 * time.Millisecond,
+		DeclineBackoff:            time.Millisecond,
+		ClientID:                  []byte{0, 'u', 'r', 'o', 'o', 't'},
+		NewTransactionID: func() dhcpv4.TransactionID {
+			next++
+			return dhcpv4.TransactionID{0xca, 0xfe, 0, byte(next)}
+		},
+		ModifyPacket: func(p *dhcpv4.DHCPv4) {
+			p.UpdateOption(siteOption)
+			p.UpdateOption(dhcpv4.OptClientIdentifier([]byte{0, 't', 'e', 's', 't'}))
+		},
+	}
+	if _, err := requestLease4(context.Background(), newTestClient4(t, s), s, testLink(), c); err != nil {
+		t.Fatalf("requestLease4() = %v", err)
+	}
+
+	type sent struct {
+		Type dhcpv4.MessageType
+		XID  dhcpv4.TransactionID
+	}
+	var got []sent
+	for _, m := range s.messages() {
+		got = append(got, sent{m.MessageType(), m.TransactionID})
+		if v := m.Options.Get(siteOption.Code); string(v) != "rack-7" {
+			t.Errorf("%s has option 224 = %q, want %q", m.MessageType(), v, "rack-7")
+		}
+		if id := m.Options.Get(dhcpv4.OptionClientIdentifier); string(id) != "\x00test" {
+			t.Errorf("%s has client identifier %q, want ModifyPacket's %q", m.MessageType(), id, "\x00test")
+		}
+	}
+	want := []sent{
+		{dhcpv4.MessageTypeDiscover, dhcpv4.TransactionID{0xca, 0xfe, 0, 1}},
+		{dhcpv4.MessageTypeRequest, dhcpv4.TransactionID{0xca, 0xfe, 0, 1}},
+		{dhcpv4.MessageTypeDecline, dhcpv4.TransactionID{0xca, 0xfe, 0, 2}},
+		{dhcpv4.MessageTypeDiscover, dhcpv4.TransactionID{0xca, 0xfe, 0, 3}},
+		{dhcpv4.MessageTypeRequest, dhcpv4.TransactionID{0xca, 0xfe, 0, 3}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %v, want %v", got, want)
+	}
+}
+
+func TestModifiers6DUID(t *testing.T) {
+	duid := dhcpv6.Duid{
+		Type:                 dhcpv6.DUID_EN,
+		EnterpriseNumber:     32473,
+		EnterpriseIdentifier: []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+
+	for _, tt := range []struct {
+		name string
+		c    Config
+		want *dhcpv6.Duid
+	}{
+		{
+			name: "custom DUID",
+			c:    Config{DUID: duid},
+			want: &duid,
+		},
+		{
+			name: "default DUID",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := dhcpv6.NewSolicit(testHWAddr, modifiers6(tt.c)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := m.Options.ClientID()
+			if got == nil {
+				t.Fatal("solicit has no client ID")
+			}
+			if tt.want == nil {
+				if got.Type != dhcpv6.DUID_LLT || !bytes.Equal(got.LinkLayerAddr, testHWAddr) {
+					t.Errorf("client ID = %v, want DUID-LLT for %s", got, testHWAddr)
+				}
+				return
+			}
+			if !bytes.Equal(got.ToBytes(), tt.want.ToBytes()) {
+				t.Errorf("client ID = %x, want %x", got.ToBytes(), tt.want.ToBytes())
+			}
+		})
+	}
+}
+
+func TestModifiers4ClientID(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		c    Config
+		want []byte
+	}{
+		{
+			name: "no client ID",
+		},
+		{
+			name: "from hardware address",
+			c:    Config{V4ClientIdentifier: true},
+			want: append([]byte{0x01}, testHWAddr...),
+		},
+		{
+			name: "verbatim",
+			c:    Config{ClientID: []byte("\x00rack4-node12")},
+			want: []byte("\x00rack4-node12"),
+		},
+		{
+			name: "verbatim overrides hardware address",
+			c:    Config{ClientID: []byte{0x01, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, V4ClientIdentifier: true},
+			want: []byte{0x01, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := dhcpv4.NewDiscovery(testHWAddr, modifiers4(tt.c, testLink())...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Options.Get(dhcpv4.OptionClientIdentifier); !bytes.Equal(got, tt.want) {
+				t.Errorf("client identifier = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModifiers6ClientID(t *testing.T) {
+	duid := dhcpv6.Duid{
+		Type:                 dhcpv6.DUID_EN,
+		EnterpriseNumber:     32473,
+		EnterpriseIdentifier: []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	// RFC 4361: type 255, IAID, DUID.
+	clientID := append([]byte{0xff, 0, 0, 0, 1}, duid.ToBytes()...)
+
+	m, err := dhcpv6.NewSolicit(testHWAddr, modifiers6(Config{ClientID: clientID})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Options.ClientID(); got == nil || !bytes.Equal(got.ToBytes(), duid.ToBytes()) {
+		t.Errorf("client ID = %v, want %v", got, &duid)
+	}
+
+	// Other client identifiers don't change the DHCPv6 client ID.
+	m, err = dhcpv6.NewSolicit(testHWAddr, modifiers6(Config{ClientID: append([]byte{0x01}, testHWAddr...)})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Options.ClientID(); got == nil || got.Type != dhcpv6.DUID_LLT {
+		t.Errorf("client ID = %v, want the default DUID-LLT", got)
+	}
+}
+
+func TestRapidCommit(t *testing.T) {
+	addr := net.ParseIP("2001:db8::5")
+	for _, tt := range []struct {
+		name                    string
+		rapidCommit             bool
+		serverRapid             bool
+		replyWithoutRapidCommit bool
+		wantSent                []dhcpv6.MessageType
+		wantEvents              []EventKind
+	}{
+		{
+			name:        "rapid",
+			rapidCommit: true,
+			serverRapid: true,
+			wantSent:    []dhcpv6.MessageType{dhcpv6.MessageTypeSolicit},
+			wantEvents:  []EventKind{EventDiscover, EventAck},
+		},
+		{
+			name:        "server without rapid commit",
+			rapidCommit: true,
+			wantSent:    []dhcpv6.MessageType{dhcpv6.MessageTypeSolicit, dhcpv6.MessageTypeRequest},
+			wantEvents:  []EventKind{EventDiscover, EventOffer, EventRequest, EventAck},
+		},
+		{
+			name:                    "reply without rapid commit",
+			rapidCommit:             true,
+			replyWithoutRapidCommit: true,
+			wantSent:                []dhcpv6.MessageType{dhcpv6.MessageTypeSolicit, dhcpv6.MessageTypeRequest},
+			wantEvents:              []EventKind{EventDiscover, EventOffer, EventRequest, EventAck},
+		},
+		{
+			name:        "disabled",
+			serverRapid: true,
+			wantSent:    []dhcpv6.MessageType{dhcpv6.MessageTypeSolicit, dhcpv6.MessageTypeRequest},
+			wantEvents:  []EventKind{EventDiscover, EventOffer, EventRequest, EventAck},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeServer6(addr, tt.serverRapid)
+			s.replyWithoutRapidCommit = tt.replyWithoutRapidCommit
+			events := make(chan Event, 10)
+			c := Config{RapidCommit: tt.rapidCommit, Events: events}
+
+			l, err := requestLease6(context.Background(), newTestClient6(t, s), testLink(), c)
+			if err != nil {
+				t.Fatalf("requestLease6() = %v", err)
+			}
+			close(events)
+
+			if got := l.(*Packet6).Lease(); got == nil || !got.IPv6Addr.Equal(addr) {
+				t.Errorf("lease = %v, want address %v", got, addr)
+			}
+			if got := s.messageTypes(); !reflect.DeepEqual(got, tt.wantSent) {
+				t.Errorf("sent %v, want %v", got, tt.wantSent)
+			}
+			var got []EventKind
+			for e := range events {
+				if e.Protocol != NetIPv6 {
+					t.Errorf("event %v has protocol %v, want %v", e, e.Protocol, NetIPv6)
+				}
+				got = append(got, e.Kind)
+			}
+			if !reflect.DeepEqual(got, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", got, tt.wantEvents)
+			}
+		})
+	}
+}
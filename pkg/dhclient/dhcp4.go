@@ -7,11 +7,13 @@ package dhclient
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net"
 	"net/url"
 	"strings"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv4/nclient4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/vishvananda/netlink"
 )
@@ -19,10 +21,22 @@ import (
 // DefaultScheme for boot file if there are none in the lease
 var DefaultScheme = "tftp"
 
+// minMTU4 is the smallest MTU allowed by IPv4, per RFC 791.
+const minMTU4 = 68
+
+// linkSetMTU sets the MTU of a link. Tests override it.
+var linkSetMTU = netlink.LinkSetMTU
+
 // Packet4 implements convenience functions for DHCPv4 packets.
 type Packet4 struct {
 	iface netlink.Link
 	P     *dhcpv4.DHCPv4
+
+	// hookScript is run by Configure, if set.
+	hookScript string
+
+	// clientPort is the UDP port Release sends from, if not zero.
+	clientPort int
 }
 
 var _ Lease = &Packet4{}
@@ -60,6 +74,11 @@ func (p *Packet4) GatherDNSSettings() (ns []net.IP, sl []string, dom string) {
 	return
 }
 
+// NTPServers returns the servers of the NTP Servers (42) option.
+func (p *Packet4) NTPServers() []net.IP {
+	return p.P.NTPServers()
+}
+
 // Configure4 adds IP addresses, routes, and DNS servers to the system.
 func Configure4(iface netlink.Link, packet *dhcpv4.DHCPv4) error {
 	p := NewPacket4(iface, packet)
@@ -73,6 +92,12 @@ func (p *Packet4) Configure() error {
 		return fmt.Errorf("packet has no IP lease")
 	}
 
+	// The address still works if the NIC cannot use the MTU, e.g. it
+	// cannot do jumbo frames.
+	if err := p.configureMTU(); err != nil {
+		log.Print(err)
+	}
+
 	// Add the address to the iface.
 	dst := &netlink.Addr{
 		IPNet: l,
@@ -115,6 +140,70 @@ func (p *Packet4) Configure() error {
 		return err
 	}
 
+	// The interface is configured even if the hook fails.
+	if p.hookScript != "" {
+		if err := runHook(p.hookScript, p); err != nil {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// Release tells the server that the lease is no longer used, as described
+// in RFC 2131 Section 4.4.6. It does not deconfigure the interface.
+func (p *Packet4) Release() error {
+	port := nclient4.ClientPort
+	if p.clientPort != 0 {
+		port = p.clientPort
+	}
+	conn, err := nclient4.NewRawUDPConn(p.iface.Attrs().Name, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return release4(conn, p.iface, p.P)
+}
+
+// release4 sends a release of the lease in ack to the server that granted
+// it.
+func release4(conn net.PacketConn, iface netlink.Link, ack *dhcpv4.DHCPv4) error {
+	server := ack.ServerIdentifier()
+	if server == nil {
+		return fmt.Errorf("cannot release lease on %s: no server identifier", iface.Attrs().Name)
+	}
+	release, err := dhcpv4.NewReleaseFromACK(ack)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.WriteTo(release.ToBytes(), &net.UDPAddr{IP: server, Port: dhcpv4.ServerPort}); err != nil {
+		return fmt.Errorf("sending DHCPv4 release on %s: %v", iface.Attrs().Name, err)
+	}
+	return nil
+}
+
+// MTU returns the MTU of the Interface MTU (26) option, or 0 if there is
+// none.
+func (p *Packet4) MTU() int {
+	mtu, err := dhcpv4.GetUint16(dhcpv4.OptionInterfaceMTU, p.P.Options)
+	if err != nil {
+		return 0
+	}
+	return int(mtu)
+}
+
+// configureMTU sets the interface's MTU if the packet has a valid one.
+func (p *Packet4) configureMTU() error {
+	mtu := p.MTU()
+	if mtu == 0 {
+		return nil
+	}
+	if mtu < minMTU4 {
+		log.Printf("Ignoring DHCPv4 MTU %d for %s, below the IPv4 minimum of %d", mtu, p.iface.Attrs().Name, minMTU4)
+		return nil
+	}
+	if err := linkSetMTU(p.iface, mtu); err != nil {
+		return fmt.Errorf("%s: set MTU %d: %v", p.iface.Attrs().Name, mtu, err)
+	}
 	return nil
 }
 
@@ -148,7 +237,9 @@ var (
 	ErrNoServerHostName = errors.New("no server host name present in DHCP message")
 )
 
-func (p *Packet4) bootfilename() string {
+// BootFileName returns the boot file name as given by the server, which may
+// be a URL or a plain file name on the TFTP server.
+func (p *Packet4) BootFileName() string {
 	// Look for dhcp option presence first, then legacy BootFileName in header.
 	bootFileName := p.P.BootFileNameOption()
 	bootFileName = strings.TrimRight(bootFileName, "\x00")
@@ -163,7 +254,7 @@ func (p *Packet4) bootfilename() string {
 
 // Boot returns the boot file assigned.
 func (p *Packet4) Boot() (*url.URL, error) {
-	bootFileName := p.bootfilename()
+	bootFileName := p.BootFileName()
 	if len(bootFileName) == 0 {
 		return nil, ErrNoBootFile
 	}
@@ -204,7 +295,7 @@ func (p *Packet4) ISCSIBoot() (*net.TCPAddr, string, error) {
 	if len(rp) > 0 {
 		return ParseISCSIURI(rp)
 	}
-	bootfilename := p.bootfilename()
+	bootfilename := p.BootFileName()
 	if len(bootfilename) > 0 && strings.HasPrefix(bootfilename, "iscsi:") {
 		return ParseISCSIURI(bootfilename)
 	}
@@ -8,10 +8,13 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/vishvananda/netlink"
 )
 
 func withNetbootInfo(bootFileName, serverHostName string) dhcpv4.Modifier {
@@ -165,3 +168,146 @@ func TestISCSIBoot(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigureMTU(t *testing.T) {
+	defer func(f func(netlink.Link, int) error) { linkSetMTU = f }(linkSetMTU)
+
+	for _, tt := range []struct {
+		name    string
+		option  []byte
+		wantMTU int
+		wantSet bool
+	}{
+		{
+			name: "no option",
+		},
+		{
+			name:    "jumbo frames",
+			option:  []byte{0x23, 0x28},
+			wantMTU: 9000,
+			wantSet: true,
+		},
+		{
+			name:    "IPv4 minimum",
+			option:  []byte{0x00, 0x44},
+			wantMTU: 68,
+			wantSet: true,
+		},
+		{
+			name:    "below IPv4 minimum",
+			option:  []byte{0x00, 0x43},
+			wantMTU: 67,
+		},
+		{
+			name:   "malformed",
+			option: []byte{0x05},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var set []int
+			linkSetMTU = func(l netlink.Link, mtu int) error {
+				if l.Attrs().Name != "eth0" {
+					t.Errorf("set MTU of %s, want eth0", l.Attrs().Name)
+				}
+				set = append(set, mtu)
+				return nil
+			}
+
+			var mods []dhcpv4.Modifier
+			if tt.option != nil {
+				mods = append(mods, dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionInterfaceMTU, tt.option)))
+			}
+			p := NewPacket4(testLink(), mustNew(t, mods...))
+			if got := p.MTU(); got != tt.wantMTU {
+				t.Errorf("MTU() = %d, want %d", got, tt.wantMTU)
+			}
+			if err := p.configureMTU(); err != nil {
+				t.Fatalf("configureMTU() = %v", err)
+			}
+			var want []int
+			if tt.wantSet {
+				want = []int{tt.wantMTU}
+			}
+			if !reflect.DeepEqual(set, want) {
+				t.Errorf("set MTUs %v, want %v", set, want)
+			}
+		})
+	}
+}
+
+func TestNTPServers(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		option []byte
+		want   []net.IP
+	}{
+		{
+			name: "no option",
+		},
+		{
+			name:   "one server",
+			option: []byte{10, 0, 0, 123},
+			want:   []net.IP{{10, 0, 0, 123}},
+		},
+		{
+			name:   "several servers",
+			option: []byte{10, 0, 0, 123, 192, 168, 1, 1, 172, 16, 0, 5},
+			want:   []net.IP{{10, 0, 0, 123}, {192, 168, 1, 1}, {172, 16, 0, 5}},
+		},
+		{
+			name:   "malformed",
+			option: []byte{10, 0, 0},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var mods []dhcpv4.Modifier
+			if tt.option != nil {
+				mods = append(mods, dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionNTPServers, tt.option)))
+			}
+			p := NewPacket4(testLink(), mustNew(t, mods...))
+			got := p.NTPServers()
+			if len(got) != len(tt.want) {
+				t.Fatalf("NTPServers() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("NTPServers() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteNTPSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ntp.conf")
+	if err := WriteNTPSettings(path, []net.IP{{10, 0, 0, 123}, net.ParseIP("2001:db8::123")}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "server 10.0.0.123 iburst\nserver 2001:db8::123 iburst\n"; string(got) != want {
+		t.Errorf("ntp.conf = %q, want %q", got, want)
+	}
+}
+
+func TestRelease4(t *testing.T) {
+	s := newFakeServer4()
+	ack := mustNew(t,
+		dhcpv4.WithHwAddr(testHWAddr),
+		dhcpv4.WithYourIP(net.IP{10, 0, 0, 5}),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(testServerIP)),
+	)
+	if err := release4(s, testLink(), ack); err != nil {
+		t.Fatalf("release4() = %v", err)
+	}
+	msgs := s.messages()
+	if len(msgs) != 1 || msgs[0].MessageType() != dhcpv4.MessageTypeRelease || !msgs[0].ClientIPAddr.Equal(net.IP{10, 0, 0, 5}) {
+		t.Errorf("release4() sent %v, want one release of 10.0.0.5", msgs)
+	}
+
+	if err := release4(s, testLink(), mustNew(t)); err == nil {
+		t.Errorf("release4() without a server identifier = nil, want error")
+	}
+}
@@ -6,6 +6,7 @@ package dhclient
 
 import (
 	"fmt"
+	"log"
 	"net"
 	"net/url"
 	"os"
@@ -20,6 +21,9 @@ import (
 type Packet6 struct {
 	p     *dhcpv6.Message
 	iface netlink.Link
+
+	// hookScript is run by Configure, if set.
+	hookScript string
 }
 
 // NewPacket6 wraps a DHCPv6 packet with some convenience methods.
@@ -87,6 +91,13 @@ func (p *Packet6) Configure() error {
 			return err
 		}
 	}
+
+	// The interface is configured even if the hook fails.
+	if p.hookScript != "" {
+		if err := runHook(p.hookScript, p); err != nil {
+			log.Print(err)
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,80 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// EventKind is a step of a DHCP exchange.
+type EventKind int
+
+// Possible event kinds.
+//
+// For DHCPv6, a Solicit is reported as EventDiscover and the server's Reply
+// as EventAck.
+const (
+	EventDiscover EventKind = iota
+	EventOffer
+	EventRequest
+	EventAck
+	EventNak
+	EventTimeout
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventDiscover:
+		return "Discover"
+	case EventOffer:
+		return "Offer"
+	case EventRequest:
+		return "Request"
+	case EventAck:
+		return "Ack"
+	case EventNak:
+		return "Nak"
+	case EventTimeout:
+		return "Timeout"
+	}
+	return fmt.Sprintf("unknown event kind (%d)", int(k))
+}
+
+// Event describes a transition in a DHCP exchange on one interface.
+type Event struct {
+	Kind EventKind
+
+	// Protocol is either NetIPv4 or NetIPv6.
+	Protocol NetworkProtocol
+
+	// Interface is the name of the interface the exchange happens on.
+	Interface string
+
+	// Time is when the event occurred.
+	Time time.Time
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %s on %s at %s", e.Protocol, e.Kind, e.Interface, e.Time.Format(time.RFC3339Nano))
+}
+
+// emit sends an event to c.Events, if set.
+func (c Config) emit(ctx context.Context, kind EventKind, proto NetworkProtocol, ifname string) {
+	if c.Events == nil {
+		return
+	}
+	e := Event{
+		Kind:      kind,
+		Protocol:  proto,
+		Interface: ifname,
+		Time:      time.Now(),
+	}
+	select {
+	case c.Events <- e:
+	case <-ctx.Done():
+	}
+}
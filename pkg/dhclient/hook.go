@@ -0,0 +1,72 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func joinIPs(ips []net.IP) string {
+	s := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return strings.Join(s, " ")
+}
+
+// hookEnv returns the lease details as environment variables named like the
+// ones ISC dhclient passes to dhclient-script.
+func hookEnv(l Lease) []string {
+	env := []string{fmt.Sprintf("interface=%s", l.Link().Attrs().Name)}
+	add := func(name, value string) {
+		if value != "" {
+			env = append(env, fmt.Sprintf("%s=%s", name, value))
+		}
+	}
+
+	switch p := l.(type) {
+	case *Packet4:
+		add("reason", "BOUND")
+		lease := p.Lease()
+		add("new_ip_address", lease.IP.String())
+		add("new_subnet_mask", net.IP(lease.Mask).String())
+		add("new_routers", joinIPs(p.P.Router()))
+		ns, sl, domain := p.GatherDNSSettings()
+		add("new_domain_name_servers", joinIPs(ns))
+		add("new_domain_search", strings.Join(sl, " "))
+		add("new_domain_name", domain)
+		add("new_host_name", p.P.HostName())
+
+	case *Packet6:
+		add("reason", "BOUND6")
+		if lease := p.Lease(); lease != nil {
+			add("new_ip6_address", lease.IPv6Addr.String())
+			add("new_ip6_prefixlen", "128")
+		}
+		add("new_dhcp6_name_servers", joinIPs(p.DNS()))
+	}
+	return env
+}
+
+// runHook runs script with the lease details in its environment, so that
+// existing dhclient-script logic can be reused.
+func runHook(script string, l Lease) error {
+	cmd := exec.Command(script)
+	cmd.Env = append(os.Environ(), hookEnv(l)...)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		log.Printf("Hook %s on %s: %s", script, l.Link().Attrs().Name, out)
+	}
+	if err != nil {
+		return fmt.Errorf("hook %s on %s: %v", script, l.Link().Attrs().Name, err)
+	}
+	log.Printf("Hook %s on %s exited with status 0", script, l.Link().Attrs().Name)
+	return nil
+}
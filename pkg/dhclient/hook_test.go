@@ -0,0 +1,70 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func TestRunHook(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "env")
+	script := filepath.Join(dir, "hook.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nenv > "+out+"\necho hello\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPacket4(testLink(), mustNew(t,
+		dhcpv4.WithYourIP(net.IP{10, 0, 0, 5}),
+		dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		dhcpv4.WithRouter(net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}),
+		dhcpv4.WithDNS(net.IP{8, 8, 8, 8}),
+		dhcpv4.WithOption(dhcpv4.OptDomainName("example.com")),
+	))
+	if err := runHook(script, p); err != nil {
+		t.Fatalf("runHook() = %v", err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{}
+	for _, line := range strings.Split(string(b), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+	for k, v := range map[string]string{
+		"reason":                  "BOUND",
+		"interface":               "eth0",
+		"new_ip_address":          "10.0.0.5",
+		"new_subnet_mask":         "255.255.255.0",
+		"new_routers":             "10.0.0.1 10.0.0.2",
+		"new_domain_name_servers": "8.8.8.8",
+		"new_domain_name":         "example.com",
+	} {
+		if env[k] != v {
+			t.Errorf("hook env %s = %q, want %q", k, env[k], v)
+		}
+	}
+}
+
+func TestRunHookFailure(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexit 3\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p := NewPacket4(testLink(), mustNew(t))
+	if err := runHook(script, p); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Errorf("runHook() = %v, want exit status 3", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// sethostname sets the kernel's hostname.
+func sethostname(name string) error {
+	return unix.Sethostname([]byte(name))
+}
+
+// defaultHosts are the entries of a hosts file that did not exist before.
+const defaultHosts = "127.0.0.1\tlocalhost\n::1\tlocalhost\n"
+
+// Hostname returns the host name of the Host Name (12) option without a
+// domain, and the fully qualified domain name made of it and the Domain
+// Name (15) option. They are empty if there is no host name.
+func (p *Packet4) Hostname() (host, fqdn string) {
+	name := strings.TrimSuffix(p.P.HostName(), ".")
+	if name == "" {
+		return "", ""
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		return name[:i], name
+	}
+	if domain := strings.TrimSuffix(p.P.DomainName(), "."); domain != "" {
+		return name, name + "." + domain
+	}
+	return name, name
+}
+
+// ApplyHostname sets the kernel's hostname to the lease's host name, writes
+// it to hostnamePath, e.g. /etc/hostname, and maps the leased address to it
+// in the hosts file at hostsPath, e.g. /etc/hosts. Other entries of the
+// hosts file are kept, except earlier ones of the leased address. Empty
+// paths are not written.
+//
+// If the lease has no Host Name (12) option, ApplyHostname does nothing. If
+// the host or domain name is not made of valid RFC 1123 labels, it returns
+// an error without changing anything.
+func (p *Packet4) ApplyHostname(hostsPath, hostnamePath string) error {
+	return p.applyHostname(hostsPath, hostnamePath, sethostname)
+}
+
+func (p *Packet4) applyHostname(hostsPath, hostnamePath string, sethostname func(string) error) error {
+	host, fqdn := p.Hostname()
+	if host == "" {
+		return nil
+	}
+	if err := validHostname(fqdn); err != nil {
+		return err
+	}
+	if err := sethostname(host); err != nil {
+		return fmt.Errorf("setting hostname %q: %v", host, err)
+	}
+	if hostnamePath != "" {
+		if err := os.WriteFile(hostnamePath, []byte(host+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+	if hostsPath == "" {
+		return nil
+	}
+	ip := p.P.YourIPAddr
+	if ip == nil || ip.IsUnspecified() {
+		return nil
+	}
+	hosts, err := os.ReadFile(hostsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		hosts, err = []byte(defaultHosts), nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	for _, line := range strings.SplitAfter(string(hosts), "\n") {
+		if f := strings.Fields(line); len(f) > 0 && f[0] == ip.String() {
+			continue
+		}
+		b.WriteString(line)
+	}
+	if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+		b.WriteString("\n")
+	}
+	names := host
+	if fqdn != host {
+		names = fqdn + " " + host
+	}
+	fmt.Fprintf(&b, "%s\t%s\n", ip, names)
+	return os.WriteFile(hostsPath, b.Bytes(), 0o644)
+}
+
+// validHostname returns an error unless name is made of dot-separated
+// RFC 1123 labels: 1 to 63 letters, digits and hyphens, not beginning or
+// ending with a hyphen.
+func validHostname(name string) error {
+	if len(name) > 253 {
+		return fmt.Errorf("invalid host name %q: longer than 253 bytes", name)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("invalid host name %q: label %q is not 1 to 63 bytes long", name, label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid host name %q: label %q begins or ends with a hyphen", name, label)
+		}
+		for _, c := range label {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid host name %q: label %q has invalid character %q", name, label, c)
+			}
+		}
+	}
+	return nil
+}
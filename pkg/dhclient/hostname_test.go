@@ -0,0 +1,158 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// recordHostnames returns a sethostname that records the names it is given
+// in set.
+func recordHostnames(set *[]string) func(string) error {
+	return func(name string) error {
+		*set = append(*set, name)
+		return nil
+	}
+}
+
+func TestApplyHostname(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		mods      []dhcpv4.Modifier
+		hosts     string
+		wantHost  string
+		wantHosts string
+	}{
+		{
+			name: "host and domain",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptHostName("node7")),
+				dhcpv4.WithOption(dhcpv4.OptDomainName("rack.example.com")),
+			},
+			wantHost:  "node7",
+			wantHosts: "127.0.0.1\tlocalhost\n::1\tlocalhost\n10.0.0.5\tnode7.rack.example.com node7\n",
+		},
+		{
+			name: "fully qualified host name",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptHostName("node7.example.org")),
+				dhcpv4.WithOption(dhcpv4.OptDomainName("rack.example.com")),
+			},
+			hosts:     "127.0.0.1 localhost\n10.0.0.5 old-name\n192.168.1.1 gateway",
+			wantHost:  "node7",
+			wantHosts: "127.0.0.1 localhost\n192.168.1.1 gateway\n10.0.0.5\tnode7.example.org node7\n",
+		},
+		{
+			name: "no domain",
+			mods: []dhcpv4.Modifier{
+				dhcpv4.WithOption(dhcpv4.OptHostName("node7")),
+			},
+			hosts:     "127.0.0.1 localhost\n",
+			wantHost:  "node7",
+			wantHosts: "127.0.0.1 localhost\n10.0.0.5\tnode7\n",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var set []string
+			dir := t.TempDir()
+			hostsPath := filepath.Join(dir, "hosts")
+			hostnamePath := filepath.Join(dir, "hostname")
+			if tt.hosts != "" {
+				if err := os.WriteFile(hostsPath, []byte(tt.hosts), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mods := append([]dhcpv4.Modifier{dhcpv4.WithYourIP(net.IP{10, 0, 0, 5})}, tt.mods...)
+			p := NewPacket4(testLink(), mustNew(t, mods...))
+			if err := p.applyHostname(hostsPath, hostnamePath, recordHostnames(&set)); err != nil {
+				t.Fatalf("ApplyHostname() = %v", err)
+			}
+
+			if want := []string{tt.wantHost}; !reflect.DeepEqual(set, want) {
+				t.Errorf("set hostnames %q, want %q", set, want)
+			}
+			if got, err := os.ReadFile(hostnamePath); err != nil || string(got) != tt.wantHost+"\n" {
+				t.Errorf("hostname file = %q, %v, want %q", got, err, tt.wantHost+"\n")
+			}
+			if got, err := os.ReadFile(hostsPath); err != nil || string(got) != tt.wantHosts {
+				t.Errorf("hosts file = %q, %v, want %q", got, err, tt.wantHosts)
+			}
+		})
+	}
+}
+
+func TestApplyHostnameNoOption(t *testing.T) {
+	var set []string
+	dir := t.TempDir()
+	hostsPath := filepath.Join(dir, "hosts")
+	hostnamePath := filepath.Join(dir, "hostname")
+
+	p := NewPacket4(testLink(), mustNew(t,
+		dhcpv4.WithYourIP(net.IP{10, 0, 0, 5}),
+		dhcpv4.WithOption(dhcpv4.OptDomainName("example.com")),
+	))
+	if err := p.applyHostname(hostsPath, hostnamePath, recordHostnames(&set)); err != nil {
+		t.Fatalf("ApplyHostname() = %v", err)
+	}
+	if len(set) != 0 {
+		t.Errorf("set hostnames %q, want none", set)
+	}
+	for _, path := range []string{hostsPath, hostnamePath} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was written without a host name: %v", path, err)
+		}
+	}
+}
+
+func TestApplyHostnameInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		host   string
+		domain string
+	}{
+		{name: "newline", host: "node7\n10.0.0.1 gateway"},
+		{name: "space", host: "node7 gateway"},
+		{name: "leading hyphen", host: "-node7"},
+		{name: "trailing hyphen", host: "node7-"},
+		{name: "empty label", host: "node7..example.com"},
+		{name: "long label", host: strings.Repeat("a", 64)},
+		{name: "invalid domain", host: "node7", domain: "example.com\n10.0.0.1 gateway"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var set []string
+			dir := t.TempDir()
+			hostsPath := filepath.Join(dir, "hosts")
+			hostnamePath := filepath.Join(dir, "hostname")
+
+			mods := []dhcpv4.Modifier{
+				dhcpv4.WithYourIP(net.IP{10, 0, 0, 5}),
+				dhcpv4.WithOption(dhcpv4.OptHostName(tt.host)),
+			}
+			if tt.domain != "" {
+				mods = append(mods, dhcpv4.WithOption(dhcpv4.OptDomainName(tt.domain)))
+			}
+			p := NewPacket4(testLink(), mustNew(t, mods...))
+			if err := p.applyHostname(hostsPath, hostnamePath, recordHostnames(&set)); err == nil {
+				t.Errorf("ApplyHostname(%q) = nil, want error", tt.host)
+			}
+			if len(set) != 0 {
+				t.Errorf("set hostnames %q, want none", set)
+			}
+			for _, path := range []string{hostsPath, hostnamePath} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s was written with an invalid host name: %v", path, err)
+				}
+			}
+		})
+	}
+}
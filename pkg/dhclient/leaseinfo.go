@@ -0,0 +1,80 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"net"
+)
+
+// LeaseInfo is a summary of a lease, e.g. to print it as JSON.
+//
+// Times are in seconds; zero means the server did not send them.
+type LeaseInfo struct {
+	Interface     string   `json:"interface"`
+	Protocol      string   `json:"protocol"`
+	IP            net.IP   `json:"ip,omitempty"`
+	Mask          string   `json:"mask,omitempty"`
+	PrefixLen     int      `json:"prefix_len,omitempty"`
+	Routers       []net.IP `json:"routers,omitempty"`
+	DNS           []net.IP `json:"dns,omitempty"`
+	Domain        string   `json:"domain,omitempty"`
+	SearchList    []string `json:"search_list,omitempty"`
+	ServerID      net.IP   `json:"server_id,omitempty"`
+	BootFile      string   `json:"boot_file,omitempty"`
+	LeaseTime     int64    `json:"lease_time,omitempty"`
+	RenewalTime   int64    `json:"renewal_time,omitempty"`
+	RebindingTime int64    `json:"rebinding_time,omitempty"`
+}
+
+// NewLeaseInfo summarizes l.
+func NewLeaseInfo(l Lease) LeaseInfo {
+	info := LeaseInfo{Interface: l.Link().Attrs().Name}
+
+	switch p := l.(type) {
+	case *Packet4:
+		info.Protocol = NetIPv4.String()
+		lease := p.Lease()
+		info.IP = lease.IP
+		info.Mask = net.IP(lease.Mask).String()
+		info.PrefixLen, _ = lease.Mask.Size()
+		info.Routers = p.P.Router()
+		info.DNS, info.SearchList, info.Domain = p.GatherDNSSettings()
+		info.ServerID = p.P.ServerIdentifier()
+		info.BootFile = p.BootFileName()
+		info.LeaseTime = int64(p.P.IPAddressLeaseTime(0).Seconds())
+		info.RenewalTime = int64(p.P.IPAddressRenewalTime(0).Seconds())
+		info.RebindingTime = int64(p.P.IPAddressRebindingTime(0).Seconds())
+
+	case *Packet6:
+		info.Protocol = NetIPv6.String()
+		if lease := p.Lease(); lease != nil {
+			info.IP = lease.IPv6Addr
+			info.PrefixLen = 128
+			info.LeaseTime = int64(lease.ValidLifetime.Seconds())
+		}
+		if iana := p.p.Options.OneIANA(); iana != nil {
+			info.RenewalTime = int64(iana.T1.Seconds())
+			info.RebindingTime = int64(iana.T2.Seconds())
+		}
+		info.DNS = p.DNS()
+		if sl := p.p.Options.DomainSearchList(); sl != nil {
+			info.SearchList = sl.Labels
+		}
+		info.BootFile = p.p.Options.BootFileURL()
+
+	case *SLAACLease:
+		info.Protocol = NetIPv6.String()
+		if addrs := p.Addrs(); len(addrs) > 0 {
+			info.IP = addrs[0].IP
+			info.PrefixLen, _ = addrs[0].Mask.Size()
+			info.LeaseTime = int64(addrs[0].ValidLft)
+		}
+		if r := p.DefaultRoute(); r != nil {
+			info.Routers = []net.IP{r.Gw}
+		}
+		info.DNS = p.RA.DNS
+	}
+	return info
+}
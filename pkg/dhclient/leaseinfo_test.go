@@ -0,0 +1,41 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func TestLeaseInfoJSON(t *testing.T) {
+	p := NewPacket4(testLink(), mustNew(t,
+		dhcpv4.WithYourIP(net.IP{10, 0, 0, 5}),
+		dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		dhcpv4.WithRouter(net.IP{10, 0, 0, 1}),
+		dhcpv4.WithDNS(net.IP{8, 8, 8, 8}),
+		dhcpv4.WithServerIP(testServerIP),
+		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(testServerIP)),
+		dhcpv4.WithOption(dhcpv4.OptDomainName("example.com")),
+		dhcpv4.WithOption(dhcpv4.OptBootFileName("pxelinux.0")),
+		dhcpv4.WithLeaseTime(3600),
+		dhcpv4.WithOption(dhcpv4.Option{Code: dhcpv4.OptionRenewTimeValue, Value: dhcpv4.Duration(1800 * time.Second)}),
+		dhcpv4.WithOption(dhcpv4.Option{Code: dhcpv4.OptionRebindingTimeValue, Value: dhcpv4.Duration(3150 * time.Second)}),
+	))
+
+	b, err := json.Marshal(NewLeaseInfo(p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"interface":"eth0","protocol":"IPv4","ip":"10.0.0.5","mask":"255.255.255.0","prefix_len":24,` +
+		`"routers":["10.0.0.1"],"dns":["8.8.8.8"],"domain":"example.com","server_id":"` + testServerIP.String() + `",` +
+		`"boot_file":"pxelinux.0","lease_time":3600,"renewal_time":1800,"rebinding_time":3150}`
+	if string(b) != want {
+		t.Errorf("NewLeaseInfo() JSON =\n%s\nwant\n%s", b, want)
+	}
+}
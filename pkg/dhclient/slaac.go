@@ -0,0 +1,444 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/dhcpv6"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoRouterAdvertisement is returned if no router answered Router
+// Solicitations.
+var ErrNoRouterAdvertisement = errors.New("no IPv6 router advertisement received")
+
+// ICMPv6 message types and Neighbor Discovery option types of RFC 4861 and
+// RFC 8106.
+const (
+	icmpRouterSolicitation   = 133
+	icmpRouterAdvertisement  = 134
+	ndOptSourceLinkAddr      = 1
+	ndOptPrefixInfo          = 3
+	ndOptMTU                 = 5
+	ndOptRecursiveDNSServers = 25
+)
+
+// infiniteLifetime is the lifetime of prefixes that do not expire.
+const infiniteLifetime = 0xffffffff * time.Second
+
+// minMTU6 is the smallest MTU allowed by IPv6, per RFC 8200.
+const minMTU6 = 1280
+
+// PrefixInfo is a Prefix Information option of a Router Advertisement.
+type PrefixInfo struct {
+	Prefix *net.IPNet
+
+	// OnLink means addresses in Prefix are reachable without a router.
+	OnLink bool
+
+	// Autonomous means Prefix may be used for SLAAC.
+	Autonomous bool
+
+	ValidLifetime     time.Duration
+	PreferredLifetime time.Duration
+}
+
+// RouterAdvertisement is an ICMPv6 Router Advertisement, described in RFC
+// 4861 Section 4.2.
+type RouterAdvertisement struct {
+	// Router is the link-local address the advertisement was sent from.
+	Router net.IP
+
+	CurHopLimit uint8
+
+	// Managed means addresses are available from DHCPv6.
+	Managed bool
+
+	// Other means other configuration, e.g. DNS servers or boot files,
+	// is available from DHCPv6.
+	Other bool
+
+	// RouterLifetime is how long the router may be used as the default
+	// router, or 0 if it is not a default router.
+	RouterLifetime time.Duration
+
+	Prefixes []PrefixInfo
+
+	// MTU is the MTU of the MTU option, or 0 if there is none.
+	MTU uint32
+
+	// DNS are the servers of Recursive DNS Server options (RFC 8106).
+	DNS []net.IP
+}
+
+// ParseRouterAdvertisement parses an ICMPv6 Router Advertisement message.
+// Unknown options, and known options with invalid contents, are skipped.
+// An option of length 0 or extending past the end of the message makes the
+// whole message invalid, as in RFC 4861 Section 4.6, and is an error.
+func ParseRouterAdvertisement(b []byte) (*RouterAdvertisement, error) {
+	if len(b) < 16 {
+		return nil, fmt.Errorf("router advertisement too short: %d bytes", len(b))
+	}
+	if b[0] != icmpRouterAdvertisement || b[1] != 0 {
+		return nil, fmt.Errorf("not a router advertisement: ICMPv6 type %d code %d", b[0], b[1])
+	}
+	ra := &RouterAdvertisement{
+		CurHopLimit:    b[4],
+		Managed:        b[5]&0x80 != 0,
+		Other:          b[5]&0x40 != 0,
+		RouterLifetime: time.Duration(binary.BigEndian.Uint16(b[6:8])) * time.Second,
+	}
+
+	opts := b[16:]
+	for len(opts) >= 2 {
+		// Option lengths are in units of 8 bytes.
+		l := int(opts[1]) * 8
+		if l == 0 || l > len(opts) {
+			return nil, fmt.Errorf("invalid length %d of option %d", l, opts[0])
+		}
+		opt := opts[:l]
+		opts = opts[l:]
+
+		switch opt[0] {
+		case ndOptPrefixInfo:
+			if l != 32 || opt[2] > 128 {
+				continue
+			}
+			prefix := net.IP(append([]byte(nil), opt[16:32]...))
+			mask := net.CIDRMask(int(opt[2]), 128)
+			ra.Prefixes = append(ra.Prefixes, PrefixInfo{
+				Prefix:            &net.IPNet{IP: prefix.Mask(mask), Mask: mask},
+				OnLink:            opt[3]&0x80 != 0,
+				Autonomous:        opt[3]&0x40 != 0,
+				ValidLifetime:     time.Duration(binary.BigEndian.Uint32(opt[4:8])) * time.Second,
+				PreferredLifetime: time.Duration(binary.BigEndian.Uint32(opt[8:12])) * time.Second,
+			})
+
+		case ndOptMTU:
+			if l == 8 {
+				ra.MTU = binary.BigEndian.Uint32(opt[4:8])
+			}
+
+		case ndOptRecursiveDNSServers:
+			if binary.BigEndian.Uint32(opt[4:8]) == 0 {
+				// The servers must no longer be used.
+				continue
+			}
+			for a := opt[8:]; len(a) >= net.IPv6len; a = a[net.IPv6len:] {
+				ra.DNS = append(ra.DNS, net.IP(append([]byte(nil), a[:net.IPv6len]...)))
+			}
+		}
+	}
+	return ra, nil
+}
+
+// routerSolicitation returns an ICMPv6 Router Solicitation from mac. The
+// kernel fills in the checksum.
+func routerSolicitation(mac net.HardwareAddr) []byte {
+	b := make([]byte, 8)
+	b[0] = icmpRouterSolicitation
+	if len(mac) > 0 {
+		// Pad the source link-layer address option to 8 bytes.
+		l := (2 + len(mac) + 7) / 8 * 8
+		opt := make([]byte, l)
+		opt[0] = ndOptSourceLinkAddr
+		opt[1] = byte(l / 8)
+		copy(opt[2:], mac)
+		b = append(b, opt...)
+	}
+	return b
+}
+
+// eui64 returns the modified EUI-64 interface identifier of a 48-bit MAC
+// address, described in RFC 4291 Appendix A.
+func eui64(mac net.HardwareAddr) ([]byte, error) {
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("cannot derive EUI-64 interface identifier from %d-byte hardware address %s", len(mac), mac)
+	}
+	return []byte{mac[0] ^ 0x02, mac[1], mac[2], 0xff, 0xfe, mac[3], mac[4], mac[5]}, nil
+}
+
+// stablePrivacyID returns a stable, semantically opaque interface
+// identifier for prefix, as described in RFC 7217 Section 5, using SHA-256
+// as the pseudorandom function.
+func stablePrivacyID(prefix net.IP, ifname string, secret []byte) []byte {
+	h := sha256.New()
+	h.Write(prefix.To16()[:8])
+	h.Write([]byte(ifname))
+	// No DAD counter: addresses are configured optimistically.
+	h.Write([]byte{0})
+	h.Write(secret)
+	return h.Sum(nil)[:8]
+}
+
+// SLAACAddress returns the address autoconfigured for iface from a /64
+// prefix (RFC 4862 Section 5.5.3). It is derived from iface's hardware
+// address, or from secret if set, as a stable privacy address.
+func SLAACAddress(prefix *net.IPNet, iface netlink.Link, secret []byte) (net.IP, error) {
+	if ones, bits := prefix.Mask.Size(); ones != 64 || bits != 128 {
+		return nil, fmt.Errorf("cannot autoconfigure an address in %s: prefix length must be 64", prefix)
+	}
+	var id []byte
+	if len(secret) > 0 {
+		id = stablePrivacyID(prefix.IP, iface.Attrs().Name, secret)
+	} else {
+		var err error
+		if id, err = eui64(iface.Attrs().HardwareAddr); err != nil {
+			return nil, err
+		}
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP.To16()[:8])
+	copy(ip[8:], id)
+	return ip, nil
+}
+
+// lifetime returns d in seconds for netlink, where 0 means forever.
+func lifetime(d time.Duration) int {
+	if d >= infiniteLifetime {
+		return 0
+	}
+	return int(d / time.Second)
+}
+
+// SLAACLease is an IPv6 configuration derived from a Router Advertisement
+// by stateless address autoconfiguration (RFC 4862).
+type SLAACLease struct {
+	iface netlink.Link
+
+	// RA is the Router Advertisement the configuration is derived from.
+	RA *RouterAdvertisement
+
+	// secret derives stable privacy addresses, if set.
+	secret []byte
+}
+
+var _ Lease = &SLAACLease{}
+
+// NewSLAACLease returns the configuration of iface derived from ra. If
+// secret is set, stable privacy addresses are used instead of addresses
+// derived from iface's hardware address.
+func NewSLAACLease(iface netlink.Link, ra *RouterAdvertisement, secret []byte) *SLAACLease {
+	return &SLAACLease{iface: iface, RA: ra, secret: secret}
+}
+
+// Addrs returns the addresses autoconfigured from the advertised prefixes.
+// Prefixes that are not for autoconfiguration or not /64 are skipped.
+func (l *SLAACLease) Addrs() []*netlink.Addr {
+	var addrs []*netlink.Addr
+	for _, p := range l.RA.Prefixes {
+		if !p.Autonomous || p.ValidLifetime == 0 || p.PreferredLifetime > p.ValidLifetime || p.Prefix.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ip, err := SLAACAddress(p.Prefix, l.iface, l.secret)
+		if err != nil {
+			log.Printf("Skipping prefix %s on %s: %v", p.Prefix, l.iface.Attrs().Name, err)
+			continue
+		}
+		mask := net.CIDRMask(128, 128)
+		if p.OnLink {
+			mask = p.Prefix.Mask
+		}
+		addrs = append(addrs, &netlink.Addr{
+			IPNet:       &net.IPNet{IP: ip, Mask: mask},
+			ValidLft:    lifetime(p.ValidLifetime),
+			PreferedLft: lifetime(p.PreferredLifetime),
+			// As for DHCPv6, use the address before DAD is done.
+			Flags: unix.IFA_F_OPTIMISTIC,
+		})
+	}
+	return addrs
+}
+
+// DefaultRoute returns the default route via the router, or nil if it is
+// not a default router.
+func (l *SLAACLease) DefaultRoute() *netlink.Route {
+	if l.RA.RouterLifetime == 0 || l.RA.Router == nil {
+		return nil
+	}
+	return &netlink.Route{
+		LinkIndex: l.iface.Attrs().Index,
+		Gw:        l.RA.Router,
+	}
+}
+
+// WantsDHCPv6 returns whether the router's M or O flag asks for DHCPv6 to
+// get addresses or other configuration.
+func (l *SLAACLease) WantsDHCPv6() bool {
+	return l.RA.Managed || l.RA.Other
+}
+
+// Configure adds the autoconfigured addresses, the default route, the MTU
+// and DNS servers to the system.
+func (l *SLAACLease) Configure() error {
+	addrs := l.Addrs()
+	if len(addrs) == 0 {
+		return fmt.Errorf("router advertisement on %s has no prefix for autoconfiguration", l.iface.Attrs().Name)
+	}
+	// The addresses still work if the NIC cannot use the MTU, e.g. it
+	// cannot do jumbo frames.
+	if l.RA.MTU >= minMTU6 {
+		if err := linkSetMTU(l.iface, int(l.RA.MTU)); err != nil {
+			log.Printf("%s: set MTU %d: %v", l.iface.Attrs().Name, l.RA.MTU, err)
+		}
+	}
+	for _, a := range addrs {
+		if err := netlink.AddrReplace(l.iface, a); err != nil {
+			return fmt.Errorf("add/replace %s to %v: %v", a, l.iface.Attrs().Name, err)
+		}
+	}
+	if r := l.DefaultRoute(); r != nil {
+		if err := netlink.RouteReplace(r); err != nil {
+			return fmt.Errorf("%s: add %s: %v", l.iface.Attrs().Name, r, err)
+		}
+	}
+	if len(l.RA.DNS) > 0 {
+		return WriteDNSSettings(l.RA.DNS, nil, "")
+	}
+	return nil
+}
+
+func (l *SLAACLease) String() string {
+	var ips []net.IP
+	for _, a := range l.Addrs() {
+		ips = append(ips, a.IP)
+	}
+	return fmt.Sprintf("IPv6 SLAAC addresses %s via router %s", joinIPs(ips), l.RA.Router)
+}
+
+// Link returns the interface the configuration is for.
+func (l *SLAACLease) Link() netlink.Link {
+	return l.iface
+}
+
+// Boot returns ErrNoBootFile, as routers do not advertise boot files.
+func (l *SLAACLease) Boot() (*url.URL, error) {
+	return nil, ErrNoBootFile
+}
+
+// ISCSIBoot returns ErrNoRootPath, as routers do not advertise root paths.
+func (l *SLAACLease) ISCSIBoot() (*net.TCPAddr, string, error) {
+	return nil, "", ErrNoRootPath
+}
+
+// Message returns no DHCP message, as the configuration is not from DHCP.
+func (l *SLAACLease) Message() (*dhcpv4.DHCPv4, *dhcpv6.Message) {
+	return nil, nil
+}
+
+var allRouters = net.ParseIP("ff02::2")
+
+// solicitRA sends Router Solicitations on iface until a router answers
+// with a valid Router Advertisement, waiting timeout after each of up to
+// 1+retries solicitations.
+func solicitRA(ctx context.Context, iface netlink.Link, timeout time.Duration, retries int) (*RouterAdvertisement, error) {
+	ifi, err := net.InterfaceByIndex(iface.Attrs().Index)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("ip6:ipv6-icmp", "::")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open ICMPv6 socket: %v", err)
+	}
+	defer conn.Close()
+
+	pc := ipv6.NewPacketConn(conn)
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeRouterAdvertisement)
+	if err := pc.SetICMPFilter(&filter); err != nil {
+		return nil, err
+	}
+	if err := pc.SetControlMessage(ipv6.FlagHopLimit|ipv6.FlagInterface, true); err != nil {
+		return nil, err
+	}
+	if err := pc.SetMulticastInterface(ifi); err != nil {
+		return nil, err
+	}
+	// Neighbor Discovery messages must have a hop limit of 255, so that
+	// they cannot come from off-link.
+	if err := pc.SetMulticastHopLimit(255); err != nil {
+		return nil, err
+	}
+
+	rs := routerSolicitation(iface.Attrs().HardwareAddr)
+	dst := &net.IPAddr{IP: allRouters, Zone: ifi.Name}
+	buf := make([]byte, ifi.MTU)
+	if len(buf) < minMTU6 {
+		buf = make([]byte, minMTU6)
+	}
+	for attempt := 0; attempt <= retries; attempt++ {
+		if _, err := pc.WriteTo(rs, nil, dst); err != nil {
+			return nil, fmt.Errorf("sending router solicitation on %s: %v", ifi.Name, err)
+		}
+
+		deadline := time.Now().Add(timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		if err := pc.SetReadDeadline(deadline); err != nil {
+			return nil, err
+		}
+		for {
+			n, cm, src, err := pc.ReadFrom(buf)
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if cm == nil || cm.HopLimit != 255 || cm.IfIndex != ifi.Index {
+				continue
+			}
+			addr, ok := src.(*net.IPAddr)
+			if !ok || !addr.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ra, err := ParseRouterAdvertisement(buf[:n])
+			if err != nil {
+				log.Printf("Ignoring router advertisement from %s on %s: %v", addr.IP, ifi.Name, err)
+				continue
+			}
+			ra.Router = addr.IP
+			return ra, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrNoRouterAdvertisement
+}
+
+// leaseSLAAC autoconfigures IPv6 on iface from the Router Advertisement of
+// a router on its link.
+func leaseSLAAC(ctx context.Context, iface netlink.Link, c Config, linkUpTimeout time.Duration) (*SLAACLease, error) {
+	if err := waitIPv6Link(ctx, iface, linkUpTimeout); err != nil {
+		return nil, err
+	}
+	log.Printf("Soliciting IPv6 router advertisements on %s", iface.Attrs().Name)
+	ra, err := solicitRA(ctx, iface, c.Timeout, c.Retries)
+	if err != nil {
+		return nil, err
+	}
+	l := NewSLAACLease(iface, ra, c.SLAACSecret)
+	log.Printf("Got IPv6 router advertisement on %s: %s, managed %t, other %t", iface.Attrs().Name, l, ra.Managed, ra.Other)
+	return l, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// prefixOption returns a Prefix Information option.
+func prefixOption(prefix string, flags byte, valid, preferred uint32) []byte {
+	_, n, err := net.ParseCIDR(prefix)
+	if err != nil {
+		panic(err)
+	}
+	ones, _ := n.Mask.Size()
+	b := make([]byte, 32)
+	b[0], b[1], b[2], b[3] = ndOptPrefixInfo, 4, byte(ones), flags
+	binary.BigEndian.PutUint32(b[4:8], valid)
+	binary.BigEndian.PutUint32(b[8:12], preferred)
+	copy(b[16:], n.IP)
+	return b
+}
+
+// routerAdvertisement returns a Router Advertisement with the given flags,
+// router lifetime in seconds and options.
+func routerAdvertisement(flags byte, routerLifetime uint16, opts ...[]byte) []byte {
+	b := make([]byte, 16)
+	b[0], b[4], b[5] = icmpRouterAdvertisement, 64, flags
+	binary.BigEndian.PutUint16(b[6:8], routerLifetime)
+	for _, o := range opts {
+		b = append(b, o...)
+	}
+	return b
+}
+
+func TestParseRouterAdvertisement(t *testing.T) {
+	mtu := make([]byte, 8)
+	mtu[0], mtu[1] = ndOptMTU, 1
+	binary.BigEndian.PutUint32(mtu[4:], 1500)
+
+	rdnss := make([]byte, 24)
+	rdnss[0], rdnss[1] = ndOptRecursiveDNSServers, 3
+	binary.BigEndian.PutUint32(rdnss[4:8], 600)
+	copy(rdnss[8:], net.ParseIP("2001:db8::53"))
+
+	unknown := []byte{200, 1, 0, 0, 0, 0, 0, 0}
+	// An MTU option must be 8 bytes long.
+	badMTU := make([]byte, 16)
+	badMTU[0], badMTU[1] = ndOptMTU, 2
+
+	ra, err := ParseRouterAdvertisement(routerAdvertisement(0x40, 1800,
+		prefixOption("2001:db8:1::/64", 0xc0, 86400, 14400),
+		unknown,
+		mtu,
+		badMTU,
+		rdnss,
+	))
+	if err != nil {
+		t.Fatalf("ParseRouterAdvertisement() = %v", err)
+	}
+	if ra.Managed || !ra.Other || ra.RouterLifetime != 30*time.Minute || ra.CurHopLimit != 64 {
+		t.Errorf("ParseRouterAdvertisement() = %+v, want O flag, lifetime 30m, hop limit 64", ra)
+	}
+	if len(ra.Prefixes) != 1 {
+		t.Fatalf("prefixes = %v, want 1", ra.Prefixes)
+	}
+	p := ra.Prefixes[0]
+	if p.Prefix.String() != "2001:db8:1::/64" || !p.OnLink || !p.Autonomous || p.ValidLifetime != 24*time.Hour || p.PreferredLifetime != 4*time.Hour {
+		t.Errorf("prefix = %+v, want on-link autonomous 2001:db8:1::/64 valid for 24h, preferred for 4h", p)
+	}
+	if ra.MTU != 1500 {
+		t.Errorf("MTU = %d, want 1500", ra.MTU)
+	}
+	if len(ra.DNS) != 1 || !ra.DNS[0].Equal(net.ParseIP("2001:db8::53")) {
+		t.Errorf("DNS = %v, want [2001:db8::53]", ra.DNS)
+	}
+
+	for _, bad := range [][]byte{
+		routerAdvertisement(0, 0)[:10],
+		append([]byte{icmpRouterSolicitation}, routerAdvertisement(0, 0)[1:]...),
+		routerAdvertisement(0, 0, []byte{ndOptMTU, 0, 0, 0, 0, 0, 0, 0}),
+		routerAdvertisement(0, 0, []byte{ndOptMTU, 2, 0, 0, 0, 0, 0, 0}),
+	} {
+		if _, err := ParseRouterAdvertisement(bad); err == nil {
+			t.Errorf("ParseRouterAdvertisement(%x) = nil, want error", bad)
+		}
+	}
+}
+
+func TestSLAACLease(t *testing.T) {
+	router := net.ParseIP("fe80::1")
+	ra, err := ParseRouterAdvertisement(routerAdvertisement(0, 1800,
+		prefixOption("2001:db8:1::/64", 0xc0, 86400, 14400),
+		// Not for autoconfiguration.
+		prefixOption("2001:db8:2::/64", 0x80, 86400, 14400),
+		// Not /64.
+		prefixOption("2001:db8:3::/48", 0xc0, 86400, 14400),
+		// Autonomous, but not on-link, and never expires.
+		prefixOption("2001:db8:4::/64", 0x40, 0xffffffff, 0xffffffff),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra.Router = router
+	l := NewSLAACLease(testLink(), ra, nil)
+
+	addrs := l.Addrs()
+	if len(addrs) != 2 {
+		t.Fatalf("Addrs() = %v, want 2 addresses", addrs)
+	}
+	for i, want := range []struct {
+		ipnet            string
+		valid, preferred int
+	}{
+		{ipnet: "2001:db8:1::ff:fe00:1/64", valid: 86400, preferred: 14400},
+		{ipnet: "2001:db8:4::ff:fe00:1/128"},
+	} {
+		a := addrs[i]
+		if a.IPNet.String() != want.ipnet || a.ValidLft != want.valid || a.PreferedLft != want.preferred || a.Flags&unix.IFA_F_OPTIMISTIC == 0 {
+			t.Errorf("Addrs()[%d] = %s valid %d preferred %d, want %s valid %d preferred %d",
+				i, a.IPNet, a.ValidLft, a.PreferedLft, want.ipnet, want.valid, want.preferred)
+		}
+	}
+
+	r := l.DefaultRoute()
+	if r == nil || !r.Gw.Equal(router) || r.LinkIndex != 1 || r.Dst != nil {
+		t.Errorf("DefaultRoute() = %v, want default route via %s on eth0", r, router)
+	}
+	if l.WantsDHCPv6() {
+		t.Errorf("WantsDHCPv6() = true, want false without M and O flags")
+	}
+
+	ra.RouterLifetime = 0
+	if r := l.DefaultRoute(); r != nil {
+		t.Errorf("DefaultRoute() for a non-default router = %v, want nil", r)
+	}
+	ra.Managed = true
+	if !l.WantsDHCPv6() {
+		t.Errorf("WantsDHCPv6() = false, want true with M flag")
+	}
+}
+
+func TestSLAACAddressStablePrivacy(t *testing.T) {
+	_, p1, _ := net.ParseCIDR("2001:db8:1::/64")
+	_, p2, _ := net.ParseCIDR("2001:db8:2::/64")
+	secret := []byte("secret")
+
+	a1, err := SLAACAddress(p1, testLink(), secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := SLAACAddress(p1, testLink(), secret)
+	a2, _ := SLAACAddress(p2, testLink(), secret)
+	other, _ := SLAACAddress(p1, testLink(), []byte("other secret"))
+	eui, _ := SLAACAddress(p1, testLink(), nil)
+
+	if !p1.Contains(a1) || !p2.Contains(a2) {
+		t.Errorf("SLAACAddress() = %s, %s, want addresses in %s, %s", a1, a2, p1, p2)
+	}
+	if !a1.Equal(again) {
+		t.Errorf("SLAACAddress() = %s, then %s, want a stable address", a1, again)
+	}
+	if bytes.Equal(a1[8:], a2[8:]) || a1.Equal(other) || a1.Equal(eui) {
+		t.Errorf("SLAACAddress() interface IDs are not opaque: %s, %s, %s, %s", a1, a2, other, eui)
+	}
+
+	_, p48, _ := net.ParseCIDR("2001:db8::/48")
+	if _, err := SLAACAddress(p48, testLink(), nil); err == nil {
+		t.Errorf("SLAACAddress(%s) = nil, want error", p48)
+	}
+}
+
+func TestRouterSolicitation(t *testing.T) {
+	want := []byte{
+		icmpRouterSolicitation, 0, 0, 0, 0, 0, 0, 0,
+		ndOptSourceLinkAddr, 1, 0x02, 0x00, 0x00, 0x00, 0x00, 0x01,
+	}
+	if got := routerSolicitation(testHWAddr); !bytes.Equal(got, want) {
+		t.Errorf("routerSolicitation() = %x, want %x", got, want)
+	}
+}
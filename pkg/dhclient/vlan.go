@@ -0,0 +1,79 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Valid 802.1Q VLAN IDs. IDs 0 and 4095 are reserved.
+const (
+	minVLANID = 1
+	maxVLANID = 4094
+)
+
+// Netlink operations on VLAN links. Tests override them.
+var (
+	linkAdd    = netlink.LinkAdd
+	linkDel    = netlink.LinkDel
+	linkByName = netlink.LinkByName
+	linkSetUp  = netlink.LinkSetUp
+)
+
+// vlanName returns the name of the VLAN id subinterface of link, e.g.
+// eth0.100.
+func vlanName(link netlink.Link, id int) string {
+	return fmt.Sprintf("%s.%d", link.Attrs().Name, id)
+}
+
+// CreateVLAN creates the 802.1Q VLAN subinterface id of link, named like
+// eth0.100, and brings it up. If it already exists, it is reused.
+func CreateVLAN(link netlink.Link, id int) (netlink.Link, error) {
+	vlan, _, err := createVLAN(link, id)
+	return vlan, err
+}
+
+// createVLAN is CreateVLAN, and also returns whether the subinterface was
+// created, i.e. whether it should be deleted when no longer needed.
+func createVLAN(link netlink.Link, id int) (netlink.Link, bool, error) {
+	if id < minVLANID || id > maxVLANID {
+		return nil, false, fmt.Errorf("invalid VLAN ID %d, must be in [%d, %d]", id, minVLANID, maxVLANID)
+	}
+
+	name := vlanName(link, id)
+	vlan := &netlink.Vlan{
+		LinkAttrs: netlink.LinkAttrs{
+			Name:        name,
+			ParentIndex: link.Attrs().Index,
+		},
+		VlanId: id,
+	}
+	created := true
+	if err := linkAdd(vlan); errors.Is(err, unix.EEXIST) {
+		created = false
+		existing, err := linkByName(name)
+		if err != nil {
+			return nil, false, fmt.Errorf("cannot get existing VLAN interface %s: %v", name, err)
+		}
+		if v, ok := existing.(*netlink.Vlan); !ok || v.VlanId != id || v.ParentIndex != link.Attrs().Index {
+			return nil, false, fmt.Errorf("interface %s exists and is not VLAN %d of %s", name, id, link.Attrs().Name)
+		}
+		vlan = existing.(*netlink.Vlan)
+	} else if err != nil {
+		return nil, false, fmt.Errorf("cannot add VLAN interface %s: %v", name, err)
+	}
+
+	if err := linkSetUp(vlan); err != nil {
+		if created {
+			linkDel(vlan)
+		}
+		return nil, false, fmt.Errorf("cannot bring up VLAN interface %s: %v", name, err)
+	}
+	return vlan, created, nil
+}
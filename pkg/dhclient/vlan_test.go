@@ -0,0 +1,122 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dhclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// fakeNetlink records VLAN link operations.
+type fakeNetlink struct {
+	links   map[string]netlink.Link
+	added   []*netlink.Vlan
+	up      []string
+	deleted []string
+	upErr   error
+}
+
+func withFakeNetlink(t *testing.T, f *fakeNetlink) {
+	oldAdd, oldDel, oldByName, oldSetUp := linkAdd, linkDel, linkByName, linkSetUp
+	t.Cleanup(func() {
+		linkAdd, linkDel, linkByName, linkSetUp = oldAdd, oldDel, oldByName, oldSetUp
+	})
+	linkAdd = func(l netlink.Link) error {
+		if _, ok := f.links[l.Attrs().Name]; ok {
+			return unix.EEXIST
+		}
+		f.added = append(f.added, l.(*netlink.Vlan))
+		return nil
+	}
+	linkDel = func(l netlink.Link) error {
+		f.deleted = append(f.deleted, l.Attrs().Name)
+		return nil
+	}
+	linkByName = func(name string) (netlink.Link, error) {
+		if l, ok := f.links[name]; ok {
+			return l, nil
+		}
+		return nil, errors.New("no such link")
+	}
+	linkSetUp = func(l netlink.Link) error {
+		f.up = append(f.up, l.Attrs().Name)
+		return f.upErr
+	}
+}
+
+func TestCreateVLAN(t *testing.T) {
+	f := &fakeNetlink{}
+	withFakeNetlink(t, f)
+
+	vlan, err := CreateVLAN(testLink(), 100)
+	if err != nil {
+		t.Fatalf("CreateVLAN(eth0, 100) = %v", err)
+	}
+	if len(f.added) != 1 {
+		t.Fatalf("CreateVLAN() added %d links, want 1", len(f.added))
+	}
+	if got := f.added[0]; got.Name != "eth0.100" || got.ParentIndex != 1 || got.VlanId != 100 {
+		t.Errorf("CreateVLAN() added %s with parent %d and VLAN ID %d, want eth0.100 with parent 1 and VLAN ID 100",
+			got.Name, got.ParentIndex, got.VlanId)
+	}
+	if vlan.Attrs().Name != "eth0.100" || len(f.up) != 1 || f.up[0] != "eth0.100" {
+		t.Errorf("CreateVLAN() = %s, brought up %v, want eth0.100 up", vlan.Attrs().Name, f.up)
+	}
+}
+
+func TestCreateVLANExisting(t *testing.T) {
+	existing := &netlink.Vlan{
+		LinkAttrs: netlink.LinkAttrs{Name: "eth0.100", Index: 7, ParentIndex: 1},
+		VlanId:    100,
+	}
+	f := &fakeNetlink{links: map[string]netlink.Link{"eth0.100": existing}}
+	withFakeNetlink(t, f)
+
+	vlan, created, err := createVLAN(testLink(), 100)
+	if err != nil {
+		t.Fatalf("createVLAN(eth0, 100) = %v", err)
+	}
+	if vlan != existing || created {
+		t.Errorf("createVLAN(eth0, 100) = %v, created %t, want existing link", vlan, created)
+	}
+
+	if _, err := CreateVLAN(testLink(), 200); err != nil {
+		t.Fatalf("CreateVLAN(eth0, 200) = %v", err)
+	}
+
+	f.links["eth0.300"] = &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "eth0.300"}}
+	if _, err := CreateVLAN(testLink(), 300); err == nil {
+		t.Errorf("CreateVLAN(eth0, 300) over a dummy link = nil, want error")
+	}
+}
+
+func TestCreateVLANInvalidID(t *testing.T) {
+	f := &fakeNetlink{}
+	withFakeNetlink(t, f)
+
+	for _, id := range []int{-1, 0, 4095, 5000} {
+		if _, err := CreateVLAN(testLink(), id); err == nil {
+			t.Errorf("CreateVLAN(eth0, %d) = nil, want error", id)
+		}
+	}
+	if len(f.added) != 0 {
+		t.Errorf("added %d links for invalid IDs, want 0", len(f.added))
+	}
+}
+
+func TestCreateVLANCleanup(t *testing.T) {
+	f := &fakeNetlink{upErr: errors.New("link is broken")}
+	withFakeNetlink(t, f)
+
+	if _, err := CreateVLAN(testLink(), 100); err == nil {
+		t.Fatalf("CreateVLAN() = nil, want error")
+	}
+	if len(f.deleted) != 1 || f.deleted[0] != "eth0.100" {
+		t.Errorf("deleted %v, want [eth0.100]", f.deleted)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoRSDP is returned by FindRSDP if there is no valid ACPI RSDP in the
+// BIOS areas.
+var ErrNoRSDP = errors.New("no ACPI RSDP found")
+
+const rsdpSignature = "RSD PTR "
+
+// The RSDP is on a 16-byte boundary in the first KiB of the EBDA, or in the
+// BIOS read-only area. See ACPI 6.4 Section 5.2.5.1.
+const (
+	ebdaSegmentAddr = 0x40e
+	ebdaSearchLen   = 1024
+	biosAreaStart   = 0xe0000
+	biosAreaEnd     = 0x100000
+)
+
+// Sizes of the checksummed parts of the ACPI 1.0 and 2.0+ RSDPs, and of
+// the header of a system description table.
+const (
+	rsdpV1Len      = 20
+	rsdpV2Len      = 36
+	tableHeaderLen = 36
+)
+
+// maxTableLen bounds the length of a table read by ReadTable, in case its
+// address is wrong.
+const maxTableLen = 16 << 20
+
+// checksum returns the 8-bit sum of b, which is 0 for valid ACPI
+// structures.
+func checksum(b []byte) uint8 {
+	var sum uint8
+	for _, c := range b {
+		sum += c
+	}
+	return sum
+}
+
+// validRSDP returns whether b starts with an RSDP with valid checksums.
+func validRSDP(b []byte) bool {
+	if len(b) < rsdpV1Len || string(b[:len(rsdpSignature)]) != rsdpSignature || checksum(b[:rsdpV1Len]) != 0 {
+		return false
+	}
+	// Revision 2 and up add the XSDT address, with an extended checksum
+	// over the whole structure.
+	if b[15] >= 2 {
+		return len(b) >= rsdpV2Len && checksum(b[:rsdpV2Len]) == 0
+	}
+	return true
+}
+
+// findRSDP returns the address of the first valid RSDP on a 16-byte
+// boundary in the size bytes at address start.
+func (m Memory) findRSDP(start, size int64) (int64, bool, error) {
+	area := ByteSlice(make([]byte, size))
+	if err := m.ReadAt(start, &area); err != nil {
+		return 0, false, err
+	}
+	for off := int64(0); off+rsdpV1Len <= size; off += 16 {
+		if validRSDP(area[off:]) {
+			return start + off, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// FindRSDP returns the physical address of the ACPI RSDP, found by
+// scanning the EBDA and the BIOS area at 0xe0000 for the "RSD PTR "
+// signature. Candidates with a bad checksum are skipped.
+func (m *MMap) FindRSDP() (int64, error) {
+	return Memory{m}.FindRSDP()
+}
+
+// FindRSDP returns the address of the ACPI RSDP. See MMap.FindRSDP.
+func (m Memory) FindRSDP() (int64, error) {
+	var segment Uint16
+	if err := m.ReadAt(ebdaSegmentAddr, &segment); err != nil {
+		return 0, fmt.Errorf("reading EBDA segment: %w", err)
+	}
+	if ebda := int64(segment) << 4; ebda != 0 {
+		addr, ok, err := m.findRSDP(ebda, ebdaSearchLen)
+		if err != nil {
+			return 0, fmt.Errorf("scanning EBDA: %w", err)
+		}
+		if ok {
+			return addr, nil
+		}
+	}
+
+	addr, ok, err := m.findRSDP(biosAreaStart, biosAreaEnd-biosAreaStart)
+	if err != nil {
+		return 0, fmt.Errorf("scanning BIOS area: %w", err)
+	}
+	if !ok {
+		return 0, ErrNoRSDP
+	}
+	return addr, nil
+}
+
+// ReadTable returns the ACPI table at physical address addr, e.g. the RSDT
+// or XSDT pointed to by the RSDP, as many bytes as its header's length.
+func (m *MMap) ReadTable(addr int64) ([]byte, error) {
+	return Memory{m}.ReadTable(addr)
+}
+
+// ReadTable returns the ACPI table at address addr. See MMap.ReadTable.
+func (m Memory) ReadTable(addr int64) ([]byte, error) {
+	var length Uint32
+	if err := m.ReadAt(addr+4, &length); err != nil {
+		return nil, fmt.Errorf("reading ACPI table length at %#x: %w", addr, err)
+	}
+	if length < tableHeaderLen || length > maxTableLen {
+		return nil, fmt.Errorf("ACPI table at %#x has invalid length %d", addr, length)
+	}
+	table := ByteSlice(make([]byte, length))
+	if err := m.ReadAt(addr, &table); err != nil {
+		return nil, fmt.Errorf("reading ACPI table at %#x: %w", addr, err)
+	}
+	return []byte(table), nil
+}
+
+// FindRSDP returns the physical address of the ACPI RSDP. See
+// MMap.FindRSDP.
+func FindRSDP() (int64, error) {
+	return Memory{DevMemBackend{}}.FindRSDP()
+}
+
+// ReadTable returns the ACPI table at physical address addr. See
+// MMap.ReadTable.
+func ReadTable(addr int64) ([]byte, error) {
+	return Memory{DevMemBackend{}}.ReadTable(addr)
+}
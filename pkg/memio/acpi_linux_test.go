@@ -0,0 +1,148 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// fakeRSDP returns an RSDP of the given revision pointing at table.
+func fakeRSDP(revision byte, table uint32) []byte {
+	b := make([]byte, rsdpV2Len)
+	copy(b, rsdpSignature)
+	copy(b[9:15], "UROOT ")
+	b[15] = revision
+	binary.LittleEndian.PutUint32(b[16:20], table)
+	b[8] = -checksum(b[:rsdpV1Len])
+	if revision >= 2 {
+		binary.LittleEndian.PutUint32(b[20:24], rsdpV2Len)
+		binary.LittleEndian.PutUint64(b[24:32], uint64(table))
+		b[32] = -checksum(b[:rsdpV2Len])
+	}
+	return b
+}
+
+// fakeTable returns an ACPI table with the given signature and length.
+func fakeTable(sig string, length int) []byte {
+	b := make([]byte, length)
+	copy(b, sig)
+	binary.LittleEndian.PutUint32(b[4:8], uint32(length))
+	for i := tableHeaderLen; i < length; i++ {
+		b[i] = byte(i)
+	}
+	b[9] = -checksum(b)
+	return b
+}
+
+// fakeMem returns a file standing in for the first MiB of physical memory,
+// with data written at the given addresses.
+func fakeMem(t *testing.T, data map[int64][]byte) string {
+	mem := make([]byte, biosAreaEnd)
+	for addr, b := range data {
+		copy(mem[addr:], b)
+	}
+	path := t.TempDir() + "/mem"
+	if err := os.WriteFile(path, mem, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func withMem(t *testing.T, path string) {
+	old := memPath
+	t.Cleanup(func() { memPath = old })
+	memPath = path
+}
+
+func TestFindRSDP(t *testing.T) {
+	badRSDP := fakeRSDP(2, 0x2000)
+	badRSDP[32]++
+
+	for _, tt := range []struct {
+		name    string
+		mem     map[int64][]byte
+		want    int64
+		wantErr error
+	}{
+		{
+			name: "BIOS area",
+			mem:  map[int64][]byte{0xe0010: fakeRSDP(0, 0x2000)},
+			want: 0xe0010,
+		},
+		{
+			name: "EBDA first",
+			mem: map[int64][]byte{
+				ebdaSegmentAddr: {0xc0, 0x9f},
+				0x9fc40:         fakeRSDP(2, 0x2000),
+				0xf0000:         fakeRSDP(0, 0x2000),
+			},
+			want: 0x9fc40,
+		},
+		{
+			name: "bad checksum skipped",
+			mem: map[int64][]byte{
+				0xe0000: badRSDP,
+				0xf5a40: fakeRSDP(2, 0x2000),
+			},
+			want: 0xf5a40,
+		},
+		{
+			name:    "unaligned signature ignored",
+			mem:     map[int64][]byte{0xe0008: fakeRSDP(0, 0x2000)},
+			wantErr: ErrNoRSDP,
+		},
+		{
+			name:    "none",
+			wantErr: ErrNoRSDP,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withMem(t, fakeMem(t, tt.mem))
+			got, err := FindRSDP()
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("FindRSDP() = %#x, %v, want %#x, %v", got, err, tt.want, tt.wantErr)
+			}
+
+			mem := make(SliceBackend, biosAreaEnd)
+			for addr, b := range tt.mem {
+				copy(mem[addr:], b)
+			}
+			got, err = Memory{mem}.FindRSDP()
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Memory.FindRSDP() = %#x, %v, want %#x, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadTable(t *testing.T) {
+	xsdt := fakeTable("XSDT", 52)
+	withMem(t, fakeMem(t, map[int64][]byte{
+		0xe0000: fakeRSDP(2, 0x2000),
+		0x2000:  xsdt,
+		0x3000:  fakeTable("FACP", 20),
+	}))
+
+	got, err := ReadTable(0x2000)
+	if err != nil {
+		t.Fatalf("ReadTable(0x2000) = %v", err)
+	}
+	if !bytes.Equal(got, xsdt) {
+		t.Errorf("ReadTable(0x2000) = %x, want %x", got, xsdt)
+	}
+
+	// The length is below the header's.
+	if _, err := ReadTable(0x3000); err == nil {
+		t.Errorf("ReadTable(0x3000) = nil, want error for a short table")
+	}
+	// There is no table, so the length is 0.
+	if _, err := ReadTable(0x4000); err == nil {
+		t.Errorf("ReadTable(0x4000) = nil, want error for no table")
+	}
+}
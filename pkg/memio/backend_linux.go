@@ -0,0 +1,262 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// Backend is physical memory as accessed by Memory, or a stand-in for it,
+// e.g. a SliceBackend in tests. MMap is a Backend.
+type Backend interface {
+	ReadAt(addr int64, data UintN) error
+	WriteAt(addr int64, data UintN) error
+	io.Closer
+}
+
+var (
+	_ Backend = &MMap{}
+	_ Backend = DevMemBackend{}
+	_ Backend = SliceBackend{}
+)
+
+// DevMemBackend is the default Backend. It maps /dev/mem for each access,
+// so it holds no resources between them.
+type DevMemBackend struct{}
+
+// ReadAt implements Backend.ReadAt.
+func (DevMemBackend) ReadAt(addr int64, data UintN) error {
+	mmap, err := NewMMap(memPath)
+	if err != nil {
+		return fmt.Errorf("reading %#x/%d: %w", addr, width(data), err)
+	}
+	defer mmap.Close()
+	return mmap.ReadAt(addr, data)
+}
+
+// WriteAt implements Backend.WriteAt.
+func (DevMemBackend) WriteAt(addr int64, data UintN) error {
+	mmap, err := NewMMap(memPath)
+	if err != nil {
+		return fmt.Errorf("writing %#x/%d: %w", addr, width(data), err)
+	}
+	defer mmap.Close()
+	return mmap.WriteAt(addr, data)
+}
+
+// Close implements Backend.Close. It does nothing.
+func (DevMemBackend) Close() error {
+	return nil
+}
+
+// SliceBackend is a Backend whose physical memory is the slice, starting at
+// address 0, e.g. to test tools that access memory without /dev/mem.
+type SliceBackend []byte
+
+// at returns a pointer to the size bytes at address addr, or an error if
+// they are not all in s.
+func (s SliceBackend) at(addr int64, size int64) (unsafe.Pointer, error) {
+	if err := checkRange(addr, size); err != nil {
+		return nil, err
+	}
+	if addr+size > int64(len(s)) {
+		return nil, fmt.Errorf("range %#x/%d is outside of memory of size %#x", addr, size, len(s))
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	return unsafe.Pointer(&s[addr]), nil
+}
+
+// ReadAt implements Backend.ReadAt.
+func (s SliceBackend) ReadAt(addr int64, data UintN) error {
+	p, err := s.at(addr, data.Size())
+	if err != nil {
+		return fmt.Errorf("reading %#x/%d: %w", addr, data.Size(), err)
+	}
+	if p == nil {
+		return nil
+	}
+	return data.read(p)
+}
+
+// WriteAt implements Backend.WriteAt.
+func (s SliceBackend) WriteAt(addr int64, data UintN) error {
+	p, err := s.at(addr, data.Size())
+	if err != nil {
+		return fmt.Errorf("writing %#x/%d: %w", addr, data.Size(), err)
+	}
+	if p == nil {
+		return nil
+	}
+	return data.write(p)
+}
+
+// Close implements Backend.Close. It does nothing.
+func (SliceBackend) Close() error {
+	return nil
+}
+
+// Memory is physical memory accessed through a Backend, e.g. a SliceBackend
+// in tests. The package-level functions access /dev/mem.
+//
+// Memory maps whole regions at once if its Backend is an *MMap or
+// DevMemBackend, and otherwise accesses the Backend one chunk at a time.
+type Memory struct {
+	Backend
+}
+
+// mmap returns the MMap the Backend maps, and a function releasing it, or
+// nil if the Backend is not mapped.
+func (m Memory) mmap() (*MMap, func() error, error) {
+	switch b := m.Backend.(type) {
+	case *MMap:
+		return b, func() error { return nil }, nil
+	case DevMemBackend:
+		mmap, err := NewMMap(memPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return mmap, mmap.Close, nil
+	}
+	return nil, nil, nil
+}
+
+// Fill sets the length bytes at address addr to value. See MMap.Fill.
+func (m Memory) Fill(addr int64, value byte, length int) error {
+	mmap, release, err := m.mmap()
+	if err != nil {
+		return err
+	}
+	if mmap != nil {
+		defer release()
+		return mmap.Fill(addr, value, length)
+	}
+
+	if err := checkRange(addr, int64(length)); err != nil {
+		return fmt.Errorf("filling: %w", err)
+	}
+	buf := bytes.Repeat([]byte{value}, int(chunk(0, int64(length))))
+	for done := int64(0); done < int64(length); {
+		a := addr + done
+		b := ByteSlice(buf[:chunk(a, int64(length)-done)])
+		if err := m.WriteAt(a, &b); err != nil {
+			return fmt.Errorf("filling: %w", err)
+		}
+		done += b.Size()
+	}
+	return nil
+}
+
+// FillUint32 writes value to the count consecutive 32-bit words at address
+// addr. See MMap.FillUint32.
+func (m Memory) FillUint32(addr int64, value Uint32, count int) error {
+	mmap, release, err := m.mmap()
+	if err != nil {
+		return err
+	}
+	if mmap != nil {
+		defer release()
+		return mmap.FillUint32(addr, value, count)
+	}
+
+	if count < 0 || int64(count) > math.MaxInt64/value.Size() {
+		return fmt.Errorf("filling: invalid count %d", count)
+	}
+	if err := checkRange(addr, int64(count)*value.Size()); err != nil {
+		return fmt.Errorf("filling: %w", err)
+	}
+	for i := int64(0); i < int64(count); i++ {
+		if err := m.WriteAt(addr+i*value.Size(), &value); err != nil {
+			return fmt.Errorf("filling: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadTo copies the length bytes at address addr to w. See MMap.ReadTo.
+func (m Memory) ReadTo(w io.Writer, addr int64, length int) (int64, error) {
+	return m.ReadToContext(context.Background(), w, addr, length)
+}
+
+// ReadToContext copies the length bytes at address addr to w until ctx is
+// done. See MMap.ReadToContext.
+func (m Memory) ReadToContext(ctx context.Context, w io.Writer, addr int64, length int) (int64, error) {
+	mmap, release, err := m.mmap()
+	if err != nil {
+		return 0, err
+	}
+	if mmap != nil {
+		defer release()
+		return mmap.ReadToContext(ctx, w, addr, length)
+	}
+
+	if err := checkRange(addr, int64(length)); err != nil {
+		return 0, fmt.Errorf("reading: %w", err)
+	}
+	buf := make([]byte, chunk(0, int64(length)))
+	var written int64
+	for written < int64(length) {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		a := addr + written
+		b := ByteSlice(buf[:chunk(a, int64(length)-written)])
+		if err := m.ReadAt(a, &b); err != nil {
+			return written, err
+		}
+		nw, err := w.Write(b)
+		written += int64(nw)
+		if err != nil {
+			return written, err
+		}
+		if nw != len(b) {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// WriteFrom copies r to memory at address addr until r returns io.EOF. See
+// MMap.WriteFrom.
+func (m Memory) WriteFrom(r io.Reader, addr int64) (int64, error) {
+	mmap, release, err := m.mmap()
+	if err != nil {
+		return 0, err
+	}
+	if mmap != nil {
+		defer release()
+		return mmap.WriteFrom(r, addr)
+	}
+
+	if addr < 0 {
+		return 0, fmt.Errorf("writing: invalid address %#x", addr)
+	}
+	buf := make([]byte, chunkSize)
+	var written int64
+	for {
+		a := addr + written
+		nr, rerr := io.ReadFull(r, buf[:chunk(a, chunkSize)])
+		if nr > 0 {
+			b := ByteSlice(buf[:nr])
+			if err := m.WriteAt(a, &b); err != nil {
+				return written, err
+			}
+			written += int64(nr)
+		}
+		switch rerr {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return written, nil
+		default:
+			return written, rerr
+		}
+	}
+}
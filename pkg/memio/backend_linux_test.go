@@ -0,0 +1,128 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memio
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSliceBackend(t *testing.T) {
+	mem := make(SliceBackend, 0x100)
+
+	for _, tt := range []struct {
+		name                string
+		addr                int64
+		writeData, readData UintN
+	}{
+		{
+			name:      "uint8",
+			addr:      0x10,
+			writeData: &[]Uint8{0x12}[0],
+			readData:  new(Uint8),
+		},
+		{
+			name:      "uint16",
+			addr:      0x20,
+			writeData: &[]Uint16{0x1234}[0],
+			readData:  new(Uint16),
+		},
+		{
+			name:      "uint32",
+			addr:      0x30,
+			writeData: &[]Uint32{0x12345678}[0],
+			readData:  new(Uint32),
+		},
+		{
+			name:      "uint64",
+			addr:      0x40,
+			writeData: &[]Uint64{0x1234567890abcdef}[0],
+			readData:  new(Uint64),
+		},
+		{
+			name:      "byte slice",
+			addr:      0xfb,
+			writeData: &[]ByteSlice{[]byte("Hello")}[0],
+			readData:  &[]ByteSlice{make([]byte, 5)}[0],
+		},
+		{
+			name:      "empty byte slice",
+			addr:      0x100,
+			writeData: &[]ByteSlice{nil}[0],
+			readData:  &[]ByteSlice{nil}[0],
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := mem.WriteAt(tt.addr, tt.writeData); err != nil {
+				t.Fatalf("WriteAt(%#x, %v) = %v", tt.addr, tt.writeData, err)
+			}
+			if err := mem.ReadAt(tt.addr, tt.readData); err != nil {
+				t.Fatalf("ReadAt(%#x) = %v", tt.addr, err)
+			}
+			if !reflect.DeepEqual(tt.readData, tt.writeData) {
+				t.Errorf("ReadAt(%#x) = %v, want %v", tt.addr, tt.readData, tt.writeData)
+			}
+		})
+	}
+
+	if got := mem[0x30:0x34]; !bytes.Equal(got, []byte{0x78, 0x56, 0x34, 0x12}) && !bytes.Equal(got, []byte{0x12, 0x34, 0x56, 0x78}) {
+		t.Errorf("memory at 0x30 = %x, want the bytes of 0x12345678", got)
+	}
+}
+
+func TestSliceBackendOutOfRange(t *testing.T) {
+	mem := make(SliceBackend, 0x100)
+
+	for _, addr := range []int64{-1, 0xfd, 0x100} {
+		data := Uint32(0xdeadbeef)
+		if err := mem.WriteAt(addr, &data); err == nil || !strings.Contains(err.Error(), "writing") {
+			t.Errorf("WriteAt(%#x, %v) = %v, want a write error", addr, &data, err)
+		}
+		if err := mem.ReadAt(addr, &data); err == nil || !strings.Contains(err.Error(), "reading") {
+			t.Errorf("ReadAt(%#x) = %v, want a read error", addr, err)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	defer func(old int64) { chunkSize = old }(chunkSize)
+	chunkSize = 0x10
+	mem := make(SliceBackend, 0x100)
+	m := Memory{mem}
+
+	if err := m.Fill(0x8, 0xaa, 0x20); err != nil {
+		t.Fatalf("Fill() = %v", err)
+	}
+	if err := m.FillUint32(0x40, 0x12345678, 3); err != nil {
+		t.Fatalf("FillUint32() = %v", err)
+	}
+	want := strings.Repeat("u-root", 10)
+	if n, err := m.WriteFrom(strings.NewReader(want), 0x80); err != nil || n != int64(len(want)) {
+		t.Fatalf("WriteFrom() = %d, %v, want %d, nil", n, err, len(want))
+	}
+
+	if got := mem[0x8:0x28]; !bytes.Equal(got, bytes.Repeat([]byte{0xaa}, 0x20)) || mem[0x7] != 0 || mem[0x28] != 0 {
+		t.Errorf("Fill() filled %x", mem[:0x30])
+	}
+	for i := int64(0); i < 3; i++ {
+		var v Uint32
+		if err := mem.ReadAt(0x40+4*i, &v); err != nil || v != 0x12345678 {
+			t.Errorf("word %d = %#x, %v, want 0x12345678", i, v, err)
+		}
+	}
+	var b bytes.Buffer
+	if n, err := m.ReadTo(&b, 0x80, len(want)); err != nil || n != int64(len(want)) || b.String() != want {
+		t.Errorf("ReadTo() = %d, %q, %v, want %d, %q, nil", n, b.String(), err, len(want), want)
+	}
+
+	if err := m.Fill(0xf0, 0, 0x20); err == nil {
+		t.Errorf("Fill() beyond the end of memory succeeded, want error")
+	}
+	if _, err := m.ReadTo(&b, 0xf0, 0x20); err == nil {
+		t.Errorf("ReadTo() beyond the end of memory succeeded, want error")
+	}
+}
@@ -5,19 +5,29 @@
 package memio
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"syscall"
 	"unsafe"
+
+	"golang.org/x/sys/unix"
 )
 
 var memPath = "/dev/mem"
 
 var pageSize = int64(syscall.Getpagesize())
 
+// chunkSize is the size of the page-aligned chunks mapped by ReadTo and
+// WriteFrom.
+var chunkSize = 256 * pageSize
+
 type syscalls interface {
 	Mmap(int, int64, int, int, int) ([]byte, error)
 	Munmap([]byte) error
+	Msync([]byte, int) error
 }
 
 type calls struct{}
@@ -30,6 +40,10 @@ func (c *calls) Munmap(mem []byte) error {
 	return syscall.Munmap(mem)
 }
 
+func (c *calls) Msync(mem []byte, flags int) error {
+	return unix.Msync(mem, flags)
+}
+
 // MMap is a struct containing an os.File and an interface to system calls to manage mapped files.
 type MMap struct {
 	*os.File
@@ -42,6 +56,9 @@ func (m *MMap) mmap(f *os.File, addr int64, size int64, prot int) (mem []byte, o
 	offset = addr - page
 	mapSize := offset + size
 	mem, err = m.Mmap(int(f.Fd()), int64(page), int(mapSize), prot, syscall.MAP_SHARED)
+	if err != nil {
+		err = fmt.Errorf("mmap %s at offset %#x len %d: %w", f.Name(), addr, size, err)
+	}
 	return
 }
 
@@ -50,14 +67,14 @@ func (m *MMap) mmap(f *os.File, addr int64, size int64, prot int) (mem []byte, o
 func (m *MMap) ReadAt(addr int64, data UintN) error {
 	mem, offset, err := m.mmap(m.File, addr, data.Size(), syscall.PROT_READ)
 	if err != nil {
-		return fmt.Errorf("reading %#x/%d: %v", addr, data.Size(), err)
+		return fmt.Errorf("reading %#x/%d: %w", addr, data.Size(), err)
 	}
 	defer m.Munmap(mem)
 
 	// MMIO makes this a bit tricky. Reads must be conducted in one load
 	// operation. Review the generated assembly to make sure.
 	if err := data.read(unsafe.Pointer(&mem[offset])); err != nil {
-		return fmt.Errorf("reading %#x/%d: %v", addr, data.Size(), err)
+		return fmt.Errorf("reading %#x/%d: %w", addr, data.Size(), err)
 	}
 	return nil
 }
@@ -67,13 +84,174 @@ func (m *MMap) ReadAt(addr int64, data UintN) error {
 func (m *MMap) WriteAt(addr int64, data UintN) error {
 	mem, offset, err := m.mmap(m.File, addr, data.Size(), syscall.PROT_WRITE)
 	if err != nil {
-		return err
+		return fmt.Errorf("writing %#x/%d: %w", addr, data.Size(), err)
 	}
 	defer m.Munmap(mem)
 
 	// MMIO makes this a bit tricky. Writes must be conducted in one store
 	// operation. Review the generated assembly to make sure.
-	return data.write(unsafe.Pointer(&mem[offset]))
+	if err := data.write(unsafe.Pointer(&mem[offset])); err != nil {
+		return fmt.Errorf("writing %#x/%d: %w", addr, data.Size(), err)
+	}
+	return nil
+}
+
+// checkRange returns an error unless the size bytes at address addr are a
+// valid range.
+func checkRange(addr int64, size int64) error {
+	if addr < 0 || size < 0 {
+		return fmt.Errorf("invalid range %#x/%d", addr, size)
+	}
+	if addr > math.MaxInt64-size {
+		return fmt.Errorf("range %#x/%d overflows", addr, size)
+	}
+	return nil
+}
+
+// Fill sets the length bytes at address addr to value, e.g. to clear a
+// framebuffer. The region is mapped once.
+func (m *MMap) Fill(addr int64, value byte, length int) error {
+	if err := checkRange(addr, int64(length)); err != nil {
+		return fmt.Errorf("filling: %w", err)
+	}
+	if length == 0 {
+		return nil
+	}
+	mem, offset, err := m.mmap(m.File, addr, int64(length), syscall.PROT_WRITE)
+	if err != nil {
+		return fmt.Errorf("filling %#x/%d: %w", addr, length, err)
+	}
+	defer m.Munmap(mem)
+
+	b := mem[offset : offset+int64(length)]
+	for i := range b {
+		b[i] = value
+	}
+	return nil
+}
+
+// FillUint32 writes value to the count consecutive 32-bit words at address
+// addr, with one store per word. The region is mapped once.
+func (m *MMap) FillUint32(addr int64, value Uint32, count int) error {
+	if count < 0 || int64(count) > math.MaxInt64/value.Size() {
+		return fmt.Errorf("filling: invalid count %d", count)
+	}
+	size := int64(count) * value.Size()
+	if err := checkRange(addr, size); err != nil {
+		return fmt.Errorf("filling: %w", err)
+	}
+	if count == 0 {
+		return nil
+	}
+	mem, offset, err := m.mmap(m.File, addr, size, syscall.PROT_WRITE)
+	if err != nil {
+		return fmt.Errorf("filling %#x/%d: %w", addr, size, err)
+	}
+	defer m.Munmap(mem)
+
+	for i := int64(0); i < size; i += value.Size() {
+		if err := value.write(unsafe.Pointer(&mem[offset+i])); err != nil {
+			return fmt.Errorf("filling %#x/%d: %w", addr+i, value.Size(), err)
+		}
+	}
+	return nil
+}
+
+// chunk returns the size of the chunk at address addr, which ends at the next
+// chunkSize boundary or after remaining bytes, whichever comes first.
+func chunk(addr int64, remaining int64) int64 {
+	n := chunkSize - addr%chunkSize
+	if n > remaining {
+		n = remaining
+	}
+	return n
+}
+
+// ReadTo copies the length bytes at address addr to w, mapping one
+// page-aligned chunk at a time, so that large regions can be dumped without
+// holding them in memory. It returns the number of bytes written to w.
+func (m *MMap) ReadTo(w io.Writer, addr int64, length int) (int64, error) {
+	return m.ReadToContext(context.Background(), w, addr, length)
+}
+
+// ReadToContext is like ReadTo, but stops before the next chunk once ctx is
+// done, returning the number of bytes written to w so far and ctx.Err().
+func (m *MMap) ReadToContext(ctx context.Context, w io.Writer, addr int64, length int) (int64, error) {
+	if err := checkRange(addr, int64(length)); err != nil {
+		return 0, fmt.Errorf("reading: %w", err)
+	}
+	var written int64
+	for written < int64(length) {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		a := addr + written
+		n := chunk(a, int64(length)-written)
+		mem, offset, err := m.mmap(m.File, a, n, syscall.PROT_READ)
+		if err != nil {
+			return written, fmt.Errorf("reading %#x/%d: %w", a, n, err)
+		}
+		nw, err := w.Write(mem[offset : offset+n])
+		m.Munmap(mem)
+		written += int64(nw)
+		if err != nil {
+			return written, err
+		}
+		if int64(nw) != n {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// WriteFrom copies r to the physical memory at address addr until r returns
+// io.EOF, mapping one page-aligned chunk at a time. It returns the number of
+// bytes written to memory.
+func (m *MMap) WriteFrom(r io.Reader, addr int64) (int64, error) {
+	if addr < 0 {
+		return 0, fmt.Errorf("writing: invalid address %#x", addr)
+	}
+	buf := make([]byte, chunkSize)
+	var written int64
+	for {
+		a := addr + written
+		nr, rerr := io.ReadFull(r, buf[:chunk(a, chunkSize)])
+		if nr > 0 {
+			if err := checkRange(a, int64(nr)); err != nil {
+				return written, fmt.Errorf("writing: %w", err)
+			}
+			mem, offset, err := m.mmap(m.File, a, int64(nr), syscall.PROT_WRITE)
+			if err != nil {
+				return written, fmt.Errorf("writing %#x/%d: %w", a, nr, err)
+			}
+			copy(mem[offset:], buf[:nr])
+			m.Munmap(mem)
+			written += int64(nr)
+		}
+		switch rerr {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return written, nil
+		default:
+			return written, rerr
+		}
+	}
+}
+
+// Sync flushes writes to the size bytes at address addr back to the
+// underlying file using msync. This matters when the MMap is backed by a
+// regular file or persistent memory; for volatile MMIO it has no effect.
+func (m *MMap) Sync(addr int64, size int64) error {
+	mem, _, err := m.mmap(m.File, addr, size, syscall.PROT_READ|syscall.PROT_WRITE)
+	if err != nil {
+		return fmt.Errorf("syncing %#x/%d: %w", addr, size, err)
+	}
+	defer m.Munmap(mem)
+
+	if err := m.Msync(mem, unix.MS_SYNC); err != nil {
+		return fmt.Errorf("syncing %#x/%d: %w", addr, size, err)
+	}
+	return nil
 }
 
 // Close implements Close.
@@ -93,24 +271,56 @@ func NewMMap(path string) (*MMap, error) {
 	}, nil
 }
 
+// width returns the size of data for error messages, or 0 if there is none.
+func width(data UintN) int64 {
+	if data == nil {
+		return 0
+	}
+	return data.Size()
+}
+
 // Read is deprecated. Still here for compatibility.
 // Use NewMMap() and the interface function instead.
+//
+// Read reads from /dev/mem. Use a Backend to read from other memory.
 func Read(addr int64, data UintN) error {
-	mmap, err := NewMMap(memPath)
-	if err != nil {
-		return err
-	}
-	defer mmap.Close()
-	return mmap.ReadAt(addr, data)
+	return DevMemBackend{}.ReadAt(addr, data)
 }
 
 // Write is deprecated. Still here for compatibility.
 // Use NewMMap() and the interface function instead.
+//
+// Write writes to /dev/mem. Use a Backend to write to other memory.
 func Write(addr int64, data UintN) error {
-	mmap, err := NewMMap(memPath)
-	if err != nil {
-		return err
-	}
-	defer mmap.Close()
-	return mmap.WriteAt(addr, data)
+	return DevMemBackend{}.WriteAt(addr, data)
+}
+
+// Fill sets the length bytes of physical memory at address addr to value.
+// See MMap.Fill.
+func Fill(addr int64, value byte, length int) error {
+	return Memory{DevMemBackend{}}.Fill(addr, value, length)
+}
+
+// FillUint32 writes value to the count 32-bit words of physical memory at
+// address addr. See MMap.FillUint32.
+func FillUint32(addr int64, value Uint32, count int) error {
+	return Memory{DevMemBackend{}}.FillUint32(addr, value, count)
+}
+
+// ReadTo copies the length bytes of physical memory at address addr to w.
+// See MMap.ReadTo.
+func ReadTo(w io.Writer, addr int64, length int) (int64, error) {
+	return ReadToContext(context.Background(), w, addr, length)
+}
+
+// ReadToContext copies the length bytes of physical memory at address addr
+// to w until ctx is done. See MMap.ReadToContext.
+func ReadToContext(ctx context.Context, w io.Writer, addr int64, length int) (int64, error) {
+	return Memory{DevMemBackend{}}.ReadToContext(ctx, w, addr, length)
+}
+
+// WriteFrom copies r to the physical memory at address addr. See
+// MMap.WriteFrom.
+func WriteFrom(r io.Reader, addr int64) (int64, error) {
+	return Memory{DevMemBackend{}}.WriteFrom(r, addr)
 }
@@ -5,11 +5,16 @@
 package memio
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"strings"
+	"syscall"
 	"testing"
 )
 
@@ -143,9 +148,75 @@ func TestReadWriteErrorWrongPath(t *testing.T) {
 	}
 }
 
+func TestMMapSync(t *testing.T) {
+	tmpFile, err := os.CreateTemp(t.TempDir(), "io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Write(make([]byte, 10000))
+	tmpFile.Close()
+	m, err := NewMMap(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("NewMMap(%q) = %v", tmpFile.Name(), err)
+	}
+	defer m.Close()
+
+	data := ByteSlice("Hello")
+	if err := m.WriteAt(0x1ffe, &data); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Sync(0x1ffe, data.Size()); err != nil {
+		t.Fatalf("Sync(0x1ffe, %d) = %v, want nil", data.Size(), err)
+	}
+
+	b, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b[0x1ffe : 0x1ffe+len(data)]); got != "Hello" {
+		t.Errorf("file contents at 0x1ffe = %q, want %q", got, "Hello")
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	memPath = "file-does-not-exist"
+	defer func() { memPath = "/dev/mem" }()
+
+	data := Uint32(0)
+	err := Read(0x1234, &data)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Read(0x1234) = %v, want an error wrapping %v", err, os.ErrNotExist)
+	}
+	if err == nil || !strings.Contains(err.Error(), "0x1234/4") {
+		t.Errorf("Read(0x1234) = %v, want an error containing %q", err, "0x1234/4")
+	}
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	m, err := NewMMap(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("NewMMap(%q) = %v", tmpFile.Name(), err)
+	}
+	defer m.Close()
+	m.syscalls = &fakeSyscalls{errMmap: syscall.EINVAL}
+
+	err = m.WriteAt(0x5678, &data)
+	if !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("WriteAt(0x5678) = %v, want an error wrapping %v", err, syscall.EINVAL)
+	}
+	want := fmt.Sprintf("mmap %s at offset 0x5678 len 4", tmpFile.Name())
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("WriteAt(0x5678) = %v, want an error containing %q", err, want)
+	}
+}
+
 type fakeSyscalls struct {
 	errMmap   error
 	errMunMap error
+	errMsync  error
 	retBytes  []byte
 }
 
@@ -157,6 +228,10 @@ func (f *fakeSyscalls) Munmap(mem []byte) error {
 	return f.errMunMap
 }
 
+func (f *fakeSyscalls) Msync(mem []byte, flags int) error {
+	return f.errMsync
+}
+
 func TestMemIOAbstractSyscalls(t *testing.T) {
 	tmpFile, err := os.CreateTemp("", "io_test")
 	if err != nil {
@@ -199,7 +274,150 @@ func TestMemIOAbstractSyscalls(t *testing.T) {
 					t.Errorf("%q_WriteAt failed. Want: %q, Got: %q", tt.name, tt.errMmap, err)
 				}
 			})
+			t.Run(tt.name, func(t *testing.T) {
+				if err := m.Sync(0x23, tt.data.Size()); !strings.Contains(err.Error(), tt.errMmap) {
+					t.Errorf("%q_Sync failed. Want: %q, Got: %q", tt.name, tt.errMmap, err)
+				}
+			})
+		}
+	}
+
+}
+
+func TestFill(t *testing.T) {
+	tmpFile, err := os.CreateTemp(t.TempDir(), "io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Write(bytes.Repeat([]byte{0x55}, 10000))
+	tmpFile.Close()
+	memPath = tmpFile.Name()
+	defer func() { memPath = "/dev/mem" }()
+
+	// Cross a page boundary.
+	if err := Fill(0xff0, 0xaa, 0x20); err != nil {
+		t.Fatalf("Fill(0xff0, 0xaa, 0x20) = %v", err)
+	}
+	if err := FillUint32(0x1ffe, 0xdeadbeef, 3); err != nil {
+		t.Fatalf("FillUint32(0x1ffe, 0xdeadbeef, 3) = %v", err)
+	}
+
+	want := bytes.Repeat([]byte{0x55}, 10000)
+	copy(want[0xff0:], bytes.Repeat([]byte{0xaa}, 0x20))
+	word := make([]byte, 4)
+	binary.LittleEndian.PutUint32(word, 0xdeadbeef)
+	copy(want[0x1ffe:], bytes.Repeat(word, 3))
+
+	got, err := os.ReadFile(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("file contents after filling differ from the expected pattern")
+	}
+
+	for _, tt := range []struct {
+		name string
+		fill func() error
+	}{
+		{"negative length", func() error { return Fill(0x10, 0, -1) }},
+		{"negative address", func() error { return Fill(-0x10, 0, 1) }},
+		{"overflow", func() error { return Fill(math.MaxInt64-1, 0, 2) }},
+		{"negative count", func() error { return FillUint32(0x10, 0, -1) }},
+		{"count overflow", func() error { return FillUint32(0x10, 0, math.MaxInt) }},
+	} {
+		if err := tt.fill(); err == nil {
+			t.Errorf("%s: Fill = nil, want error", tt.name)
 		}
 	}
+}
+
+func TestReadToWriteFrom(t *testing.T) {
+	// Use small chunks, so that the region spans several of them.
+	defer func(c int64) { chunkSize = c }(chunkSize)
+	chunkSize = pageSize
+
+	size := 5*pageSize + 100
+	tmpFile, err := os.CreateTemp(t.TempDir(), "io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Write(make([]byte, size))
+	tmpFile.Close()
+	memPath = tmpFile.Name()
+	defer func() { memPath = "/dev/mem" }()
+
+	pattern := make([]byte, 3*pageSize+17)
+	for i := range pattern {
+		pattern[i] = byte(i * 7)
+	}
+	addr := pageSize - 10
 
+	n, err := WriteFrom(bytes.NewReader(pattern), addr)
+	if err != nil || n != int64(len(pattern)) {
+		t.Fatalf("WriteFrom(pattern, %#x) = %d, %v, want %d, nil", addr, n, err, len(pattern))
+	}
+
+	var b bytes.Buffer
+	n, err = ReadTo(&b, addr, len(pattern))
+	if err != nil || n != int64(len(pattern)) {
+		t.Fatalf("ReadTo(%#x, %d) = %d, %v, want %d, nil", addr, len(pattern), n, err, len(pattern))
+	}
+	if !bytes.Equal(b.Bytes(), pattern) {
+		t.Errorf("ReadTo returned different bytes than WriteFrom wrote")
+	}
+
+	b.Reset()
+	if n, err := ReadTo(&b, 0, 0); err != nil || n != 0 || b.Len() != 0 {
+		t.Errorf("ReadTo(0, 0) = %d, %v and %d bytes, want 0, nil and no bytes", n, err, b.Len())
+	}
+	if _, err := ReadTo(&b, 0, -1); err == nil {
+		t.Errorf("ReadTo(0, -1) = nil, want error")
+	}
+	if _, err := WriteFrom(bytes.NewReader(pattern), -1); err == nil {
+		t.Errorf("WriteFrom(pattern, -1) = nil, want error")
+	}
+}
+
+// cancelWriter cancels a context after n writes.
+type cancelWriter struct {
+	bytes.Buffer
+	n      int
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	if w.n--; w.n == 0 {
+		w.cancel()
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestReadToContext(t *testing.T) {
+	defer func(c int64) { chunkSize = c }(chunkSize)
+	chunkSize = pageSize
+
+	tmpFile, err := os.CreateTemp(t.TempDir(), "io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Write(bytes.Repeat([]byte{0x5a}, int(4*pageSize)))
+	tmpFile.Close()
+	memPath = tmpFile.Name()
+	defer func() { memPath = "/dev/mem" }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelWriter{n: 2, cancel: cancel}
+	n, err := ReadToContext(ctx, w, 0, int(4*pageSize))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadToContext() = %v, want %v", err, context.Canceled)
+	}
+	if n != 2*pageSize || int64(w.Len()) != n {
+		t.Errorf("ReadToContext() = %d bytes, wrote %d, want %d", n, w.Len(), 2*pageSize)
+	}
+
+	if n, err := ReadToContext(ctx, w, 0, 1); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadToContext() with a canceled context = %d, %v, want 0, %v", n, err, context.Canceled)
+	}
 }
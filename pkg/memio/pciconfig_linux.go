@@ -0,0 +1,87 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build (linux && amd64) || (linux && 386)
+// +build linux,amd64 linux,386
+
+package memio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// The I/O ports of PCI configuration mechanism #1. A register is selected by
+// writing its address to CONFIG_ADDRESS, and then read or written through
+// CONFIG_DATA. See the PCI Local Bus Specification 3.0, Section 3.2.2.3.2.
+const (
+	pciConfigAddressPort = 0xcf8
+	pciConfigDataPort    = 0xcfc
+)
+
+var (
+	// pciPort is used for the accesses. Tests override it.
+	pciPort PortReadWriter = &ArchPort{}
+
+	// pciMu serializes accesses, as each takes two port accesses.
+	pciMu sync.Mutex
+)
+
+// pciConfigAddress returns the CONFIG_ADDRESS value selecting the 32-bit
+// register at offset in the configuration space of the function.
+func pciConfigAddress(bus, dev, fn, offset uint8) (uint32, error) {
+	if dev > 31 {
+		return 0, fmt.Errorf("PCI device %d out of range [0, 31]", dev)
+	}
+	if fn > 7 {
+		return 0, fmt.Errorf("PCI function %d out of range [0, 7]", fn)
+	}
+	if offset%4 != 0 {
+		return 0, fmt.Errorf("PCI config register offset %#x is not 32-bit aligned", offset)
+	}
+	return 1<<31 | uint32(bus)<<16 | uint32(dev)<<11 | uint32(fn)<<8 | uint32(offset), nil
+}
+
+// PCIConfigRead reads the 32-bit register at offset in the configuration
+// space of the PCI function bus:dev.fn, using the legacy configuration
+// mechanism #1 through the 0xcf8 and 0xcfc I/O ports. Only the first 256
+// bytes of the configuration space can be accessed this way.
+func PCIConfigRead(bus, dev, fn, offset uint8) (Uint32, error) {
+	addr, err := pciConfigAddress(bus, dev, fn, offset)
+	if err != nil {
+		return 0, err
+	}
+
+	pciMu.Lock()
+	defer pciMu.Unlock()
+	a := Uint32(addr)
+	if err := pciPort.Out(pciConfigAddressPort, &a); err != nil {
+		return 0, fmt.Errorf("PCI %02x:%02x.%x: selecting register %#x: %w", bus, dev, fn, offset, err)
+	}
+	var data Uint32
+	if err := pciPort.In(pciConfigDataPort, &data); err != nil {
+		return 0, fmt.Errorf("PCI %02x:%02x.%x: reading register %#x: %w", bus, dev, fn, offset, err)
+	}
+	return data, nil
+}
+
+// PCIConfigWrite writes the 32-bit register at offset in the configuration
+// space of the PCI function bus:dev.fn. See PCIConfigRead.
+func PCIConfigWrite(bus, dev, fn, offset uint8, data Uint32) error {
+	addr, err := pciConfigAddress(bus, dev, fn, offset)
+	if err != nil {
+		return err
+	}
+
+	pciMu.Lock()
+	defer pciMu.Unlock()
+	a := Uint32(addr)
+	if err := pciPort.Out(pciConfigAddressPort, &a); err != nil {
+		return fmt.Errorf("PCI %02x:%02x.%x: selecting register %#x: %w", bus, dev, fn, offset, err)
+	}
+	if err := pciPort.Out(pciConfigDataPort, &data); err != nil {
+		return fmt.Errorf("PCI %02x:%02x.%x: writing register %#x: %w", bus, dev, fn, offset, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build (linux && amd64) || (linux && 386)
+// +build linux,amd64 linux,386
+
+package memio
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// portAccess is an access to an I/O port.
+type portAccess struct {
+	out  bool
+	addr uint16
+	data uint32
+}
+
+// fakePort records accesses to I/O ports. In returns data.
+type fakePort struct {
+	accesses []portAccess
+	data     uint32
+	err      error
+}
+
+func (p *fakePort) In(addr uint16, data UintN) error {
+	if p.err != nil {
+		return p.err
+	}
+	*data.(*Uint32) = Uint32(p.data)
+	p.accesses = append(p.accesses, portAccess{addr: addr, data: p.data})
+	return nil
+}
+
+func (p *fakePort) Out(addr uint16, data UintN) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.accesses = append(p.accesses, portAccess{out: true, addr: addr, data: uint32(*data.(*Uint32))})
+	return nil
+}
+
+func (p *fakePort) Close() error { return nil }
+
+func withFakePCIPort(t *testing.T, p *fakePort) {
+	t.Helper()
+	old := pciPort
+	pciPort = p
+	t.Cleanup(func() { pciPort = old })
+}
+
+func TestPCIConfigRead(t *testing.T) {
+	for _, tt := range []struct {
+		bus, dev, fn, offset uint8
+		wantAddr             uint32
+	}{
+		{bus: 0, dev: 0, fn: 0, offset: 0, wantAddr: 0x80000000},
+		{bus: 0, dev: 0x1f, fn: 3, offset: 0x08, wantAddr: 0x8000fb08},
+		{bus: 0xff, dev: 0x1f, fn: 7, offset: 0xfc, wantAddr: 0x80fffffc},
+		{bus: 2, dev: 1, fn: 0, offset: 0x10, wantAddr: 0x80020810},
+	} {
+		t.Run(fmt.Sprintf("%02x:%02x.%x+%#x", tt.bus, tt.dev, tt.fn, tt.offset), func(t *testing.T) {
+			p := &fakePort{data: 0x12348086}
+			withFakePCIPort(t, p)
+
+			got, err := PCIConfigRead(tt.bus, tt.dev, tt.fn, tt.offset)
+			if err != nil {
+				t.Fatalf("PCIConfigRead() = %v", err)
+			}
+			if got != 0x12348086 {
+				t.Errorf("PCIConfigRead() = %#x, want 0x12348086", got)
+			}
+			want := []portAccess{
+				{out: true, addr: 0xcf8, data: tt.wantAddr},
+				{addr: 0xcfc, data: 0x12348086},
+			}
+			if !reflect.DeepEqual(p.accesses, want) {
+				t.Errorf("port accesses = %+v, want %+v", p.accesses, want)
+			}
+		})
+	}
+}
+
+func TestPCIConfigWrite(t *testing.T) {
+	p := &fakePort{}
+	withFakePCIPort(t, p)
+
+	if err := PCIConfigWrite(0, 0x1f, 3, 0x04, 0x0146); err != nil {
+		t.Fatalf("PCIConfigWrite() = %v", err)
+	}
+	want := []portAccess{
+		{out: true, addr: 0xcf8, data: 0x8000fb04},
+		{out: true, addr: 0xcfc, data: 0x0146},
+	}
+	if !reflect.DeepEqual(p.accesses, want) {
+		t.Errorf("port accesses = %+v, want %+v", p.accesses, want)
+	}
+}
+
+func TestPCIConfigInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name            string
+		dev, fn, offset uint8
+	}{
+		{name: "device", dev: 32},
+		{name: "function", fn: 8},
+		{name: "unaligned offset", offset: 0x06},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &fakePort{}
+			withFakePCIPort(t, p)
+
+			if _, err := PCIConfigRead(0, tt.dev, tt.fn, tt.offset); err == nil {
+				t.Errorf("PCIConfigRead() = nil, want error")
+			}
+			if err := PCIConfigWrite(0, tt.dev, tt.fn, tt.offset, 0); err == nil {
+				t.Errorf("PCIConfigWrite() = nil, want error")
+			}
+			if len(p.accesses) != 0 {
+				t.Errorf("port accesses = %+v, want none", p.accesses)
+			}
+		})
+	}
+}
+
+func TestPCIConfigPortError(t *testing.T) {
+	errPort := errors.New("no iopl")
+	withFakePCIPort(t, &fakePort{err: errPort})
+
+	if _, err := PCIConfigRead(0, 0, 0, 0); !errors.Is(err, errPort) {
+		t.Errorf("PCIConfigRead() = %v, want %v", err, errPort)
+	}
+	if err := PCIConfigWrite(0, 0, 0, 0, 0); !errors.Is(err, errPort) {
+		t.Errorf("PCIConfigWrite() = %v, want %v", err, errPort)
+	}
+}
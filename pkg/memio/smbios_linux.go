@@ -0,0 +1,103 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrNoSMBIOS is returned by FindSMBIOS if there is no valid SMBIOS entry
+// point in the BIOS area.
+var ErrNoSMBIOS = errors.New("no SMBIOS entry point found")
+
+// The SMBIOS entry point is on a 16-byte boundary in the BIOS area at
+// 0xf0000. See DSP0134 Section 5.2.
+const (
+	smbiosAreaStart = 0xf0000
+	smbiosAreaEnd   = 0x100000
+)
+
+// Anchors and lengths of the SMBIOS 2.1 32-bit and SMBIOS 3.0 64-bit entry
+// points.
+const (
+	smbios2Anchor    = "_SM_"
+	smbios2DMIAnchor = "_DMI_"
+	smbios2Len       = 0x1f
+	smbios3Anchor    = "_SM3_"
+	smbios3Len       = 0x18
+)
+
+// smbios3Entry returns the 64-bit entry point at the start of b and its
+// structure table address, if it is valid.
+func smbios3Entry(b []byte) ([]byte, int64, bool) {
+	if len(b) < smbios3Len || string(b[:len(smbios3Anchor)]) != smbios3Anchor {
+		return nil, 0, false
+	}
+	l := int(b[6])
+	if l < smbios3Len || l > len(b) || checksum(b[:l]) != 0 {
+		return nil, 0, false
+	}
+	return b[:l], int64(binary.LittleEndian.Uint64(b[0x10:0x18])), true
+}
+
+// smbios2Entry returns the 32-bit entry point at the start of b and its
+// structure table address, if it is valid.
+func smbios2Entry(b []byte) ([]byte, int64, bool) {
+	if len(b) < smbios2Len || string(b[:len(smbios2Anchor)]) != smbios2Anchor {
+		return nil, 0, false
+	}
+	// Some SMBIOS 2.1 firmware wrongly reports a length of 0x1e.
+	l := int(b[5])
+	if l < 0x1e || l > len(b) || checksum(b[:l]) != 0 {
+		return nil, 0, false
+	}
+	if string(b[0x10:0x15]) != smbios2DMIAnchor || checksum(b[0x10:smbios2Len]) != 0 {
+		return nil, 0, false
+	}
+	return b[:l], int64(binary.LittleEndian.Uint32(b[0x18:0x1c])), true
+}
+
+// FindSMBIOS returns the SMBIOS entry point found by scanning the BIOS area
+// at 0xf0000 for the "_SM3_" and "_SM_" anchors, and the physical address
+// of the structure table it points to. Candidates with a bad checksum are
+// skipped, and a 64-bit entry point is preferred over a 32-bit one.
+//
+// The entry point also holds the length of the structure table, and can be
+// parsed with smbios.Entry32 or smbios.Entry64 depending on its anchor.
+func (m *MMap) FindSMBIOS() (entry []byte, tableAddr int64, err error) {
+	return Memory{m}.FindSMBIOS()
+}
+
+// FindSMBIOS returns the SMBIOS entry point and the address of the structure
+// table. See MMap.FindSMBIOS.
+func (m Memory) FindSMBIOS() (entry []byte, tableAddr int64, err error) {
+	area := ByteSlice(make([]byte, smbiosAreaEnd-smbiosAreaStart))
+	if err := m.ReadAt(smbiosAreaStart, &area); err != nil {
+		return nil, 0, fmt.Errorf("scanning BIOS area: %w", err)
+	}
+
+	var entry2 []byte
+	var table2 int64
+	for off := 0; off+len(smbios2Anchor) <= len(area); off += 16 {
+		if e, addr, ok := smbios3Entry(area[off:]); ok {
+			return append([]byte(nil), e...), addr, nil
+		}
+		if entry2 == nil {
+			entry2, table2, _ = smbios2Entry(area[off:])
+		}
+	}
+	if entry2 == nil {
+		return nil, 0, ErrNoSMBIOS
+	}
+	return append([]byte(nil), entry2...), table2, nil
+}
+
+// FindSMBIOS returns the SMBIOS entry point and the physical address of the
+// structure table. See MMap.FindSMBIOS.
+func FindSMBIOS() (entry []byte, tableAddr int64, err error) {
+	return Memory{DevMemBackend{}}.FindSMBIOS()
+}
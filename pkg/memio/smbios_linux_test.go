@@ -0,0 +1,98 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// fakeSMBIOS3 returns a 64-bit SMBIOS entry point for a structure table of
+// size bytes at addr.
+func fakeSMBIOS3(addr uint64, size uint32) []byte {
+	b := make([]byte, smbios3Len)
+	copy(b, smbios3Anchor)
+	b[6] = smbios3Len
+	b[7], b[8] = 3, 2
+	b[10] = 1
+	binary.LittleEndian.PutUint32(b[0x0c:0x10], size)
+	binary.LittleEndian.PutUint64(b[0x10:0x18], addr)
+	b[5] = -checksum(b)
+	return b
+}
+
+// fakeSMBIOS2 returns a 32-bit SMBIOS entry point for a structure table at
+// addr.
+func fakeSMBIOS2(addr uint32) []byte {
+	b := make([]byte, smbios2Len)
+	copy(b, smbios2Anchor)
+	b[5] = smbios2Len
+	b[6], b[7] = 2, 8
+	copy(b[0x10:], smbios2DMIAnchor)
+	binary.LittleEndian.PutUint16(b[0x16:0x18], 0x400)
+	binary.LittleEndian.PutUint32(b[0x18:0x1c], addr)
+	b[0x15] = -checksum(b[0x10:smbios2Len])
+	b[4] = -checksum(b)
+	return b
+}
+
+func TestFindSMBIOS(t *testing.T) {
+	badSMBIOS3 := fakeSMBIOS3(0x7f000000, 0x1000)
+	badSMBIOS3[0x10]++
+
+	for _, tt := range []struct {
+		name      string
+		mem       map[int64][]byte
+		wantEntry []byte
+		wantTable int64
+		wantErr   error
+	}{
+		{
+			name:      "SMBIOS 3",
+			mem:       map[int64][]byte{0xf5a00: fakeSMBIOS3(0x7f000000, 0x1000)},
+			wantEntry: fakeSMBIOS3(0x7f000000, 0x1000),
+			wantTable: 0x7f000000,
+		},
+		{
+			name:      "SMBIOS 2",
+			mem:       map[int64][]byte{0xf0010: fakeSMBIOS2(0xe8000)},
+			wantEntry: fakeSMBIOS2(0xe8000),
+			wantTable: 0xe8000,
+		},
+		{
+			name: "SMBIOS 3 preferred",
+			mem: map[int64][]byte{
+				0xf0000: fakeSMBIOS2(0xe8000),
+				0xf8000: fakeSMBIOS3(0x7f000000, 0x1000),
+			},
+			wantEntry: fakeSMBIOS3(0x7f000000, 0x1000),
+			wantTable: 0x7f000000,
+		},
+		{
+			name: "bad checksum skipped",
+			mem: map[int64][]byte{
+				0xf0000: badSMBIOS3,
+				0xf0100: fakeSMBIOS2(0xe8000),
+			},
+			wantEntry: fakeSMBIOS2(0xe8000),
+			wantTable: 0xe8000,
+		},
+		{
+			name:    "none",
+			mem:     map[int64][]byte{0xf0004: fakeSMBIOS3(0x7f000000, 0x1000)},
+			wantErr: ErrNoSMBIOS,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withMem(t, fakeMem(t, tt.mem))
+			entry, table, err := FindSMBIOS()
+			if !errors.Is(err, tt.wantErr) || table != tt.wantTable || !bytes.Equal(entry, tt.wantEntry) {
+				t.Errorf("FindSMBIOS() = %x, %#x, %v, want %x, %#x, %v", entry, table, err, tt.wantEntry, tt.wantTable, tt.wantErr)
+			}
+		})
+	}
+}
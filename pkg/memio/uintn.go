@@ -112,9 +112,8 @@ func (u *Uint64) read(addr unsafe.Pointer) error {
 }
 
 func (s *ByteSlice) read(addr unsafe.Pointer) error {
-	for i := 0; i < len(*s); i++ {
-		(*s)[i] = *(*byte)(addr)
-		addr = unsafe.Pointer(uintptr(addr) + 1)
+	for i := range *s {
+		(*s)[i] = *(*byte)(unsafe.Add(addr, i))
 	}
 	return nil // TODO: catch misalign, segfault, sigbus, ...
 }
@@ -141,9 +140,8 @@ func (u *Uint64) write(addr unsafe.Pointer) error {
 }
 
 func (s *ByteSlice) write(addr unsafe.Pointer) error {
-	for i := 0; i < len(*s); i++ {
-		*(*byte)(addr) = (*s)[i]
-		addr = unsafe.Pointer(uintptr(addr) + 1)
+	for i := range *s {
+		*(*byte)(unsafe.Add(addr, i)) = (*s)[i]
 	}
 	return nil // TODO: catch misalign, segfault, sigbus, ...
 }
@@ -0,0 +1,74 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package memio
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Value is an unsigned integer that ReadValue and WriteValue access with a
+// memory access of its width, e.g. uint32 or Uint32.
+type Value interface {
+	~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// ReadValue returns the value at address addr of /dev/mem, e.g.
+//
+//	v, err := memio.ReadValue[uint32](0xfed40000)
+func ReadValue[T Value](addr int64) (T, error) {
+	return ReadValueFrom[T](DevMemBackend{}, addr)
+}
+
+// ReadValueFrom returns the value at address addr of b.
+func ReadValueFrom[T Value](b Backend, addr int64) (T, error) {
+	var v T
+	switch unsafe.Sizeof(v) {
+	case 1:
+		var d Uint8
+		err := b.ReadAt(addr, &d)
+		return T(d), err
+	case 2:
+		var d Uint16
+		err := b.ReadAt(addr, &d)
+		return T(d), err
+	case 4:
+		var d Uint32
+		err := b.ReadAt(addr, &d)
+		return T(d), err
+	case 8:
+		var d Uint64
+		err := b.ReadAt(addr, &d)
+		return T(d), err
+	}
+	return v, fmt.Errorf("reading %#x: unsupported width %d", addr, unsafe.Sizeof(v))
+}
+
+// WriteValue writes v to address addr of /dev/mem.
+func WriteValue[T Value](addr int64, v T) error {
+	return WriteValueTo(DevMemBackend{}, addr, v)
+}
+
+// WriteValueTo writes v to address addr of b.
+func WriteValueTo[T Value](b Backend, addr int64, v T) error {
+	switch unsafe.Sizeof(v) {
+	case 1:
+		d := Uint8(v)
+		return b.WriteAt(addr, &d)
+	case 2:
+		d := Uint16(v)
+		return b.WriteAt(addr, &d)
+	case 4:
+		d := Uint32(v)
+		return b.WriteAt(addr, &d)
+	case 8:
+		d := Uint64(v)
+		return b.WriteAt(addr, &d)
+	}
+	return fmt.Errorf("writing %#x: unsupported width %d", addr, unsafe.Sizeof(v))
+}
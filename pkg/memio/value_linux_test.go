@@ -0,0 +1,82 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package memio
+
+import (
+	"os"
+	"testing"
+)
+
+// testValue writes want with WriteValue and checks that ReadValue returns
+// it again.
+func testValue[T Value](t *testing.T, addr int64, want T) {
+	t.Helper()
+	if err := WriteValue(addr, want); err != nil {
+		t.Fatalf("WriteValue(%#x, %#x) = %v", addr, want, err)
+	}
+	got, err := ReadValue[T](addr)
+	if err != nil {
+		t.Fatalf("ReadValue(%#x) = %v", addr, err)
+	}
+	if got != want {
+		t.Errorf("ReadValue(%#x) = %#x, want %#x", addr, got, want)
+	}
+}
+
+func TestReadWriteValue(t *testing.T) {
+	tmpFile, err := os.CreateTemp(t.TempDir(), "io_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpFile.Write(make([]byte, 0x100)); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+	memPath = tmpFile.Name()
+	defer func() { memPath = "/dev/mem" }()
+
+	t.Run("uint8", func(t *testing.T) {
+		testValue(t, 0x10, uint8(0x12))
+	})
+	t.Run("uint16", func(t *testing.T) {
+		testValue(t, 0x20, uint16(0x1234))
+	})
+	t.Run("uint32", func(t *testing.T) {
+		testValue(t, 0x30, uint32(0x12345678))
+	})
+	t.Run("uint64", func(t *testing.T) {
+		testValue(t, 0x40, uint64(0x1234567890abcdef))
+	})
+	t.Run("Uint32", func(t *testing.T) {
+		testValue(t, 0x50, Uint32(0xdeadbeef))
+	})
+
+	// The values were written with the original API's widths.
+	var d Uint32
+	if err := Read(0x30, &d); err != nil || d != 0x12345678 {
+		t.Errorf("Read(0x30) = %#x, %v, want 0x12345678, nil", d, err)
+	}
+
+	memPath = "file-does-not-exist"
+	if _, err := ReadValue[uint64](0x40); err == nil {
+		t.Errorf("ReadValue(0x40) without memory succeeded, want error")
+	}
+	if err := WriteValue(0x40, uint64(1)); err == nil {
+		t.Errorf("WriteValue(0x40) without memory succeeded, want error")
+	}
+}
+
+func TestMemoryValue(t *testing.T) {
+	mem := make(SliceBackend, 0x100)
+	if err := WriteValueTo(mem, 0x10, uint16(0x1234)); err != nil {
+		t.Fatalf("WriteValueTo() = %v", err)
+	}
+	if got, err := ReadValueFrom[uint16](mem, 0x10); err != nil || got != 0x1234 {
+		t.Errorf("ReadValueFrom() = %#x, %v, want 0x1234, nil", got, err)
+	}
+}
@@ -383,6 +383,58 @@ func tryXFS(file io.ReaderAt) (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
 
+// Offsets of the volume labels of the file systems whose UUIDs are read
+// above.
+const (
+	ext2SprblkLabelOff  = 120
+	ext2SprblkLabelSize = 16
+
+	fat16LabelOff = 0x2b
+	fat32LabelOff = 0x47
+	fatLabelSize  = 11
+
+	// FAT file systems without a label have this one.
+	fatNoLabel = "NO NAME"
+
+	xfsLabelOff  = 108
+	xfsLabelSize = 12
+)
+
+func getFSLabel(devpath string) (string, error) {
+	file, err := os.Open(devpath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := tryFAT32(file); err == nil {
+		return readLabel(file, fat32LabelOff, fatLabelSize)
+	}
+	if _, err := tryFAT16(file); err == nil {
+		return readLabel(file, fat16LabelOff, fatLabelSize)
+	}
+	if _, err := tryEXT4(file); err == nil {
+		return readLabel(file, ext2SprblkOff+ext2SprblkLabelOff, ext2SprblkLabelSize)
+	}
+	if _, err := tryXFS(file); err == nil {
+		return readLabel(file, xfsLabelOff, xfsLabelSize)
+	}
+	return "", fmt.Errorf("unknown label (not vfat, ext4, nor xfs)")
+}
+
+// readLabel reads a NUL- or space-padded volume label.
+func readLabel(file io.ReaderAt, off int64, size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := file.ReadAt(b, off); err != nil {
+		return "", err
+	}
+	label := strings.TrimRight(string(b), "\x00 ")
+	if label == fatNoLabel {
+		return "", nil
+	}
+	return label, nil
+}
+
 // BlockDevices is a list of block devices.
 type BlockDevices []*BlockDev
 
@@ -459,6 +511,18 @@ func (b BlockDevices) FilterFSUUID(fsuuid string) BlockDevices {
 	return partitions
 }
 
+// FilterFSLabel returns a list of BlockDev objects whose underlying block
+// device has a filesystem with the given volume label.
+func (b BlockDevices) FilterFSLabel(label string) BlockDevices {
+	partitions := make(BlockDevices, 0)
+	for _, device := range b {
+		if l, err := getFSLabel(device.DevicePath()); err == nil && l == label {
+			partitions = append(partitions, device)
+		}
+	}
+	return partitions
+}
+
 // FilterZeroSize attempts to find block devices that have at least one block
 // of content.
 //
@@ -6,6 +6,7 @@ package block
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -241,6 +242,69 @@ func TestBlockDevicesFilterFSUUID(t *testing.T) {
 	}
 }
 
+func TestGetFSLabel(t *testing.T) {
+	// fsImage returns the path of a file with magic and label at the
+	// given offsets.
+	fsImage := func(magicOff int64, magic string, labelOff int64, label string) string {
+		b := make([]byte, 4096)
+		copy(b[magicOff:], magic)
+		copy(b[labelOff:], label)
+		path := filepath.Join(t.TempDir(), "disk")
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for _, tt := range []struct {
+		name    string
+		devpath string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "ext4",
+			devpath: fsImage(ext2SprblkOff+ext2SprblkMagicOff, "\x53\xef", ext2SprblkOff+ext2SprblkLabelOff, "rootfs\x00\x00"),
+			want:    "rootfs",
+		},
+		{
+			name:    "fat32",
+			devpath: fsImage(fat32MagicOff, fat32Magic, fat32LabelOff, "EFI        "),
+			want:    "EFI",
+		},
+		{
+			name:    "fat16 without label",
+			devpath: fsImage(fat16MagicOff, fat16Magic, fat16LabelOff, "NO NAME    "),
+			want:    "",
+		},
+		{
+			name:    "xfs",
+			devpath: fsImage(0, xfsMagic, xfsLabelOff, "data"),
+			want:    "data",
+		},
+		{
+			name:    "unknown",
+			devpath: fsImage(0, "", 0, "label"),
+			wantErr: true,
+		},
+		{
+			name:    "no device",
+			devpath: filepath.Join(t.TempDir(), "noexist"),
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getFSLabel(tt.devpath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getFSLabel() = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getFSLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetMountpointByDevice(t *testing.T) {
 	LinuxMountsPath = "testdata/mounts"
 
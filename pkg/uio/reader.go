@@ -6,6 +6,7 @@ package uio
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"math"
 	"os"
@@ -34,6 +35,25 @@ func Reader(r io.ReaderAt) io.Reader {
 	return io.NewSectionReader(r, 0, math.MaxInt64)
 }
 
+// ctxReader is an io.Reader that stops reading once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// ContextReader returns a Reader that reads from r until ctx is done, and
+// then fails with ctx's error. It lets io.Copy be cancelled between reads.
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, r: r}
+}
+
 // ReaderAtEqual compares the contents of r1 and r2.
 func ReaderAtEqual(r1, r2 io.ReaderAt) bool {
 	var c, d []byte
@@ -5,6 +5,9 @@
 package uio
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -62,3 +65,17 @@ func TestReadIntoFile(t *testing.T) {
 	}
 	readAndCheck(t, want, p)
 }
+
+func TestContextReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := ContextReader(ctx, strings.NewReader("kernel"))
+
+	b := make([]byte, 3)
+	if n, err := r.Read(b); err != nil || string(b[:n]) != "ker" {
+		t.Fatalf("Read() = %q, %v, want %q", b[:n], err, "ker")
+	}
+	cancel()
+	if _, err := io.ReadAll(r); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadAll() after cancel = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONLogger is a Logger that writes one JSON object per message, e.g. for
+// shipping logs to a collector.
+//
+// Each object has the fields "time" (RFC 3339), "level", "msg" and those
+// added with With. Print and Printf log at LevelInfo.
+type JSONLogger struct {
+	w io.Writer
+
+	// mu serializes writes to w, and is shared by loggers returned by
+	// With.
+	mu *sync.Mutex
+
+	fields map[string]interface{}
+}
+
+var (
+	_ Logger       = &JSONLogger{}
+	_ LevelPrinter = &JSONLogger{}
+)
+
+// NewJSONLogger returns a JSONLogger writing to w.
+func NewJSONLogger(w io.Writer) *JSONLogger {
+	return &JSONLogger{
+		w:      w,
+		mu:     &sync.Mutex{},
+		fields: map[string]interface{}{},
+	}
+}
+
+// With returns a logger that adds the fields given as alternating keys and
+// values to every message, in addition to j's fields.
+func (j *JSONLogger) With(kv ...interface{}) *JSONLogger {
+	fields := make(map[string]interface{}, len(j.fields)+len(kv)/2)
+	for k, v := range j.fields {
+		fields[k] = v
+	}
+	for i := 0; i < len(kv); i += 2 {
+		var v interface{} = "MISSING"
+		if i+1 < len(kv) {
+			v = kv[i+1]
+		}
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[fmt.Sprint(kv[i])] = v
+	}
+	return &JSONLogger{w: j.w, mu: j.mu, fields: fields}
+}
+
+// Logf implements LevelPrinter.
+func (j *JSONLogger) Logf(level Level, format string, v ...interface{}) {
+	entry := make(map[string]interface{}, len(j.fields)+3)
+	for k, v := range j.fields {
+		entry[k] = v
+	}
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["msg"] = fmt.Sprintf(format, v...)
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		// Some field cannot be marshaled. Log all fields as strings
+		// instead.
+		for k, v := range entry {
+			entry[k] = fmt.Sprint(v)
+		}
+		b, _ = json.Marshal(entry)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.w.Write(append(b, '\n'))
+}
+
+// Printf implements Logger by logging at LevelInfo.
+func (j *JSONLogger) Printf(format string, v ...interface{}) {
+	j.Logf(LevelInfo, format, v...)
+}
+
+// Print implements Logger by logging at LevelInfo.
+func (j *JSONLogger) Print(v ...interface{}) {
+	j.Logf(LevelInfo, "%s", fmt.Sprint(v...))
+}
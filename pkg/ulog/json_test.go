@@ -0,0 +1,87 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func parseJSONLines(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	s := bufio.NewScanner(b)
+	for s.Scan() {
+		var m map[string]interface{}
+		if err := json.Unmarshal(s.Bytes(), &m); err != nil {
+			t.Fatalf("line %q is not JSON: %v", s.Text(), err)
+		}
+		ts, ok := m["time"].(string)
+		if !ok {
+			t.Fatalf("line %q has no time", s.Text())
+		}
+		if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+			t.Errorf("time %q is not RFC 3339: %v", ts, err)
+		}
+		delete(m, "time")
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestJSONLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewJSONLogger(&b)
+	l.Printf("got lease for %s", "eth0")
+
+	nl := l.With("iface", "eth0", "attempt", 2)
+	nl.Logf(LevelWarn, "no boot file")
+	nl.With("err", errors.New("timeout"), "odd").Print("DHCP ", "failed")
+
+	// Loggers with fields don't change the original.
+	l.Logf(LevelDebug, "done")
+
+	want := []map[string]interface{}{
+		{"level": "info", "msg": "got lease for eth0"},
+		{"level": "warn", "msg": "no boot file", "iface": "eth0", "attempt": float64(2)},
+		{"level": "info", "msg": "DHCP failed", "iface": "eth0", "attempt": float64(2), "err": "timeout", "odd": "MISSING"},
+		{"level": "debug", "msg": "done"},
+	}
+	if got := parseJSONLines(t, &b); !reflect.DeepEqual(got, want) {
+		t.Errorf("logged %v, want %v", got, want)
+	}
+}
+
+func TestJSONLoggerLevels(t *testing.T) {
+	var b bytes.Buffer
+	l := NewLevelLogger(NewJSONLogger(&b).With("cmd", "pxeboot"), LevelInfo)
+	l.Debugf("dropped")
+	l.Errorf("boot failed: %v", "no images")
+
+	want := []map[string]interface{}{
+		{"level": "error", "msg": "boot failed: no images", "cmd": "pxeboot"},
+	}
+	if got := parseJSONLines(t, &b); !reflect.DeepEqual(got, want) {
+		t.Errorf("logged %v, want %v", got, want)
+	}
+}
+
+func TestJSONLoggerUnmarshalable(t *testing.T) {
+	var b bytes.Buffer
+	NewJSONLogger(&b).With("ch", make(chan int)).Printf("hi")
+
+	got := parseJSONLines(t, &b)
+	if len(got) != 1 || got[0]["msg"] != "hi" {
+		t.Fatalf("logged %v, want message hi", got)
+	}
+	if _, ok := got[0]["ch"].(string); !ok {
+		t.Errorf("unmarshalable field logged as %v, want a string", got[0]["ch"])
+	}
+}
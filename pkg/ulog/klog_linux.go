@@ -7,14 +7,17 @@ package ulog
 import (
 	"fmt"
 	"os"
+	"strings"
 	"sync/atomic"
+	"unicode/utf8"
 
 	"golang.org/x/sys/unix"
 )
 
 // KernelLog is a logger that prints to the kernel syslog buffer.
 //
-// Default log level is KLogInfo.
+// Default log level is KLogInfo. Messages logged with Logf, e.g. by a
+// LevelLogger, get the printk log level matching their Level instead.
 //
 // If the syslog buffer cannot be written to, KernelLog falls back to Log.
 var KernelLog = &KLog{
@@ -25,7 +28,9 @@ func init() {
 	KernelLog.Reinit()
 }
 
-// KLog is a logger to the kernel sysloBg buffer.
+var _ LevelPrinter = &KLog{}
+
+// KLog is a logger to the kernel syslog buffer.
 type KLog struct {
 	// FD for /dev/kmsg if it was openable.
 	*os.File
@@ -40,31 +45,96 @@ type KLog struct {
 func (k *KLog) Reinit() {
 	f, err := os.OpenFile("/dev/kmsg", os.O_RDWR, 0)
 	if err == nil {
-		KernelLog.File = f
+		k.File = f
+	}
+}
+
+const (
+	// kmsgFacility is the syslog facility of messages written to
+	// /dev/kmsg, LOG_USER. The kernel reserves facility 0 for itself.
+	kmsgFacility = 1
+
+	// kmsgMaxRecord is the longest record /dev/kmsg accepts, including
+	// the priority prefix. Longer writes fail with EINVAL. Kernels before
+	// 5.10 allow 1024 bytes minus 32 for their own prefix, newer ones
+	// 1024.
+	kmsgMaxRecord = 1024 - 32
+)
+
+// kmsgRecords returns the /dev/kmsg records logging s at level: one per line
+// of s, split further so that none is longer than kmsgMaxRecord.
+func kmsgRecords(level KLogLevel, s string) []string {
+	prefix := fmt.Sprintf("<%d>", kmsgFacility<<3|level&7)
+	max := kmsgMaxRecord - len(prefix) - 1
+
+	var records []string
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		for {
+			n := len(line)
+			if n > max {
+				// Don't split a UTF-8 encoded rune.
+				n = max
+				for n > 0 && !utf8.RuneStart(line[n]) {
+					n--
+				}
+				if n == 0 {
+					n = max
+				}
+			}
+			records = append(records, prefix+line[:n]+"\n")
+			line = line[n:]
+			if line == "" {
+				break
+			}
+		}
 	}
+	return records
 }
 
 // writeString returns true iff it was able to write the log to /dev/kmsg.
-func (k *KLog) writeString(s string) bool {
+func (k *KLog) writeString(level KLogLevel, s string) bool {
 	if k.File == nil {
 		return false
 	}
-	if _, err := k.File.WriteString(fmt.Sprintf("<%d>%s", atomic.LoadUintptr(&k.LogLevel), s)); err != nil {
-		return false
+	// Every write to /dev/kmsg is one record.
+	for _, r := range kmsgRecords(level, s) {
+		if _, err := k.File.WriteString(r); err != nil {
+			return false
+		}
 	}
 	return true
 }
 
+// kmsgLevels maps Levels to the printk log levels they are logged with.
+var kmsgLevels = map[Level]KLogLevel{
+	LevelDebug: KLogDebug,
+	LevelInfo:  KLogInfo,
+	LevelWarn:  KLogWarning,
+	LevelError: KLogError,
+}
+
+// Logf implements LevelPrinter by writing to kernel logging with the printk
+// log level matching level, instead of LogLevel.
+func (k *KLog) Logf(level Level, format string, v ...interface{}) {
+	klevel, ok := kmsgLevels[level]
+	if !ok {
+		klevel = KLogLevel(atomic.LoadUintptr(&k.LogLevel))
+	}
+	if !k.writeString(klevel, fmt.Sprintf(format, v...)) {
+		Logf(Log, level, format, v...)
+	}
+}
+
 // Printf formats according to a format specifier and writes to kernel logging.
 func (k *KLog) Printf(format string, v ...interface{}) {
-	if !k.writeString(fmt.Sprintf(format, v...)) {
+	if !k.writeString(KLogLevel(atomic.LoadUintptr(&k.LogLevel)), fmt.Sprintf(format, v...)) {
 		Log.Printf(format, v...)
 	}
 }
 
 // Print formats using the default operands for v and writes to kernel logging.
 func (k *KLog) Print(v ...interface{}) {
-	if !k.writeString(fmt.Sprint(v...)) {
+	if !k.writeString(KLogLevel(atomic.LoadUintptr(&k.LogLevel)), fmt.Sprint(v...)) {
 		Log.Print(v...)
 	}
 }
@@ -0,0 +1,149 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tempKLog returns a KLog writing to a temporary file instead of /dev/kmsg,
+// and a function returning the records written so far.
+func tempKLog(t *testing.T) (*KLog, func() []string) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "kmsg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return &KLog{File: f, LogLevel: uintptr(KLogInfo)}, func() []string {
+		b, err := os.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := strings.SplitAfter(string(b), "\n")
+		return records[:len(records)-1]
+	}
+}
+
+func TestKLogLevels(t *testing.T) {
+	for _, tt := range []struct {
+		level Level
+		want  string
+	}{
+		{LevelDebug, "<15>debug message\n"},
+		{LevelInfo, "<14>info message\n"},
+		{LevelWarn, "<12>warn message\n"},
+		{LevelError, "<11>error message\n"},
+		{Level(42), "<14>Level(42) message\n"},
+	} {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			k, records := tempKLog(t)
+			k.Logf(tt.level, "%s message", tt.level)
+			if got := records(); !reflect.DeepEqual(got, []string{tt.want}) {
+				t.Errorf("Logf(%v) wrote %q, want %q", tt.level, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKLogPrint(t *testing.T) {
+	k, records := tempKLog(t)
+	k.Printf("hello %s", "world")
+	k.SetLogLevel(KLogNotice)
+	k.Print("notice")
+	want := []string{"<14>hello world\n", "<13>notice\n"}
+	if got := records(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+func TestKLogLevelLogger(t *testing.T) {
+	k, records := tempKLog(t)
+	l := NewLevelLogger(k, LevelInfo)
+	l.Debugf("dropped")
+	l.Warnf("disk %s is slow", "sda")
+	l.Printf("done")
+	want := []string{"<12>disk sda is slow\n", "<14>done\n"}
+	if got := records(); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
+
+func TestKmsgRecords(t *testing.T) {
+	long := strings.Repeat("x", kmsgMaxRecord)
+	// A multi-byte rune straddling the record limit.
+	straddle := strings.Repeat("x", kmsgMaxRecord-len("<14>\n")-1) + "é"
+
+	for _, tt := range []struct {
+		name string
+		msg  string
+		want []string
+	}{
+		{
+			name: "trailing newline",
+			msg:  "hello\n",
+			want: []string{"<14>hello\n"},
+		},
+		{
+			name: "lines",
+			msg:  "hello\nworld",
+			want: []string{"<14>hello\n", "<14>world\n"},
+		},
+		{
+			name: "empty",
+			msg:  "",
+			want: []string{"<14>\n"},
+		},
+		{
+			name: "long",
+			msg:  long,
+			want: []string{
+				"<14>" + long[:kmsgMaxRecord-5] + "\n",
+				"<14>" + long[kmsgMaxRecord-5:] + "\n",
+			},
+		},
+		{
+			name: "rune boundary",
+			msg:  straddle,
+			want: []string{
+				"<14>" + straddle[:len(straddle)-2] + "\n",
+				"<14>é\n",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := kmsgRecords(KLogInfo, tt.msg)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("kmsgRecords(%q) = %q, want %q", tt.msg, got, tt.want)
+			}
+			for _, r := range got {
+				if len(r) > kmsgMaxRecord {
+					t.Errorf("record of %d bytes is longer than %d", len(r), kmsgMaxRecord)
+				}
+			}
+		})
+	}
+}
+
+func TestKLogFallback(t *testing.T) {
+	defer func(old Logger) { Log = old }(Log)
+	var buf bytes.Buffer
+	Log = log.New(&buf, "", 0)
+
+	k := &KLog{LogLevel: uintptr(KLogInfo)}
+	k.Printf("hello %s", "world")
+	k.Logf(LevelWarn, "disk %s is slow", "sda")
+
+	want := "hello world\nwarn: disk sda is slow\n"
+	if got := buf.String(); got != want {
+		t.Errorf("logged %q to Log, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Level is the severity of a log message.
+type Level int32
+
+// These are the levels of log messages, from least to most severe.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", int32(l))
+}
+
+// LevelPrinter is implemented by Loggers that handle levels themselves,
+// e.g. to record them in structured output.
+type LevelPrinter interface {
+	Logf(level Level, format string, v ...interface{})
+}
+
+// LevelLogger is a Logger that drops messages below a minimum level.
+//
+// Print and Printf log at LevelInfo.
+type LevelLogger struct {
+	l Logger
+
+	// min is the minimum level logged. Should only be accessed
+	// atomically.
+	min int32
+}
+
+var _ LevelPrinter = &LevelLogger{}
+
+// NewLevelLogger returns a LevelLogger logging messages of at least min to
+// l.
+func NewLevelLogger(l Logger, min Level) *LevelLogger {
+	return &LevelLogger{l: l, min: int32(min)}
+}
+
+// SetLevel sets the minimum level of messages that are logged.
+func (l *LevelLogger) SetLevel(min Level) {
+	atomic.StoreInt32(&l.min, int32(min))
+}
+
+// Enabled returns whether messages of level are logged.
+func (l *LevelLogger) Enabled(level Level) bool {
+	return level >= Level(atomic.LoadInt32(&l.min))
+}
+
+// Logf logs a message at level, if it is at least the minimum level.
+//
+// Messages other than LevelInfo ones are prefixed with their level, unless
+// the underlying Logger is a LevelPrinter.
+func (l *LevelLogger) Logf(level Level, format string, v ...interface{}) {
+	if l.Enabled(level) {
+		Logf(l.l, level, format, v...)
+	}
+}
+
+// Logf logs a message at level to l. If l is not a LevelPrinter, messages
+// other than LevelInfo ones are prefixed with their level.
+func Logf(l Logger, level Level, format string, v ...interface{}) {
+	if lp, ok := l.(LevelPrinter); ok {
+		lp.Logf(level, format, v...)
+		return
+	}
+	if level != LevelInfo {
+		format = fmt.Sprintf("%s: %s", level, format)
+	}
+	l.Printf(format, v...)
+}
+
+// Debugf logs a message at LevelDebug.
+func (l *LevelLogger) Debugf(format string, v ...interface{}) {
+	l.Logf(LevelDebug, format, v...)
+}
+
+// Infof logs a message at LevelInfo.
+func (l *LevelLogger) Infof(format string, v ...interface{}) {
+	l.Logf(LevelInfo, format, v...)
+}
+
+// Warnf logs a message at LevelWarn.
+func (l *LevelLogger) Warnf(format string, v ...interface{}) {
+	l.Logf(LevelWarn, format, v...)
+}
+
+// Errorf logs a message at LevelError.
+func (l *LevelLogger) Errorf(format string, v ...interface{}) {
+	l.Logf(LevelError, format, v...)
+}
+
+// Printf implements Logger by logging at LevelInfo.
+func (l *LevelLogger) Printf(format string, v ...interface{}) {
+	l.Logf(LevelInfo, format, v...)
+}
+
+// Print implements Logger by logging at LevelInfo.
+func (l *LevelLogger) Print(v ...interface{}) {
+	l.Logf(LevelInfo, "%s", fmt.Sprint(v...))
+}
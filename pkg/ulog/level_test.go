@@ -0,0 +1,44 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestLevelLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewLevelLogger(log.New(&b, "", 0), LevelInfo)
+
+	l.Debugf("probing %s", "eth0")
+	if b.Len() != 0 {
+		t.Errorf("Debugf below the threshold logged %q", b.String())
+	}
+
+	l.Printf("got lease for %s", "eth0")
+	l.Warnf("no %s in lease", "boot file")
+	l.Errorf("boot failed")
+	want := "got lease for eth0\nwarn: no boot file in lease\nerror: boot failed\n"
+	if got := b.String(); got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+
+	b.Reset()
+	l.SetLevel(LevelDebug)
+	l.Debugf("probing %s", "eth0")
+	if got, want := b.String(), "debug: probing eth0\n"; got != want {
+		t.Errorf("Debugf above the threshold logged %q, want %q", got, want)
+	}
+
+	b.Reset()
+	l.SetLevel(LevelError)
+	l.Print("quiet")
+	l.Warnf("quiet")
+	if b.Len() != 0 {
+		t.Errorf("messages below LevelError logged %q", b.String())
+	}
+}
@@ -8,6 +8,11 @@
 // library "log" package Logger, a kernel syslog (dmesg) Logger, and a test
 // Logger that logs via a test's testing.TB.Logf.
 // To use the test logger import "ulog/ulogtest".
+//
+// A LevelLogger adds levels to any Logger, and drops messages below a
+// minimum level. A JSONLogger writes structured messages, e.g. for log
+// collectors. Multi logs to several Loggers at once, and RateLimit keeps a
+// flood of messages from filling the console.
 package ulog
 
 import (
@@ -0,0 +1,66 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"fmt"
+	"os"
+)
+
+type multiLogger []Logger
+
+var _ LevelPrinter = multiLogger{}
+
+// Multi returns a Logger that logs every message to all loggers, e.g. to
+// both the console and KernelLog. Levels are passed on to loggers that are
+// LevelPrinters.
+//
+// A logger that panics does not keep the message from the others, which
+// log the panic after it, or from os.Stderr if they all panicked.
+func Multi(loggers ...Logger) Logger {
+	return multiLogger(append([]Logger(nil), loggers...))
+}
+
+// each calls f for every logger, recovering from panics and reporting them
+// to the loggers that did not panic.
+func (m multiLogger) each(f func(l Logger)) {
+	var ok []Logger
+	var panics []string
+	for _, l := range m {
+		if r := catch(func() { f(l) }); r != nil {
+			panics = append(panics, fmt.Sprintf("ulog: %T panicked: %v", l, r))
+		} else {
+			ok = append(ok, l)
+		}
+	}
+	for _, msg := range panics {
+		if len(ok) == 0 {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		for _, l := range ok {
+			catch(func() { l.Print(msg) })
+		}
+	}
+}
+
+// catch calls f and returns the value it panicked with, if any.
+func catch(f func()) (r interface{}) {
+	defer func() { r = recover() }()
+	f()
+	return nil
+}
+
+func (m multiLogger) Printf(format string, v ...interface{}) {
+	m.each(func(l Logger) { l.Printf(format, v...) })
+}
+
+func (m multiLogger) Print(v ...interface{}) {
+	m.each(func(l Logger) { l.Print(v...) })
+}
+
+// Logf implements LevelPrinter.
+func (m multiLogger) Logf(level Level, format string, v ...interface{}) {
+	m.each(func(l Logger) { Logf(l, level, format, v...) })
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+type panicLogger struct{}
+
+func (panicLogger) Printf(format string, v ...interface{}) { panic("console is gone") }
+func (panicLogger) Print(v ...interface{})                 { panic("console is gone") }
+
+func TestMulti(t *testing.T) {
+	var console, kmsg bytes.Buffer
+	l := Multi(log.New(&console, "", 0), panicLogger{}, log.New(&kmsg, "", 0))
+
+	l.Printf("booting %s", "vmlinuz")
+	l.Print("kexec", " done")
+	want := "booting vmlinuz\nulog: ulog.panicLogger panicked: console is gone\n" +
+		"kexec done\nulog: ulog.panicLogger panicked: console is gone\n"
+	for name, b := range map[string]*bytes.Buffer{"console": &console, "kmsg": &kmsg} {
+		if got := b.String(); got != want {
+			t.Errorf("%s logged %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestMultiLevels(t *testing.T) {
+	var plain, structured bytes.Buffer
+	l := NewLevelLogger(Multi(log.New(&plain, "", 0), NewJSONLogger(&structured)), LevelInfo)
+	l.Debugf("dropped")
+	l.Warnf("no %s", "lease")
+
+	if got, want := plain.String(), "warn: no lease\n"; got != want {
+		t.Errorf("plain logger logged %q, want %q", got, want)
+	}
+	if got := structured.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, `"level":"warn"`) || !strings.Contains(got, `"msg":"no lease"`) {
+		t.Errorf("JSON logger logged %q, want one warning", got)
+	}
+}
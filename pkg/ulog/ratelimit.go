@@ -0,0 +1,121 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a Logger that logs at most burst messages per window.
+type rateLimiter struct {
+	l     Logger
+	every time.Duration
+	burst int
+
+	mu sync.Mutex
+
+	// start is when the current window started.
+	start time.Time
+
+	// logged is the number of messages logged in the current window.
+	logged int
+
+	// last is the last message logged in the current window.
+	last string
+
+	// suppressed is the number of messages dropped in the current
+	// window, and level the level of the last one.
+	suppressed int
+	level      Level
+
+	// stop stops the timer noting the dropped messages when the current
+	// window closes.
+	stop func() bool
+
+	// now returns the current time, and afterFunc calls f after d like
+	// time.AfterFunc. Tests override them.
+	now       func() time.Time
+	afterFunc func(d time.Duration, f func()) (stop func() bool)
+}
+
+var _ LevelPrinter = &rateLimiter{}
+
+// RateLimit returns a Logger that logs at most burst messages to l in every
+// window of length every, e.g. to keep a failing retry loop from flooding
+// the console. Other messages are dropped, as are repeats of the last
+// message in a window. When a window with dropped messages closes, a note
+// of how many is logged, e.g. "(suppressed 42)".
+//
+// Levels are passed on to l if it is a LevelPrinter.
+func RateLimit(l Logger, every time.Duration, burst int) Logger {
+	return &rateLimiter{
+		l:     l,
+		every: every,
+		burst: burst,
+		now:   time.Now,
+		afterFunc: func(d time.Duration, f func()) func() bool {
+			return time.AfterFunc(d, f).Stop
+		},
+	}
+}
+
+// Logf implements LevelPrinter.
+func (r *rateLimiter) Logf(level Level, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := r.now(); now.Sub(r.start) >= r.every {
+		// The timer may not have fired yet.
+		r.closeWindow()
+		r.start, r.logged, r.last = now, 0, ""
+	}
+	if r.logged >= r.burst || (r.logged > 0 && msg == r.last) {
+		r.suppressed++
+		r.level = level
+		if r.suppressed == 1 {
+			start := r.start
+			r.stop = r.afterFunc(start.Add(r.every).Sub(r.now()), func() {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				// Messages after the window closed may have
+				// started the next one already.
+				if r.start.Equal(start) {
+					r.closeWindow()
+				}
+			})
+		}
+		return
+	}
+	r.logged++
+	r.last = msg
+	// Log while holding the lock so messages stay in order.
+	Logf(r.l, level, "%s", msg)
+}
+
+// closeWindow logs how many messages were dropped in the current window,
+// if any. r.mu must be held.
+func (r *rateLimiter) closeWindow() {
+	if r.stop != nil {
+		r.stop()
+		r.stop = nil
+	}
+	if r.suppressed > 0 {
+		Logf(r.l, r.level, "(suppressed %d)", r.suppressed)
+		r.suppressed = 0
+	}
+}
+
+// Printf implements Logger by logging at LevelInfo.
+func (r *rateLimiter) Printf(format string, v ...interface{}) {
+	r.Logf(LevelInfo, format, v...)
+}
+
+// Print implements Logger by logging at LevelInfo.
+func (r *rateLimiter) Print(v ...interface{}) {
+	r.Logf(LevelInfo, "%s", fmt.Sprint(v...))
+}
@@ -0,0 +1,165 @@
+// Copyright 2022 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ulog
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countLogger counts the messages logged to it.
+type countLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (c *countLogger) Printf(format string, v ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, fmt.Sprintf(format, v...))
+}
+
+func (c *countLogger) Print(v ...interface{}) { c.Printf("%s", fmt.Sprint(v...)) }
+
+// fakeClock is a clock for a rateLimiter that only moves when told to.
+type fakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+// use makes the rateLimiter l use c.
+func (c *fakeClock) use(l Logger) {
+	r := l.(*rateLimiter)
+	r.now = func() time.Time { return c.now }
+	r.afterFunc = func(d time.Duration, f func()) func() bool {
+		t := &fakeTimer{at: c.now.Add(d), f: f}
+		c.timers = append(c.timers, t)
+		return func() bool {
+			stopped := t.stopped
+			t.stopped = true
+			return !stopped
+		}
+	}
+}
+
+// advance moves the clock by d and fires the timers that expire.
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	timers := c.timers
+	c.timers = nil
+	for _, t := range timers {
+		switch {
+		case t.stopped:
+		case t.at.After(c.now):
+			c.timers = append(c.timers, t)
+		default:
+			t.stopped = true
+			t.f()
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var b bytes.Buffer
+	c := &fakeClock{now: time.Unix(0, 0)}
+	l := RateLimit(log.New(&b, "", 0), time.Second, 3)
+	c.use(l)
+
+	for i := 0; i < 100; i++ {
+		l.Printf("retry %d failed", i)
+	}
+	c.advance(500 * time.Millisecond)
+	l.Print("still failing")
+	c.advance(500 * time.Millisecond)
+	l.Printf("retry %d failed", 100)
+
+	want := "retry 0 failed\nretry 1 failed\nretry 2 failed\n(suppressed 98)\nretry 100 failed\n"
+	if got := b.String(); got != want {
+		t.Errorf("RateLimit logged %q, want %q", got, want)
+	}
+}
+
+func TestRateLimitWindowCloses(t *testing.T) {
+	var b bytes.Buffer
+	c := &fakeClock{now: time.Unix(0, 0)}
+	l := RateLimit(log.New(&b, "", 0), time.Second, 1)
+	c.use(l)
+
+	l.Print("no lease")
+	l.Print("still no lease")
+	c.advance(999 * time.Millisecond)
+	if got, want := b.String(), "no lease\n"; got != want {
+		t.Errorf("RateLimit logged %q before the window closed, want %q", got, want)
+	}
+
+	// No message follows, but the dropped one is still noted.
+	c.advance(time.Millisecond)
+	if got, want := b.String(), "no lease\n(suppressed 1)\n"; got != want {
+		t.Errorf("RateLimit logged %q, want %q", got, want)
+	}
+}
+
+func TestRateLimitDuplicates(t *testing.T) {
+	var b bytes.Buffer
+	c := &fakeClock{now: time.Unix(0, 0)}
+	l := RateLimit(log.New(&b, "", 0), time.Second, 10)
+	c.use(l)
+
+	for i := 0; i < 5; i++ {
+		l.Print("no lease")
+	}
+	l.Print("got lease")
+	// The next window starts before the timer of this one fires.
+	c.now = c.now.Add(time.Second)
+	l.Print("no lease")
+	c.advance(0)
+
+	want := "no lease\ngot lease\n(suppressed 4)\nno lease\n"
+	if got := b.String(); got != want {
+		t.Errorf("RateLimit logged %q, want %q", got, want)
+	}
+}
+
+func TestRateLimitLevels(t *testing.T) {
+	var b bytes.Buffer
+	l := NewLevelLogger(RateLimit(log.New(&b, "", 0), time.Hour, 1), LevelDebug)
+	l.Warnf("link %s down", "eth0")
+	l.Warnf("link %s down", "eth1")
+
+	if got, want := b.String(), "warn: link eth0 down\n"; got != want {
+		t.Errorf("RateLimit logged %q, want %q", got, want)
+	}
+}
+
+func TestRateLimitConcurrent(t *testing.T) {
+	var c countLogger
+	l := RateLimit(&c, time.Hour, 5)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				l.Printf("worker %d: attempt %d", i, j)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(c.msgs) != 5 {
+		t.Errorf("RateLimit logged %d messages, want 5: %q", len(c.msgs), c.msgs)
+	}
+}